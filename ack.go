@@ -0,0 +1,196 @@
+package hl7 // import "fknsrs.biz/p/hl7"
+
+import (
+	"fmt"
+	"sync/atomic"
+	"time"
+
+	"github.com/facebookgo/stackerr"
+)
+
+// Acknowledgement codes, for MSA-1. The "A" codes are application
+// acknowledgements, and the "C" codes are commit acknowledgements, which are
+// only used in enhanced acknowledgement mode.
+const (
+	AckAccept       = "AA"
+	AckError        = "AE"
+	AckReject       = "AR"
+	AckCommitAccept = "CA"
+	AckCommitError  = "CE"
+	AckCommitReject = "CR"
+)
+
+// Acknowledgement conditions, for MSH-15 (accept acknowledgement type) and
+// MSH-16 (application acknowledgement type). They say when the receiver of a
+// message should send each kind of acknowledgement in enhanced mode.
+const (
+	AckAlways    = "AL"
+	AckNever     = "NE"
+	AckOnError   = "ER"
+	AckOnSuccess = "SU"
+)
+
+// ErrNoACK is returned by ReadACK if a message has no MSA segment.
+type ErrNoACK error
+
+// ACK is what an acknowledgement message says about the message it's
+// acknowledging.
+type ACK struct {
+	// Code is the acknowledgement code from MSA-1, like "AA" or "AE".
+	Code string
+	// ControlID is the control ID of the message being acknowledged, from
+	// MSA-2.
+	ControlID string
+	// Text describes the problem, if there was one. It comes from MSA-3, or
+	// if that's empty, from the ERR segment.
+	Text string
+}
+
+// OK reports whether the acknowledgement code is AA or CA.
+func (a *ACK) OK() bool {
+	return a.Code == AckAccept || a.Code == AckCommitAccept
+}
+
+// AckConditions returns the conditions under which a message wants a commit
+// (accept) acknowledgement and an application acknowledgement, from MSH-15 and
+// MSH-16. If neither is set, the message is using original acknowledgement
+// mode, and both are returned empty. If only one of them is set, the other is
+// taken to be AL.
+func AckConditions(m Message) (accept, application string) {
+	msh := m.Segment("MSH", 0)
+
+	accept, application = msh.Value(15), msh.Value(16)
+	if accept == "" && application == "" {
+		return "", ""
+	}
+
+	if accept == "" {
+		accept = AckAlways
+	}
+	if application == "" {
+		application = AckAlways
+	}
+
+	return accept, application
+}
+
+// AckWanted reports whether an acknowledgement with the given code should be
+// sent, according to a condition from AckConditions. An empty condition means
+// original mode, where there's always an acknowledgement.
+func AckWanted(condition, code string) bool {
+	ok := code == AckAccept || code == AckCommitAccept
+
+	switch condition {
+	case AckNever:
+		return false
+	case AckOnError:
+		return !ok
+	case AckOnSuccess:
+		return ok
+	default:
+		return true
+	}
+}
+
+// ReadACK reads the MSA segment (and ERR, if there is one) of an
+// acknowledgement message.
+func ReadACK(m Message) (*ACK, error) {
+	msa := m.Segment("MSA", 0)
+	if msa == nil {
+		return nil, ErrNoACK(stackerr.Newf("message has no MSA segment"))
+	}
+
+	a := ACK{
+		Code:      msa.Value(1),
+		ControlID: msa.Value(2),
+		Text:      msa.Value(3),
+	}
+
+	if err := m.Segment("ERR", 0); a.Text == "" && err != nil {
+		switch {
+		case err.Value(8) != "":
+			a.Text = err.Value(8)
+		case err.Field(3).item(0).get(2) != "":
+			a.Text = err.Field(3).item(0).get(2)
+		default:
+			// Before version 2.5, ERR-1 is an ELD, with the error code (a CE)
+			// as the fourth component.
+			a.Text = err.Field(1).item(0).component(4).get(2)
+		}
+	}
+
+	return &a, nil
+}
+
+// NewACK builds an acknowledgement for a message. The header is the
+// original's with the senders and receivers swapped, the message type set to
+// ACK, and a new timestamp and control ID. MSA-2 holds the control ID of the
+// original message, and MSA-3 holds text, if there is any. For errors and
+// rejections in version 2.5 and later, there's also an ERR segment with the
+// text.
+//
+// m can be nil, for when the original message couldn't be parsed at all. If
+// d is nil, DefaultDelimiters are used.
+func NewACK(m Message, d *Delimiters, code, text string) Message {
+	if d == nil {
+		d = &DefaultDelimiters
+	}
+
+	msh := m.Segment("MSH", 0)
+
+	h := Header{
+		SendingApplication:   DecodeHD(msh.Field(5).item(0)),
+		SendingFacility:      DecodeHD(msh.Field(6).item(0)),
+		ReceivingApplication: DecodeHD(msh.Field(3).item(0)),
+		ReceivingFacility:    DecodeHD(msh.Field(4).item(0)),
+		Timestamp:            time.Now(),
+		MessageCode:          "ACK",
+		TriggerEvent:         msh.Field(9).item(0).get(2),
+		ControlID:            newControlID(),
+		ProcessingID:         msh.Value(11),
+		Version:              msh.Value(12),
+	}
+
+	if h.ProcessingID == "" {
+		h.ProcessingID = "P"
+	}
+	if h.Version == "" {
+		h.Version = "2.5"
+	}
+	if CompareVersion(h.Version, "2.3.1") >= 0 {
+		h.MessageStructure = "ACK"
+	}
+
+	msa := Segment{Field{FieldItem{Component{"MSA"}}}}
+	msa = msa.SetField(1, makeField(makeFieldItem(code)))
+	msa = msa.SetField(2, makeField(makeFieldItem(msh.Value(10))))
+	msa = msa.SetField(3, makeField(makeFieldItem(text)))
+
+	ack := Message{h.Segment(d), trimSegment(msa)}
+
+	if text != "" && CompareVersion(h.Version, "2.5") >= 0 && code != AckAccept && code != AckCommitAccept {
+		severity := "E"
+		if code == AckReject || code == AckCommitReject {
+			severity = "F"
+		}
+
+		e := Segment{Field{FieldItem{Component{"ERR"}}}}
+		e = e.SetField(3, makeField(makeFieldItem("207", "Application internal error", "HL70357")))
+		e = e.SetField(4, makeField(makeFieldItem(severity)))
+		e = e.SetField(8, makeField(makeFieldItem(text)))
+
+		ack = append(ack, e)
+	}
+
+	return ack
+}
+
+var controlIDCounter uint32
+
+// newControlID makes a control ID that's unique enough for acknowledgements:
+// the current time, to the second, followed by a counter.
+func newControlID() string {
+	n := atomic.AddUint32(&controlIDCounter, 1) % 1000000
+
+	return fmt.Sprintf("%s%06d", time.Now().Format("20060102150405"), n)
+}
@@ -0,0 +1,108 @@
+package hl7
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewACK(t *testing.T) {
+	a := assert.New(t)
+
+	m, d, err := ParseMessage([]byte("MSH|^~\\&|APP|FAC|RAPP|RFAC|20240102||ADT^A01^ADT_A01|MSG1|P|2.5\rPID|1\r"))
+	a.NoError(err)
+
+	ack := NewACK(m, d, AckAccept, "")
+
+	h, err := ack.Header()
+	a.NoError(err)
+	a.Equal("RAPP", h.SendingApplication.NamespaceID)
+	a.Equal("RFAC", h.SendingFacility.NamespaceID)
+	a.Equal("APP", h.ReceivingApplication.NamespaceID)
+	a.Equal("FAC", h.ReceivingFacility.NamespaceID)
+	a.Equal("ACK", h.MessageCode)
+	a.Equal("A01", h.TriggerEvent)
+	a.Equal("ACK", h.MessageStructure)
+	a.Equal("P", h.ProcessingID)
+	a.Equal("2.5", h.Version)
+	a.Len(h.ControlID, 20)
+	a.NotEqual(h.ControlID, NewACK(m, d, AckAccept, "").Segment("MSH", 0).Value(10))
+
+	a.Len(ack, 2)
+	a.Equal("MSA|AA|MSG1\r", string(EncodeMessage(Message{ack[1]}, d)))
+
+	ack = NewACK(m, d, AckError, "it broke")
+	a.Len(ack, 3)
+	a.Equal("MSA|AE|MSG1|it broke\r", string(EncodeMessage(Message{ack[1]}, d)))
+	a.Equal("ERR|||207^Application internal error^HL70357|E||||it broke\r", string(EncodeMessage(Message{ack[2]}, d)))
+
+	r, err := ReadACK(ack)
+	a.NoError(err)
+	a.Equal(&ACK{Code: AckError, ControlID: "MSG1", Text: "it broke"}, r)
+	a.False(r.OK())
+}
+
+func TestNewACKWithoutMessage(t *testing.T) {
+	a := assert.New(t)
+
+	ack := NewACK(nil, nil, AckReject, "couldn't parse")
+
+	r, err := ReadACK(ack)
+	a.NoError(err)
+	a.Equal(&ACK{Code: AckReject, Text: "couldn't parse"}, r)
+
+	p, _, err := ParseMessage(EncodeMessage(ack, nil))
+	a.NoError(err)
+	a.Equal("ACK", p.Segment("MSH", 0).Value(9))
+}
+
+func TestReadACK(t *testing.T) {
+	a := assert.New(t)
+
+	m, _, err := ParseMessage([]byte("MSH|^~\\&|A|B|C|D|20240102||ACK|1|P|2.3\rMSA|AR|MSG1\rERR|PID^1^3^101&Required field missing&HL70357\r"))
+	a.NoError(err)
+
+	r, err := ReadACK(m)
+	a.NoError(err)
+	a.Equal(&ACK{Code: AckReject, ControlID: "MSG1", Text: "Required field missing"}, r)
+
+	m, _, err = ParseMessage([]byte("MSH|^~\\&|A|B|C|D|20240102||ACK|1|P|2.5\rMSA|CA|MSG1\r"))
+	a.NoError(err)
+
+	r, err = ReadACK(m)
+	a.NoError(err)
+	a.True(r.OK())
+
+	_, err = ReadACK(Message{m[0]})
+	a.Error(err)
+}
+
+func TestAckConditions(t *testing.T) {
+	a := assert.New(t)
+
+	for _, c := range []struct{ msh15, msh16, accept, application string }{
+		{"", "", "", ""},
+		{"AL", "NE", "AL", "NE"},
+		{"", "ER", "AL", "ER"},
+		{"NE", "", "NE", "AL"},
+	} {
+		m, _, err := ParseMessage([]byte("MSH|^~\\&|APP|FAC|||20240102||ADT^A01|1|P|2.5|||" + c.msh15 + "|" + c.msh16 + "\r"))
+		a.NoError(err)
+
+		accept, application := AckConditions(m)
+		a.Equal(c.accept, accept, c.msh15+"/"+c.msh16)
+		a.Equal(c.application, application, c.msh15+"/"+c.msh16)
+	}
+}
+
+func TestAckWanted(t *testing.T) {
+	a := assert.New(t)
+
+	a.True(AckWanted("", AckError))
+	a.True(AckWanted(AckAlways, AckCommitAccept))
+	a.False(AckWanted(AckNever, AckReject))
+	a.True(AckWanted(AckOnError, AckError))
+	a.False(AckWanted(AckOnError, AckAccept))
+	a.True(AckWanted(AckOnSuccess, AckCommitAccept))
+	a.False(AckWanted(AckOnSuccess, AckCommitReject))
+}
@@ -0,0 +1,354 @@
+package hl7 // import "fknsrs.biz/p/hl7"
+
+import (
+	"time"
+
+	"github.com/facebookgo/stackerr"
+)
+
+// ErrNotADT is returned by ParseADT when it's given a message that isn't an
+// ADT message.
+type ErrNotADT error
+
+// ADT is a typed view of an ADT (admit, discharge, transfer) message. It
+// smooths over the differences between versions 2.3 to 2.5, so the same
+// fields are filled in no matter which of them a message follows.
+type ADT struct {
+	Event        string    // MSH-9-2, or EVN-1 if that's empty
+	RecordedTime time.Time // EVN-2
+	EventReason  string    // EVN-4
+	EventTime    time.Time // EVN-6
+	Patient      *Patient  // the first PID; nil if there isn't one
+	NextOfKin    []NextOfKin
+	Visit        *Visit // PV1 and PV2; nil if there's no PV1
+	Allergies    []Allergy
+	Diagnoses    []Diagnosis
+	Insurance    []Insurance
+	Merges       []Merge // for merge events like A34 and A40
+}
+
+// Patient holds the demographics from a PID segment.
+type Patient struct {
+	// Identifiers are from PID-3. Before version 2.3.1, the external ID in
+	// PID-2 and the alternate IDs in PID-4 were used too; any of those that
+	// aren't already in PID-3 are added to the end.
+	Identifiers      []CX
+	Names            []XPN     // PID-5
+	MothersMaiden    []XPN     // PID-6
+	BirthTime        time.Time // PID-7
+	Sex              string    // PID-8
+	Race             []CWE     // PID-10
+	Addresses        []XAD     // PID-11
+	HomePhones       []XTN     // PID-13
+	BusinessPhones   []XTN     // PID-14
+	PrimaryLanguage  CWE       // PID-15
+	MaritalStatus    CWE       // PID-16
+	Religion         CWE       // PID-17
+	AccountNumber    CX        // PID-18
+	SSN              string    // PID-19
+	EthnicGroups     []CWE     // PID-22
+	MultipleBirth    string    // PID-24
+	BirthOrder       string    // PID-25
+	DeathTime        time.Time // PID-29
+	DeathIndicator   string    // PID-30
+	IdentityUnknown  string    // PID-31, since 2.4
+	LastUpdateTime   time.Time // PID-33, since 2.4
+	LastUpdateSource HD        // PID-34, since 2.4
+}
+
+// NextOfKin is a contact from an NK1 segment.
+type NextOfKin struct {
+	Names          []XPN // NK1-2
+	Relationship   CWE   // NK1-3
+	Addresses      []XAD // NK1-4
+	Phones         []XTN // NK1-5
+	BusinessPhones []XTN // NK1-6
+	ContactRole    CWE   // NK1-7
+}
+
+// Visit holds the details of a visit from the PV1 and PV2 segments.
+type Visit struct {
+	Class                 string    // PV1-2
+	Location              PL        // PV1-3
+	AdmissionType         string    // PV1-4
+	PriorLocation         PL        // PV1-6
+	AttendingDoctors      []XCN     // PV1-7
+	ReferringDoctors      []XCN     // PV1-8
+	ConsultingDoctors     []XCN     // PV1-9
+	HospitalService       string    // PV1-10
+	TemporaryLocation     PL        // PV1-11
+	AdmitSource           string    // PV1-14
+	AdmittingDoctors      []XCN     // PV1-17
+	PatientType           string    // PV1-18
+	VisitNumber           CX        // PV1-19
+	DischargeDisposition  string    // PV1-36
+	PendingLocation       PL        // PV1-42
+	PriorTemporary        PL        // PV1-43
+	AdmitTime             time.Time // PV1-44
+	DischargeTime         time.Time // PV1-45, the first repetition
+	AlternateVisitID      CX        // PV1-50
+	AdmitReason           CWE       // PV2-3
+	ExpectedAdmitTime     time.Time // PV2-8
+	ExpectedDischargeTime time.Time // PV2-9
+}
+
+// Allergy is an allergy from an AL1 segment. The coded values were CE
+// before version 2.5, and are CWE since; CWE is used for both.
+type Allergy struct {
+	Type               CWE       // AL1-2
+	Allergen           CWE       // AL1-3
+	Severity           CWE       // AL1-4
+	Reactions          []string  // AL1-5
+	IdentificationDate time.Time // AL1-6
+}
+
+// Diagnosis is a diagnosis from a DG1 segment. Before version 2.5 the
+// description was usually in DG1-4 rather than in the code itself; if the
+// code has no text, the description is copied into it.
+type Diagnosis struct {
+	CodingMethod string    // DG1-2
+	Code         CWE       // DG1-3
+	Description  string    // DG1-4
+	Time         time.Time // DG1-5
+	Type         string    // DG1-6
+	Priority     string    // DG1-15
+	Clinicians   []XCN     // DG1-16
+}
+
+// Insurance is a policy from an IN1 segment.
+type Insurance struct {
+	PlanID              CWE       // IN1-2
+	CompanyIDs          []CX      // IN1-3
+	CompanyName         string    // IN1-4, the first component
+	CompanyAddresses    []XAD     // IN1-5
+	CompanyPhones       []XTN     // IN1-7
+	GroupNumber         string    // IN1-8
+	GroupName           string    // IN1-9, the first component
+	PlanEffectiveDate   time.Time // IN1-12
+	PlanExpirationDate  time.Time // IN1-13
+	PlanType            string    // IN1-15
+	InsuredNames        []XPN     // IN1-16
+	InsuredRelationship CWE       // IN1-17
+	InsuredBirthTime    time.Time // IN1-18
+	InsuredAddresses    []XAD     // IN1-19
+	PolicyNumber        string    // IN1-36
+}
+
+// Merge describes one merge, from an MRG segment. Patient is the patient
+// that the prior identifiers were merged into: the PID that comes before the
+// MRG.
+type Merge struct {
+	Patient *Patient
+	// PriorIdentifiers are from MRG-1. Before version 2.3.1, the prior
+	// patient ID was in MRG-4; if it's there and not already in MRG-1, it's
+	// added to the end.
+	PriorIdentifiers      []CX
+	PriorAccountNumber    CX    // MRG-3
+	PriorVisitNumber      CX    // MRG-5
+	PriorAlternateVisitID CX    // MRG-6
+	PriorNames            []XPN // MRG-7
+}
+
+// ParseADT reads an ADT message. Segments that aren't part of the model are
+// skipped, and for segments that can only appear once, like PV1, only the
+// first is used. It returns an error if the message isn't an ADT message, or
+// if one of the times in it is invalid.
+func ParseADT(m Message) (*ADT, error) {
+	msh := m.Segment("MSH", 0)
+	if msh.Field(9).item(0).get(1) != "ADT" {
+		return nil, ErrNotADT(stackerr.Newf("expected an ADT message; instead got %q", m.Type()))
+	}
+
+	var d adtDecoder
+
+	r := ADT{Event: msh.Field(9).item(0).get(2)}
+
+	var current *Patient
+	var pv2 bool
+
+	for _, s := range m {
+		switch s.Name() {
+		case "EVN":
+			if r.Event == "" {
+				r.Event = s.Value(1)
+			}
+			r.RecordedTime = d.time(s, 2)
+			r.EventReason = s.Value(4)
+			r.EventTime = d.time(s, 6)
+		case "PID":
+			current = d.patient(s)
+			if r.Patient == nil {
+				r.Patient = current
+			}
+		case "NK1":
+			r.NextOfKin = append(r.NextOfKin, NextOfKin{
+				Names:          DecodeXPNs(s.Field(2)),
+				Relationship:   DecodeCWE(s.Field(3).item(0)),
+				Addresses:      DecodeXADs(s.Field(4)),
+				Phones:         DecodeXTNs(s.Field(5)),
+				BusinessPhones: DecodeXTNs(s.Field(6)),
+				ContactRole:    DecodeCWE(s.Field(7).item(0)),
+			})
+		case "PV1":
+			if r.Visit == nil {
+				r.Visit = &Visit{}
+				d.pv1(r.Visit, s)
+			}
+		case "PV2":
+			if r.Visit != nil && !pv2 {
+				pv2 = true
+				r.Visit.AdmitReason = DecodeCWE(s.Field(3).item(0))
+				r.Visit.ExpectedAdmitTime = d.time(s, 8)
+				r.Visit.ExpectedDischargeTime = d.time(s, 9)
+			}
+		case "AL1":
+			var reactions []string
+			for _, fi := range s.Field(5) {
+				if v := fi.get(1); v != "" {
+					reactions = append(reactions, v)
+				}
+			}
+
+			r.Allergies = append(r.Allergies, Allergy{
+				Type:               DecodeCWE(s.Field(2).item(0)),
+				Allergen:           DecodeCWE(s.Field(3).item(0)),
+				Severity:           DecodeCWE(s.Field(4).item(0)),
+				Reactions:          reactions,
+				IdentificationDate: d.time(s, 6),
+			})
+		case "DG1":
+			dg := Diagnosis{
+				CodingMethod: s.Value(2),
+				Code:         DecodeCWE(s.Field(3).item(0)),
+				Description:  s.Value(4),
+				Time:         d.time(s, 5),
+				Type:         s.Value(6),
+				Priority:     s.Value(15),
+				Clinicians:   DecodeXCNs(s.Field(16)),
+			}
+			if dg.Code.Text == "" {
+				dg.Code.Text = dg.Description
+			}
+
+			r.Diagnoses = append(r.Diagnoses, dg)
+		case "IN1":
+			r.Insurance = append(r.Insurance, Insurance{
+				PlanID:              DecodeCWE(s.Field(2).item(0)),
+				CompanyIDs:          DecodeCXs(s.Field(3)),
+				CompanyName:         s.Value(4),
+				CompanyAddresses:    DecodeXADs(s.Field(5)),
+				CompanyPhones:       DecodeXTNs(s.Field(7)),
+				GroupNumber:         s.Value(8),
+				GroupName:           s.Value(9),
+				PlanEffectiveDate:   d.time(s, 12),
+				PlanExpirationDate:  d.time(s, 13),
+				PlanType:            s.Value(15),
+				InsuredNames:        DecodeXPNs(s.Field(16)),
+				InsuredRelationship: DecodeCWE(s.Field(17).item(0)),
+				InsuredBirthTime:    d.time(s, 18),
+				InsuredAddresses:    DecodeXADs(s.Field(19)),
+				PolicyNumber:        s.Value(36),
+			})
+		case "MRG":
+			r.Merges = append(r.Merges, Merge{
+				Patient:               current,
+				PriorIdentifiers:      appendCXs(DecodeCXs(s.Field(1)), s.Field(4)),
+				PriorAccountNumber:    DecodeCX(s.Field(3).item(0)),
+				PriorVisitNumber:      DecodeCX(s.Field(5).item(0)),
+				PriorAlternateVisitID: DecodeCX(s.Field(6).item(0)),
+				PriorNames:            DecodeXPNs(s.Field(7)),
+			})
+		}
+	}
+
+	if d.err != nil {
+		return nil, d.err
+	}
+
+	return &r, nil
+}
+
+// adtDecoder keeps the first error from parsing times, so that ParseADT
+// doesn't have to check after every field.
+type adtDecoder struct {
+	err error
+}
+
+func (d *adtDecoder) time(s Segment, n int) time.Time {
+	t, err := ParseTime(s.Field(n).item(0).get(1))
+	if err != nil && d.err == nil {
+		d.err = stackerr.Newf("%s-%d: %s", s.Name(), n, ErrorText(err))
+	}
+
+	return t
+}
+
+func (d *adtDecoder) patient(s Segment) *Patient {
+	return &Patient{
+		Identifiers:      appendCXs(appendCXs(DecodeCXs(s.Field(3)), s.Field(2)), s.Field(4)),
+		Names:            DecodeXPNs(s.Field(5)),
+		MothersMaiden:    DecodeXPNs(s.Field(6)),
+		BirthTime:        d.time(s, 7),
+		Sex:              s.Value(8),
+		Race:             DecodeCWEs(s.Field(10)),
+		Addresses:        DecodeXADs(s.Field(11)),
+		HomePhones:       DecodeXTNs(s.Field(13)),
+		BusinessPhones:   DecodeXTNs(s.Field(14)),
+		PrimaryLanguage:  DecodeCWE(s.Field(15).item(0)),
+		MaritalStatus:    DecodeCWE(s.Field(16).item(0)),
+		Religion:         DecodeCWE(s.Field(17).item(0)),
+		AccountNumber:    DecodeCX(s.Field(18).item(0)),
+		SSN:              s.Value(19),
+		EthnicGroups:     DecodeCWEs(s.Field(22)),
+		MultipleBirth:    s.Value(24),
+		BirthOrder:       s.Value(25),
+		DeathTime:        d.time(s, 29),
+		DeathIndicator:   s.Value(30),
+		IdentityUnknown:  s.Value(31),
+		LastUpdateTime:   d.time(s, 33),
+		LastUpdateSource: DecodeHD(s.Field(34).item(0)),
+	}
+}
+
+func (d *adtDecoder) pv1(v *Visit, s Segment) {
+	v.Class = s.Value(2)
+	v.Location = DecodePL(s.Field(3).item(0))
+	v.AdmissionType = s.Value(4)
+	v.PriorLocation = DecodePL(s.Field(6).item(0))
+	v.AttendingDoctors = DecodeXCNs(s.Field(7))
+	v.ReferringDoctors = DecodeXCNs(s.Field(8))
+	v.ConsultingDoctors = DecodeXCNs(s.Field(9))
+	v.HospitalService = s.Value(10)
+	v.TemporaryLocation = DecodePL(s.Field(11).item(0))
+	v.AdmitSource = s.Value(14)
+	v.AdmittingDoctors = DecodeXCNs(s.Field(17))
+	v.PatientType = s.Value(18)
+	v.VisitNumber = DecodeCX(s.Field(19).item(0))
+	v.DischargeDisposition = s.Value(36)
+	v.PendingLocation = DecodePL(s.Field(42).item(0))
+	v.PriorTemporary = DecodePL(s.Field(43).item(0))
+	v.AdmitTime = d.time(s, 44)
+	v.DischargeTime = d.time(s, 45)
+	v.AlternateVisitID = DecodeCX(s.Field(50).item(0))
+}
+
+// appendCXs adds the identifiers in f to a, skipping empty ones and ones
+// that are already there.
+func appendCXs(a []CX, f Field) []CX {
+outer:
+	for _, c := range DecodeCXs(f) {
+		if c.ID == "" {
+			continue
+		}
+
+		for _, e := range a {
+			if e.ID == c.ID && (c.AssigningAuthority.IsZero() || e.AssigningAuthority == c.AssigningAuthority) {
+				continue outer
+			}
+		}
+
+		a = append(a, c)
+	}
+
+	return a
+}
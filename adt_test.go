@@ -0,0 +1,291 @@
+package hl7
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func parseADTTest(t *testing.T, segments ...string) (*ADT, error) {
+	m, _, err := ParseMessage([]byte(strings.Join(segments, "\r")))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return ParseADT(m)
+}
+
+// testSegment builds a segment from a map of field numbers to values, so that
+// long segments don't need their pipes counted by hand.
+func testSegment(name string, fields map[int]string) string {
+	var n int
+	for i := range fields {
+		if i > n {
+			n = i
+		}
+	}
+
+	a := make([]string, n+1)
+	a[0] = name
+	for i, v := range fields {
+		a[i] = v
+	}
+
+	return strings.Join(a, "|")
+}
+
+func TestParseADT(t *testing.T) {
+	a := assert.New(t)
+
+	r, err := parseADTTest(t,
+		`MSH|^~\&|ADM|HOSP|EMR|HOSP|20240102103000||ADT^A01^ADT_A01|1|P|2.5`,
+		`EVN||20240102102900||01||20240102100000`,
+		testSegment("PID", map[int]string{
+			1:  "1",
+			3:  "123^^^HOSP^MR~456^^^STATE^SS",
+			5:  "Smith^Jane^Q",
+			7:  "19800101",
+			8:  "F",
+			10: "2106-3^White^HL70005",
+			11: "1 Main St^^Springfield^IL^62701",
+			13: "^PRN^PH^^1^217^5551234",
+			16: "M^Married^HL70002",
+			18: "A100^^^HOSP^AN",
+			29: "20990101",
+			30: "N",
+		}),
+		`NK1|1|Smith^John|SPO^Spouse^HL70063|1 Main St^^Springfield^IL^62701|^PRN^PH^^1^217^5554321||EC^Emergency contact^HL70131`,
+		testSegment("PV1", map[int]string{
+			1:  "1",
+			2:  "I",
+			3:  "4E^401^B^HOSP",
+			7:  "1234^Welby^Marcus^^^Dr~5678^Kildare^James",
+			10: "MED",
+			14: "7",
+			17: "1234^Welby^Marcus",
+			18: "IP",
+			19: "V100^^^HOSP^VN",
+			44: "20240102100000",
+		}),
+		testSegment("PV2", map[int]string{3: "CHEST^Chest pain^L", 8: "20240102090000", 9: "20240105"}),
+		`PV2|||OTHER`,
+		`AL1|1|DA^Drug allergy^HL70127|PCN^Penicillin^L|SV^Severe^HL70128|HIVES~WHEEZE|20100101`,
+		testSegment("DG1", map[int]string{
+			1:  "1",
+			3:  "I20.9^Angina pectoris, unspecified^I10",
+			5:  "20240102",
+			6:  "A",
+			15: "1",
+			16: "1234^Welby^Marcus",
+		}),
+		testSegment("IN1", map[int]string{
+			1:  "1",
+			2:  "PPO^Gold PPO^L",
+			3:  "INS1^^^PAYERS",
+			4:  "Acme Health",
+			5:  "PO Box 1^^Chicago^IL^60601",
+			7:  "^WPN^PH^^1^800^5550000",
+			8:  "G123",
+			9:  "Acme Employees",
+			12: "20240101",
+			13: "20241231",
+			15: "PPO",
+			16: "Smith^Jane",
+			17: "SEL^Self^HL70063",
+			18: "19800101",
+			19: "1 Main St^^Springfield^IL^62701",
+			36: "POL999",
+		}),
+		`ZPV|custom`,
+	)
+	if !a.NoError(err) {
+		return
+	}
+
+	a.Equal("A01", r.Event)
+	a.Equal(time.Date(2024, 1, 2, 10, 29, 0, 0, time.Local), r.RecordedTime)
+	a.Equal("01", r.EventReason)
+	a.Equal(time.Date(2024, 1, 2, 10, 0, 0, 0, time.Local), r.EventTime)
+
+	if p := r.Patient; a.NotNil(p) {
+		if a.Len(p.Identifiers, 2) {
+			a.Equal("123", p.Identifiers[0].ID)
+			a.Equal("HOSP", p.Identifiers[0].AssigningAuthority.NamespaceID)
+			a.Equal("SS", p.Identifiers[1].IdentifierTypeCode)
+		}
+		a.Equal("Smith", p.Names[0].Family)
+		a.Equal("Jane", p.Names[0].Given)
+		a.Equal(time.Date(1980, 1, 1, 0, 0, 0, 0, time.Local), p.BirthTime)
+		a.Equal("F", p.Sex)
+		a.Equal("White", p.Race[0].Text)
+		a.Equal("Springfield", p.Addresses[0].City)
+		a.Equal("5551234", p.HomePhones[0].LocalNumber)
+		a.Equal("M", p.MaritalStatus.Identifier)
+		a.Equal("A100", p.AccountNumber.ID)
+		a.Equal(time.Date(2099, 1, 1, 0, 0, 0, 0, time.Local), p.DeathTime)
+		a.Equal("N", p.DeathIndicator)
+	}
+
+	if a.Len(r.NextOfKin, 1) {
+		k := r.NextOfKin[0]
+		a.Equal("John", k.Names[0].Given)
+		a.Equal("SPO", k.Relationship.Identifier)
+		a.Equal("5554321", k.Phones[0].LocalNumber)
+		a.Equal("EC", k.ContactRole.Identifier)
+	}
+
+	if v := r.Visit; a.NotNil(v) {
+		a.Equal("I", v.Class)
+		a.Equal(PL{PointOfCare: "4E", Room: "401", Bed: "B", Facility: HD{NamespaceID: "HOSP"}}, v.Location)
+		if a.Len(v.AttendingDoctors, 2) {
+			a.Equal("Kildare", v.AttendingDoctors[1].Family)
+		}
+		a.Equal("MED", v.HospitalService)
+		a.Equal("7", v.AdmitSource)
+		a.Equal("1234", v.AdmittingDoctors[0].ID)
+		a.Equal("IP", v.PatientType)
+		a.Equal("V100", v.VisitNumber.ID)
+		a.Equal(time.Date(2024, 1, 2, 10, 0, 0, 0, time.Local), v.AdmitTime)
+		a.True(v.DischargeTime.IsZero())
+		a.Equal("Chest pain", v.AdmitReason.Text)
+		a.Equal(time.Date(2024, 1, 2, 9, 0, 0, 0, time.Local), v.ExpectedAdmitTime)
+		a.Equal(time.Date(2024, 1, 5, 0, 0, 0, 0, time.Local), v.ExpectedDischargeTime)
+	}
+
+	if a.Len(r.Allergies, 1) {
+		al := r.Allergies[0]
+		a.Equal("DA", al.Type.Identifier)
+		a.Equal("Penicillin", al.Allergen.Text)
+		a.Equal("SV", al.Severity.Identifier)
+		a.Equal([]string{"HIVES", "WHEEZE"}, al.Reactions)
+		a.Equal(time.Date(2010, 1, 1, 0, 0, 0, 0, time.Local), al.IdentificationDate)
+	}
+
+	if a.Len(r.Diagnoses, 1) {
+		dg := r.Diagnoses[0]
+		a.Equal("I20.9", dg.Code.Identifier)
+		a.Equal("Angina pectoris, unspecified", dg.Code.Text)
+		a.Equal("", dg.Description)
+		a.Equal("A", dg.Type)
+		a.Equal("1", dg.Priority)
+		a.Equal("Welby", dg.Clinicians[0].Family)
+	}
+
+	if a.Len(r.Insurance, 1) {
+		in := r.Insurance[0]
+		a.Equal("PPO", in.PlanID.Identifier)
+		a.Equal("INS1", in.CompanyIDs[0].ID)
+		a.Equal("Acme Health", in.CompanyName)
+		a.Equal("Chicago", in.CompanyAddresses[0].City)
+		a.Equal("G123", in.GroupNumber)
+		a.Equal("Acme Employees", in.GroupName)
+		a.Equal(time.Date(2024, 1, 1, 0, 0, 0, 0, time.Local), in.PlanEffectiveDate)
+		a.Equal(time.Date(2024, 12, 31, 0, 0, 0, 0, time.Local), in.PlanExpirationDate)
+		a.Equal("PPO", in.PlanType)
+		a.Equal("Smith", in.InsuredNames[0].Family)
+		a.Equal("SEL", in.InsuredRelationship.Identifier)
+		a.Equal("POL999", in.PolicyNumber)
+	}
+
+	a.Empty(r.Merges)
+}
+
+func TestParseADTVersion23(t *testing.T) {
+	a := assert.New(t)
+
+	r, err := parseADTTest(t,
+		`MSH|^~\&|ADM|HOSP|||199901021030||ADT|1|P|2.3`,
+		`EVN|A08|199901021029`,
+		`PID|1|EXT1|123^^^HOSP~EXT1|ALT1|Smith^Jane`,
+		`DG1|1|I9|786.50||199901020000|W`,
+	)
+	if !a.NoError(err) {
+		return
+	}
+
+	a.Equal("A08", r.Event)
+
+	if a.NotNil(r.Patient) {
+		var ids []string
+		for _, c := range r.Patient.Identifiers {
+			ids = append(ids, c.ID)
+		}
+		a.Equal([]string{"123", "EXT1", "ALT1"}, ids)
+	}
+
+	a.Nil(r.Visit)
+
+	if a.Len(r.Diagnoses, 1) {
+		a.Equal("I9", r.Diagnoses[0].CodingMethod)
+		a.Equal("786.50", r.Diagnoses[0].Code.Identifier)
+	}
+
+	r, err = parseADTTest(t,
+		`MSH|^~\&|ADM|HOSP|||199901021030||ADT^A08|1|P|2.3`,
+		`EVN|A08|199901021029`,
+		`PID|1||123`,
+		`DG1|1|I9|786.50|Chest pain, unspecified|199901020000|W`,
+	)
+	if a.NoError(err) && a.Len(r.Diagnoses, 1) {
+		a.Equal("Chest pain, unspecified", r.Diagnoses[0].Code.Text)
+		a.Equal("Chest pain, unspecified", r.Diagnoses[0].Description)
+	}
+}
+
+func TestParseADTMerge(t *testing.T) {
+	a := assert.New(t)
+
+	r, err := parseADTTest(t,
+		`MSH|^~\&|ADM|HOSP|||20240102103000||ADT^A40^ADT_A39|1|P|2.5`,
+		`EVN||20240102103000`,
+		`PID|1||100^^^HOSP^MR||Smith^Jane`,
+		`MRG|200^^^HOSP^MR~201^^^HOSP^MR||||||Smyth^Jane`,
+		`PID|1||300^^^HOSP^MR||Brown^Bob`,
+		`MRG|400^^^HOSP^MR|||V1`,
+	)
+	if !a.NoError(err) {
+		return
+	}
+
+	a.Equal("A40", r.Event)
+	a.Equal("100", r.Patient.Identifiers[0].ID)
+
+	if a.Len(r.Merges, 2) {
+		a.Equal("100", r.Merges[0].Patient.Identifiers[0].ID)
+		a.Len(r.Merges[0].PriorIdentifiers, 2)
+		a.Equal("201", r.Merges[0].PriorIdentifiers[1].ID)
+		a.Equal("Smyth", r.Merges[0].PriorNames[0].Family)
+
+		a.Equal("300", r.Merges[1].Patient.Identifiers[0].ID)
+		a.Equal("400", r.Merges[1].PriorIdentifiers[0].ID)
+		a.Len(r.Merges[1].PriorIdentifiers, 2)
+		a.Equal("V1", r.Merges[1].PriorIdentifiers[1].ID)
+	}
+
+	// before 2.3.1, A34 merges had the prior ID in MRG-4
+	r, err = parseADTTest(t,
+		`MSH|^~\&|ADM|HOSP|||19990102||ADT^A34|1|P|2.3`,
+		`EVN|A34|19990102`,
+		`PID|1||100`,
+		`MRG||||200`,
+	)
+	if a.NoError(err) && a.Len(r.Merges, 1) {
+		a.Equal([]CX{{ID: "200"}}, r.Merges[0].PriorIdentifiers)
+	}
+}
+
+func TestParseADTErrors(t *testing.T) {
+	a := assert.New(t)
+
+	_, err := parseADTTest(t, `MSH|^~\&|||||||ORU^R01|1|P|2.5`)
+	if a.Error(err) {
+		a.Equal(`expected an ADT message; instead got "ORU^R01"`, ErrorText(err))
+	}
+
+	_, err = parseADTTest(t, `MSH|^~\&|||||||ADT^A01|1|P|2.5`, `EVN||20240102`, `PID|1||1||X||1980XX01`)
+	if a.Error(err) {
+		a.Contains(ErrorText(err), "PID-7: ")
+	}
+}
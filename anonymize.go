@@ -0,0 +1,536 @@
+package hl7 // import "fknsrs.biz/p/hl7"
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"strings"
+
+	"github.com/facebookgo/stackerr"
+)
+
+// ErrInvalidRule is returned by NewAnonymizer if a rule doesn't make sense.
+type ErrInvalidRule error
+
+// Action is what an anonymization rule does to the values it applies to.
+type Action string
+
+// These are the actions a Rule can take.
+const (
+	// ActionRemove empties out the value.
+	ActionRemove Action = "remove"
+	// ActionHash replaces every part of the value with a keyed hash of it,
+	// so that the same identifier always turns into the same thing (for a
+	// given key), but can't be turned back.
+	ActionHash Action = "hash"
+	// ActionFake replaces the value with made up data of the kind given in
+	// the rule. The same value always gets the same replacement (for a given
+	// key).
+	ActionFake Action = "fake"
+	// ActionShiftDate moves a date or timestamp by a number of days that's
+	// worked out from the patient's identifier, so that every date for a
+	// patient moves by the same amount and the time between them is kept.
+	ActionShiftDate Action = "shift"
+	// ActionYear cuts a date or timestamp down to just its year.
+	ActionYear Action = "year"
+)
+
+// Kinds of fake data for ActionFake. FakeName, FakeAddress, and FakePhone
+// work on whole fields (XPN, XAD, and XTN respectively), replacing the
+// identifying parts and keeping the rest (like the name type or the state).
+// The others work on single values.
+const (
+	FakeName    = "name"
+	FakeAddress = "address"
+	FakePhone   = "phone"
+	FakeFamily  = "family"
+	FakeGiven   = "given"
+	FakeStreet  = "street"
+	FakeCity    = "city"
+	FakeEmail   = "email"
+	FakeID      = "id"
+	// FakeZip keeps the first three digits of a zip code, and zeroes the
+	// rest. Safe Harbor only allows that where the three digits cover more
+	// than 20,000 people, so the ones that don't become 000.
+	FakeZip = "zip"
+)
+
+// Rule says what to do with the values at a query path, like "PID-5" or
+// "PID-3-1". A path without a segment number applies to every segment with
+// that name, and a path without a repetition number applies to every
+// repetition.
+type Rule struct {
+	Path   string
+	Action Action
+	// Fake is the kind of fake data to use for ActionFake.
+	Fake string
+	// If, if set, limits the rule to segments it returns true for.
+	If func(s Segment) bool
+}
+
+// SafeHarborRules remove, hash, or fake the identifiers that the HIPAA Safe
+// Harbor method lists (names, addresses, dates, phone numbers, and
+// identifying numbers) from the segments where they usually turn up, along
+// with free text, which might hold any of them. Dates are cut down to the
+// year, as Safe Harbor requires. Safe Harbor also requires ages over 89 to be
+// grouped together, which these rules don't do; birth years that would show
+// an age over 89 have to be dealt with separately.
+//
+// Observation values (OBX-5) are removed unless they're numbers (NM, SN, or
+// CQ) or codes from a table (ID or IS). Any other type, including ED
+// documents, RP links, and the text in CE and CWE values, can hold a whole
+// report, identifiers and all.
+//
+// Shifting dates with ActionShiftDate keeps more of their meaning, but isn't
+// enough for Safe Harbor on its own.
+var SafeHarborRules = []Rule{
+	{Path: "EVN-2", Action: ActionYear},
+	{Path: "EVN-6", Action: ActionYear},
+
+	{Path: "PID-2-1", Action: ActionHash},
+	{Path: "PID-3-1", Action: ActionHash},
+	{Path: "PID-4-1", Action: ActionHash},
+	{Path: "PID-5", Action: ActionFake, Fake: FakeName},
+	{Path: "PID-6", Action: ActionFake, Fake: FakeName},
+	{Path: "PID-7", Action: ActionYear},
+	{Path: "PID-9", Action: ActionFake, Fake: FakeName},
+	{Path: "PID-11", Action: ActionFake, Fake: FakeAddress},
+	{Path: "PID-12", Action: ActionRemove},
+	{Path: "PID-13", Action: ActionFake, Fake: FakePhone},
+	{Path: "PID-14", Action: ActionFake, Fake: FakePhone},
+	{Path: "PID-18-1", Action: ActionHash},
+	{Path: "PID-19", Action: ActionHash},
+	{Path: "PID-20", Action: ActionRemove},
+	{Path: "PID-21-1", Action: ActionHash},
+	{Path: "PID-23", Action: ActionRemove},
+	{Path: "PID-29", Action: ActionYear},
+
+	{Path: "NK1-2", Action: ActionFake, Fake: FakeName},
+	{Path: "NK1-4", Action: ActionFake, Fake: FakeAddress},
+	{Path: "NK1-5", Action: ActionFake, Fake: FakePhone},
+	{Path: "NK1-6", Action: ActionFake, Fake: FakePhone},
+	{Path: "NK1-8", Action: ActionYear},
+	{Path: "NK1-9", Action: ActionYear},
+	{Path: "NK1-12-1", Action: ActionHash},
+	{Path: "NK1-16", Action: ActionYear},
+	{Path: "NK1-26", Action: ActionFake, Fake: FakeName},
+	{Path: "NK1-30", Action: ActionFake, Fake: FakeName},
+	{Path: "NK1-31", Action: ActionFake, Fake: FakePhone},
+	{Path: "NK1-32", Action: ActionFake, Fake: FakeAddress},
+	{Path: "NK1-37", Action: ActionHash},
+
+	{Path: "PV1-19-1", Action: ActionHash},
+	{Path: "PV1-44", Action: ActionYear},
+	{Path: "PV1-45", Action: ActionYear},
+	{Path: "PV1-50-1", Action: ActionHash},
+
+	{Path: "MRG-1-1", Action: ActionHash},
+	{Path: "MRG-2-1", Action: ActionHash},
+	{Path: "MRG-3-1", Action: ActionHash},
+	{Path: "MRG-4-1", Action: ActionHash},
+	{Path: "MRG-5-1", Action: ActionHash},
+	{Path: "MRG-6-1", Action: ActionHash},
+	{Path: "MRG-7", Action: ActionFake, Fake: FakeName},
+
+	{Path: "IN1-16", Action: ActionFake, Fake: FakeName},
+	{Path: "IN1-18", Action: ActionYear},
+	{Path: "IN1-19", Action: ActionFake, Fake: FakeAddress},
+	{Path: "IN1-36", Action: ActionHash},
+	{Path: "IN1-44", Action: ActionFake, Fake: FakeAddress},
+	{Path: "IN1-49-1", Action: ActionHash},
+	{Path: "IN1-52", Action: ActionRemove},
+
+	{Path: "AL1-6", Action: ActionYear},
+	{Path: "DG1-5", Action: ActionYear},
+	{Path: "ORC-9", Action: ActionYear},
+	{Path: "OBR-6", Action: ActionYear},
+	{Path: "OBR-7", Action: ActionYear},
+	{Path: "OBR-8", Action: ActionYear},
+	{Path: "OBR-14", Action: ActionYear},
+	{Path: "OBR-22", Action: ActionYear},
+	{Path: "OBX-5", Action: ActionRemove, If: mayIdentifyOBX},
+	{Path: "OBX-14", Action: ActionYear},
+	{Path: "OBX-19", Action: ActionYear},
+	{Path: "SPM-17", Action: ActionYear},
+	{Path: "SPM-18", Action: ActionYear},
+	{Path: "NTE-3", Action: ActionRemove},
+}
+
+// mayIdentifyOBX reports whether an OBX segment's value might hold
+// identifiers, judging by its value type.
+func mayIdentifyOBX(s Segment) bool {
+	switch s.Value(2) {
+	case "NM", "SN", "CQ", "ID", "IS":
+		return false
+	default:
+		return true
+	}
+}
+
+// Anonymizer applies rules to messages to strip out protected health
+// information. Its output depends only on the message and the key, so the
+// same patient gets the same hashed identifiers, fake name, and date shift in
+// every message anonymized with the same key.
+type Anonymizer struct {
+	// MaxShift is the largest number of days a date can be moved by. Dates
+	// are always moved into the past. If it's zero or less, 365 is used.
+	MaxShift int
+
+	key   []byte
+	rules []compiledRule
+}
+
+type compiledRule struct {
+	Rule
+	q *Query
+}
+
+// NewAnonymizer checks a set of rules and returns an Anonymizer that uses
+// them, with key as the secret for hashing, faking, and date shifting. If
+// rules is nil, SafeHarborRules are used.
+func NewAnonymizer(key []byte, rules []Rule) (*Anonymizer, error) {
+	if rules == nil {
+		rules = SafeHarborRules
+	}
+
+	a := Anonymizer{key: key}
+
+	for _, r := range rules {
+		q, err := ParseQuery(r.Path)
+		if err != nil {
+			return nil, ErrInvalidRule(stackerr.Newf("invalid path %q in rule: %s", r.Path, ErrorText(err)))
+		}
+
+		if !q.HasField {
+			return nil, ErrInvalidRule(stackerr.Newf("path %q in rule doesn't pick out a field", r.Path))
+		}
+
+		switch r.Action {
+		case ActionRemove, ActionHash, ActionShiftDate, ActionYear:
+		case ActionFake:
+			switch r.Fake {
+			case FakeName, FakeAddress, FakePhone:
+				if q.HasComponent {
+					return nil, ErrInvalidRule(stackerr.Newf("fake %s needs a whole field, not %q", r.Fake, r.Path))
+				}
+			case FakeFamily, FakeGiven, FakeStreet, FakeCity, FakeEmail, FakeID, FakeZip:
+			default:
+				return nil, ErrInvalidRule(stackerr.Newf("unknown kind of fake data %q", r.Fake))
+			}
+		default:
+			return nil, ErrInvalidRule(stackerr.Newf("unknown action %q", r.Action))
+		}
+
+		a.rules = append(a.rules, compiledRule{Rule: r, q: q})
+	}
+
+	return &a, nil
+}
+
+// Anonymize returns an anonymized copy of a message, leaving the original
+// alone. Dates with ActionShiftDate are shifted according to the most recent
+// PID segment (or the first one, for segments before it), identified by the
+// first repetition of PID-3.
+func (a *Anonymizer) Anonymize(m Message) Message {
+	r := cloneMessage(m)
+
+	patient := patientKey(m.Segment("PID", 0))
+	counts := make(map[string]int)
+
+	for i, s := range m {
+		name := s.Name()
+		if name == "PID" {
+			patient = patientKey(s)
+		}
+
+		n := counts[name]
+		counts[name]++
+
+		for _, rule := range a.rules {
+			if rule.q.Segment != name || (rule.q.HasSegmentOffset && rule.q.SegmentOffset != n) {
+				continue
+			}
+			if rule.If != nil && !rule.If(s) {
+				continue
+			}
+
+			r[i] = a.applyRule(r[i], rule, patient)
+		}
+	}
+
+	return r
+}
+
+func (a *Anonymizer) applyRule(s Segment, r compiledRule, patient string) Segment {
+	n := r.q.Field + 1
+	if n >= len(s) {
+		return s
+	}
+
+	for i := range s[n] {
+		if r.q.HasFieldOffset && r.q.FieldOffset != i {
+			continue
+		}
+
+		fi := s[n][i]
+
+		switch {
+		case r.Action == ActionRemove && !r.q.HasComponent:
+			s[n][i] = nil
+		case r.Action == ActionFake && !r.q.HasComponent:
+			s[n][i] = a.fakeFieldItem(r.Fake, fi)
+		case (r.Action == ActionShiftDate || r.Action == ActionYear) && !r.q.HasComponent:
+			if len(fi) > 0 && len(fi[0]) > 0 {
+				fi[0][0] = Subcomponent(a.value(r, string(fi[0][0]), patient))
+			}
+		case !r.q.HasComponent:
+			for _, c := range fi {
+				for k := range c {
+					c[k] = Subcomponent(a.value(r, string(c[k]), patient))
+				}
+			}
+		case r.q.Component < len(fi):
+			c := fi[r.q.Component]
+
+			for k := range c {
+				if r.q.HasSubComponent && r.q.SubComponent != k {
+					continue
+				}
+				if !r.q.HasSubComponent && (r.Action == ActionShiftDate || r.Action == ActionYear) && k > 0 {
+					continue
+				}
+
+				c[k] = Subcomponent(a.value(r, string(c[k]), patient))
+			}
+		}
+	}
+
+	return s
+}
+
+// value applies a rule to a single value.
+func (a *Anonymizer) value(r compiledRule, s, patient string) string {
+	if s == "" {
+		return ""
+	}
+
+	switch r.Action {
+	case ActionRemove:
+		return ""
+	case ActionHash:
+		return a.hash("hash", s)
+	case ActionShiftDate:
+		return a.shiftDate(s, patient)
+	case ActionYear:
+		return dateYear(s)
+	default:
+		return a.fake(r.Fake, s)
+	}
+}
+
+func (a *Anonymizer) sum(kind, s string) []byte {
+	h := hmac.New(sha256.New, a.key)
+	h.Write([]byte(kind))
+	h.Write([]byte{0})
+	h.Write([]byte(s))
+	return h.Sum(nil)
+}
+
+func (a *Anonymizer) hash(kind, s string) string {
+	return strings.ToUpper(hex.EncodeToString(a.sum(kind, s))[0:16])
+}
+
+func (a *Anonymizer) pick(list []string, kind, s string) string {
+	return list[binary.BigEndian.Uint32(a.sum(kind, s))%uint32(len(list))]
+}
+
+func (a *Anonymizer) fake(kind, s string) string {
+	if s == "" {
+		return ""
+	}
+
+	switch kind {
+	case FakeFamily:
+		return a.pick(fakeFamilyNames, kind, s)
+	case FakeGiven:
+		return a.pick(fakeGivenNames, kind, s)
+	case FakeStreet:
+		return fmt.Sprintf("%d %s", 1+binary.BigEndian.Uint16(a.sum("number", s))%9999, a.pick(fakeStreets, kind, s))
+	case FakeCity:
+		return a.pick(fakeCities, kind, s)
+	case FakePhone:
+		return fmt.Sprintf("(555)555-%04d", binary.BigEndian.Uint16(a.sum(kind, s))%10000)
+	case FakeEmail:
+		return strings.ToLower(a.hash(kind, s)[0:10]) + "@example.com"
+	case FakeZip:
+		prefix := strings.SplitN(s, "-", 2)[0]
+		if len(prefix) < 3 {
+			return "000"
+		}
+		zip3 := prefix[0:3]
+		if smallZip3s[zip3] {
+			zip3 = "000"
+		}
+		return zip3 + strings.Repeat("0", len(prefix)-3)
+	default:
+		return a.hash(kind, s)
+	}
+}
+
+func (a *Anonymizer) fakeFieldItem(kind string, fi FieldItem) FieldItem {
+	if len(fi) == 0 {
+		return fi
+	}
+
+	// set replaces component n (counting from one) with a fake, if it has a
+	// value to begin with.
+	set := func(n int, kind string) {
+		if n <= len(fi) && !fi[n-1].empty() {
+			fi[n-1] = Component{Subcomponent(a.fake(kind, fi[n-1].get(1)))}
+		}
+	}
+	clear := func(n ...int) {
+		for _, i := range n {
+			if i <= len(fi) {
+				fi[i-1] = nil
+			}
+		}
+	}
+
+	switch kind {
+	case FakeName:
+		set(1, FakeFamily)
+		set(2, FakeGiven)
+		clear(3, 4, 5, 6)
+	case FakeAddress:
+		set(1, FakeStreet)
+		set(3, FakeCity)
+		set(5, FakeZip)
+		clear(2, 8, 9, 10)
+	case FakePhone:
+		set(1, FakePhone)
+		set(4, FakeEmail)
+		if len(fi) >= 7 && !fi[6].empty() {
+			fi[5] = Component{"555"}
+			fi[6] = Component{Subcomponent(strings.Replace(a.fake(FakePhone, fi[6].get(1))[5:], "-", "", 1))}
+		}
+		clear(8, 9)
+	}
+
+	return trimFieldItem(fi)
+}
+
+// dateYear cuts a DT or DTM value down to its year. Values that can't be
+// parsed are removed, like they are by shiftDate.
+func dateYear(s string) string {
+	if _, err := ParseTime(s); err != nil || len(s) < 4 {
+		return ""
+	}
+
+	return s[0:4]
+}
+
+// shiftDate moves a DT or DTM value back by the patient's number of days,
+// keeping its precision. Values that can't be parsed are removed, since
+// there's no telling what's in them.
+func (a *Anonymizer) shiftDate(s, patient string) string {
+	if s == "" {
+		return ""
+	}
+
+	t, err := ParseTime(s)
+	if err != nil {
+		return ""
+	}
+
+	max := a.MaxShift
+	if max <= 0 {
+		max = 365
+	}
+
+	days := 1 + int(binary.BigEndian.Uint32(a.sum("shift", patient))%uint32(max))
+
+	digits := 0
+	for digits < len(s) && digits < 14 && s[digits] >= '0' && s[digits] <= '9' {
+		digits++
+	}
+
+	return t.AddDate(0, 0, -days).Format("20060102150405"[0:digits]) + s[digits:]
+}
+
+// patientKey identifies a patient by the first identifier in PID-3, with its
+// assigning authority. If there isn't one, the name and date of birth are
+// used instead.
+func patientKey(pid Segment) string {
+	cx := DecodeCX(pid.Field(3).item(0))
+	if cx.ID != "" {
+		return cx.ID + "^" + cx.AssigningAuthority.NamespaceID + "^" + cx.AssigningAuthority.UniversalID
+	}
+
+	n := DecodeXPN(pid.Field(5).item(0))
+
+	return n.Family + "^" + n.Given + "^" + pid.Value(7)
+}
+
+func cloneMessage(m Message) Message {
+	r := make(Message, len(m))
+
+	for i, s := range m {
+		r[i] = make(Segment, len(s))
+		for j, f := range s {
+			if f == nil {
+				continue
+			}
+			r[i][j] = make(Field, len(f))
+			for k, fi := range f {
+				if fi == nil {
+					continue
+				}
+				r[i][j][k] = make(FieldItem, len(fi))
+				for l, c := range fi {
+					if c != nil {
+						r[i][j][k][l] = append(Component(nil), c...)
+					}
+				}
+			}
+		}
+	}
+
+	return r
+}
+
+var (
+	fakeFamilyNames = []string{
+		"Anderson", "Baker", "Carter", "Davies", "Edwards", "Fletcher",
+		"Garcia", "Harris", "Ingram", "Jackson", "Kelly", "Lopez", "Morgan",
+		"Nguyen", "Owens", "Patel", "Quinn", "Roberts", "Singh", "Turner",
+		"Underwood", "Vaughan", "Walker", "Young",
+	}
+	fakeGivenNames = []string{
+		"Alex", "Bailey", "Casey", "Dana", "Elliot", "Frankie", "Gale",
+		"Harper", "Indigo", "Jordan", "Kai", "Logan", "Morgan", "Noel",
+		"Oakley", "Parker", "Quinn", "Riley", "Sam", "Taylor", "Val",
+		"Wren",
+	}
+	fakeStreets = []string{
+		"Main St", "High St", "Church Rd", "Park Ave", "Oak St", "Maple Ave",
+		"Elm St", "Station Rd", "Mill Ln", "Hill Rd", "Lake Dr", "River Rd",
+	}
+	fakeCities = []string{
+		"Springfield", "Riverside", "Fairview", "Franklin", "Greenville",
+		"Bristol", "Clinton", "Georgetown", "Salem", "Madison", "Ashland",
+		"Oxford",
+	}
+
+	// smallZip3s are the three digit zip code prefixes that cover 20,000
+	// people or fewer, according to the 2000 census, which is what HHS's
+	// Safe Harbor guidance uses.
+	smallZip3s = map[string]bool{
+		"036": true, "059": true, "063": true, "102": true, "203": true,
+		"556": true, "692": true, "790": true, "821": true, "823": true,
+		"830": true, "831": true, "878": true, "879": true, "884": true,
+		"890": true, "893": true,
+	}
+)
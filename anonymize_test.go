@@ -0,0 +1,194 @@
+package hl7
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const anonymizeTestMessage = "MSH|^~\\&|APP|FAC|||20240102||ORU^R01|1|P|2.5\r" +
+	"PID|1||123^^^GHH&1.2.3&ISO~456^^^OTHER||Smith^John^Q^Jr||19800115|M|||12 Real St^Apt 4^Hometown^CA^90210^USA||(03)9555-1234|||||||123-45-6789\r" +
+	"NK1|1|Smith^Jane|SPO|12 Real St^^Hometown^CA^90210\r" +
+	"OBR|1||||||202401021030+1000\r" +
+	"OBX|1|NM|GLU^Glucose||5.5||||||F|||20240102\r" +
+	"OBX|2|TX|COMMENT^Comment||Patient John Smith said hello\r" +
+	"NTE|1||Call John on 9555 1234\r"
+
+func anonymizeTestGet(a *assert.Assertions, m Message, path string) string {
+	q, err := ParseQuery(path)
+	a.NoError(err)
+	return q.GetString(m)
+}
+
+func TestAnonymize(t *testing.T) {
+	a := assert.New(t)
+
+	m, _, err := ParseMessage([]byte(anonymizeTestMessage))
+	a.NoError(err)
+
+	an, err := NewAnonymizer([]byte("secret"), nil)
+	a.NoError(err)
+
+	r := an.Anonymize(m)
+
+	a.Equal("Smith", anonymizeTestGet(a, m, "PID-5-1"), "original should be left alone")
+
+	a.Equal("APP", anonymizeTestGet(a, r, "MSH-3"))
+	a.Equal("5.5", anonymizeTestGet(a, r, "OBX-5"))
+
+	id := anonymizeTestGet(a, r, "PID-3-1")
+	a.Len(id, 16)
+	a.NotEqual("123", id)
+	a.Equal("GHH", anonymizeTestGet(a, r, "PID-3-4-1"))
+	a.NotEqual("456", anonymizeTestGet(a, r, "PID-3(2)-1"))
+
+	a.NotEqual("Smith", anonymizeTestGet(a, r, "PID-5-1"))
+	a.NotEqual("John", anonymizeTestGet(a, r, "PID-5-2"))
+	a.Equal("", anonymizeTestGet(a, r, "PID-5-3"))
+	a.Equal("", anonymizeTestGet(a, r, "PID-5-4"))
+
+	a.NotEqual("12 Real St", anonymizeTestGet(a, r, "PID-11-1"))
+	a.Equal("", anonymizeTestGet(a, r, "PID-11-2"))
+	a.Equal("CA", anonymizeTestGet(a, r, "PID-11-4"))
+	a.Equal("90200", anonymizeTestGet(a, r, "PID-11-5"))
+	a.Regexp(`^\(555\)555-\d{4}$`, anonymizeTestGet(a, r, "PID-13-1"))
+	a.NotEqual("123-45-6789", anonymizeTestGet(a, r, "PID-19"))
+
+	a.NotEqual("Smith", anonymizeTestGet(a, r, "NK1-2-1"))
+	a.Equal("90200", anonymizeTestGet(a, r, "NK1-4-5"))
+
+	a.Equal("", anonymizeTestGet(a, r, "OBX(2)-5"))
+	a.Equal("", anonymizeTestGet(a, r, "NTE-3"))
+
+	a.Equal("1980", anonymizeTestGet(a, r, "PID-7"))
+	a.Equal("2024", anonymizeTestGet(a, r, "OBR-7"))
+	a.Equal("2024", anonymizeTestGet(a, r, "OBX-14"))
+
+	a.Equal(r, an.Anonymize(m), "output should be deterministic")
+
+	other, err := NewAnonymizer([]byte("other secret"), nil)
+	a.NoError(err)
+	a.NotEqual(id, anonymizeTestGet(a, other.Anonymize(m), "PID-3-1"))
+}
+
+func TestAnonymizeObservations(t *testing.T) {
+	a := assert.New(t)
+
+	m, _, err := ParseMessage(pdfGeneticsContent)
+	a.NoError(err)
+
+	an, err := NewAnonymizer([]byte("secret"), nil)
+	a.NoError(err)
+
+	r := an.Anonymize(m)
+
+	obx := r.Segments("OBX")
+	if a.NotEmpty(obx) {
+		for i, s := range obx {
+			a.NotEqual("", s.Value(3), "OBX %d", i)
+			a.Equal("", s.Value(5), "OBX %d", i)
+		}
+	}
+
+	// the report is an embedded PDF, which could say anything, and the CWE
+	// values have their results in the text
+	a.NotContains(string(EncodeMessage(r, nil)), "JVBERi")
+	a.NotContains(string(EncodeMessage(r, nil)), "CYP2C19")
+}
+
+func TestAnonymizeShiftDate(t *testing.T) {
+	a := assert.New(t)
+
+	m, _, err := ParseMessage([]byte(anonymizeTestMessage))
+	a.NoError(err)
+
+	an, err := NewAnonymizer([]byte("secret"), []Rule{
+		{Path: "PID-7", Action: ActionShiftDate},
+		{Path: "OBR-7", Action: ActionShiftDate},
+		{Path: "OBX-14", Action: ActionShiftDate},
+	})
+	a.NoError(err)
+
+	r := an.Anonymize(m)
+
+	dob := anonymizeTestGet(a, r, "PID-7")
+	a.Len(dob, 8)
+	a.NotEqual("19800115", dob)
+
+	obr := anonymizeTestGet(a, r, "OBR-7")
+	a.Len(obr, len("202401021030+1000"))
+	a.Equal("1030+1000", obr[8:])
+
+	// every date for the patient moves by the same amount
+	a.Equal(anonymizeTestDays(a, "19800115", "20240102"), anonymizeTestDays(a, dob, anonymizeTestGet(a, r, "OBX-14")))
+}
+
+func anonymizeTestDays(a *assert.Assertions, from, to string) int {
+	t1, err := time.Parse("20060102", from)
+	a.NoError(err)
+	t2, err := time.Parse("20060102", to)
+	a.NoError(err)
+	return int(t2.Sub(t1).Hours() / 24)
+}
+
+func TestAnonymizeRules(t *testing.T) {
+	a := assert.New(t)
+
+	m, _, err := ParseMessage([]byte(anonymizeTestMessage))
+	a.NoError(err)
+
+	an, err := NewAnonymizer([]byte("secret"), []Rule{
+		{Path: "PID-3(2)", Action: ActionRemove},
+		{Path: "PID-5-2", Action: ActionFake, Fake: FakeGiven},
+		{Path: "OBX(1)-5", Action: ActionHash},
+	})
+	a.NoError(err)
+
+	r := an.Anonymize(m)
+
+	a.Equal("123", anonymizeTestGet(a, r, "PID-3-1"))
+	a.Equal("", anonymizeTestGet(a, r, "PID-3(2)-1"))
+	a.Equal("Smith", anonymizeTestGet(a, r, "PID-5-1"))
+	a.Contains(fakeGivenNames, anonymizeTestGet(a, r, "PID-5-2"))
+	a.Len(anonymizeTestGet(a, r, "OBX-5"), 16)
+	a.Equal("Patient John Smith said hello", anonymizeTestGet(a, r, "OBX(2)-5"))
+
+	for _, rule := range []Rule{
+		{Path: "PID-X", Action: ActionRemove},
+		{Path: "PID", Action: ActionRemove},
+		{Path: "PID-5", Action: "scramble"},
+		{Path: "PID-5", Action: ActionFake, Fake: "wizard"},
+		{Path: "PID-5-1", Action: ActionFake, Fake: FakeName},
+	} {
+		_, err := NewAnonymizer(nil, []Rule{rule})
+		a.Error(err, rule.Path)
+	}
+}
+
+func TestAnonymizeZip(t *testing.T) {
+	a := assert.New(t)
+
+	an, err := NewAnonymizer([]byte("secret"), nil)
+	a.NoError(err)
+
+	for in, out := range map[string]string{
+		"90210":      "90200",
+		"90210-1234": "90200",
+		"03601":      "00000",
+		"87901-1234": "00000",
+		"893":        "000",
+		"12-3456":    "000",
+		"1-23":       "000",
+		"12":         "000",
+		"SW1A 1AA":   "SW100000",
+		"K1A-0B1":    "K1A",
+		"":           "",
+	} {
+		a.Equal(out, an.fake(FakeZip, in), in)
+	}
+
+	m, _, err := ParseMessage([]byte("MSH|^~\\&|||||||ADT^A01|1|P|2.5\rPID|1||123||Smith^John||||||12 Real St^^Hometown^CA^12-3456"))
+	a.NoError(err)
+	a.Equal("000", anonymizeTestGet(a, an.Anonymize(m), "PID-11-5"))
+}
@@ -0,0 +1,26 @@
+package main
+
+import (
+	"fmt"
+
+	"fknsrs.biz/p/hl7"
+)
+
+// runCount prints the result of Query.Count for each message, e.g. the
+// number of OBX segments for "OBX", or the number of repetitions of PID-3
+// for "PID-3".
+func runCount(e *env, args []string) error {
+	if len(args) < 1 {
+		return errUsage
+	}
+
+	q, err := hl7.ParseQuery(args[0])
+	if err != nil {
+		return fmt.Errorf("invalid query %q: %s", args[0], hl7.ErrorText(err))
+	}
+
+	return eachMessage(e, args[1:], func(m hl7.Message, d *hl7.Delimiters) error {
+		fmt.Fprintln(e.stdout, q.Count(m))
+		return nil
+	})
+}
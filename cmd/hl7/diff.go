@@ -0,0 +1,88 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"strings"
+
+	"fknsrs.biz/p/hl7"
+)
+
+// runDiff compares the messages in two files, the first with the first, the
+// second with the second, and so on, printing a line for each difference.
+// Like diff(1), it exits with an error if there are any differences.
+func runDiff(e *env, args []string) error {
+	fs := flag.NewFlagSet("diff", flag.ContinueOnError)
+	fs.SetOutput(ioutil.Discard)
+	volatile := fs.Bool("volatile", false, "ignore fields that change in every message ("+strings.Join(hl7.VolatileFields, ", ")+")")
+	ignore := fs.String("ignore", "", "comma-separated list of paths to ignore")
+	keys := fs.String("key", "", "comma-separated list of segment keys, like OBX=OBX-3")
+	if err := fs.Parse(args); err != nil || fs.NArg() != 2 {
+		return errUsage
+	}
+
+	var o hl7.DiffOptions
+
+	if *ignore != "" {
+		o.Ignore = strings.Split(*ignore, ",")
+	}
+	if *volatile {
+		o.Ignore = append(o.Ignore, hl7.VolatileFields...)
+	}
+
+	if *keys != "" {
+		o.Keys = make(map[string]string)
+
+		for _, k := range strings.Split(*keys, ",") {
+			a := strings.SplitN(k, "=", 2)
+			if len(a) != 2 {
+				return fmt.Errorf("invalid key %q; should look like OBX=OBX-3", k)
+			}
+			if _, err := hl7.ParseQuery(a[1]); err != nil {
+				return fmt.Errorf("invalid query %q: %s", a[1], hl7.ErrorText(err))
+			}
+
+			o.Keys[a[0]] = a[1]
+		}
+	}
+
+	var before, after []hl7.Message
+
+	for i, p := range []*[]hl7.Message{&before, &after} {
+		err := eachMessage(e, fs.Args()[i:i+1], func(m hl7.Message, d *hl7.Delimiters) error {
+			*p = append(*p, m)
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	different := len(before) != len(after)
+
+	for i := 0; i < len(before) || i < len(after); i++ {
+		prefix := ""
+		if len(before) > 1 || len(after) > 1 {
+			prefix = fmt.Sprintf("message %d: ", i+1)
+		}
+
+		switch {
+		case i >= len(after):
+			fmt.Fprintf(e.stdout, "%sonly in %s\n", prefix, fs.Arg(0))
+		case i >= len(before):
+			fmt.Fprintf(e.stdout, "%sonly in %s\n", prefix, fs.Arg(1))
+		default:
+			for _, c := range o.Diff(before[i], after[i]) {
+				fmt.Fprintf(e.stdout, "%s%s\n", prefix, c)
+				different = true
+			}
+		}
+	}
+
+	if different {
+		return errDifferent
+	}
+
+	return nil
+}
@@ -0,0 +1,37 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDiff(t *testing.T) {
+	a := assert.New(t)
+
+	dir, err := ioutil.TempDir("", "hl7-diff")
+	a.NoError(err)
+	defer os.RemoveAll(dir)
+
+	before := filepath.Join(dir, "before.hl7")
+	after := filepath.Join(dir, "after.hl7")
+
+	a.NoError(ioutil.WriteFile(before, []byte("MSH|^~\\&|A|B|||20240102||ADT^A01|1|P|2.5\rPID|1||123||Smith\rOBX|1|ST|X||a\rOBX|2|ST|Y||b\r"), 0644))
+	a.NoError(ioutil.WriteFile(after, []byte("MSH|^~\\&|A|B|||20240103||ADT^A01|2|P|2.5\rPID|1||123||Smyth\rOBX|1|ST|Y||b\r"), 0644))
+
+	code, out, errText := testRun("", "diff", "-volatile", "-ignore", "OBX-1", "-key", "OBX=OBX-3", before, after)
+	a.Equal(1, code)
+	a.Empty(errText)
+	a.Equal("~ PID-5: \"Smith\" -> \"Smyth\"\n- OBX [OBX-3=X]: OBX|1|ST|X||a\n", out)
+
+	code, out, _ = testRun("", "diff", before, before)
+	a.Equal(0, code)
+	a.Empty(out)
+
+	code, _, errText = testRun("", "diff", "-key", "OBX", before, after)
+	a.Equal(1, code)
+	a.Contains(errText, "invalid key")
+}
@@ -0,0 +1,35 @@
+package main
+
+import (
+	"flag"
+	"io/ioutil"
+
+	"fknsrs.biz/p/hl7/synth"
+)
+
+// runGenerate writes synthetic messages of the given types, going round the
+// types in order until it's written as many as it was asked for.
+func runGenerate(e *env, args []string) error {
+	fs := flag.NewFlagSet("generate", flag.ContinueOnError)
+	fs.SetOutput(ioutil.Discard)
+	seed := fs.Int64("seed", 1, "seed for the random number generator")
+	n := fs.Int("n", 1, "number of messages to generate")
+	version := fs.String("version", "2.5", "version of the standard to use")
+	if err := fs.Parse(args); err != nil || fs.NArg() < 1 || *n < 0 {
+		return errUsage
+	}
+
+	g := synth.New(*seed)
+	g.Version = *version
+
+	for i := 0; i < *n; i++ {
+		m, err := g.Message(fs.Arg(i%fs.NArg()), nil)
+		if err != nil {
+			return err
+		}
+
+		writeMessage(e.stdout, m, nil)
+	}
+
+	return nil
+}
@@ -0,0 +1,41 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io/ioutil"
+
+	"fknsrs.biz/p/hl7"
+)
+
+// runGet prints the value of a query for each message, one per line. With
+// -all, a query without a segment offset (e.g. "OBX-5") prints the value for
+// every matching segment instead of just the first.
+func runGet(e *env, args []string) error {
+	fs := flag.NewFlagSet("get", flag.ContinueOnError)
+	fs.SetOutput(ioutil.Discard)
+	all := fs.Bool("all", false, "print the value from every matching segment")
+	if err := fs.Parse(args); err != nil || fs.NArg() < 1 {
+		return errUsage
+	}
+
+	q, err := hl7.ParseQuery(fs.Arg(0))
+	if err != nil {
+		return fmt.Errorf("invalid query %q: %s", fs.Arg(0), hl7.ErrorText(err))
+	}
+
+	return eachMessage(e, fs.Args()[1:], func(m hl7.Message, d *hl7.Delimiters) error {
+		if !*all || q.HasSegmentOffset {
+			fmt.Fprintln(e.stdout, q.GetString(m))
+			return nil
+		}
+
+		for i := range m.Segments(q.Segment) {
+			q := *q
+			q.SegmentOffset = i
+			fmt.Fprintln(e.stdout, q.GetString(m))
+		}
+
+		return nil
+	})
+}
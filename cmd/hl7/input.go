@@ -0,0 +1,55 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+
+	"fknsrs.biz/p/hl7"
+)
+
+// eachMessage parses every message in the named files (or standard input, if
+// there aren't any) and calls fn with each of them. It stops at the first
+// error, which says where the bad message was.
+func eachMessage(e *env, files []string, fn func(m hl7.Message, d *hl7.Delimiters) error) error {
+	if len(files) == 0 {
+		buf, err := ioutil.ReadAll(e.stdin)
+		if err != nil {
+			return err
+		}
+
+		return eachMessageIn("<stdin>", buf, fn)
+	}
+
+	for _, file := range files {
+		buf, err := ioutil.ReadFile(file)
+		if err != nil {
+			return err
+		}
+
+		if err := eachMessageIn(file, buf, fn); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func eachMessageIn(name string, buf []byte, fn func(m hl7.Message, d *hl7.Delimiters) error) error {
+	messages := hl7.SplitMessages(buf)
+	if len(messages) == 0 {
+		return fmt.Errorf("%s: no messages found", name)
+	}
+
+	for i, b := range messages {
+		m, d, err := hl7.ParseMessage(b)
+		if err != nil {
+			return fmt.Errorf("%s: message %d: %s", name, i+1, hl7.ErrorText(err))
+		}
+
+		if err := fn(m, d); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
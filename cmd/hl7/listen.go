@@ -0,0 +1,173 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"fknsrs.biz/p/hl7"
+	"fknsrs.biz/p/hl7/mllp"
+)
+
+type listenOptions struct {
+	code        string
+	text        string
+	dir         string
+	pretty      bool
+	metrics     string
+	maxConns    int
+	idleTimeout time.Duration
+	allow       string
+}
+
+// runListen runs an MLLP server that prints every message it gets, and
+// answers each with the same acknowledgement code. On SIGINT or SIGTERM, it
+// stops accepting connections and waits for the messages it's handling to
+// finish before it exits.
+func runListen(e *env, args []string) error {
+	var o listenOptions
+
+	fs := flag.NewFlagSet("listen", flag.ContinueOnError)
+	fs.SetOutput(ioutil.Discard)
+	fs.StringVar(&o.code, "ack", hl7.AckAccept, "acknowledgement code to answer with (AA, AE, or AR)")
+	fs.StringVar(&o.text, "text", "", "text to put in the acknowledgement")
+	fs.StringVar(&o.dir, "dir", "", "directory to save each message in")
+	fs.BoolVar(&o.pretty, "pretty", false, "pretty-print messages")
+	fs.StringVar(&o.metrics, "metrics", "", "address to serve Prometheus metrics on, at /metrics")
+	fs.IntVar(&o.maxConns, "max-conns", 0, "maximum number of connections at once")
+	fs.DurationVar(&o.idleTimeout, "idle-timeout", 0, "close connections that don't send anything for this long")
+	fs.StringVar(&o.allow, "allow", "", "comma-separated IP addresses and networks to accept connections from")
+	var tf tlsFlags
+	tf.server(fs)
+	if err := fs.Parse(args); err != nil || fs.NArg() != 1 {
+		return errUsage
+	}
+
+	switch o.code {
+	case hl7.AckAccept, hl7.AckError, hl7.AckReject:
+	default:
+		return fmt.Errorf("invalid acknowledgement code %q", o.code)
+	}
+
+	if o.dir != "" {
+		if err := os.MkdirAll(o.dir, 0755); err != nil {
+			return err
+		}
+	}
+
+	s := mllp.Server{
+		Addr:        fs.Arg(0),
+		Handler:     listenHandler(e, o),
+		MaxConns:    o.maxConns,
+		IdleTimeout: o.idleTimeout,
+		ErrorLog:    log.New(e.stderr, "", log.LstdFlags),
+	}
+
+	if o.allow != "" {
+		s.AllowList = strings.Split(o.allow, ",")
+	}
+
+	if o.metrics != "" {
+		m := mllp.NewPrometheusMetrics("mllp_server")
+		s.Metrics = m
+
+		l, err := net.Listen("tcp", o.metrics)
+		if err != nil {
+			return err
+		}
+		defer l.Close()
+
+		mux := http.NewServeMux()
+		mux.Handle("/metrics", m)
+
+		go http.Serve(l, mux)
+	}
+
+	var err error
+	if tf.use() {
+		if s.TLSConfig, err = tf.config(true); err != nil {
+			return err
+		}
+	}
+
+	sig := make(chan os.Signal, 1)
+	signal.Notify(sig, os.Interrupt, syscall.SIGTERM)
+	defer signal.Stop(sig)
+
+	stop := make(chan struct{})
+	defer close(stop)
+
+	shutdown := make(chan error, 1)
+	go func() {
+		select {
+		case <-sig:
+		case <-stop:
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+		defer cancel()
+
+		shutdown <- s.Shutdown(ctx)
+	}()
+
+	if tf.use() {
+		err = s.ListenAndServeTLS(tf.cert, tf.key)
+	} else {
+		err = s.ListenAndServe()
+	}
+
+	if err == mllp.ErrServerClosed {
+		return <-shutdown
+	}
+
+	return err
+}
+
+// shutdownTimeout limits how long listen waits for messages to finish when
+// it's stopped.
+const shutdownTimeout = 10 * time.Second
+
+var unsafeFileChars = regexp.MustCompile(`[^A-Za-z0-9._-]`)
+
+func listenHandler(e *env, o listenOptions) hl7.Handler {
+	var mu sync.Mutex
+
+	return hl7.HandlerFunc(func(ctx context.Context, m hl7.Message, d *hl7.Delimiters) (hl7.Message, error) {
+		mu.Lock()
+		defer mu.Unlock()
+
+		fmt.Fprintf(e.stdout, "# from %s\n", mllp.RemoteAddr(ctx))
+		if o.pretty {
+			fmt.Fprint(e.stdout, hl7.Pretty(m, hl7.PrettyOptions{Dictionary: hl7.DefaultDictionary, HideEmpty: true, MaxValueLength: 80}))
+		} else {
+			writeMessage(e.stdout, m, d)
+		}
+		fmt.Fprintln(e.stdout)
+
+		if o.dir != "" {
+			name := time.Now().Format("20060102T150405.000000000")
+			if id := m.Segment("MSH", 0).Value(10); id != "" {
+				name += "-" + unsafeFileChars.ReplaceAllString(id, "_")
+			}
+
+			if err := ioutil.WriteFile(filepath.Join(o.dir, name+".hl7"), hl7.EncodeMessage(m, d), 0644); err != nil {
+				return nil, err
+			}
+		}
+
+		return hl7.NewACK(m, d, o.code, o.text), nil
+	})
+}
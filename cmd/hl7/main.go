@@ -0,0 +1,106 @@
+// Command hl7 queries and inspects HL7 v2 messages, a bit like jq does for
+// JSON.
+//
+//	hl7 get PID-5-1 file.hl7
+//	hl7 pretty < file.hl7
+//	hl7 count OBX file.hl7
+//	hl7 send localhost:2575 file.hl7
+//	hl7 listen :2575
+//	hl7 diff -volatile before.hl7 after.hl7
+//	hl7 generate -n 100 ADT^A01 ORU^R01
+//
+// Commands read the files named on the command line, or standard input if
+// there aren't any. Files can hold any number of messages.
+package main // import "fknsrs.biz/p/hl7/cmd/hl7"
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+
+	"fknsrs.biz/p/hl7"
+)
+
+type command struct {
+	usage string
+	run   func(env *env, args []string) error
+}
+
+var commands = map[string]command{
+	"get":      {"get [-all] QUERY [FILE...]", runGet},
+	"pretty":   {"pretty [-hide-empty] [-truncate N] [FILE...]", runPretty},
+	"count":    {"count QUERY [FILE...]", runCount},
+	"send":     {"send [-timeout DURATION] [-tls] [-ca FILE] [-cert FILE -key FILE] ADDR [FILE...]", runSend},
+	"diff":     {"diff [-volatile] [-ignore PATH,...] [-key SEGMENT=QUERY,...] FILE1 FILE2", runDiff},
+	"listen":   {"listen [-ack CODE] [-text TEXT] [-dir DIR] [-pretty] [-metrics ADDR] [-max-conns N] [-idle-timeout DURATION] [-allow ADDR,...] [-cert FILE -key FILE [-client-ca FILE]] ADDR", runListen},
+	"generate": {"generate [-seed N] [-n COUNT] [-version VERSION] TYPE...", runGenerate},
+}
+
+var (
+	// errUsage is returned by commands when they're given the wrong
+	// arguments.
+	errUsage = errors.New("usage")
+	// errDifferent is returned by diff when it finds differences, so that
+	// it exits with an error but doesn't print anything else.
+	errDifferent = errors.New("messages are different")
+)
+
+// env holds the standard streams, so that commands can be run from tests.
+type env struct {
+	stdin          io.Reader
+	stdout, stderr io.Writer
+}
+
+func main() {
+	os.Exit(run(&env{stdin: os.Stdin, stdout: os.Stdout, stderr: os.Stderr}, os.Args[1:]))
+}
+
+func run(e *env, args []string) int {
+	if len(args) == 0 {
+		usage(e.stderr)
+		return 2
+	}
+
+	c, ok := commands[args[0]]
+	if !ok {
+		fmt.Fprintf(e.stderr, "hl7: unknown command %q\n", args[0])
+		usage(e.stderr)
+		return 2
+	}
+
+	if err := c.run(e, args[1:]); err != nil {
+		switch err {
+		case errUsage:
+			fmt.Fprintf(e.stderr, "usage: hl7 %s\n", c.usage)
+		case errDifferent:
+		default:
+			fmt.Fprintf(e.stderr, "hl7 %s: %s\n", args[0], hl7.ErrorText(err))
+		}
+
+		return 1
+	}
+
+	return 0
+}
+
+func usage(w io.Writer) {
+	var names []string
+	for name := range commands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	fmt.Fprintf(w, "usage:\n")
+	for _, name := range names {
+		fmt.Fprintf(w, "  hl7 %s\n", commands[name].usage)
+	}
+}
+
+// writeMessage writes a message in the usual encoding, but with newlines
+// between segments so that it looks right in a terminal.
+func writeMessage(w io.Writer, m hl7.Message, d *hl7.Delimiters) {
+	fmt.Fprint(w, strings.Replace(string(hl7.EncodeMessage(m, d)), "\r", "\n", -1))
+}
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const testMessages = "MSH|^~\\&|A|B|C|D|20240102||ADT^A01|1|P|2.5\r\n" +
+	"PID|1||123||Smith^John\r\n" +
+	"OBX|1|ST|X||one\r\n" +
+	"OBX|2|ST|Y||two\r\n" +
+	"MSH|^~\\&|A|B|C|D|20240102||ADT^A08|2|P|2.5\r\n" +
+	"PID|1||456||Jones^Jane\r\n"
+
+func testRun(stdin string, args ...string) (int, string, string) {
+	var stdout, stderr bytes.Buffer
+
+	code := run(&env{stdin: strings.NewReader(stdin), stdout: &stdout, stderr: &stderr}, args)
+
+	return code, stdout.String(), stderr.String()
+}
+
+func TestGet(t *testing.T) {
+	a := assert.New(t)
+
+	code, out, _ := testRun(testMessages, "get", "PID-5-1")
+	a.Equal(0, code)
+	a.Equal("Smith\nJones\n", out)
+
+	code, out, _ = testRun(testMessages, "get", "-all", "OBX-5")
+	a.Equal(0, code)
+	a.Equal("one\ntwo\n", out)
+
+	code, out, _ = testRun(testMessages, "get", "-all", "OBX(2)-5")
+	a.Equal(0, code)
+	a.Equal("two\n\n", out)
+
+	code, out, _ = testRun(testMessages, "get", "MSH-9-2", "../../testdata/simple.hl7")
+	a.Equal(0, code)
+	a.NotEmpty(out)
+}
+
+func TestCount(t *testing.T) {
+	a := assert.New(t)
+
+	code, out, _ := testRun(testMessages, "count", "OBX")
+	a.Equal(0, code)
+	a.Equal("2\n0\n", out)
+}
+
+func TestPretty(t *testing.T) {
+	a := assert.New(t)
+
+	code, out, _ := testRun(testMessages, "pretty", "-hide-empty")
+	a.Equal(0, code)
+	a.Contains(out, "  PID-5 Patient Name\n    PID-5-1 Patient Name.Family Name = Smith\n")
+	a.Contains(out, "\n\nMSH\n")
+}
+
+func TestGenerate(t *testing.T) {
+	a := assert.New(t)
+
+	code, out, _ := testRun("", "generate", "-n", "3", "ADT^A01", "ORU^R01")
+	a.Equal(0, code)
+
+	code, types, _ := testRun(out, "get", "MSH-9-1")
+	a.Equal(0, code)
+	a.Equal("ADT\nORU\nADT\n", types)
+
+	code, _, errText := testRun("", "generate", "ZZZ^Z01")
+	a.Equal(1, code)
+	a.Contains(errText, `unknown message type "ZZZ^Z01"`)
+}
+
+func TestErrors(t *testing.T) {
+	a := assert.New(t)
+
+	code, _, errText := testRun("")
+	a.Equal(2, code)
+	a.Contains(errText, "usage:")
+
+	code, _, errText = testRun("", "frobnicate")
+	a.Equal(2, code)
+	a.Contains(errText, `unknown command "frobnicate"`)
+
+	code, _, errText = testRun("", "get")
+	a.Equal(1, code)
+	a.Equal("usage: hl7 get [-all] QUERY [FILE...]\n", errText)
+
+	code, _, errText = testRun(testMessages, "get", "!!")
+	a.Equal(1, code)
+	a.Contains(errText, `invalid query "!!"`)
+
+	code, _, errText = testRun(testMessages+"MSH|^~\\&\r", "count", "PID")
+	a.Equal(1, code)
+	a.Contains(errText, "hl7 count: <stdin>: message 3: ")
+
+	code, _, errText = testRun("\r\n", "count", "PID")
+	a.Equal(1, code)
+	a.Equal("hl7 count: <stdin>: no messages found\n", errText)
+
+	code, _, errText = testRun("", "count", "PID", "does-not-exist.hl7")
+	a.Equal(1, code)
+	a.Contains(errText, "does-not-exist.hl7")
+}
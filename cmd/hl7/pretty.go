@@ -0,0 +1,40 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io/ioutil"
+
+	"fknsrs.biz/p/hl7"
+)
+
+// runPretty prints each message as a tree, with field names from the default
+// dictionary, and a blank line between messages.
+func runPretty(e *env, args []string) error {
+	fs := flag.NewFlagSet("pretty", flag.ContinueOnError)
+	fs.SetOutput(ioutil.Discard)
+	hideEmpty := fs.Bool("hide-empty", false, "leave out empty values")
+	truncate := fs.Int("truncate", 0, "cut values down to this many bytes")
+	if err := fs.Parse(args); err != nil {
+		return errUsage
+	}
+
+	o := hl7.PrettyOptions{
+		Dictionary:     hl7.DefaultDictionary,
+		HideEmpty:      *hideEmpty,
+		MaxValueLength: *truncate,
+	}
+
+	n := 0
+
+	return eachMessage(e, fs.Args(), func(m hl7.Message, d *hl7.Delimiters) error {
+		if n > 0 {
+			fmt.Fprintln(e.stdout)
+		}
+		n++
+
+		fmt.Fprint(e.stdout, hl7.Pretty(m, o))
+
+		return nil
+	})
+}
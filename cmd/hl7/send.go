@@ -0,0 +1,77 @@
+package main
+
+import (
+	"crypto/tls"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"time"
+
+	"fknsrs.biz/p/hl7"
+	"fknsrs.biz/p/hl7/mllp"
+)
+
+// runSend sends each message to an MLLP server, one at a time, and prints
+// the acknowledgements that come back. It stops at the first message that
+// isn't accepted. Messages in enhanced acknowledgement mode that don't ask
+// for a commit acknowledgement are sent without waiting for anything.
+func runSend(e *env, args []string) error {
+	fs := flag.NewFlagSet("send", flag.ContinueOnError)
+	fs.SetOutput(ioutil.Discard)
+	timeout := fs.Duration("timeout", 30*time.Second, "how long to wait for each acknowledgement")
+	var tf tlsFlags
+	tf.client(fs)
+	if err := fs.Parse(args); err != nil || fs.NArg() < 1 {
+		return errUsage
+	}
+
+	var c *mllp.Client
+	var err error
+
+	if tf.use() {
+		var config *tls.Config
+		if config, err = tf.config(false); err != nil {
+			return err
+		}
+
+		c, err = mllp.DialTLS(fs.Arg(0), config)
+	} else {
+		c, err = mllp.Dial(fs.Arg(0))
+	}
+	if err != nil {
+		return err
+	}
+	defer c.Close()
+
+	c.Timeout = *timeout
+
+	return eachMessage(e, fs.Args()[1:], func(m hl7.Message, d *hl7.Delimiters) error {
+		id := m.Segment("MSH", 0).Value(10)
+
+		ack, err := c.SendMessage(m, d)
+		if err != nil {
+			return fmt.Errorf("sending message %s: %s", id, hl7.ErrorText(err))
+		}
+
+		if ack == nil {
+			return nil
+		}
+
+		writeMessage(e.stdout, ack, d)
+
+		r, err := hl7.ReadACK(ack)
+		if err != nil {
+			return fmt.Errorf("message %s: %s", id, hl7.ErrorText(err))
+		}
+
+		if !r.OK() {
+			if r.Text != "" {
+				return fmt.Errorf("message %s: got %s: %s", id, r.Code, r.Text)
+			}
+
+			return fmt.Errorf("message %s: got %s", id, r.Code)
+		}
+
+		return nil
+	})
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"log"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"fknsrs.biz/p/hl7/mllp"
+)
+
+func startListener(t *testing.T, o listenOptions) (*mllp.Server, string, *bytes.Buffer) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var out bytes.Buffer
+
+	s := &mllp.Server{
+		Handler:  listenHandler(&env{stdout: &out}, o),
+		ErrorLog: log.New(ioutil.Discard, "", 0),
+	}
+	go s.Serve(l)
+
+	return s, l.Addr().String(), &out
+}
+
+func TestSendListen(t *testing.T) {
+	a := assert.New(t)
+
+	dir, err := ioutil.TempDir("", "hl7-listen")
+	a.NoError(err)
+	defer os.RemoveAll(dir)
+
+	s, addr, received := startListener(t, listenOptions{code: "AA", dir: dir})
+	defer s.Close()
+
+	code, out, errText := testRun(testMessages, "send", addr)
+	a.Equal(0, code)
+	a.Empty(errText)
+	a.Contains(out, "\nMSA|AA|1\n")
+	a.Contains(out, "\nMSA|AA|2\n")
+
+	a.Contains(received.String(), "PID|1||123||Smith^John\n")
+	a.Contains(received.String(), "PID|1||456||Jones^Jane\n")
+
+	files, err := filepath.Glob(filepath.Join(dir, "*.hl7"))
+	a.NoError(err)
+	a.Len(files, 2)
+}
+
+func TestSendRejected(t *testing.T) {
+	a := assert.New(t)
+
+	s, addr, _ := startListener(t, listenOptions{code: "AE", text: "not today"})
+	defer s.Close()
+
+	code, out, errText := testRun(testMessages, "send", addr)
+	a.Equal(1, code)
+	a.Contains(out, "\nMSA|AE|1|not today\n")
+	a.NotContains(out, "\nMSA|AE|2")
+	a.Equal("hl7 send: message 1: got AE: not today\n", errText)
+}
+
+func TestListenUsage(t *testing.T) {
+	a := assert.New(t)
+
+	code, _, errText := testRun("", "listen", "-ack", "XX", ":0")
+	a.Equal(1, code)
+	a.Contains(errText, `invalid acknowledgement code "XX"`)
+
+	code, _, _ = testRun("", "listen")
+	a.Equal(1, code)
+}
+
+func TestSendTLSFlags(t *testing.T) {
+	a := assert.New(t)
+
+	code, _, errText := testRun(testMessages, "send", "-ca", "does-not-exist.pem", "127.0.0.1:1")
+	a.Equal(1, code)
+	a.Contains(errText, "does-not-exist.pem")
+
+	code, _, errText = testRun("", "listen", "-cert", "does-not-exist.crt", "-key", "does-not-exist.key", "127.0.0.1:0")
+	a.Equal(1, code)
+	a.Contains(errText, "does-not-exist.crt")
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"crypto/tls"
+	"flag"
+
+	"fknsrs.biz/p/hl7/mllp"
+)
+
+// tlsFlags are the flags for the commands that can use TLS.
+type tlsFlags struct {
+	enabled  bool
+	cert     string
+	key      string
+	ca       string
+	clientCA string
+}
+
+func (f *tlsFlags) client(fs *flag.FlagSet) {
+	fs.BoolVar(&f.enabled, "tls", false, "connect over TLS")
+	fs.StringVar(&f.cert, "cert", "", "client certificate file, for TLS")
+	fs.StringVar(&f.key, "key", "", "client key file, for TLS")
+	fs.StringVar(&f.ca, "ca", "", "CA certificate file to trust, for TLS")
+}
+
+func (f *tlsFlags) server(fs *flag.FlagSet) {
+	fs.StringVar(&f.cert, "cert", "", "server certificate file; turns on TLS")
+	fs.StringVar(&f.key, "key", "", "server key file, for TLS")
+	fs.StringVar(&f.clientCA, "client-ca", "", "CA certificate file that client certificates must be signed by, for TLS")
+}
+
+// use reports whether any TLS flags were given.
+func (f *tlsFlags) use() bool {
+	return f.enabled || f.cert != "" || f.ca != "" || f.clientCA != ""
+}
+
+// config builds a TLS configuration from the flags, apart from the server's
+// own certificate, which the server loads itself.
+func (f *tlsFlags) config(server bool) (*tls.Config, error) {
+	c := &tls.Config{}
+
+	if f.ca != "" {
+		p, err := mllp.LoadCertPool(f.ca)
+		if err != nil {
+			return nil, err
+		}
+		c.RootCAs = p
+	}
+
+	if f.clientCA != "" {
+		p, err := mllp.LoadCertPool(f.clientCA)
+		if err != nil {
+			return nil, err
+		}
+		c.ClientCAs = p
+		c.ClientAuth = tls.RequireAndVerifyClientCert
+	}
+
+	if !server && f.cert != "" {
+		cert, err := tls.LoadX509KeyPair(f.cert, f.key)
+		if err != nil {
+			return nil, err
+		}
+		c.Certificates = []tls.Certificate{cert}
+	}
+
+	return c, nil
+}
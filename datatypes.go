@@ -0,0 +1,637 @@
+package hl7 // import "fknsrs.biz/p/hl7"
+
+// HD is a hierarchic designator, used to identify applications, facilities,
+// and assigning authorities.
+type HD struct {
+	NamespaceID     string
+	UniversalID     string
+	UniversalIDType string
+}
+
+// DecodeHD reads an HD value from a field item.
+func DecodeHD(fi FieldItem) HD {
+	return HD{
+		NamespaceID:     fi.get(1),
+		UniversalID:     fi.get(2),
+		UniversalIDType: fi.get(3),
+	}
+}
+
+// DecodeHDs reads every repetition of a field as an HD value.
+func DecodeHDs(f Field) []HD {
+	a := make([]HD, len(f))
+	for i, fi := range f {
+		a[i] = DecodeHD(fi)
+	}
+	return a
+}
+
+// decodeHDComponent reads an HD value that's been embedded as subcomponents
+// of a single component, like CX-4.
+func decodeHDComponent(c Component) HD {
+	return HD{
+		NamespaceID:     c.get(1),
+		UniversalID:     c.get(2),
+		UniversalIDType: c.get(3),
+	}
+}
+
+// Encode turns an HD value into a field item. Before version 2.3, an HD was
+// only a namespace ID, so the other components are left out.
+func (h HD) Encode(version string) FieldItem {
+	if CompareVersion(version, "2.3") < 0 {
+		return makeFieldItem(h.NamespaceID)
+	}
+
+	return makeFieldItem(h.NamespaceID, h.UniversalID, h.UniversalIDType)
+}
+
+func (h HD) component(version string) Component {
+	return subcomponents(h.Encode(version))
+}
+
+// IsZero reports whether all the components of the HD are empty.
+func (h HD) IsZero() bool {
+	return h == HD{}
+}
+
+// CX is an extended composite ID with check digit, used for patient
+// identifiers like PID-3.
+type CX struct {
+	ID                 string
+	CheckDigit         string
+	CheckDigitScheme   string
+	AssigningAuthority HD
+	IdentifierTypeCode string
+	AssigningFacility  HD
+	EffectiveDate      string // since 2.5
+	ExpirationDate     string // since 2.5
+}
+
+// DecodeCX reads a CX value (or a CK value, from before version 2.3) from a
+// field item.
+func DecodeCX(fi FieldItem) CX {
+	return CX{
+		ID:                 fi.get(1),
+		CheckDigit:         fi.get(2),
+		CheckDigitScheme:   fi.get(3),
+		AssigningAuthority: decodeHDComponent(fi.component(4)),
+		IdentifierTypeCode: fi.get(5),
+		AssigningFacility:  decodeHDComponent(fi.component(6)),
+		EffectiveDate:      fi.get(7),
+		ExpirationDate:     fi.get(8),
+	}
+}
+
+// DecodeCXs reads every repetition of a field as a CX value.
+func DecodeCXs(f Field) []CX {
+	a := make([]CX, len(f))
+	for i, fi := range f {
+		a[i] = DecodeCX(fi)
+	}
+	return a
+}
+
+// Encode turns a CX value into a field item, leaving out the components that
+// don't exist in the given version.
+func (c CX) Encode(version string) FieldItem {
+	fi := FieldItem{
+		simple(c.ID),
+		simple(c.CheckDigit),
+		simple(c.CheckDigitScheme),
+		c.AssigningAuthority.component(version),
+		simple(c.IdentifierTypeCode),
+		c.AssigningFacility.component(version),
+		simple(c.EffectiveDate),
+		simple(c.ExpirationDate),
+	}
+
+	switch {
+	case CompareVersion(version, "2.3") < 0:
+		fi = fi[:4]
+	case CompareVersion(version, "2.5") < 0:
+		fi = fi[:6]
+	}
+
+	return trimFieldItem(fi)
+}
+
+// XPN is an extended person name, used for patient names like PID-5. Before
+// version 2.3 this was called PN, and had the first six components.
+type XPN struct {
+	Family                 string
+	Given                  string
+	Middle                 string
+	Suffix                 string
+	Prefix                 string
+	Degree                 string
+	NameTypeCode           string // since 2.3
+	NameRepresentationCode string // since 2.3
+	ProfessionalSuffix     string // since 2.5
+}
+
+// DecodeXPN reads an XPN (or PN) value from a field item. From version 2.3.1
+// onwards the family name has subcomponents; only the surname is kept.
+func DecodeXPN(fi FieldItem) XPN {
+	return XPN{
+		Family:                 fi.get(1),
+		Given:                  fi.get(2),
+		Middle:                 fi.get(3),
+		Suffix:                 fi.get(4),
+		Prefix:                 fi.get(5),
+		Degree:                 fi.get(6),
+		NameTypeCode:           fi.get(7),
+		NameRepresentationCode: fi.get(8),
+		ProfessionalSuffix:     fi.get(14),
+	}
+}
+
+// DecodeXPNs reads every repetition of a field as an XPN value.
+func DecodeXPNs(f Field) []XPN {
+	a := make([]XPN, len(f))
+	for i, fi := range f {
+		a[i] = DecodeXPN(fi)
+	}
+	return a
+}
+
+// Encode turns an XPN value into a field item, leaving out the components
+// that don't exist in the given version.
+func (x XPN) Encode(version string) FieldItem {
+	switch {
+	case CompareVersion(version, "2.3") < 0:
+		return makeFieldItem(x.Family, x.Given, x.Middle, x.Suffix, x.Prefix, x.Degree)
+	case CompareVersion(version, "2.5") < 0:
+		return makeFieldItem(x.Family, x.Given, x.Middle, x.Suffix, x.Prefix, x.Degree, x.NameTypeCode, x.NameRepresentationCode)
+	}
+
+	return makeFieldItem(x.Family, x.Given, x.Middle, x.Suffix, x.Prefix, x.Degree, x.NameTypeCode, x.NameRepresentationCode, "", "", "", "", "", x.ProfessionalSuffix)
+}
+
+// XCN is an extended composite ID number and name for persons, used for
+// doctors and other staff like PV1-7. Before version 2.3 this was called CN,
+// and had the first nine components.
+type XCN struct {
+	ID                     string
+	Family                 string
+	Given                  string
+	Middle                 string
+	Suffix                 string
+	Prefix                 string
+	Degree                 string
+	SourceTable            string
+	AssigningAuthority     HD
+	NameTypeCode           string // since 2.3
+	CheckDigit             string // since 2.3
+	CheckDigitScheme       string // since 2.3
+	IdentifierTypeCode     string // since 2.3
+	AssigningFacility      HD     // since 2.3
+	NameRepresentationCode string // since 2.3.1
+	ProfessionalSuffix     string // since 2.5
+}
+
+// DecodeXCN reads an XCN (or CN) value from a field item.
+func DecodeXCN(fi FieldItem) XCN {
+	return XCN{
+		ID:                     fi.get(1),
+		Family:                 fi.get(2),
+		Given:                  fi.get(3),
+		Middle:                 fi.get(4),
+		Suffix:                 fi.get(5),
+		Prefix:                 fi.get(6),
+		Degree:                 fi.get(7),
+		SourceTable:            fi.get(8),
+		AssigningAuthority:     decodeHDComponent(fi.component(9)),
+		NameTypeCode:           fi.get(10),
+		CheckDigit:             fi.get(11),
+		CheckDigitScheme:       fi.get(12),
+		IdentifierTypeCode:     fi.get(13),
+		AssigningFacility:      decodeHDComponent(fi.component(14)),
+		NameRepresentationCode: fi.get(15),
+		ProfessionalSuffix:     fi.get(21),
+	}
+}
+
+// DecodeXCNs reads every repetition of a field as an XCN value.
+func DecodeXCNs(f Field) []XCN {
+	a := make([]XCN, len(f))
+	for i, fi := range f {
+		a[i] = DecodeXCN(fi)
+	}
+	return a
+}
+
+// Encode turns an XCN value into a field item, leaving out the components
+// that don't exist in the given version.
+func (x XCN) Encode(version string) FieldItem {
+	fi := FieldItem{
+		simple(x.ID),
+		simple(x.Family),
+		simple(x.Given),
+		simple(x.Middle),
+		simple(x.Suffix),
+		simple(x.Prefix),
+		simple(x.Degree),
+		simple(x.SourceTable),
+		x.AssigningAuthority.component(version),
+		simple(x.NameTypeCode),
+		simple(x.CheckDigit),
+		simple(x.CheckDigitScheme),
+		simple(x.IdentifierTypeCode),
+		x.AssigningFacility.component(version),
+		simple(x.NameRepresentationCode),
+		nil,
+		nil,
+		nil,
+		nil,
+		nil,
+		simple(x.ProfessionalSuffix),
+	}
+
+	switch {
+	case CompareVersion(version, "2.3") < 0:
+		fi = fi[:9]
+	case CompareVersion(version, "2.3.1") < 0:
+		fi = fi[:14]
+	case CompareVersion(version, "2.5") < 0:
+		fi = fi[:15]
+	}
+
+	return trimFieldItem(fi)
+}
+
+// XAD is an extended address, used for things like PID-11. Before version
+// 2.3 this was called AD, and had the first eight components.
+type XAD struct {
+	Street                     string
+	OtherDesignation           string
+	City                       string
+	State                      string
+	Zip                        string
+	Country                    string
+	AddressType                string
+	OtherGeographicDesignation string
+	County                     string // since 2.3
+	CensusTract                string // since 2.3
+	AddressRepresentationCode  string // since 2.3
+	EffectiveDate              string // since 2.5
+	ExpirationDate             string // since 2.5
+}
+
+// DecodeXAD reads an XAD (or AD) value from a field item. From version 2.5
+// onwards the street address has subcomponents; only the first is kept.
+func DecodeXAD(fi FieldItem) XAD {
+	return XAD{
+		Street:                     fi.get(1),
+		OtherDesignation:           fi.get(2),
+		City:                       fi.get(3),
+		State:                      fi.get(4),
+		Zip:                        fi.get(5),
+		Country:                    fi.get(6),
+		AddressType:                fi.get(7),
+		OtherGeographicDesignation: fi.get(8),
+		County:                     fi.get(9),
+		CensusTract:                fi.get(10),
+		AddressRepresentationCode:  fi.get(11),
+		EffectiveDate:              fi.get(13),
+		ExpirationDate:             fi.get(14),
+	}
+}
+
+// DecodeXADs reads every repetition of a field as an XAD value.
+func DecodeXADs(f Field) []XAD {
+	a := make([]XAD, len(f))
+	for i, fi := range f {
+		a[i] = DecodeXAD(fi)
+	}
+	return a
+}
+
+// Encode turns an XAD value into a field item, leaving out the components
+// that don't exist in the given version.
+func (x XAD) Encode(version string) FieldItem {
+	a := []string{
+		x.Street,
+		x.OtherDesignation,
+		x.City,
+		x.State,
+		x.Zip,
+		x.Country,
+		x.AddressType,
+		x.OtherGeographicDesignation,
+		x.County,
+		x.CensusTract,
+		x.AddressRepresentationCode,
+		"",
+		x.EffectiveDate,
+		x.ExpirationDate,
+	}
+
+	switch {
+	case CompareVersion(version, "2.3") < 0:
+		a = a[:8]
+	case CompareVersion(version, "2.5") < 0:
+		a = a[:11]
+	}
+
+	return makeFieldItem(a...)
+}
+
+// XTN is an extended telecommunication number, used for things like PID-13.
+// Before version 2.3 this was called TN, and was just the number itself.
+type XTN struct {
+	TelephoneNumber      string
+	TelecomUseCode       string // since 2.3
+	TelecomEquipmentType string // since 2.3
+	Email                string // since 2.3
+	CountryCode          string // since 2.3
+	AreaCode             string // since 2.3
+	LocalNumber          string // since 2.3
+	Extension            string // since 2.3
+	AnyText              string // since 2.3
+}
+
+// DecodeXTN reads an XTN (or TN) value from a field item.
+func DecodeXTN(fi FieldItem) XTN {
+	return XTN{
+		TelephoneNumber:      fi.get(1),
+		TelecomUseCode:       fi.get(2),
+		TelecomEquipmentType: fi.get(3),
+		Email:                fi.get(4),
+		CountryCode:          fi.get(5),
+		AreaCode:             fi.get(6),
+		LocalNumber:          fi.get(7),
+		Extension:            fi.get(8),
+		AnyText:              fi.get(9),
+	}
+}
+
+// DecodeXTNs reads every repetition of a field as an XTN value.
+func DecodeXTNs(f Field) []XTN {
+	a := make([]XTN, len(f))
+	for i, fi := range f {
+		a[i] = DecodeXTN(fi)
+	}
+	return a
+}
+
+// Number returns the telephone number as a single string. Version 2.6
+// withdrew the first component in favour of the structured ones, so if it's
+// empty the number is put together from the country code, area code, local
+// number, and extension instead.
+func (x XTN) Number() string {
+	if x.TelephoneNumber != "" {
+		return x.TelephoneNumber
+	}
+
+	s := x.LocalNumber
+	if x.AreaCode != "" {
+		s = "(" + x.AreaCode + ")" + s
+	}
+	if x.CountryCode != "" {
+		s = "+" + x.CountryCode + " " + s
+	}
+	if x.Extension != "" {
+		s += " X" + x.Extension
+	}
+
+	return s
+}
+
+// Encode turns an XTN value into a field item, leaving out the components
+// that don't exist in the given version. From version 2.6 onwards the first
+// component is left empty, unless there's no structured number to use
+// instead.
+func (x XTN) Encode(version string) FieldItem {
+	if CompareVersion(version, "2.3") < 0 {
+		return makeFieldItem(x.Number())
+	}
+
+	n := x.TelephoneNumber
+	if CompareVersion(version, "2.6") >= 0 && x.LocalNumber != "" {
+		n = ""
+	}
+
+	return makeFieldItem(n, x.TelecomUseCode, x.TelecomEquipmentType, x.Email, x.CountryCode, x.AreaCode, x.LocalNumber, x.Extension, x.AnyText)
+}
+
+// CE is a coded element, used for coded values like OBX-3 before version
+// 2.6.
+type CE struct {
+	Identifier            string
+	Text                  string
+	CodingSystem          string
+	AlternateIdentifier   string
+	AlternateText         string
+	AlternateCodingSystem string
+}
+
+// DecodeCE reads a CE value from a field item.
+func DecodeCE(fi FieldItem) CE {
+	return CE{
+		Identifier:            fi.get(1),
+		Text:                  fi.get(2),
+		CodingSystem:          fi.get(3),
+		AlternateIdentifier:   fi.get(4),
+		AlternateText:         fi.get(5),
+		AlternateCodingSystem: fi.get(6),
+	}
+}
+
+// DecodeCEs reads every repetition of a field as a CE value.
+func DecodeCEs(f Field) []CE {
+	a := make([]CE, len(f))
+	for i, fi := range f {
+		a[i] = DecodeCE(fi)
+	}
+	return a
+}
+
+// Encode turns a CE value into a field item. CE has had the same layout in
+// every version, so the version is ignored.
+func (c CE) Encode(version string) FieldItem {
+	return makeFieldItem(c.Identifier, c.Text, c.CodingSystem, c.AlternateIdentifier, c.AlternateText, c.AlternateCodingSystem)
+}
+
+// CWE is a coded value with exceptions. It starts out the same as CE, and
+// version 2.5 added the version IDs and original text.
+type CWE struct {
+	Identifier                     string
+	Text                           string
+	CodingSystem                   string
+	AlternateIdentifier            string
+	AlternateText                  string
+	AlternateCodingSystem          string
+	CodingSystemVersionID          string // since 2.5
+	AlternateCodingSystemVersionID string // since 2.5
+	OriginalText                   string // since 2.5
+}
+
+// DecodeCWE reads a CWE value from a field item. It's also fine to use this
+// to read CE values, which have the same first six components.
+func DecodeCWE(fi FieldItem) CWE {
+	return CWE{
+		Identifier:                     fi.get(1),
+		Text:                           fi.get(2),
+		CodingSystem:                   fi.get(3),
+		AlternateIdentifier:            fi.get(4),
+		AlternateText:                  fi.get(5),
+		AlternateCodingSystem:          fi.get(6),
+		CodingSystemVersionID:          fi.get(7),
+		AlternateCodingSystemVersionID: fi.get(8),
+		OriginalText:                   fi.get(9),
+	}
+}
+
+// DecodeCWEs reads every repetition of a field as a CWE value.
+func DecodeCWEs(f Field) []CWE {
+	a := make([]CWE, len(f))
+	for i, fi := range f {
+		a[i] = DecodeCWE(fi)
+	}
+	return a
+}
+
+// Encode turns a CWE value into a field item, leaving out the components
+// that don't exist in the given version.
+func (c CWE) Encode(version string) FieldItem {
+	if CompareVersion(version, "2.5") < 0 {
+		return makeFieldItem(c.Identifier, c.Text, c.CodingSystem, c.AlternateIdentifier, c.AlternateText, c.AlternateCodingSystem)
+	}
+
+	return makeFieldItem(c.Identifier, c.Text, c.CodingSystem, c.AlternateIdentifier, c.AlternateText, c.AlternateCodingSystem, c.CodingSystemVersionID, c.AlternateCodingSystemVersionID, c.OriginalText)
+}
+
+// CE returns the first six components of the CWE as a CE.
+func (c CWE) CE() CE {
+	return CE{c.Identifier, c.Text, c.CodingSystem, c.AlternateIdentifier, c.AlternateText, c.AlternateCodingSystem}
+}
+
+// PL is a person location, used for things like PV1-3. The facility is an
+// HD, which is only a namespace ID before version 2.3.
+type PL struct {
+	PointOfCare         string
+	Room                string
+	Bed                 string
+	Facility            HD
+	LocationStatus      string
+	PersonLocationType  string
+	Building            string
+	Floor               string
+	LocationDescription string
+}
+
+// DecodePL reads a PL value from a field item.
+func DecodePL(fi FieldItem) PL {
+	return PL{
+		PointOfCare:         fi.get(1),
+		Room:                fi.get(2),
+		Bed:                 fi.get(3),
+		Facility:            decodeHDComponent(fi.component(4)),
+		LocationStatus:      fi.get(5),
+		PersonLocationType:  fi.get(6),
+		Building:            fi.get(7),
+		Floor:               fi.get(8),
+		LocationDescription: fi.get(9),
+	}
+}
+
+// DecodePLs reads every repetition of a field as a PL value.
+func DecodePLs(f Field) []PL {
+	a := make([]PL, len(f))
+	for i, fi := range f {
+		a[i] = DecodePL(fi)
+	}
+	return a
+}
+
+// Encode turns a PL value into a field item.
+func (p PL) Encode(version string) FieldItem {
+	return trimFieldItem(FieldItem{
+		simple(p.PointOfCare),
+		simple(p.Room),
+		simple(p.Bed),
+		p.Facility.component(version),
+		simple(p.LocationStatus),
+		simple(p.PersonLocationType),
+		simple(p.Building),
+		simple(p.Floor),
+		simple(p.LocationDescription),
+	})
+}
+
+// IsZero reports whether all the components of the PL are empty.
+func (p PL) IsZero() bool {
+	return p == PL{}
+}
+
+// simple makes a component holding a single value, or nil if it's empty.
+func simple(s string) Component {
+	if s == "" {
+		return nil
+	}
+
+	return Component{Subcomponent(s)}
+}
+
+// subcomponents squashes a field item made up of simple components into a
+// single component, for data types that embed other data types.
+func subcomponents(fi FieldItem) Component {
+	if len(fi) == 0 {
+		return nil
+	}
+
+	c := make(Component, len(fi))
+	for i := range fi {
+		c[i] = Subcomponent(fi.get(i + 1))
+	}
+
+	return c
+}
+
+// CompareVersion compares two HL7 version strings like "2.3.1" and "2.5",
+// returning -1, 0, or 1. Missing parts count as zero, so "2.3" comes before
+// "2.3.1". An empty version is treated as the newest possible version, so
+// that encoders default to the most complete layout.
+func CompareVersion(a, b string) int {
+	switch {
+	case a == b:
+		return 0
+	case a == "":
+		return 1
+	case b == "":
+		return -1
+	}
+
+	for a != "" || b != "" {
+		var x, y int
+		x, a = versionPart(a)
+		y, b = versionPart(b)
+
+		switch {
+		case x < y:
+			return -1
+		case x > y:
+			return 1
+		}
+	}
+
+	return 0
+}
+
+func versionPart(s string) (int, string) {
+	n := 0
+
+	i := 0
+	for ; i < len(s) && s[i] != '.'; i++ {
+		if s[i] >= '0' && s[i] <= '9' {
+			n = n*10 + int(s[i]-'0')
+		}
+	}
+
+	if i < len(s) {
+		i++
+	}
+
+	return n, s[i:]
+}
@@ -0,0 +1,152 @@
+package hl7
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDecodeLongMessage(t *testing.T) {
+	a := assert.New(t)
+
+	m, _, err := ParseMessage([]byte(longTestMessageContent))
+	a.NoError(err)
+
+	pid := m.Segment("PID", 0)
+
+	a.Equal([]CX{
+		CX{ID: "1234", IdentifierTypeCode: "SR"},
+		CX{ID: "1234-12", IdentifierTypeCode: "LR"},
+		CX{ID: "00725", IdentifierTypeCode: "MR"},
+	}, DecodeCXs(pid.Field(3)))
+
+	a.Equal([]XPN{
+		XPN{Family: "Doe", Given: "John", Middle: "Fitzgerald", Suffix: "JR", NameTypeCode: "L"},
+	}, DecodeXPNs(pid.Field(5)))
+
+	a.Equal([]CE{
+		CE{Identifier: "2106-3", Text: "White", CodingSystem: "HL70005"},
+	}, DecodeCEs(pid.Field(10)))
+
+	a.Equal([]XAD{
+		XAD{Street: "123 Peachtree St", OtherDesignation: "APT 3B", City: "Atlanta", State: "GA", Zip: "30210", AddressType: "M", County: "GA067"},
+	}, DecodeXADs(pid.Field(11)))
+
+	a.Equal([]XTN{
+		XTN{TelephoneNumber: "(678) 555-1212", TelecomEquipmentType: "PRN"},
+	}, DecodeXTNs(pid.Field(13)))
+
+	a.Equal([]XCN{
+		XCN{ID: "1234567", Family: "Welby", Given: "Marcus", Middle: "J", Suffix: "Jr", Prefix: "Dr.", Degree: "MD", SourceTable: "L"},
+	}, DecodeXCNs(m.Segment("ORC", 0).Field(12)))
+}
+
+func TestDecodeSubcomponents(t *testing.T) {
+	a := assert.New(t)
+
+	m, _, err := ParseMessage([]byte("MSH|^~\\&|||||||ADT^A01|1|P|2.5\rPID|||123^^^HOSP&1.2.3&ISO^MR^WARD&&~456||van&Dyke^Anna"))
+	a.NoError(err)
+
+	pid := m.Segment("PID", 0)
+
+	a.Equal([]CX{
+		CX{ID: "123", AssigningAuthority: HD{"HOSP", "1.2.3", "ISO"}, IdentifierTypeCode: "MR", AssigningFacility: HD{NamespaceID: "WARD"}},
+		CX{ID: "456"},
+	}, DecodeCXs(pid.Field(3)))
+
+	a.Equal([]XPN{XPN{Family: "van", Given: "Anna"}}, DecodeXPNs(pid.Field(5)))
+}
+
+func TestEncodeCX(t *testing.T) {
+	a := assert.New(t)
+
+	c := CX{ID: "123", AssigningAuthority: HD{"HOSP", "1.2.3", "ISO"}, IdentifierTypeCode: "MR", AssigningFacility: HD{NamespaceID: "WARD"}, EffectiveDate: "20160101"}
+
+	a.Equal(FieldItem{Component{"123"}, nil, nil, Component{"HOSP", "1.2.3", "ISO"}, Component{"MR"}, Component{"WARD"}, Component{"20160101"}}, c.Encode("2.5"))
+	a.Equal(FieldItem{Component{"123"}, nil, nil, Component{"HOSP", "1.2.3", "ISO"}, Component{"MR"}, Component{"WARD"}}, c.Encode("2.3"))
+	a.Equal(FieldItem{Component{"123"}, nil, nil, Component{"HOSP"}}, c.Encode("2.2"))
+
+	a.Equal(c, DecodeCX(c.Encode("2.5")))
+}
+
+func TestEncodeXPN(t *testing.T) {
+	a := assert.New(t)
+
+	x := XPN{Family: "Doe", Given: "John", NameTypeCode: "L", ProfessionalSuffix: "PhD"}
+
+	a.Equal(makeFieldItem("Doe", "John", "", "", "", "", "L", "", "", "", "", "", "", "PhD"), x.Encode("2.5"))
+	a.Equal(makeFieldItem("Doe", "John", "", "", "", "", "L"), x.Encode("2.4"))
+	a.Equal(makeFieldItem("Doe", "John"), x.Encode("2.2"))
+
+	a.Equal(x, DecodeXPN(x.Encode("")))
+}
+
+func TestEncodeXCN(t *testing.T) {
+	a := assert.New(t)
+
+	x := XCN{ID: "1", Family: "Welby", AssigningAuthority: HD{NamespaceID: "AA"}, NameTypeCode: "L", NameRepresentationCode: "A"}
+
+	a.Equal(makeFieldItem("1", "Welby", "", "", "", "", "", "", "AA", "L", "", "", "", "", "A"), x.Encode("2.4"))
+	a.Equal(makeFieldItem("1", "Welby", "", "", "", "", "", "", "AA", "L"), x.Encode("2.3"))
+	a.Equal(makeFieldItem("1", "Welby", "", "", "", "", "", "", "AA"), x.Encode("2.1"))
+
+	a.Equal(x, DecodeXCN(x.Encode("2.5")))
+}
+
+func TestEncodeXAD(t *testing.T) {
+	a := assert.New(t)
+
+	x := XAD{Street: "1 Main St", City: "Atlanta", County: "GA067", EffectiveDate: "20160101"}
+
+	a.Equal(makeFieldItem("1 Main St", "", "Atlanta", "", "", "", "", "", "GA067", "", "", "", "20160101"), x.Encode("2.5"))
+	a.Equal(makeFieldItem("1 Main St", "", "Atlanta", "", "", "", "", "", "GA067"), x.Encode("2.3"))
+	a.Equal(makeFieldItem("1 Main St", "", "Atlanta"), x.Encode("2.2"))
+}
+
+func TestXTN(t *testing.T) {
+	a := assert.New(t)
+
+	x := XTN{TelecomUseCode: "PRN", TelecomEquipmentType: "PH", CountryCode: "1", AreaCode: "678", LocalNumber: "5551212", Extension: "12"}
+	a.Equal("+1 (678)5551212 X12", x.Number())
+	a.Equal(makeFieldItem("+1 (678)5551212 X12"), x.Encode("2.2"))
+	a.Equal(makeFieldItem("", "PRN", "PH", "", "1", "678", "5551212", "12"), x.Encode("2.6"))
+
+	x.TelephoneNumber = "(678) 555-1212"
+	a.Equal("(678) 555-1212", x.Number())
+	a.Equal(makeFieldItem("(678) 555-1212", "PRN", "PH", "", "1", "678", "5551212", "12"), x.Encode("2.5"))
+	a.Equal(makeFieldItem("", "PRN", "PH", "", "1", "678", "5551212", "12"), x.Encode("2.7"))
+}
+
+func TestEncodeCWE(t *testing.T) {
+	a := assert.New(t)
+
+	c := CWE{Identifier: "E", Text: "required emergency room/doctor visit", CodingSystem: "NIP005", OriginalText: "ER visit"}
+
+	a.Equal(makeFieldItem("E", "required emergency room/doctor visit", "NIP005", "", "", "", "", "", "ER visit"), c.Encode("2.5"))
+	a.Equal(makeFieldItem("E", "required emergency room/doctor visit", "NIP005"), c.Encode("2.4"))
+	a.Equal(makeFieldItem("E", "required emergency room/doctor visit", "NIP005"), c.CE().Encode("2.5"))
+}
+
+func TestEncodePL(t *testing.T) {
+	a := assert.New(t)
+
+	p := PL{PointOfCare: "4E", Room: "401", Bed: "B", Facility: HD{NamespaceID: "HOSP", UniversalID: "1.2.3", UniversalIDType: "ISO"}}
+
+	a.Equal(FieldItem{{"4E"}, {"401"}, {"B"}, {"HOSP", "1.2.3", "ISO"}}, p.Encode("2.5"))
+	a.Equal(FieldItem{{"4E"}, {"401"}, {"B"}, {"HOSP"}}, p.Encode("2.2"))
+
+	a.Equal(p, DecodePL(p.Encode("2.5")))
+	a.True(PL{}.IsZero())
+	a.False(p.IsZero())
+}
+
+func TestCompareVersion(t *testing.T) {
+	a := assert.New(t)
+
+	a.Equal(0, CompareVersion("2.5", "2.5"))
+	a.Equal(-1, CompareVersion("2.3", "2.3.1"))
+	a.Equal(1, CompareVersion("2.3.1", "2.3"))
+	a.Equal(1, CompareVersion("2.10", "2.9"))
+	a.Equal(1, CompareVersion("", "2.9"))
+	a.Equal(-1, CompareVersion("2.9", ""))
+}
@@ -0,0 +1,111 @@
+package hl7 // import "fknsrs.biz/p/hl7"
+
+import (
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/facebookgo/stackerr"
+)
+
+// ErrInvalidTime is returned when a TS/DTM value can't be parsed.
+type ErrInvalidTime error
+
+// ParseTime parses an HL7 timestamp (TS or DTM) of the form
+// `YYYY[MM[DD[HH[MM[SS[.S[S[S[S]]]]]]]]][+/-ZZZZ]`. Any components that are
+// left out are treated as zero (or one, for months and days). If there's no
+// time zone offset, the time is assumed to be in `time.Local`, which is what
+// the specification says the sender's local time should mean to us.
+func ParseTime(s string) (time.Time, error) {
+	if s == "" {
+		return time.Time{}, nil
+	}
+
+	loc := time.Local
+
+	if i := strings.IndexAny(s, "+-"); i != -1 {
+		z := s[i:]
+		s = s[:i]
+
+		if len(z) != 5 || !isDigits(z[1:]) {
+			return time.Time{}, ErrInvalidTime(stackerr.Newf("invalid time zone offset %q", z))
+		}
+
+		h, _ := strconv.Atoi(z[1:3])
+		m, _ := strconv.Atoi(z[3:5])
+
+		o := h*3600 + m*60
+		if z[0] == '-' {
+			o = -o
+		}
+
+		loc = time.FixedZone("", o)
+	}
+
+	var frac string
+	if i := strings.IndexByte(s, '.'); i != -1 {
+		frac = s[i+1:]
+		s = s[:i]
+
+		if len(s) != 14 || frac == "" || len(frac) > 4 || !isDigits(frac) {
+			return time.Time{}, ErrInvalidTime(stackerr.Newf("invalid fractional seconds in %q", s+"."+frac))
+		}
+	}
+
+	switch len(s) {
+	case 4, 6, 8, 10, 12, 14:
+	default:
+		return time.Time{}, ErrInvalidTime(stackerr.Newf("invalid timestamp %q; length must be 4, 6, 8, 10, 12, or 14", s))
+	}
+
+	if !isDigits(s) {
+		return time.Time{}, ErrInvalidTime(stackerr.Newf("invalid timestamp %q; must be all digits", s))
+	}
+
+	n := []int{0, 1, 1, 0, 0, 0}
+	n[0], _ = strconv.Atoi(s[0:4])
+	for i := 1; i*2+4 <= len(s); i++ {
+		n[i], _ = strconv.Atoi(s[i*2+2 : i*2+4])
+	}
+
+	var ns int
+	if frac != "" {
+		ns, _ = strconv.Atoi(frac)
+		for i := len(frac); i < 9; i++ {
+			ns *= 10
+		}
+	}
+
+	if n[1] > 12 || n[2] > 31 || n[3] > 23 || n[4] > 59 || n[5] > 59 || n[1] < 1 || n[2] < 1 {
+		return time.Time{}, ErrInvalidTime(stackerr.Newf("invalid timestamp %q; value out of range", s))
+	}
+
+	return time.Date(n[0], time.Month(n[1]), n[2], n[3], n[4], n[5], ns, loc), nil
+}
+
+// FormatTime formats a time as an HL7 timestamp with second precision and a
+// time zone offset. Fractional seconds are included (to four digits, the
+// most HL7 allows) if they're not zero. A zero time is formatted as an empty
+// string.
+func FormatTime(t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+
+	s := t.Format("20060102150405")
+	if ns := t.Nanosecond(); ns >= 100000 {
+		s += "." + strconv.Itoa(10000 + ns/100000)[1:]
+	}
+
+	return s + t.Format("-0700")
+}
+
+func isDigits(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if s[i] < '0' || s[i] > '9' {
+			return false
+		}
+	}
+
+	return true
+}
@@ -0,0 +1,114 @@
+// Package dedup stops receivers from processing the same message twice when
+// a sender retries it, for example after timing out waiting for the
+// acknowledgement. Messages are identified by their sending application
+// (MSH-3), sending facility (MSH-4), and control ID (MSH-10), and the
+// acknowledgement sent for the first copy is sent again for any repeats.
+package dedup // import "fknsrs.biz/p/hl7/dedup"
+
+import (
+	"context"
+	"sync"
+
+	"github.com/facebookgo/stackerr"
+
+	"fknsrs.biz/p/hl7"
+)
+
+// Store remembers the acknowledgements sent for messages, keyed by the
+// result of Key. Stores have to be safe to use from more than one goroutine
+// at once.
+type Store interface {
+	// Get returns the encoded acknowledgement stored for a key, and whether
+	// there was one.
+	Get(key string) ([]byte, bool, error)
+	// Put stores the encoded acknowledgement for a key.
+	Put(key string, ack []byte) error
+}
+
+// Key returns the key identifying a message: the namespace IDs from MSH-3 and
+// MSH-4, and the control ID from MSH-10, separated by "|". It returns an
+// empty string if the message doesn't have a control ID.
+func Key(m hl7.Message) string {
+	msh := m.Segment("MSH", 0)
+
+	if msh.Value(10) == "" {
+		return ""
+	}
+
+	return msh.Value(3) + "|" + msh.Value(4) + "|" + msh.Value(10)
+}
+
+// Middleware returns middleware that looks up each message in s before
+// passing it on. If it's been seen before, the stored acknowledgement is sent
+// back again, and the handler isn't called. Otherwise, once the handler is
+// done, its acknowledgement is stored, but only if it accepts the message
+// (AA or CA); messages that were rejected or failed are processed again if
+// they're sent again. Messages without a control ID are always passed on.
+//
+// If a copy of a message turns up while the first is still being handled,
+// it waits for the first to finish. If the store fails, the message is
+// passed on anyway, on the grounds that processing a message twice is better
+// than not processing it at all.
+func Middleware(s Store) hl7.Middleware {
+	var mu sync.Mutex
+	inflight := make(map[string]chan struct{})
+
+	return func(h hl7.Handler) hl7.Handler {
+		return hl7.HandlerFunc(func(ctx context.Context, m hl7.Message, d *hl7.Delimiters) (hl7.Message, error) {
+			key := Key(m)
+			if key == "" {
+				return h.ServeHL7(ctx, m, d)
+			}
+
+			ch := make(chan struct{})
+
+			for {
+				mu.Lock()
+				other, ok := inflight[key]
+				if !ok {
+					inflight[key] = ch
+				}
+				mu.Unlock()
+
+				if !ok {
+					break
+				}
+
+				select {
+				case <-other:
+				case <-ctx.Done():
+					return nil, stackerr.Wrap(ctx.Err())
+				}
+			}
+
+			defer func() {
+				mu.Lock()
+				delete(inflight, key)
+				mu.Unlock()
+				close(ch)
+			}()
+
+			if b, ok, err := s.Get(key); err == nil && ok {
+				if ack, _, err := hl7.ParseMessage(b); err == nil {
+					return ack, nil
+				}
+			}
+
+			ack, err := h.ServeHL7(ctx, m, d)
+			if err != nil {
+				return nil, err
+			}
+
+			if ack == nil {
+				ack = hl7.NewACK(m, d, hl7.AckAccept, "")
+			}
+
+			switch ack.Segment("MSA", 0).Value(1) {
+			case hl7.AckAccept, hl7.AckCommitAccept:
+				s.Put(key, hl7.EncodeMessage(ack, d))
+			}
+
+			return ack, nil
+		})
+	}
+}
@@ -0,0 +1,99 @@
+package dedup
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"fknsrs.biz/p/hl7"
+)
+
+func testMessage(a *assert.Assertions, app, id string) (hl7.Message, *hl7.Delimiters) {
+	m, d, err := hl7.ParseMessage([]byte("MSH|^~\\&|" + app + "|FAC|||20240102||ADT^A01|" + id + "|P|2.5\r"))
+	a.NoError(err)
+	return m, d
+}
+
+func TestKey(t *testing.T) {
+	a := assert.New(t)
+
+	m, _ := testMessage(a, "APP", "123")
+	a.Equal("APP|FAC|123", Key(m))
+
+	m, _ = testMessage(a, "APP", "")
+	a.Equal("", Key(m))
+}
+
+func TestMiddleware(t *testing.T) {
+	a := assert.New(t)
+
+	var calls int32
+	h := hl7.Chain(hl7.HandlerFunc(func(ctx context.Context, m hl7.Message, d *hl7.Delimiters) (hl7.Message, error) {
+		atomic.AddInt32(&calls, 1)
+
+		switch m.Segment("MSH", 0).Value(10) {
+		case "fail":
+			return nil, errors.New("failed")
+		case "reject":
+			return hl7.NewACK(m, d, hl7.AckReject, "rejected"), nil
+		}
+
+		return nil, nil
+	}), Middleware(NewMemoryStore(10, time.Hour)))
+
+	m, d := testMessage(a, "APP", "1")
+	ack1, err := h.ServeHL7(context.Background(), m, d)
+	a.NoError(err)
+	a.Equal("AA", ack1.Segment("MSA", 0).Value(1))
+
+	ack2, err := h.ServeHL7(context.Background(), m, d)
+	a.NoError(err)
+	a.Equal(ack1, ack2)
+	a.Equal(int32(1), atomic.LoadInt32(&calls))
+
+	m, d = testMessage(a, "OTHER", "1")
+	_, err = h.ServeHL7(context.Background(), m, d)
+	a.NoError(err)
+	a.Equal(int32(2), atomic.LoadInt32(&calls))
+
+	for _, id := range []string{"fail", "reject", ""} {
+		m, d = testMessage(a, "APP", id)
+		h.ServeHL7(context.Background(), m, d)
+		h.ServeHL7(context.Background(), m, d)
+	}
+	a.Equal(int32(8), atomic.LoadInt32(&calls))
+}
+
+func TestMiddlewareConcurrent(t *testing.T) {
+	a := assert.New(t)
+
+	var calls int32
+	h := hl7.Chain(hl7.HandlerFunc(func(ctx context.Context, m hl7.Message, d *hl7.Delimiters) (hl7.Message, error) {
+		atomic.AddInt32(&calls, 1)
+		time.Sleep(10 * time.Millisecond)
+		return nil, nil
+	}), Middleware(NewMemoryStore(10, time.Hour)))
+
+	m, d := testMessage(a, "APP", "1")
+
+	var wg sync.WaitGroup
+	acks := make([]hl7.Message, 5)
+	for i := range acks {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			acks[i], _ = h.ServeHL7(context.Background(), m, d)
+		}(i)
+	}
+	wg.Wait()
+
+	a.Equal(int32(1), atomic.LoadInt32(&calls))
+	for _, ack := range acks[1:] {
+		a.Equal(acks[0], ack)
+	}
+}
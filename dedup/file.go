@@ -0,0 +1,117 @@
+package dedup
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/facebookgo/stackerr"
+)
+
+// FileStore is a Store that keeps each acknowledgement in its own file in a
+// directory, so that they survive restarts. Files are named after a hash of
+// the key, and their modification time is used to expire them.
+type FileStore struct {
+	dir string
+	ttl time.Duration
+	now func() time.Time
+}
+
+// NewFileStore returns a FileStore that keeps acknowledgements in dir,
+// creating it if it doesn't exist, for at most ttl. If ttl is zero or less,
+// they don't expire.
+func NewFileStore(dir string, ttl time.Duration) (*FileStore, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, stackerr.Wrap(err)
+	}
+
+	return &FileStore{dir: dir, ttl: ttl, now: time.Now}, nil
+}
+
+func (s *FileStore) path(key string) string {
+	h := sha256.Sum256([]byte(key))
+	return filepath.Join(s.dir, hex.EncodeToString(h[:])+".ack")
+}
+
+// Get implements Store.
+func (s *FileStore) Get(key string) ([]byte, bool, error) {
+	p := s.path(key)
+
+	fi, err := os.Stat(p)
+	if os.IsNotExist(err) {
+		return nil, false, nil
+	} else if err != nil {
+		return nil, false, stackerr.Wrap(err)
+	}
+
+	if s.expired(fi) {
+		os.Remove(p)
+		return nil, false, nil
+	}
+
+	b, err := ioutil.ReadFile(p)
+	if os.IsNotExist(err) {
+		return nil, false, nil
+	} else if err != nil {
+		return nil, false, stackerr.Wrap(err)
+	}
+
+	return b, true, nil
+}
+
+// Put implements Store. The acknowledgement is written to a temporary file
+// first, then renamed, so that a half written file is never read.
+func (s *FileStore) Put(key string, ack []byte) error {
+	f, err := ioutil.TempFile(s.dir, ".tmp-")
+	if err != nil {
+		return stackerr.Wrap(err)
+	}
+
+	if _, err := f.Write(ack); err != nil {
+		f.Close()
+		os.Remove(f.Name())
+		return stackerr.Wrap(err)
+	}
+
+	if err := f.Close(); err != nil {
+		os.Remove(f.Name())
+		return stackerr.Wrap(err)
+	}
+
+	if err := os.Rename(f.Name(), s.path(key)); err != nil {
+		os.Remove(f.Name())
+		return stackerr.Wrap(err)
+	}
+
+	return nil
+}
+
+// Prune removes any acknowledgements that have expired. Get ignores expired
+// acknowledgements whether or not they've been pruned, so this only needs to
+// be called now and then to free up disk space.
+func (s *FileStore) Prune() error {
+	l, err := ioutil.ReadDir(s.dir)
+	if err != nil {
+		return stackerr.Wrap(err)
+	}
+
+	for _, fi := range l {
+		if !strings.HasSuffix(fi.Name(), ".ack") || !s.expired(fi) {
+			continue
+		}
+
+		if err := os.Remove(filepath.Join(s.dir, fi.Name())); err != nil && !os.IsNotExist(err) {
+			return stackerr.Wrap(err)
+		}
+	}
+
+	return nil
+}
+
+func (s *FileStore) expired(fi os.FileInfo) bool {
+	return s.ttl > 0 && s.now().Sub(fi.ModTime()) > s.ttl
+}
@@ -0,0 +1,56 @@
+package dedup
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFileStore(t *testing.T) {
+	a := assert.New(t)
+
+	dir, err := ioutil.TempDir("", "dedup")
+	if !a.NoError(err) {
+		return
+	}
+	defer os.RemoveAll(dir)
+
+	s, err := NewFileStore(filepath.Join(dir, "acks"), time.Hour)
+	if !a.NoError(err) {
+		return
+	}
+
+	_, ok, err := s.Get("a")
+	a.NoError(err)
+	a.False(ok)
+
+	a.NoError(s.Put("a", []byte("A")))
+	a.NoError(s.Put("b", []byte("B")))
+
+	// a new store in the same place sees the same acknowledgements
+	s, err = NewFileStore(filepath.Join(dir, "acks"), time.Hour)
+	if !a.NoError(err) {
+		return
+	}
+
+	b, ok, err := s.Get("a")
+	a.NoError(err)
+	a.True(ok)
+	a.Equal("A", string(b))
+
+	s.now = func() time.Time { return time.Now().Add(2 * time.Hour) }
+
+	_, ok, err = s.Get("a")
+	a.NoError(err)
+	a.False(ok)
+
+	a.NoError(s.Prune())
+
+	l, err := ioutil.ReadDir(filepath.Join(dir, "acks"))
+	a.NoError(err)
+	a.Len(l, 0)
+}
@@ -0,0 +1,93 @@
+package dedup
+
+import (
+	"container/list"
+	"sync"
+	"time"
+)
+
+// MemoryStore is a Store that keeps acknowledgements in memory, forgetting
+// the least recently used ones when it gets full, and any that are older
+// than its time to live.
+type MemoryStore struct {
+	size int
+	ttl  time.Duration
+	now  func() time.Time
+
+	mu    sync.Mutex
+	items map[string]*list.Element
+	order *list.List
+}
+
+type memoryEntry struct {
+	key  string
+	ack  []byte
+	time time.Time
+}
+
+// NewMemoryStore returns a MemoryStore that holds at most size
+// acknowledgements, each for at most ttl. If size is zero or less, there's
+// no limit on the number of acknowledgements; if ttl is zero or less, they
+// don't expire.
+func NewMemoryStore(size int, ttl time.Duration) *MemoryStore {
+	return &MemoryStore{
+		size:  size,
+		ttl:   ttl,
+		now:   time.Now,
+		items: make(map[string]*list.Element),
+		order: list.New(),
+	}
+}
+
+// Get implements Store.
+func (s *MemoryStore) Get(key string) ([]byte, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	el, ok := s.items[key]
+	if !ok {
+		return nil, false, nil
+	}
+
+	e := el.Value.(*memoryEntry)
+	if s.ttl > 0 && s.now().Sub(e.time) > s.ttl {
+		s.order.Remove(el)
+		delete(s.items, key)
+		return nil, false, nil
+	}
+
+	s.order.MoveToFront(el)
+
+	return e.ack, true, nil
+}
+
+// Put implements Store.
+func (s *MemoryStore) Put(key string, ack []byte) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if el, ok := s.items[key]; ok {
+		el.Value = &memoryEntry{key: key, ack: ack, time: s.now()}
+		s.order.MoveToFront(el)
+		return nil
+	}
+
+	s.items[key] = s.order.PushFront(&memoryEntry{key: key, ack: ack, time: s.now()})
+
+	for s.size > 0 && s.order.Len() > s.size {
+		el := s.order.Back()
+		s.order.Remove(el)
+		delete(s.items, el.Value.(*memoryEntry).key)
+	}
+
+	return nil
+}
+
+// Len returns the number of acknowledgements in the store, including any
+// that have expired but haven't been looked up since.
+func (s *MemoryStore) Len() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.order.Len()
+}
@@ -0,0 +1,42 @@
+package dedup
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMemoryStore(t *testing.T) {
+	a := assert.New(t)
+
+	now := time.Date(2024, time.January, 1, 0, 0, 0, 0, time.UTC)
+
+	s := NewMemoryStore(2, time.Minute)
+	s.now = func() time.Time { return now }
+
+	a.NoError(s.Put("a", []byte("A")))
+	a.NoError(s.Put("b", []byte("B")))
+
+	b, ok, err := s.Get("a")
+	a.NoError(err)
+	a.True(ok)
+	a.Equal("A", string(b))
+
+	// "b" is now the least recently used, so it goes
+	a.NoError(s.Put("c", []byte("C")))
+	a.Equal(2, s.Len())
+
+	_, ok, _ = s.Get("b")
+	a.False(ok)
+	_, ok, _ = s.Get("a")
+	a.True(ok)
+	_, ok, _ = s.Get("c")
+	a.True(ok)
+
+	now = now.Add(2 * time.Minute)
+
+	_, ok, _ = s.Get("a")
+	a.False(ok)
+	a.Equal(1, s.Len())
+}
@@ -0,0 +1,770 @@
+package hl7 // import "fknsrs.biz/p/hl7"
+
+// Definition describes one field of a segment, or one component of a data
+// type.
+type Definition struct {
+	Name string
+	Type string
+}
+
+// Dictionary holds names and data types for segment fields and data type
+// components. The slices are indexed from zero, so field n of a segment is
+// at `Segments[name][n-1]`.
+type Dictionary struct {
+	Segments  map[string][]Definition
+	DataTypes map[string][]Definition
+}
+
+// Field returns the definition of field n (numbered from one) of a segment.
+func (d *Dictionary) Field(segment string, n int) (Definition, bool) {
+	if d == nil {
+		return Definition{}, false
+	}
+
+	a := d.Segments[segment]
+	if n < 1 || n > len(a) {
+		return Definition{}, false
+	}
+
+	return a[n-1], true
+}
+
+// FieldByName returns the number of the field of a segment with the given
+// name, or zero if there's no such field.
+func (d *Dictionary) FieldByName(segment, name string) int {
+	if d == nil {
+		return 0
+	}
+
+	for i, f := range d.Segments[segment] {
+		if f.Name == name {
+			return i + 1
+		}
+	}
+
+	return 0
+}
+
+// Component returns the definition of component n (numbered from one) of a
+// data type.
+func (d *Dictionary) Component(dataType string, n int) (Definition, bool) {
+	if d == nil {
+		return Definition{}, false
+	}
+
+	a := d.DataTypes[dataType]
+	if n < 1 || n > len(a) {
+		return Definition{}, false
+	}
+
+	return a[n-1], true
+}
+
+// DefaultDictionary covers the common segments and data types, using the
+// names from version 2.5 of the standard. It's deliberately incomplete; if
+// you need more, build your own Dictionary (perhaps starting from a copy of
+// this one).
+var DefaultDictionary = &Dictionary{
+	Segments: map[string][]Definition{
+		"MSH": {
+			{"Field Separator", "ST"},
+			{"Encoding Characters", "ST"},
+			{"Sending Application", "HD"},
+			{"Sending Facility", "HD"},
+			{"Receiving Application", "HD"},
+			{"Receiving Facility", "HD"},
+			{"Date/Time Of Message", "TS"},
+			{"Security", "ST"},
+			{"Message Type", "MSG"},
+			{"Message Control ID", "ST"},
+			{"Processing ID", "PT"},
+			{"Version ID", "VID"},
+			{"Sequence Number", "NM"},
+			{"Continuation Pointer", "ST"},
+			{"Accept Acknowledgment Type", "ID"},
+			{"Application Acknowledgment Type", "ID"},
+			{"Country Code", "ID"},
+			{"Character Set", "ID"},
+			{"Principal Language Of Message", "CE"},
+			{"Alternate Character Set Handling Scheme", "ID"},
+			{"Message Profile Identifier", "EI"},
+		},
+		"MSA": {
+			{"Acknowledgment Code", "ID"},
+			{"Message Control ID", "ST"},
+			{"Text Message", "ST"},
+			{"Expected Sequence Number", "NM"},
+			{"Delayed Acknowledgment Type", "ID"},
+			{"Error Condition", "CE"},
+		},
+		"ERR": {
+			{"Error Code and Location", "ELD"},
+			{"Error Location", "ERL"},
+			{"HL7 Error Code", "CWE"},
+			{"Severity", "ID"},
+			{"Application Error Code", "CWE"},
+			{"Application Error Parameter", "ST"},
+			{"Diagnostic Information", "TX"},
+			{"User Message", "TX"},
+			{"Inform Person Indicator", "IS"},
+			{"Override Type", "CWE"},
+			{"Override Reason Code", "CWE"},
+			{"Help Desk Contact Point", "XTN"},
+		},
+		"EVN": {
+			{"Event Type Code", "ID"},
+			{"Recorded Date/Time", "TS"},
+			{"Date/Time Planned Event", "TS"},
+			{"Event Reason Code", "IS"},
+			{"Operator ID", "XCN"},
+			{"Event Occurred", "TS"},
+			{"Event Facility", "HD"},
+		},
+		"PID": {
+			{"Set ID - PID", "SI"},
+			{"Patient ID", "CX"},
+			{"Patient Identifier List", "CX"},
+			{"Alternate Patient ID - PID", "CX"},
+			{"Patient Name", "XPN"},
+			{"Mother's Maiden Name", "XPN"},
+			{"Date/Time of Birth", "TS"},
+			{"Administrative Sex", "IS"},
+			{"Patient Alias", "XPN"},
+			{"Race", "CE"},
+			{"Patient Address", "XAD"},
+			{"County Code", "IS"},
+			{"Phone Number - Home", "XTN"},
+			{"Phone Number - Business", "XTN"},
+			{"Primary Language", "CE"},
+			{"Marital Status", "CE"},
+			{"Religion", "CE"},
+			{"Patient Account Number", "CX"},
+			{"SSN Number - Patient", "ST"},
+			{"Driver's License Number - Patient", "DLN"},
+			{"Mother's Identifier", "CX"},
+			{"Ethnic Group", "CE"},
+			{"Birth Place", "ST"},
+			{"Multiple Birth Indicator", "ID"},
+			{"Birth Order", "NM"},
+			{"Citizenship", "CE"},
+			{"Veterans Military Status", "CE"},
+			{"Nationality", "CE"},
+			{"Patient Death Date and Time", "TS"},
+			{"Patient Death Indicator", "ID"},
+			{"Identity Unknown Indicator", "ID"},
+			{"Identity Reliability Code", "IS"},
+			{"Last Update Date/Time", "TS"},
+			{"Last Update Facility", "HD"},
+			{"Species Code", "CE"},
+			{"Breed Code", "CE"},
+			{"Strain", "ST"},
+			{"Production Class Code", "CE"},
+			{"Tribal Citizenship", "CWE"},
+		},
+		"NK1": {
+			{"Set ID - NK1", "SI"},
+			{"Name", "XPN"},
+			{"Relationship", "CE"},
+			{"Address", "XAD"},
+			{"Phone Number", "XTN"},
+			{"Business Phone Number", "XTN"},
+			{"Contact Role", "CE"},
+			{"Start Date", "DT"},
+			{"End Date", "DT"},
+			{"Next of Kin / Associated Parties Job Title", "ST"},
+			{"Next of Kin / Associated Parties Job Code/Class", "JCC"},
+			{"Next of Kin / Associated Parties Employee Number", "CX"},
+			{"Organization Name - NK1", "XON"},
+			{"Marital Status", "CE"},
+			{"Administrative Sex", "IS"},
+			{"Date/Time of Birth", "TS"},
+			{"Living Dependency", "IS"},
+			{"Ambulatory Status", "IS"},
+			{"Citizenship", "CE"},
+			{"Primary Language", "CE"},
+			{"Living Arrangement", "IS"},
+			{"Publicity Code", "CE"},
+			{"Protection Indicator", "ID"},
+			{"Student Indicator", "IS"},
+			{"Religion", "CE"},
+			{"Mother's Maiden Name", "XPN"},
+			{"Nationality", "CE"},
+			{"Ethnic Group", "CE"},
+			{"Contact Reason", "CE"},
+			{"Contact Person's Name", "XPN"},
+			{"Contact Person's Telephone Number", "XTN"},
+			{"Contact Person's Address", "XAD"},
+			{"Next of Kin/Associated Party's Identifiers", "CX"},
+			{"Job Status", "IS"},
+			{"Race", "CE"},
+			{"Handicap", "IS"},
+			{"Contact Person Social Security Number", "ST"},
+			{"Next of Kin Birth Place", "ST"},
+			{"VIP Indicator", "IS"},
+		},
+		"PV1": {
+			{"Set ID - PV1", "SI"},
+			{"Patient Class", "IS"},
+			{"Assigned Patient Location", "PL"},
+			{"Admission Type", "IS"},
+			{"Preadmit Number", "CX"},
+			{"Prior Patient Location", "PL"},
+			{"Attending Doctor", "XCN"},
+			{"Referring Doctor", "XCN"},
+			{"Consulting Doctor", "XCN"},
+			{"Hospital Service", "IS"},
+			{"Temporary Location", "PL"},
+			{"Preadmit Test Indicator", "IS"},
+			{"Re-admission Indicator", "IS"},
+			{"Admit Source", "IS"},
+			{"Ambulatory Status", "IS"},
+			{"VIP Indicator", "IS"},
+			{"Admitting Doctor", "XCN"},
+			{"Patient Type", "IS"},
+			{"Visit Number", "CX"},
+			{"Financial Class", "FC"},
+			{"Charge Price Indicator", "IS"},
+			{"Courtesy Code", "IS"},
+			{"Credit Rating", "IS"},
+			{"Contract Code", "IS"},
+			{"Contract Effective Date", "DT"},
+			{"Contract Amount", "NM"},
+			{"Contract Period", "NM"},
+			{"Interest Code", "IS"},
+			{"Transfer to Bad Debt Code", "IS"},
+			{"Transfer to Bad Debt Date", "DT"},
+			{"Bad Debt Agency Code", "IS"},
+			{"Bad Debt Transfer Amount", "NM"},
+			{"Bad Debt Recovery Amount", "NM"},
+			{"Delete Account Indicator", "IS"},
+			{"Delete Account Date", "DT"},
+			{"Discharge Disposition", "IS"},
+			{"Discharged to Location", "DLD"},
+			{"Diet Type", "CE"},
+			{"Servicing Facility", "IS"},
+			{"Bed Status", "IS"},
+			{"Account Status", "IS"},
+			{"Pending Location", "PL"},
+			{"Prior Temporary Location", "PL"},
+			{"Admit Date/Time", "TS"},
+			{"Discharge Date/Time", "TS"},
+			{"Current Patient Balance", "NM"},
+			{"Total Charges", "NM"},
+			{"Total Adjustments", "NM"},
+			{"Total Payments", "NM"},
+			{"Alternate Visit ID", "CX"},
+			{"Visit Indicator", "IS"},
+			{"Other Healthcare Provider", "XCN"},
+		},
+		"PV2": {
+			{"Prior Pending Location", "PL"},
+			{"Accommodation Code", "CE"},
+			{"Admit Reason", "CE"},
+			{"Transfer Reason", "CE"},
+			{"Patient Valuables", "ST"},
+			{"Patient Valuables Location", "ST"},
+			{"Visit User Code", "IS"},
+			{"Expected Admit Date/Time", "TS"},
+			{"Expected Discharge Date/Time", "TS"},
+			{"Estimated Length of Inpatient Stay", "NM"},
+			{"Actual Length of Inpatient Stay", "NM"},
+			{"Visit Description", "ST"},
+			{"Referral Source Code", "XCN"},
+			{"Previous Service Date", "DT"},
+			{"Employment Illness Related Indicator", "ID"},
+			{"Purge Status Code", "IS"},
+			{"Purge Status Date", "DT"},
+			{"Special Program Code", "IS"},
+			{"Retention Indicator", "ID"},
+			{"Expected Number of Insurance Plans", "NM"},
+			{"Visit Publicity Code", "IS"},
+			{"Visit Protection Indicator", "ID"},
+			{"Clinic Organization Name", "XON"},
+			{"Patient Status Code", "IS"},
+			{"Visit Priority Code", "IS"},
+			{"Previous Treatment Date", "DT"},
+			{"Expected Discharge Disposition", "IS"},
+			{"Signature on File Date", "DT"},
+			{"First Similar Illness Date", "DT"},
+			{"Patient Charge Adjustment Code", "CE"},
+			{"Recurring Service Code", "IS"},
+			{"Billing Media Code", "ID"},
+			{"Expected Surgery Date and Time", "TS"},
+			{"Military Partnership Code", "ID"},
+			{"Military Non-Availability Code", "ID"},
+			{"Newborn Baby Indicator", "ID"},
+			{"Baby Detained Indicator", "ID"},
+			{"Mode of Arrival Code", "CE"},
+			{"Recreational Drug Use Code", "CE"},
+			{"Admission Level of Care Code", "CE"},
+			{"Precaution Code", "CE"},
+			{"Patient Condition Code", "CE"},
+			{"Living Will Code", "IS"},
+			{"Organ Donor Code", "IS"},
+			{"Advance Directive Code", "CE"},
+			{"Patient Status Effective Date", "DT"},
+			{"Expected LOA Return Date/Time", "TS"},
+			{"Expected Pre-admission Testing Date/Time", "TS"},
+			{"Notify Clergy Code", "IS"},
+		},
+		"AL1": {
+			{"Set ID - AL1", "SI"},
+			{"Allergen Type Code", "CE"},
+			{"Allergen Code/Mnemonic/Description", "CE"},
+			{"Allergy Severity Code", "CE"},
+			{"Allergy Reaction Code", "ST"},
+			{"Identification Date", "DT"},
+		},
+		"DG1": {
+			{"Set ID - DG1", "SI"},
+			{"Diagnosis Coding Method", "ID"},
+			{"Diagnosis Code - DG1", "CE"},
+			{"Diagnosis Description", "ST"},
+			{"Diagnosis Date/Time", "TS"},
+			{"Diagnosis Type", "IS"},
+			{"Major Diagnostic Category", "CE"},
+			{"Diagnostic Related Group", "CE"},
+			{"DRG Approval Indicator", "ID"},
+			{"DRG Grouper Review Code", "IS"},
+			{"Outlier Type", "CE"},
+			{"Outlier Days", "NM"},
+			{"Outlier Cost", "CP"},
+			{"Grouper Version And Type", "ST"},
+			{"Diagnosis Priority", "ID"},
+			{"Diagnosing Clinician", "XCN"},
+			{"Diagnosis Classification", "IS"},
+			{"Confidential Indicator", "ID"},
+			{"Attestation Date/Time", "TS"},
+			{"Diagnosis Identifier", "EI"},
+			{"Diagnosis Action Code", "ID"},
+		},
+		"MRG": {
+			{"Prior Patient Identifier List", "CX"},
+			{"Prior Alternate Patient ID", "CX"},
+			{"Prior Patient Account Number", "CX"},
+			{"Prior Patient ID", "CX"},
+			{"Prior Visit Number", "CX"},
+			{"Prior Alternate Visit ID", "CX"},
+			{"Prior Patient Name", "XPN"},
+		},
+		"IN1": {
+			{"Set ID - IN1", "SI"},
+			{"Insurance Plan ID", "CE"},
+			{"Insurance Company ID", "CX"},
+			{"Insurance Company Name", "XON"},
+			{"Insurance Company Address", "XAD"},
+			{"Insurance Co Contact Person", "XPN"},
+			{"Insurance Co Phone Number", "XTN"},
+			{"Group Number", "ST"},
+			{"Group Name", "XON"},
+			{"Insured's Group Emp ID", "CX"},
+			{"Insured's Group Emp Name", "XON"},
+			{"Plan Effective Date", "DT"},
+			{"Plan Expiration Date", "DT"},
+			{"Authorization Information", "AUI"},
+			{"Plan Type", "IS"},
+			{"Name Of Insured", "XPN"},
+			{"Insured's Relationship To Patient", "CE"},
+			{"Insured's Date Of Birth", "TS"},
+			{"Insured's Address", "XAD"},
+			{"Assignment Of Benefits", "IS"},
+			{"Coordination Of Benefits", "IS"},
+			{"Coord Of Ben. Priority", "ST"},
+			{"Notice Of Admission Flag", "ID"},
+			{"Notice Of Admission Date", "DT"},
+			{"Report Of Eligibility Flag", "ID"},
+			{"Report Of Eligibility Date", "DT"},
+			{"Release Information Code", "IS"},
+			{"Pre-Admit Cert (PAC)", "ST"},
+			{"Verification Date/Time", "TS"},
+			{"Verification By", "XCN"},
+			{"Type Of Agreement Code", "IS"},
+			{"Billing Status", "IS"},
+			{"Lifetime Reserve Days", "NM"},
+			{"Delay Before L.R. Day", "NM"},
+			{"Company Plan Code", "IS"},
+			{"Policy Number", "ST"},
+			{"Policy Deductible", "CP"},
+			{"Policy Limit - Amount", "CP"},
+			{"Policy Limit - Days", "NM"},
+			{"Room Rate - Semi-Private", "CP"},
+			{"Room Rate - Private", "CP"},
+			{"Insured's Employment Status", "CE"},
+			{"Insured's Administrative Sex", "IS"},
+			{"Insured's Employer's Address", "XAD"},
+			{"Verification Status", "ST"},
+			{"Prior Insurance Plan ID", "IS"},
+			{"Coverage Type", "IS"},
+			{"Handicap", "IS"},
+			{"Insured's ID Number", "CX"},
+			{"Signature Code", "IS"},
+			{"Signature Code Date", "DT"},
+			{"Insured's Birth Place", "ST"},
+			{"VIP Indicator", "IS"},
+		},
+		"ORC": {
+			{"Order Control", "ID"},
+			{"Placer Order Number", "EI"},
+			{"Filler Order Number", "EI"},
+			{"Placer Group Number", "EI"},
+			{"Order Status", "ID"},
+			{"Response Flag", "ID"},
+			{"Quantity/Timing", "TQ"},
+			{"Parent", "EIP"},
+			{"Date/Time of Transaction", "TS"},
+			{"Entered By", "XCN"},
+			{"Verified By", "XCN"},
+			{"Ordering Provider", "XCN"},
+			{"Enterer's Location", "PL"},
+			{"Call Back Phone Number", "XTN"},
+			{"Order Effective Date/Time", "TS"},
+			{"Order Control Code Reason", "CE"},
+			{"Entering Organization", "CE"},
+			{"Entering Device", "CE"},
+			{"Action By", "XCN"},
+			{"Advanced Beneficiary Notice Code", "CE"},
+			{"Ordering Facility Name", "XON"},
+			{"Ordering Facility Address", "XAD"},
+			{"Ordering Facility Phone Number", "XTN"},
+			{"Ordering Provider Address", "XAD"},
+			{"Order Status Modifier", "CWE"},
+			{"Advanced Beneficiary Notice Override Reason", "CWE"},
+			{"Filler's Expected Availability Date/Time", "TS"},
+			{"Confidentiality Code", "CWE"},
+			{"Order Type", "CWE"},
+			{"Enterer Authorization Mode", "CNE"},
+			{"Parent Universal Service Identifier", "CWE"},
+		},
+		"OBR": {
+			{"Set ID - OBR", "SI"},
+			{"Placer Order Number", "EI"},
+			{"Filler Order Number", "EI"},
+			{"Universal Service Identifier", "CE"},
+			{"Priority - OBR", "ID"},
+			{"Requested Date/Time", "TS"},
+			{"Observation Date/Time", "TS"},
+			{"Observation End Date/Time", "TS"},
+			{"Collection Volume", "CQ"},
+			{"Collector Identifier", "XCN"},
+			{"Specimen Action Code", "ID"},
+			{"Danger Code", "CE"},
+			{"Relevant Clinical Information", "ST"},
+			{"Specimen Received Date/Time", "TS"},
+			{"Specimen Source", "SPS"},
+			{"Ordering Provider", "XCN"},
+			{"Order Callback Phone Number", "XTN"},
+			{"Placer Field 1", "ST"},
+			{"Placer Field 2", "ST"},
+			{"Filler Field 1", "ST"},
+			{"Filler Field 2", "ST"},
+			{"Results Rpt/Status Chng - Date/Time", "TS"},
+			{"Charge to Practice", "MOC"},
+			{"Diagnostic Serv Sect ID", "ID"},
+			{"Result Status", "ID"},
+			{"Parent Result", "PRL"},
+			{"Quantity/Timing", "TQ"},
+			{"Result Copies To", "XCN"},
+			{"Parent", "EIP"},
+			{"Transportation Mode", "ID"},
+			{"Reason for Study", "CE"},
+			{"Principal Result Interpreter", "NDL"},
+			{"Assistant Result Interpreter", "NDL"},
+			{"Technician", "NDL"},
+			{"Transcriptionist", "NDL"},
+			{"Scheduled Date/Time", "TS"},
+			{"Number of Sample Containers", "NM"},
+			{"Transport Logistics of Collected Sample", "CE"},
+			{"Collector's Comment", "CE"},
+			{"Transport Arrangement Responsibility", "CE"},
+			{"Transport Arranged", "ID"},
+			{"Escort Required", "ID"},
+			{"Planned Patient Transport Comment", "CE"},
+			{"Procedure Code", "CE"},
+			{"Procedure Code Modifier", "CE"},
+			{"Placer Supplemental Service Information", "CE"},
+			{"Filler Supplemental Service Information", "CE"},
+			{"Medically Necessary Duplicate Procedure Reason", "CWE"},
+			{"Result Handling", "IS"},
+			{"Parent Universal Service Identifier", "CWE"},
+		},
+		"OBX": {
+			{"Set ID - OBX", "SI"},
+			{"Value Type", "ID"},
+			{"Observation Identifier", "CE"},
+			{"Observation Sub-ID", "ST"},
+			{"Observation Value", "varies"},
+			{"Units", "CE"},
+			{"References Range", "ST"},
+			{"Abnormal Flags", "IS"},
+			{"Probability", "NM"},
+			{"Nature of Abnormal Test", "ID"},
+			{"Observation Result Status", "ID"},
+			{"Effective Date of Reference Range", "TS"},
+			{"User Defined Access Checks", "ST"},
+			{"Date/Time of the Observation", "TS"},
+			{"Producer's ID", "CE"},
+			{"Responsible Observer", "XCN"},
+			{"Observation Method", "CE"},
+			{"Equipment Instance Identifier", "EI"},
+			{"Date/Time of the Analysis", "TS"},
+		},
+		"NTE": {
+			{"Set ID - NTE", "SI"},
+			{"Source of Comment", "ID"},
+			{"Comment", "FT"},
+			{"Comment Type", "CE"},
+		},
+		"SPM": {
+			{"Set ID - SPM", "SI"},
+			{"Specimen ID", "EIP"},
+			{"Specimen Parent IDs", "EIP"},
+			{"Specimen Type", "CWE"},
+			{"Specimen Type Modifier", "CWE"},
+			{"Specimen Additives", "CWE"},
+			{"Specimen Collection Method", "CWE"},
+			{"Specimen Source Site", "CWE"},
+			{"Specimen Source Site Modifier", "CWE"},
+			{"Specimen Collection Site", "CWE"},
+			{"Specimen Role", "CWE"},
+			{"Specimen Collection Amount", "CQ"},
+			{"Grouped Specimen Count", "NM"},
+			{"Specimen Description", "ST"},
+			{"Specimen Handling Code", "CWE"},
+			{"Specimen Risk Code", "CWE"},
+			{"Specimen Collection Date/Time", "DR"},
+			{"Specimen Received Date/Time", "TS"},
+			{"Specimen Expiration Date/Time", "TS"},
+			{"Specimen Availability", "ID"},
+			{"Specimen Reject Reason", "CWE"},
+			{"Specimen Quality", "CWE"},
+			{"Specimen Appropriateness", "CWE"},
+			{"Specimen Condition", "CWE"},
+			{"Specimen Current Quantity", "CQ"},
+			{"Number of Specimen Containers", "NM"},
+			{"Container Type", "CWE"},
+			{"Container Condition", "CWE"},
+			{"Specimen Child Role", "CWE"},
+		},
+	},
+	DataTypes: map[string][]Definition{
+		"CE": {
+			{"Identifier", "ST"},
+			{"Text", "ST"},
+			{"Name of Coding System", "ID"},
+			{"Alternate Identifier", "ST"},
+			{"Alternate Text", "ST"},
+			{"Name of Alternate Coding System", "ID"},
+		},
+		"CNE": {
+			{"Identifier", "ST"},
+			{"Text", "ST"},
+			{"Name of Coding System", "ID"},
+			{"Alternate Identifier", "ST"},
+			{"Alternate Text", "ST"},
+			{"Name of Alternate Coding System", "ID"},
+			{"Coding System Version ID", "ST"},
+			{"Alternate Coding System Version ID", "ST"},
+			{"Original Text", "ST"},
+		},
+		"CQ": {
+			{"Quantity", "NM"},
+			{"Units", "CE"},
+		},
+		"CWE": {
+			{"Identifier", "ST"},
+			{"Text", "ST"},
+			{"Name of Coding System", "ID"},
+			{"Alternate Identifier", "ST"},
+			{"Alternate Text", "ST"},
+			{"Name of Alternate Coding System", "ID"},
+			{"Coding System Version ID", "ST"},
+			{"Alternate Coding System Version ID", "ST"},
+			{"Original Text", "ST"},
+		},
+		"CX": {
+			{"ID Number", "ST"},
+			{"Check Digit", "ST"},
+			{"Check Digit Scheme", "ID"},
+			{"Assigning Authority", "HD"},
+			{"Identifier Type Code", "ID"},
+			{"Assigning Facility", "HD"},
+			{"Effective Date", "DT"},
+			{"Expiration Date", "DT"},
+			{"Assigning Jurisdiction", "CWE"},
+			{"Assigning Agency or Department", "CWE"},
+		},
+		"DLN": {
+			{"License Number", "ST"},
+			{"Issuing State, Province, Country", "IS"},
+			{"Expiration Date", "DT"},
+		},
+		"DR": {
+			{"Range Start Date/Time", "TS"},
+			{"Range End Date/Time", "TS"},
+		},
+		"ED": {
+			{"Source Application", "HD"},
+			{"Type of Data", "ID"},
+			{"Data Subtype", "ID"},
+			{"Encoding", "ID"},
+			{"Data", "ST"},
+		},
+		"EI": {
+			{"Entity Identifier", "ST"},
+			{"Namespace ID", "IS"},
+			{"Universal ID", "ST"},
+			{"Universal ID Type", "ID"},
+		},
+		"EIP": {
+			{"Placer Assigned Identifier", "EI"},
+			{"Filler Assigned Identifier", "EI"},
+		},
+		"FC": {
+			{"Financial Class Code", "IS"},
+			{"Effective Date", "TS"},
+		},
+		"FN": {
+			{"Surname", "ST"},
+			{"Own Surname Prefix", "ST"},
+			{"Own Surname", "ST"},
+			{"Surname Prefix From Partner/Spouse", "ST"},
+			{"Surname From Partner/Spouse", "ST"},
+		},
+		"HD": {
+			{"Namespace ID", "IS"},
+			{"Universal ID", "ST"},
+			{"Universal ID Type", "ID"},
+		},
+		"MSG": {
+			{"Message Code", "ID"},
+			{"Trigger Event", "ID"},
+			{"Message Structure", "ID"},
+		},
+		"PL": {
+			{"Point of Care", "IS"},
+			{"Room", "IS"},
+			{"Bed", "IS"},
+			{"Facility", "HD"},
+			{"Location Status", "IS"},
+			{"Person Location Type", "IS"},
+			{"Building", "IS"},
+			{"Floor", "IS"},
+			{"Location Description", "ST"},
+			{"Comprehensive Location Identifier", "EI"},
+			{"Assigning Authority for Location", "HD"},
+		},
+		"PT": {
+			{"Processing ID", "ID"},
+			{"Processing Mode", "ID"},
+		},
+		"RP": {
+			{"Pointer", "ST"},
+			{"Application ID", "HD"},
+			{"Type of Data", "ID"},
+			{"Subtype", "ID"},
+		},
+		"SAD": {
+			{"Street or Mailing Address", "ST"},
+			{"Street Name", "ST"},
+			{"Dwelling Number", "ST"},
+		},
+		"SN": {
+			{"Comparator", "ST"},
+			{"Num1", "NM"},
+			{"Separator/Suffix", "ST"},
+			{"Num2", "NM"},
+		},
+		"TS": {
+			{"Time", "DTM"},
+			{"Degree of Precision", "ID"},
+		},
+		"VID": {
+			{"Version ID", "ID"},
+			{"Internationalization Code", "CE"},
+			{"International Version ID", "CE"},
+		},
+		"XAD": {
+			{"Street Address", "SAD"},
+			{"Other Designation", "ST"},
+			{"City", "ST"},
+			{"State or Province", "ST"},
+			{"Zip or Postal Code", "ST"},
+			{"Country", "ID"},
+			{"Address Type", "ID"},
+			{"Other Geographic Designation", "ST"},
+			{"County/Parish Code", "IS"},
+			{"Census Tract", "IS"},
+			{"Address Representation Code", "ID"},
+			{"Address Validity Range", "DR"},
+			{"Effective Date", "TS"},
+			{"Expiration Date", "TS"},
+		},
+		"XCN": {
+			{"ID Number", "ST"},
+			{"Family Name", "FN"},
+			{"Given Name", "ST"},
+			{"Second and Further Given Names or Initials Thereof", "ST"},
+			{"Suffix", "ST"},
+			{"Prefix", "ST"},
+			{"Degree", "IS"},
+			{"Source Table", "IS"},
+			{"Assigning Authority", "HD"},
+			{"Name Type Code", "ID"},
+			{"Identifier Check Digit", "ST"},
+			{"Check Digit Scheme", "ID"},
+			{"Identifier Type Code", "ID"},
+			{"Assigning Facility", "HD"},
+			{"Name Representation Code", "ID"},
+			{"Name Context", "CE"},
+			{"Name Validity Range", "DR"},
+			{"Name Assembly Order", "ID"},
+			{"Effective Date", "TS"},
+			{"Expiration Date", "TS"},
+			{"Professional Suffix", "ST"},
+			{"Assigning Jurisdiction", "CWE"},
+			{"Assigning Agency or Department", "CWE"},
+		},
+		"XON": {
+			{"Organization Name", "ST"},
+			{"Organization Name Type Code", "IS"},
+			{"ID Number", "NM"},
+			{"Check Digit", "NM"},
+			{"Check Digit Scheme", "ID"},
+			{"Assigning Authority", "HD"},
+			{"Identifier Type Code", "ID"},
+			{"Assigning Facility", "HD"},
+			{"Name Representation Code", "ID"},
+			{"Organization Identifier", "ST"},
+		},
+		"XPN": {
+			{"Family Name", "FN"},
+			{"Given Name", "ST"},
+			{"Second and Further Given Names or Initials Thereof", "ST"},
+			{"Suffix", "ST"},
+			{"Prefix", "ST"},
+			{"Degree", "IS"},
+			{"Name Type Code", "ID"},
+			{"Name Representation Code", "ID"},
+			{"Name Context", "CE"},
+			{"Name Validity Range", "DR"},
+			{"Name Assembly Order", "ID"},
+			{"Effective Date", "TS"},
+			{"Expiration Date", "TS"},
+			{"Professional Suffix", "ST"},
+		},
+		"XTN": {
+			{"Telephone Number", "ST"},
+			{"Telecommunication Use Code", "ID"},
+			{"Telecommunication Equipment Type", "ID"},
+			{"Email Address", "ST"},
+			{"Country Code", "NM"},
+			{"Area/City Code", "NM"},
+			{"Local Number", "NM"},
+			{"Extension", "NM"},
+			{"Any Text", "ST"},
+			{"Extension Prefix", "ST"},
+			{"Speed Dial Code", "ST"},
+			{"Unformatted Telephone number", "ST"},
+		},
+	},
+}
@@ -0,0 +1,327 @@
+package hl7 // import "fknsrs.biz/p/hl7"
+
+import (
+	"bytes"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// ChangeType says what kind of difference a Change describes.
+type ChangeType string
+
+// These are the kinds of Change.
+const (
+	SegmentAdded   ChangeType = "added"
+	SegmentRemoved ChangeType = "removed"
+	ValueChanged   ChangeType = "changed"
+)
+
+// Change is one difference between two messages.
+type Change struct {
+	Type ChangeType
+	// Path is the query path of what changed. For added and removed
+	// segments it's just the segment (e.g. "OBX(3)"), and for changed values
+	// it goes as deep as it needs to (e.g. "PID-5-1" or "PID-3(2)-4-2").
+	// Segments are numbered as they are in the first message, except for
+	// added segments, which are numbered as they are in the second.
+	Path string
+	// Key is the key the segment was lined up by, if there was one (see
+	// DiffOptions.Keys), along with its path, like "OBX-3=2093-3".
+	Key string
+	// Old and New are the values before and after. For added and removed
+	// segments they're the whole segment, encoded with the default
+	// delimiters.
+	Old, New string
+}
+
+// String describes the change on one line, like "~ PID-5-1: Smith -> Smyth".
+func (c Change) String() string {
+	path := c.Path
+	if c.Key != "" {
+		path += " [" + c.Key + "]"
+	}
+
+	switch c.Type {
+	case SegmentAdded:
+		return "+ " + path + ": " + c.New
+	case SegmentRemoved:
+		return "- " + path + ": " + c.Old
+	default:
+		return fmt.Sprintf("~ %s: %q -> %q", path, c.Old, c.New)
+	}
+}
+
+// VolatileFields are the fields that are different in every message, even
+// if nothing else is: the timestamp and the control ID.
+var VolatileFields = []string{"MSH-7", "MSH-10"}
+
+// DiffOptions controls how messages are compared.
+type DiffOptions struct {
+	// Ignore lists query paths to leave out of the comparison, like those
+	// in VolatileFields. Ignoring a field (e.g. "OBX-14") ignores all of its
+	// components, in every segment with that name unless the path picks out
+	// a particular one (e.g. "OBX(2)-14").
+	Ignore []string
+	// Keys maps segment names to the query that identifies each segment
+	// with that name, like {"OBX": "OBX-3"}. Segments with keys are lined up
+	// by matching keys instead of by position, so that a result that moves
+	// is reported as having moved rather than as changes to every result in
+	// between.
+	Keys map[string]string
+}
+
+// Diff compares two messages with the default options, lining segments up by
+// position and comparing every value.
+func Diff(a, b Message) []Change {
+	return DiffOptions{}.Diff(a, b)
+}
+
+// Diff compares two messages. Segments in a are lined up with segments of the
+// same name in b, and then compared value by value. The changes come out in
+// the order of the segments in a, with added segments slotted in where they
+// are in b.
+func (o DiffOptions) Diff(a, b Message) []Change {
+	pairs := o.align(a, b)
+
+	var changes []Change
+
+	added := 0
+	emitAdded := func(before int) {
+		for ; added < len(b) && added < before; added++ {
+			if p := pairs.b[added]; p.a == -1 {
+				changes = append(changes, Change{
+					Type: SegmentAdded,
+					Path: p.bpath,
+					Key:  p.key,
+					New:  encodeSegment(b[added]),
+				})
+			}
+		}
+	}
+
+	for i := range a {
+		p := pairs.a[i]
+
+		if p.b == -1 {
+			changes = append(changes, Change{
+				Type: SegmentRemoved,
+				Path: p.apath,
+				Key:  p.key,
+				Old:  encodeSegment(a[i]),
+			})
+			continue
+		}
+
+		emitAdded(p.b)
+
+		for _, c := range o.diffSegment(p.apath, a[i], b[p.b]) {
+			c.Key = p.key
+			changes = append(changes, c)
+		}
+	}
+
+	emitAdded(len(b))
+
+	return changes
+}
+
+// FormatDiff describes a list of changes, one per line.
+func FormatDiff(changes []Change) string {
+	var buf bytes.Buffer
+
+	for _, c := range changes {
+		buf.WriteString(c.String())
+		buf.WriteString("\n")
+	}
+
+	return buf.String()
+}
+
+type segmentPair struct {
+	a, b         int
+	apath, bpath string
+	key          string
+}
+
+type alignment struct {
+	a, b []*segmentPair
+}
+
+func (o DiffOptions) align(a, b Message) alignment {
+	r := alignment{a: make([]*segmentPair, len(a)), b: make([]*segmentPair, len(b))}
+
+	occurrences := func(m Message) map[string][]int {
+		x := make(map[string][]int)
+		for i, s := range m {
+			x[s.Name()] = append(x[s.Name()], i)
+		}
+		return x
+	}
+
+	ao, bo := occurrences(a), occurrences(b)
+
+	for i, s := range a {
+		if r.a[i] != nil {
+			continue
+		}
+
+		name := s.Name()
+		as, bs := ao[name], bo[name]
+
+		var q *Query
+		if k, ok := o.Keys[name]; ok {
+			q, _ = ParseQuery(k)
+		}
+
+		used := make([]bool, len(bs))
+
+		for an, ai := range as {
+			p := &segmentPair{a: ai, b: -1, apath: segmentPath(name, an)}
+
+			if q != nil {
+				p.key = segmentKey(q, a[ai])
+
+				for bn, bi := range bs {
+					if !used[bn] && segmentKey(q, b[bi]) == p.key {
+						p.b, p.bpath = bi, segmentPath(name, bn)
+						used[bn] = true
+						break
+					}
+				}
+			} else if an < len(bs) {
+				p.b, p.bpath = bs[an], segmentPath(name, an)
+				used[an] = true
+			}
+
+			r.a[ai] = p
+			if p.b != -1 {
+				r.b[p.b] = p
+			}
+		}
+
+		for bn, bi := range bs {
+			if !used[bn] {
+				p := &segmentPair{a: -1, b: bi, bpath: segmentPath(name, bn)}
+				if q != nil {
+					p.key = segmentKey(q, b[bi])
+				}
+				r.b[bi] = p
+			}
+		}
+	}
+
+	for i, s := range b {
+		if r.b[i] == nil {
+			r.b[i] = &segmentPair{a: -1, b: i, bpath: segmentPath(s.Name(), indexOf(bo[s.Name()], i))}
+		}
+	}
+
+	return r
+}
+
+// segmentKey returns the key of a segment, with the key's query path in front, like
+// "OBX-3=2093-3".
+func segmentKey(q *Query, s Segment) string {
+	c := *q
+	c.Segment, c.SegmentOffset, c.HasSegmentOffset = s.Name(), 0, false
+
+	return c.String() + "=" + c.GetString(Message{s})
+}
+
+func indexOf(a []int, v int) int {
+	for i, x := range a {
+		if x == v {
+			return i
+		}
+	}
+
+	return -1
+}
+
+func segmentPath(name string, n int) string {
+	if n == 0 {
+		return name
+	}
+
+	return name + "(" + strconv.Itoa(n+1) + ")"
+}
+
+func (o DiffOptions) diffSegment(path string, a, b Segment) []Change {
+	var changes []Change
+
+	add := func(path, x, y string) {
+		if x != y && !o.ignored(path) {
+			changes = append(changes, Change{Type: ValueChanged, Path: path, Old: x, New: y})
+		}
+	}
+
+	first := 1
+	if a.Name() == "MSH" {
+		first = 3
+	}
+
+	for n := first; n < len(a) || n < len(b); n++ {
+		fa, fb := a.Field(n), b.Field(n)
+		fpath := path + "-" + strconv.Itoa(n)
+
+		if o.ignored(fpath) {
+			continue
+		}
+
+		for i := 0; i < len(fa) || i < len(fb); i++ {
+			ia, ib := fa.item(i), fb.item(i)
+			ipath := fpath
+			if i > 0 {
+				ipath += "(" + strconv.Itoa(i+1) + ")"
+			}
+
+			if len(ia) <= 1 && len(ib) <= 1 && len(ia.component(1)) <= 1 && len(ib.component(1)) <= 1 {
+				add(ipath, ia.get(1), ib.get(1))
+				continue
+			}
+
+			for j := 1; j <= len(ia) || j <= len(ib); j++ {
+				ca, cb := ia.component(j), ib.component(j)
+				cpath := ipath + "-" + strconv.Itoa(j)
+
+				if len(ca) <= 1 && len(cb) <= 1 {
+					add(cpath, ca.get(1), cb.get(1))
+					continue
+				}
+
+				for x := 1; x <= len(ca) || x <= len(cb); x++ {
+					add(cpath+"-"+strconv.Itoa(x), ca.get(x), cb.get(x))
+				}
+			}
+		}
+	}
+
+	return changes
+}
+
+// ignored reports whether a path, or anything containing it, is in the
+// ignore list. Patterns without a segment number match every segment with
+// that name.
+func (o DiffOptions) ignored(path string) bool {
+	general := path
+	if i := strings.IndexAny(path, "(-"); i != -1 && path[i] == '(' {
+		if j := strings.IndexByte(path, ')'); j != -1 {
+			general = path[:i] + path[j+1:]
+		}
+	}
+
+	for _, p := range o.Ignore {
+		for _, s := range []string{path, general} {
+			if s == p || strings.HasPrefix(s, p+"-") || strings.HasPrefix(s, p+"(") {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+func encodeSegment(s Segment) string {
+	return strings.TrimSuffix(string(EncodeMessage(Message{s}, nil)), "\r")
+}
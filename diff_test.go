@@ -0,0 +1,92 @@
+package hl7
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const (
+	diffTestBefore = "MSH|^~\\&|APP|FAC|||20240102||ORU^R01|1|P|2.5\r" +
+		"PID|1||123^^^GHH&1.2.3&ISO~456||Smith^John\r" +
+		"OBR|1\r" +
+		"OBX|1|NM|GLU^Glucose||5.5\r" +
+		"OBX|2|NM|NA^Sodium||140\r" +
+		"OBX|3|NM|K^Potassium||4.1\r"
+	diffTestAfter = "MSH|^~\\&|APP|FAC|||20240103||ORU^R01|2|P|2.5\r" +
+		"PID|1||123^^^GHH&1.2.4&ISO||Smyth^John\r" +
+		"OBR|1\r" +
+		"NTE|1||Haemolysed\r" +
+		"OBX|1|NM|NA^Sodium||141\r" +
+		"OBX|2|NM|K^Potassium||4.1\r" +
+		"OBX|3|NM|CL^Chloride||100\r"
+)
+
+func TestDiff(t *testing.T) {
+	a := assert.New(t)
+
+	before, _, err := ParseMessage([]byte(diffTestBefore))
+	a.NoError(err)
+	after, _, err := ParseMessage([]byte(diffTestAfter))
+	a.NoError(err)
+
+	a.Nil(Diff(before, before))
+
+	a.Equal([]Change{
+		{Type: ValueChanged, Path: "MSH-7", Old: "20240102", New: "20240103"},
+		{Type: ValueChanged, Path: "MSH-10", Old: "1", New: "2"},
+		{Type: ValueChanged, Path: "PID-3-4-2", Old: "1.2.3", New: "1.2.4"},
+		{Type: ValueChanged, Path: "PID-3(2)", Old: "456", New: ""},
+		{Type: ValueChanged, Path: "PID-5-1", Old: "Smith", New: "Smyth"},
+		{Type: SegmentAdded, Path: "NTE", New: "NTE|1||Haemolysed"},
+		{Type: ValueChanged, Path: "OBX-3-1", Old: "GLU", New: "NA"},
+		{Type: ValueChanged, Path: "OBX-3-2", Old: "Glucose", New: "Sodium"},
+		{Type: ValueChanged, Path: "OBX-5", Old: "5.5", New: "141"},
+		{Type: ValueChanged, Path: "OBX(2)-3-1", Old: "NA", New: "K"},
+		{Type: ValueChanged, Path: "OBX(2)-3-2", Old: "Sodium", New: "Potassium"},
+		{Type: ValueChanged, Path: "OBX(2)-5", Old: "140", New: "4.1"},
+		{Type: ValueChanged, Path: "OBX(3)-3-1", Old: "K", New: "CL"},
+		{Type: ValueChanged, Path: "OBX(3)-3-2", Old: "Potassium", New: "Chloride"},
+		{Type: ValueChanged, Path: "OBX(3)-5", Old: "4.1", New: "100"},
+	}, Diff(before, after))
+}
+
+func TestDiffOptions(t *testing.T) {
+	a := assert.New(t)
+
+	before, _, err := ParseMessage([]byte(diffTestBefore))
+	a.NoError(err)
+	after, _, err := ParseMessage([]byte(diffTestAfter))
+	a.NoError(err)
+
+	o := DiffOptions{
+		Ignore: append([]string{"PID-3", "OBX-1"}, VolatileFields...),
+		Keys:   map[string]string{"OBX": "OBX-3"},
+	}
+
+	changes := o.Diff(before, after)
+
+	a.Equal([]Change{
+		{Type: ValueChanged, Path: "PID-5-1", Old: "Smith", New: "Smyth"},
+		{Type: SegmentRemoved, Path: "OBX", Key: "OBX-3=GLU", Old: "OBX|1|NM|GLU^Glucose||5.5"},
+		{Type: SegmentAdded, Path: "NTE", New: "NTE|1||Haemolysed"},
+		{Type: ValueChanged, Path: "OBX(2)-5", Key: "OBX-3=NA", Old: "140", New: "141"},
+		{Type: SegmentAdded, Path: "OBX(3)", Key: "OBX-3=CL", New: "OBX|3|NM|CL^Chloride||100"},
+	}, changes)
+
+	a.Equal(`~ PID-5-1: "Smith" -> "Smyth"
+- OBX [OBX-3=GLU]: OBX|1|NM|GLU^Glucose||5.5
++ NTE: NTE|1||Haemolysed
+~ OBX(2)-5 [OBX-3=NA]: "140" -> "141"
++ OBX(3) [OBX-3=CL]: OBX|3|NM|CL^Chloride||100
+`, FormatDiff(changes))
+
+	changed, _, err := ParseMessage([]byte(diffTestBefore))
+	a.NoError(err)
+	changed[4][5] = Field{FieldItem{Component{"141"}}}
+
+	a.Len(Diff(before, changed), 1)
+	a.Empty(DiffOptions{Ignore: []string{"OBX(2)-5"}}.Diff(before, changed))
+	a.Empty(DiffOptions{Ignore: []string{"OBX-5"}}.Diff(before, changed))
+	a.Len(DiffOptions{Ignore: []string{"OBX(3)-5"}}.Diff(before, changed), 1)
+}
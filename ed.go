@@ -0,0 +1,183 @@
+package hl7 // import "fknsrs.biz/p/hl7"
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/hex"
+	"io"
+	"io/ioutil"
+	"strings"
+
+	"github.com/facebookgo/stackerr"
+)
+
+// ErrUnknownEncoding is returned when an ED value uses an encoding other than
+// the ones defined by HL7 table 0299.
+type ErrUnknownEncoding error
+
+// These are the encodings defined by HL7 table 0299, for use in ED-4.
+const (
+	EncodingASCII  = "A"
+	EncodingHex    = "Hex"
+	EncodingBase64 = "Base64"
+)
+
+// ED is encapsulated data, used to embed things like PDF reports in OBX-5.
+type ED struct {
+	SourceApplication HD
+	TypeOfData        string
+	DataSubtype       string
+	Encoding          string
+	Data              string
+}
+
+// DecodeED reads an ED value from a field item.
+//
+// Some senders leave out the components they don't care about instead of
+// leaving them empty (e.g. "PDF^Base64^JVBERi0..."). If there are fewer than
+// five components, DecodeED looks for the last one that names an encoding,
+// takes the data from the component after it, and the type of data from the
+// component before it.
+func DecodeED(fi FieldItem) ED {
+	if len(fi) < 5 {
+		for i := len(fi) - 1; i >= 1; i-- {
+			if !isEncoding(fi.get(i)) {
+				continue
+			}
+
+			e := ED{Encoding: fi.get(i), Data: fi.get(i + 1)}
+			if i > 1 {
+				e.TypeOfData = fi.get(i - 1)
+			}
+			if i > 2 {
+				e.DataSubtype = e.TypeOfData
+				e.TypeOfData = fi.get(i - 2)
+			}
+
+			return e
+		}
+	}
+
+	return ED{
+		SourceApplication: decodeHDComponent(fi.component(1)),
+		TypeOfData:        fi.get(2),
+		DataSubtype:       fi.get(3),
+		Encoding:          fi.get(4),
+		Data:              fi.get(5),
+	}
+}
+
+func isEncoding(s string) bool {
+	switch {
+	case s == EncodingASCII, strings.EqualFold(s, EncodingHex), strings.EqualFold(s, EncodingBase64):
+		return true
+	}
+
+	return false
+}
+
+// Encode turns an ED value into a field item.
+func (e ED) Encode(version string) FieldItem {
+	return trimFieldItem(FieldItem{
+		e.SourceApplication.component(version),
+		simple(e.TypeOfData),
+		simple(e.DataSubtype),
+		simple(e.Encoding),
+		simple(e.Data),
+	})
+}
+
+// Reader returns a reader that decodes the data according to its encoding,
+// so that large payloads can be written somewhere without holding a second
+// copy of them in memory. Encoding names are matched case-insensitively, and
+// an empty encoding is treated as "A".
+func (e ED) Reader() (io.Reader, error) {
+	r := strings.NewReader(e.Data)
+
+	switch {
+	case e.Encoding == "", e.Encoding == EncodingASCII:
+		return r, nil
+	case strings.EqualFold(e.Encoding, EncodingHex):
+		return hex.NewDecoder(r), nil
+	case strings.EqualFold(e.Encoding, EncodingBase64):
+		return base64.NewDecoder(base64.StdEncoding, r), nil
+	}
+
+	return nil, ErrUnknownEncoding(stackerr.Newf("unknown encoding %q", e.Encoding))
+}
+
+// Bytes returns the decoded data.
+func (e ED) Bytes() ([]byte, error) {
+	r, err := e.Reader()
+	if err != nil {
+		return nil, stackerr.Wrap(err)
+	}
+
+	b, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, stackerr.Wrap(err)
+	}
+
+	return b, nil
+}
+
+// NewED builds an ED value holding b, encoded as Base64.
+func NewED(typeOfData, dataSubtype string, b []byte) ED {
+	return ED{
+		TypeOfData:  typeOfData,
+		DataSubtype: dataSubtype,
+		Encoding:    EncodingBase64,
+		Data:        base64.StdEncoding.EncodeToString(b),
+	}
+}
+
+// ReadED builds an ED value from everything that can be read from r, encoded
+// as Base64. Unlike NewED, the raw content is never held in memory all at
+// once.
+func ReadED(typeOfData, dataSubtype string, r io.Reader) (ED, error) {
+	var buf bytes.Buffer
+
+	w := base64.NewEncoder(base64.StdEncoding, &buf)
+	if _, err := io.Copy(w, r); err != nil {
+		return ED{}, stackerr.Wrap(err)
+	}
+	if err := w.Close(); err != nil {
+		return ED{}, stackerr.Wrap(err)
+	}
+
+	return ED{
+		TypeOfData:  typeOfData,
+		DataSubtype: dataSubtype,
+		Encoding:    EncodingBase64,
+		Data:        buf.String(),
+	}, nil
+}
+
+// RP is a reference pointer, used to point at data that's stored somewhere
+// other than the message itself.
+type RP struct {
+	Pointer       string
+	ApplicationID HD
+	TypeOfData    string
+	Subtype       string
+}
+
+// DecodeRP reads an RP value from a field item.
+func DecodeRP(fi FieldItem) RP {
+	return RP{
+		Pointer:       fi.get(1),
+		ApplicationID: decodeHDComponent(fi.component(2)),
+		TypeOfData:    fi.get(3),
+		Subtype:       fi.get(4),
+	}
+}
+
+// Encode turns an RP value into a field item.
+func (r RP) Encode(version string) FieldItem {
+	return trimFieldItem(FieldItem{
+		simple(r.Pointer),
+		r.ApplicationID.component(version),
+		simple(r.TypeOfData),
+		simple(r.Subtype),
+	})
+}
@@ -0,0 +1,89 @@
+package hl7
+
+import (
+	"bytes"
+	"io/ioutil"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDecodeEDPDF(t *testing.T) {
+	a := assert.New(t)
+
+	m, _, err := ParseMessage(pdfGeneticsContent)
+	a.NoError(err)
+
+	e := DecodeED(m.Segment("OBX", 0).Field(5).item(0))
+	a.Equal("PDF", e.TypeOfData)
+	a.Equal("", e.DataSubtype)
+	a.Equal(EncodingBase64, e.Encoding)
+
+	b, err := e.Bytes()
+	a.NoError(err)
+	a.True(bytes.HasPrefix(b, []byte("%PDF-1.4")))
+	a.True(bytes.HasSuffix(b, []byte("%%EOF\n")))
+
+	r, err := e.Reader()
+	a.NoError(err)
+	s, err := ioutil.ReadAll(r)
+	a.NoError(err)
+	a.Equal(b, s)
+}
+
+func TestDecodeED(t *testing.T) {
+	a := assert.New(t)
+
+	a.Equal(
+		ED{SourceApplication: HD{NamespaceID: "LAB", UniversalID: "1.2.3", UniversalIDType: "ISO"}, TypeOfData: "AP", DataSubtype: "PDF", Encoding: "Hex", Data: "48656c6c6f"},
+		DecodeED(FieldItem{Component{"LAB", "1.2.3", "ISO"}, Component{"AP"}, Component{"PDF"}, Component{"Hex"}, Component{"48656c6c6f"}}),
+	)
+
+	a.Equal(
+		ED{TypeOfData: "AP", DataSubtype: "PDF", Encoding: "Base64", Data: "SGVsbG8="},
+		DecodeED(FieldItem{Component{"AP"}, Component{"PDF"}, Component{"Base64"}, Component{"SGVsbG8="}}),
+	)
+}
+
+func TestEDBytes(t *testing.T) {
+	a := assert.New(t)
+
+	for _, e := range []ED{
+		ED{Encoding: "A", Data: "Hello"},
+		ED{Encoding: "", Data: "Hello"},
+		ED{Encoding: "Hex", Data: "48656c6c6f"},
+		ED{Encoding: "HEX", Data: "48656C6C6F"},
+		ED{Encoding: "Base64", Data: "SGVsbG8="},
+	} {
+		b, err := e.Bytes()
+		a.NoError(err, e.Encoding)
+		a.Equal([]byte("Hello"), b, e.Encoding)
+	}
+
+	_, err := ED{Encoding: "Hex", Data: "zz"}.Bytes()
+	a.Error(err)
+
+	_, err = ED{Encoding: "Base32", Data: "JBSWY3DP"}.Bytes()
+	a.Error(err)
+}
+
+func TestNewED(t *testing.T) {
+	a := assert.New(t)
+
+	e := NewED("AP", "PDF", []byte("Hello"))
+	a.Equal(ED{TypeOfData: "AP", DataSubtype: "PDF", Encoding: "Base64", Data: "SGVsbG8="}, e)
+	a.Equal(FieldItem{nil, Component{"AP"}, Component{"PDF"}, Component{"Base64"}, Component{"SGVsbG8="}}, e.Encode("2.5"))
+	a.Equal(e, DecodeED(e.Encode("2.5")))
+
+	r, err := ReadED("AP", "PDF", bytes.NewReader([]byte("Hello")))
+	a.NoError(err)
+	a.Equal(e, r)
+}
+
+func TestRP(t *testing.T) {
+	a := assert.New(t)
+
+	r := RP{Pointer: "doc/123", ApplicationID: HD{NamespaceID: "PACS"}, TypeOfData: "IM", Subtype: "JPEG"}
+	a.Equal(FieldItem{Component{"doc/123"}, Component{"PACS"}, Component{"IM"}, Component{"JPEG"}}, r.Encode("2.5"))
+	a.Equal(r, DecodeRP(r.Encode("2.5")))
+}
@@ -0,0 +1,116 @@
+package hl7 // import "fknsrs.biz/p/hl7"
+
+import (
+	"bytes"
+)
+
+// DefaultDelimiters are the delimiters almost everyone uses: `|^~\&`.
+var DefaultDelimiters = Delimiters{'|', '^', '~', '\\', '&'}
+
+// EncodeMessage turns a message into the usual pipe-delimited HL7 encoding,
+// the reverse of ParseMessage. Segments are ended with "\r". If d is nil,
+// DefaultDelimiters are used. MSH-1 and MSH-2 are always written from d,
+// whatever the message has in them. Any delimiters in values are escaped.
+func EncodeMessage(m Message, d *Delimiters) []byte {
+	if d == nil {
+		d = &DefaultDelimiters
+	}
+
+	var buf bytes.Buffer
+
+	for _, s := range m {
+		first := 1
+
+		buf.WriteString(s.Name())
+		if s.Name() == "MSH" {
+			buf.Write([]byte{d.Field, d.Component, d.Repeat, d.Escape, d.Subcomponent})
+			first = 3
+		}
+
+		for n := first; n < len(s); n++ {
+			buf.WriteByte(d.Field)
+
+			for i, fi := range s[n] {
+				if i > 0 {
+					buf.WriteByte(d.Repeat)
+				}
+
+				for j, c := range fi {
+					if j > 0 {
+						buf.WriteByte(d.Component)
+					}
+
+					for k, sc := range c {
+						if k > 0 {
+							buf.WriteByte(d.Subcomponent)
+						}
+
+						escape(&buf, string(sc), d)
+					}
+
+					if len(c) > 1 && c[len(c)-1] == "" {
+						buf.WriteByte(d.Subcomponent)
+					}
+				}
+
+				if len(fi) > 1 && componentIsBlank(fi[len(fi)-1]) {
+					buf.WriteByte(d.Component)
+				}
+			}
+
+			if len(s[n]) > 1 && fieldItemIsBlank(s[n][len(s[n])-1]) {
+				buf.WriteByte(d.Repeat)
+			}
+		}
+
+		if len(s) > first && fieldIsBlank(s[len(s)-1]) {
+			buf.WriteByte(d.Field)
+		}
+
+		buf.WriteByte('\r')
+	}
+
+	return buf.Bytes()
+}
+
+// ParseMessage drops the last position of a list (of fields, repetitions,
+// components, or subcomponents) if it's empty, so "A^B^" comes out the same
+// as "A^B". To make sure that what comes out of ParseMessage is encoded the
+// same way it went in, a list that ends in an empty position gets an extra
+// delimiter. These functions check whether something encodes to nothing.
+
+func componentIsBlank(c Component) bool {
+	return len(c) == 0 || (len(c) == 1 && c[0] == "")
+}
+
+func fieldItemIsBlank(fi FieldItem) bool {
+	return len(fi) == 0 || (len(fi) == 1 && componentIsBlank(fi[0]))
+}
+
+func fieldIsBlank(f Field) bool {
+	return len(f) == 0 || (len(f) == 1 && fieldItemIsBlank(f[0]))
+}
+
+func escape(buf *bytes.Buffer, s string, d *Delimiters) {
+	for i := 0; i < len(s); i++ {
+		var e byte
+
+		switch s[i] {
+		case d.Field:
+			e = 'F'
+		case d.Component:
+			e = 'S'
+		case d.Subcomponent:
+			e = 'T'
+		case d.Repeat:
+			e = 'R'
+		case d.Escape:
+			e = 'E'
+		default:
+			buf.WriteByte(s[i])
+			continue
+		}
+
+		buf.Write([]byte{d.Escape, e, d.Escape})
+	}
+}
@@ -0,0 +1,61 @@
+package hl7
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEncodeMessage(t *testing.T) {
+	a := assert.New(t)
+
+	m := Message{
+		Segment{
+			Field{FieldItem{Component{"MSH"}}},
+			Field{FieldItem{Component{"|"}}},
+			Field{FieldItem{Component{"^~\\&"}}},
+			Field{FieldItem{Component{"APP"}}},
+		},
+		Segment{
+			Field{FieldItem{Component{"PID"}}},
+			nil,
+			nil,
+			Field{FieldItem{Component{"1"}, nil, nil, Component{"GHH", "1.2.3", "ISO"}}, FieldItem{Component{"2"}}},
+			nil,
+			Field{FieldItem{Component{"Smith|Jones"}, Component{"A^B~C\\D&E"}}},
+		},
+	}
+
+	a.Equal("MSH|^~\\&|APP\rPID|||1^^^GHH&1.2.3&ISO~2||Smith\\F\\Jones^A\\S\\B\\R\\C\\E\\D\\T\\E\r", string(EncodeMessage(m, nil)))
+	a.Equal("MSH#$%*@#APP\rPID###1$$$GHH@1.2.3@ISO%2##Smith|Jones$A^B~C\\D&E\r", string(EncodeMessage(m, &Delimiters{'#', '$', '%', '*', '@'})))
+
+	p, _, err := ParseMessage(EncodeMessage(m, nil))
+	a.NoError(err)
+	a.Equal(m, p)
+}
+
+func TestEncodeMessageRoundTrip(t *testing.T) {
+	a := assert.New(t)
+
+	files, err := filepath.Glob("testdata/*.hl7")
+	a.NoError(err)
+
+	for _, file := range files {
+		buf, err := ioutil.ReadFile(file)
+		a.NoError(err)
+
+		m, d, err := ParseMessage(buf)
+		if !a.NoError(err, file) {
+			continue
+		}
+
+		encoded := EncodeMessage(m, d)
+
+		p, _, err := ParseMessage(encoded)
+		a.NoError(err, file)
+		a.Equal(m, p, file)
+		a.Equal(string(encoded), string(EncodeMessage(p, d)), file)
+	}
+}
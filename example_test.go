@@ -13,3 +13,26 @@ func ExampleQuery_GetString() {
 	fmt.Printf("%s_%s", msh9_1.GetString(m), msh9_2.GetString(m))
 	// Output: ORU_R01
 }
+
+func ExampleParseORU() {
+	m, _, _ := ParseMessage([]byte(testORU))
+
+	r, _ := ParseORU(m)
+
+	for _, res := range r.Results {
+		for _, o := range res.Orders {
+			fmt.Println(o.ServiceID().Text)
+
+			for _, obs := range o.Observations {
+				v, _ := obs.Value()
+				fmt.Println(" ", obs.ID().Text, v, obs.Units().Identifier, obs.Notes())
+			}
+		}
+	}
+	// Output:
+	// Comprehensive metabolic panel
+	//   Glucose [182] mg/dL [repeat advised called to ward]
+	//   Sodium [140] mmol/L []
+	// CBC panel
+	// Other
+}
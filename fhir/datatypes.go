@@ -0,0 +1,416 @@
+package fhir // import "fknsrs.biz/p/hl7/fhir"
+
+import (
+	"strings"
+	"time"
+
+	"fknsrs.biz/p/hl7"
+)
+
+var codeSystems = map[string]string{
+	"LN":     "http://loinc.org",
+	"SCT":    "http://snomed.info/sct",
+	"SNM":    "http://snomed.info/sct",
+	"I9":     "http://hl7.org/fhir/sid/icd-9-cm",
+	"I9C":    "http://hl7.org/fhir/sid/icd-9-cm",
+	"I10":    "http://hl7.org/fhir/sid/icd-10",
+	"UCUM":   "http://unitsofmeasure.org",
+	"CVX":    "http://hl7.org/fhir/sid/cvx",
+	"NDC":    "http://hl7.org/fhir/sid/ndc",
+	"RXNORM": "http://www.nlm.nih.gov/research/umls/rxnorm",
+	"CPT4":   "http://www.ama-assn.org/go/cpt",
+}
+
+// DefaultCodeSystem turns the common HL7 v2 coding system names into FHIR
+// code system URIs. HL7 tables (e.g. "HL70078") become the matching v2 code
+// systems on terminology.hl7.org. Anything else gives an empty string, which
+// leaves the system out.
+func DefaultCodeSystem(name string) string {
+	if u, ok := codeSystems[strings.ToUpper(name)]; ok {
+		return u
+	}
+
+	if len(name) == 7 && strings.HasPrefix(name, "HL7") && isDigits(name[3:]) {
+		return "http://terminology.hl7.org/CodeSystem/v2-" + name[3:]
+	}
+
+	return ""
+}
+
+// DefaultIdentifier turns a CX into an identifier. The system comes from the
+// assigning authority's universal ID (as an OID URN for ISO ones); if there
+// isn't one, the namespace ID is used as the assigner's display text.
+func DefaultIdentifier(cx hl7.CX) *Identifier {
+	i := Identifier{
+		Value:  cx.ID,
+		System: endpoint(hl7.HD{UniversalID: cx.AssigningAuthority.UniversalID, UniversalIDType: cx.AssigningAuthority.UniversalIDType}),
+	}
+
+	if i.System == "" && cx.AssigningAuthority.NamespaceID != "" {
+		i.Assigner = &Reference{Display: cx.AssigningAuthority.NamespaceID}
+	}
+
+	if cx.IdentifierTypeCode != "" {
+		i.Type = &CodeableConcept{
+			Coding: []Coding{{System: "http://terminology.hl7.org/CodeSystem/v2-0203", Code: cx.IdentifierTypeCode}},
+		}
+	}
+
+	start, end := date(cx.EffectiveDate), date(cx.ExpirationDate)
+	if start != "" || end != "" {
+		i.Period = &Period{Start: start, End: end}
+	}
+
+	return &i
+}
+
+// endpoint turns an HD into a URI, preferring the universal ID.
+func endpoint(h hl7.HD) string {
+	switch {
+	case h.UniversalID != "" && strings.EqualFold(h.UniversalIDType, "ISO"):
+		return "urn:oid:" + h.UniversalID
+	case h.UniversalID != "":
+		return h.UniversalID
+	default:
+		return h.NamespaceID
+	}
+}
+
+func first(f hl7.Field) hl7.FieldItem {
+	if len(f) == 0 {
+		return nil
+	}
+
+	return f[0]
+}
+
+// text returns the first subcomponent of each component in a field item,
+// separated by spaces.
+func text(fi hl7.FieldItem) string {
+	var a []string
+
+	for _, c := range fi {
+		if len(c) > 0 && c[0] != "" {
+			a = append(a, string(c[0]))
+		}
+	}
+
+	return strings.Join(a, " ")
+}
+
+func isDigits(s string) bool {
+	for _, r := range s {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+
+	return s != ""
+}
+
+// date turns a v2 DT or DTM into a FHIR date, keeping the precision of the
+// original (e.g. "198005" becomes "1980-05").
+func date(s string) string {
+	if len(s) < 4 || !isDigits(s[0:4]) {
+		return ""
+	}
+
+	switch {
+	case len(s) >= 8 && isDigits(s[4:8]):
+		return s[0:4] + "-" + s[4:6] + "-" + s[6:8]
+	case len(s) >= 6 && isDigits(s[4:6]):
+		return s[0:4] + "-" + s[4:6]
+	default:
+		return s[0:4]
+	}
+}
+
+// dateTime turns a v2 DTM into a FHIR dateTime. Values with only a date keep
+// their precision; values with a time become full timestamps, since FHIR
+// needs seconds and a time zone once there's a time at all.
+func dateTime(s string) string {
+	if len(s) <= 8 || !isDigits(s[8:9]) {
+		return date(s)
+	}
+
+	t, err := hl7.ParseTime(s)
+	if err != nil {
+		return date(s)
+	}
+
+	return t.Format(time.RFC3339Nano)
+}
+
+// instant turns a v2 DTM into a FHIR instant, which always has a time.
+func instant(s string) string {
+	t, err := hl7.ParseTime(s)
+	if err != nil || t.IsZero() {
+		return ""
+	}
+
+	return t.Format(time.RFC3339Nano)
+}
+
+func gender(s string) string {
+	switch s {
+	case "M":
+		return "male"
+	case "F":
+		return "female"
+	case "O", "A":
+		return "other"
+	case "U", "N":
+		return "unknown"
+	default:
+		return ""
+	}
+}
+
+func humanName(x hl7.XPN) *HumanName {
+	n := HumanName{Family: x.Family}
+
+	for _, s := range []string{x.Given, x.Middle} {
+		if s != "" {
+			n.Given = append(n.Given, s)
+		}
+	}
+
+	if x.Prefix != "" {
+		n.Prefix = []string{x.Prefix}
+	}
+	for _, s := range []string{x.Suffix, x.Degree, x.ProfessionalSuffix} {
+		if s != "" {
+			n.Suffix = append(n.Suffix, s)
+		}
+	}
+
+	switch x.NameTypeCode {
+	case "L":
+		n.Use = "official"
+	case "D", "A":
+		n.Use = "usual"
+	case "M":
+		n.Use = "maiden"
+	case "N":
+		n.Use = "nickname"
+	case "B":
+		n.Use = "old"
+	case "S":
+		n.Use = "anonymous"
+	}
+
+	if n.Family == "" && len(n.Given) == 0 {
+		return nil
+	}
+
+	return &n
+}
+
+func address(x hl7.XAD) *Address {
+	a := Address{
+		City:       x.City,
+		State:      x.State,
+		PostalCode: x.Zip,
+		Country:    x.Country,
+		District:   x.County,
+	}
+
+	for _, s := range []string{x.Street, x.OtherDesignation} {
+		if s != "" {
+			a.Line = append(a.Line, s)
+		}
+	}
+
+	switch x.AddressType {
+	case "H":
+		a.Use = "home"
+	case "B", "O":
+		a.Use = "work"
+	case "C":
+		a.Use = "temp"
+	case "M":
+		a.Type = "postal"
+	}
+
+	start, end := date(x.EffectiveDate), date(x.ExpirationDate)
+	if start != "" || end != "" {
+		a.Period = &Period{Start: start, End: end}
+	}
+
+	if len(a.Line) == 0 && a.City == "" && a.State == "" && a.PostalCode == "" && a.Country == "" {
+		return nil
+	}
+
+	return &a
+}
+
+func contactPoint(x hl7.XTN, use string) *ContactPoint {
+	c := ContactPoint{Value: x.Number(), Use: use, System: "phone"}
+
+	switch x.TelecomEquipmentType {
+	case "FX":
+		c.System = "fax"
+	case "Internet", "X.400":
+		c.System = "email"
+		c.Value = x.Email
+	case "CP":
+		c.Use = "mobile"
+	case "BP":
+		c.System = "pager"
+	}
+
+	if c.Value == "" && x.Email != "" {
+		c.System, c.Value = "email", x.Email
+	}
+
+	if c.Value == "" {
+		return nil
+	}
+
+	return &c
+}
+
+func encounterClass(s string) Coding {
+	const actCode = "http://terminology.hl7.org/CodeSystem/v3-ActCode"
+
+	switch s {
+	case "I":
+		return Coding{System: actCode, Code: "IMP", Display: "inpatient encounter"}
+	case "O":
+		return Coding{System: actCode, Code: "AMB", Display: "ambulatory"}
+	case "E":
+		return Coding{System: actCode, Code: "EMER", Display: "emergency"}
+	case "P":
+		return Coding{System: actCode, Code: "PRENC", Display: "pre-admission"}
+	default:
+		return Coding{System: "http://terminology.hl7.org/CodeSystem/v2-0004", Code: s}
+	}
+}
+
+func practitioner(x hl7.XCN) *Reference {
+	var a []string
+	for _, s := range []string{x.Prefix, x.Given, x.Middle, x.Family, x.Suffix} {
+		if s != "" {
+			a = append(a, s)
+		}
+	}
+
+	r := Reference{Display: strings.Join(a, " ")}
+
+	if x.ID != "" {
+		r.Identifier = &Identifier{Value: x.ID, System: endpoint(hl7.HD{UniversalID: x.AssigningAuthority.UniversalID, UniversalIDType: x.AssigningAuthority.UniversalIDType})}
+	}
+
+	if r.Display == "" && r.Identifier == nil {
+		return nil
+	}
+
+	return &r
+}
+
+// location describes a PL (point of care, room, bed, facility, ...) as text.
+func location(fi hl7.FieldItem) string {
+	var a []string
+
+	for _, c := range fi {
+		if len(c) > 0 && c[0] != "" {
+			a = append(a, string(c[0]))
+		}
+	}
+
+	return strings.Join(a, ", ")
+}
+
+func reportStatus(s string) string {
+	switch s {
+	case "O", "I", "S":
+		return "registered"
+	case "A", "R":
+		return "partial"
+	case "P":
+		return "preliminary"
+	case "C":
+		return "corrected"
+	case "F":
+		return "final"
+	case "X":
+		return "cancelled"
+	default:
+		return "unknown"
+	}
+}
+
+func observationStatus(s string) string {
+	switch s {
+	case "R", "I", "O", "S":
+		return "registered"
+	case "P":
+		return "preliminary"
+	case "C":
+		return "corrected"
+	case "F", "U":
+		return "final"
+	case "X", "N":
+		return "cancelled"
+	case "D", "W":
+		return "entered-in-error"
+	default:
+		return "unknown"
+	}
+}
+
+var contentTypes = map[string]string{
+	"PDF":  "application/pdf",
+	"RTF":  "application/rtf",
+	"HTML": "text/html",
+	"XML":  "text/xml",
+	"TEXT": "text/plain",
+	"JPEG": "image/jpeg",
+	"PNG":  "image/png",
+	"TIFF": "image/tiff",
+	"GIF":  "image/gif",
+}
+
+func contentType(e hl7.ED) string {
+	for _, s := range []string{e.DataSubtype, e.TypeOfData} {
+		if strings.Contains(s, "/") {
+			return s
+		}
+		if t, ok := contentTypes[strings.ToUpper(s)]; ok {
+			return t
+		}
+	}
+
+	return "application/octet-stream"
+}
+
+// referenceRange reads an OBX-7 reference range like "3.5-5.0" or "<10". If
+// it doesn't look like a simple numeric range, it's kept as text.
+func referenceRange(s string) ObservationReferenceRange {
+	r := ObservationReferenceRange{Text: s}
+
+	if i := strings.Index(strings.TrimPrefix(s, "-"), "-"); i != -1 {
+		i++
+		if strings.HasPrefix(s, "-") {
+			i++
+		}
+
+		lo, err1 := hl7.ParseNM(strings.TrimSpace(s[:i-1]))
+		hi, err2 := hl7.ParseNM(strings.TrimSpace(s[i:]))
+		if err1 == nil && err2 == nil {
+			return ObservationReferenceRange{Low: &Quantity{Value: &lo}, High: &Quantity{Value: &hi}}
+		}
+	}
+
+	return r
+}
+
+// component returns the first subcomponent of the nth component (counting
+// from one) of a field item.
+func component(fi hl7.FieldItem, n int) string {
+	if n < 1 || n > len(fi) || len(fi[n-1]) == 0 {
+		return ""
+	}
+
+	return string(fi[n-1][0])
+}
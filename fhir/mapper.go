@@ -0,0 +1,521 @@
+// Package fhir maps parsed HL7 v2 messages to FHIR R4 resources, following
+// the HL7 v2-to-FHIR mapping for the common segments and data types.
+package fhir // import "fknsrs.biz/p/hl7/fhir"
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/facebookgo/stackerr"
+
+	"fknsrs.biz/p/hl7"
+)
+
+// Mapper turns messages into bundles of FHIR resources. The zero value is
+// ready to use; set the hooks to customise the output.
+type Mapper struct {
+	// CodeSystem turns an HL7 v2 coding system name (e.g. "LN" from CE-3)
+	// into a FHIR code system URI. If it's nil, DefaultCodeSystem is used.
+	CodeSystem func(name string) string
+	// Identifier turns a CX (e.g. from PID-3) into a FHIR identifier. It can
+	// return nil to leave the identifier out. If it's nil,
+	// DefaultIdentifier is used.
+	Identifier func(cx hl7.CX) *Identifier
+	// ID generates the id of the nth resource (counting from one) of a given
+	// type. If it's nil, ids look like "observation-3".
+	ID func(resourceType string, n int) string
+}
+
+// Map turns a message into a bundle using a zero Mapper.
+func Map(m hl7.Message) (*Bundle, error) {
+	var mp Mapper
+	return mp.Map(m)
+}
+
+// MarshalBundle is a shortcut for Map followed by json.Marshal.
+func MarshalBundle(m hl7.Message) ([]byte, error) {
+	b, err := Map(m)
+	if err != nil {
+		return nil, stackerr.Wrap(err)
+	}
+
+	return json.Marshal(b)
+}
+
+// Map turns a message into a bundle. The MessageHeader comes first, then the
+// other resources in the order of the segments they were made from. Each
+// resource refers to the most recent Patient, Encounter, and (for
+// observations) DiagnosticReport before it.
+func (mp *Mapper) Map(m hl7.Message) (*Bundle, error) {
+	msh := m.Segment("MSH", 0)
+	if msh == nil {
+		return nil, hl7.ErrNoHeader(stackerr.Newf("message has no MSH segment"))
+	}
+
+	s := mapState{mp: mp, counts: make(map[string]int), event: component(first(msh.Field(9)), 2)}
+
+	mh := s.messageHeader(msh)
+
+	var resources []Resource
+	for _, sg := range m {
+		var r Resource
+
+		switch sg.Name() {
+		case "PID":
+			r = s.patient(sg)
+		case "PV1":
+			r = s.encounter(sg)
+		case "OBR":
+			r = s.diagnosticReport(sg)
+		case "OBX":
+			if o := s.observation(sg); o != nil {
+				r = o
+			}
+		case "NTE":
+			s.note(sg)
+		}
+
+		if r != nil {
+			resources = append(resources, r)
+		}
+	}
+
+	for _, r := range resources {
+		switch r := r.(type) {
+		case *Patient:
+			mh.Focus = append(mh.Focus, Reference{Reference: "Patient/" + r.ID})
+		case *Encounter:
+			mh.Focus = append(mh.Focus, Reference{Reference: "Encounter/" + r.ID})
+		case *DiagnosticReport:
+			mh.Focus = append(mh.Focus, Reference{Reference: "DiagnosticReport/" + r.ID})
+		}
+	}
+
+	b := &Bundle{
+		ResourceType: "Bundle",
+		Type:         "message",
+		Timestamp:    instant(msh.Value(7)),
+		Entry:        []BundleEntry{{Resource: mh}},
+	}
+
+	if v := msh.Value(10); v != "" {
+		b.Identifier = &Identifier{Value: v}
+	}
+
+	for _, r := range resources {
+		b.Entry = append(b.Entry, BundleEntry{Resource: r})
+	}
+
+	return b, nil
+}
+
+type mapState struct {
+	mp     *Mapper
+	counts map[string]int
+	event  string
+
+	subject *Reference
+	visit   *Reference
+	report  *DiagnosticReport
+	obs     *Observation
+	obr7    string
+}
+
+func (s *mapState) id(resourceType string) string {
+	s.counts[resourceType]++
+	n := s.counts[resourceType]
+
+	if s.mp.ID != nil {
+		return s.mp.ID(resourceType, n)
+	}
+
+	return strings.ToLower(resourceType) + "-" + strconv.Itoa(n)
+}
+
+func (s *mapState) system(name string) string {
+	if s.mp.CodeSystem != nil {
+		return s.mp.CodeSystem(name)
+	}
+
+	return DefaultCodeSystem(name)
+}
+
+func (s *mapState) identifiers(f hl7.Field) []Identifier {
+	var a []Identifier
+
+	for _, cx := range hl7.DecodeCXs(f) {
+		if cx.ID == "" {
+			continue
+		}
+
+		var i *Identifier
+		if s.mp.Identifier != nil {
+			i = s.mp.Identifier(cx)
+		} else {
+			i = DefaultIdentifier(cx)
+		}
+
+		if i != nil {
+			a = append(a, *i)
+		}
+	}
+
+	return a
+}
+
+func (s *mapState) codeableConcept(c hl7.CWE) *CodeableConcept {
+	if c.Identifier == "" && c.Text == "" && c.AlternateIdentifier == "" {
+		return nil
+	}
+
+	var cc CodeableConcept
+
+	if c.Identifier != "" || c.Text != "" {
+		cc.Coding = append(cc.Coding, Coding{System: s.system(c.CodingSystem), Code: c.Identifier, Display: c.Text})
+	}
+	if c.AlternateIdentifier != "" || c.AlternateText != "" {
+		cc.Coding = append(cc.Coding, Coding{System: s.system(c.AlternateCodingSystem), Code: c.AlternateIdentifier, Display: c.AlternateText})
+	}
+
+	cc.Text = c.OriginalText
+
+	return &cc
+}
+
+func (s *mapState) messageHeader(sg hl7.Segment) *MessageHeader {
+	sendingApplication := hl7.DecodeHD(first(sg.Field(3)))
+	sendingFacility := hl7.DecodeHD(first(sg.Field(4)))
+	receivingApplication := hl7.DecodeHD(first(sg.Field(5)))
+	receivingFacility := hl7.DecodeHD(first(sg.Field(6)))
+
+	mh := &MessageHeader{
+		ResourceType: "MessageHeader",
+		ID:           s.id("MessageHeader"),
+		EventCoding: Coding{
+			System: "http://terminology.hl7.org/CodeSystem/v2-0003",
+			Code:   s.event,
+		},
+		Source: MessageSource{
+			Name:     sendingApplication.NamespaceID,
+			Endpoint: endpoint(sendingApplication),
+		},
+	}
+
+	if !sendingFacility.IsZero() {
+		mh.Sender = &Reference{Display: sendingFacility.NamespaceID}
+		if sendingFacility.UniversalID != "" {
+			mh.Sender.Identifier = &Identifier{Value: endpoint(sendingFacility)}
+		}
+	}
+
+	if !receivingApplication.IsZero() || !receivingFacility.IsZero() {
+		d := MessageDestination{
+			Name:     receivingApplication.NamespaceID,
+			Endpoint: endpoint(receivingApplication),
+		}
+
+		if !receivingFacility.IsZero() {
+			d.Receiver = &Reference{Display: receivingFacility.NamespaceID}
+		}
+
+		mh.Destination = append(mh.Destination, d)
+	}
+
+	return mh
+}
+
+func (s *mapState) patient(sg hl7.Segment) *Patient {
+	p := &Patient{
+		ResourceType: "Patient",
+		ID:           s.id("Patient"),
+		Identifier:   s.identifiers(sg.Field(3)),
+		Gender:       gender(sg.Value(8)),
+		BirthDate:    date(sg.Value(7)),
+	}
+
+	for _, x := range hl7.DecodeXPNs(sg.Field(5)) {
+		if n := humanName(x); n != nil {
+			p.Name = append(p.Name, *n)
+		}
+	}
+
+	for _, x := range hl7.DecodeXADs(sg.Field(11)) {
+		if a := address(x); a != nil {
+			p.Address = append(p.Address, *a)
+		}
+	}
+
+	for _, x := range hl7.DecodeXTNs(sg.Field(13)) {
+		if c := contactPoint(x, "home"); c != nil {
+			p.Telecom = append(p.Telecom, *c)
+		}
+	}
+	for _, x := range hl7.DecodeXTNs(sg.Field(14)) {
+		if c := contactPoint(x, "work"); c != nil {
+			p.Telecom = append(p.Telecom, *c)
+		}
+	}
+
+	if c := hl7.DecodeCWE(first(sg.Field(16))); c.Identifier != "" {
+		p.MaritalStatus = &CodeableConcept{
+			Coding: []Coding{{System: "http://terminology.hl7.org/CodeSystem/v3-MaritalStatus", Code: c.Identifier, Display: c.Text}},
+		}
+	}
+
+	if t := dateTime(sg.Value(29)); t != "" {
+		p.DeceasedDateTime = t
+	} else if v := sg.Value(30); v == "Y" || v == "N" {
+		b := v == "Y"
+		p.DeceasedBoolean = &b
+	}
+
+	s.subject = &Reference{Reference: "Patient/" + p.ID}
+	s.visit = nil
+	s.report = nil
+	s.obs = nil
+
+	return p
+}
+
+func (s *mapState) encounter(sg hl7.Segment) *Encounter {
+	e := &Encounter{
+		ResourceType: "Encounter",
+		ID:           s.id("Encounter"),
+		Identifier:   s.identifiers(sg.Field(19)),
+		Status:       "in-progress",
+		Class:        encounterClass(sg.Value(2)),
+		Subject:      s.subject,
+	}
+
+	start, end := dateTime(sg.Value(44)), dateTime(sg.Value(45))
+	if start != "" || end != "" {
+		e.Period = &Period{Start: start, End: end}
+	}
+
+	switch {
+	case end != "":
+		e.Status = "finished"
+	case s.event == "A05" || s.event == "A14":
+		e.Status = "planned"
+	case s.event == "A11" || s.event == "A27" || s.event == "A38":
+		e.Status = "cancelled"
+	}
+
+	for _, p := range []struct {
+		n    int
+		code string
+	}{{7, "ATND"}, {8, "REF"}, {9, "CON"}, {17, "ADM"}} {
+		for _, x := range hl7.DecodeXCNs(sg.Field(p.n)) {
+			r := practitioner(x)
+			if r == nil {
+				continue
+			}
+
+			e.Participant = append(e.Participant, EncounterParticipant{
+				Type: []CodeableConcept{{
+					Coding: []Coding{{System: "http://terminology.hl7.org/CodeSystem/v3-ParticipationType", Code: p.code}},
+				}},
+				Individual: r,
+			})
+		}
+	}
+
+	if l := location(first(sg.Field(3))); l != "" {
+		e.Location = append(e.Location, EncounterLocation{Location: Reference{Display: l}})
+	}
+
+	s.visit = &Reference{Reference: "Encounter/" + e.ID}
+
+	return e
+}
+
+func (s *mapState) diagnosticReport(sg hl7.Segment) *DiagnosticReport {
+	r := &DiagnosticReport{
+		ResourceType:      "DiagnosticReport",
+		ID:                s.id("DiagnosticReport"),
+		Status:            reportStatus(sg.Value(25)),
+		Subject:           s.subject,
+		Encounter:         s.visit,
+		EffectiveDateTime: dateTime(sg.Value(7)),
+		Issued:            instant(sg.Value(22)),
+	}
+
+	for i, n := range []int{2, 3} {
+		if v := sg.Value(n); v != "" {
+			r.Identifier = append(r.Identifier, Identifier{
+				Type: &CodeableConcept{
+					Coding: []Coding{{System: "http://terminology.hl7.org/CodeSystem/v2-0203", Code: []string{"PLAC", "FILL"}[i]}},
+				},
+				Value: v,
+			})
+		}
+	}
+
+	if c := s.codeableConcept(hl7.DecodeCWE(first(sg.Field(4)))); c != nil {
+		r.Code = *c
+	}
+
+	s.report = r
+	s.obs = nil
+	s.obr7 = r.EffectiveDateTime
+
+	return r
+}
+
+func (s *mapState) observation(sg hl7.Segment) *Observation {
+	if sg.Value(2) == "ED" && s.report != nil {
+		for _, fi := range sg.Field(5) {
+			e := hl7.DecodeED(fi)
+			if e.Data == "" {
+				continue
+			}
+
+			a := Attachment{ContentType: contentType(e), Title: hl7.DecodeCWE(first(sg.Field(3))).Text}
+			if b, err := e.Bytes(); err == nil {
+				a.Data = base64.StdEncoding.EncodeToString(b)
+			}
+
+			s.report.PresentedForm = append(s.report.PresentedForm, a)
+		}
+
+		s.obs = nil
+
+		return nil
+	}
+
+	o := &Observation{
+		ResourceType:      "Observation",
+		ID:                s.id("Observation"),
+		Status:            observationStatus(sg.Value(11)),
+		Subject:           s.subject,
+		Encounter:         s.visit,
+		EffectiveDateTime: dateTime(sg.Value(14)),
+	}
+
+	if o.EffectiveDateTime == "" {
+		o.EffectiveDateTime = s.obr7
+	}
+
+	if c := s.codeableConcept(hl7.DecodeCWE(first(sg.Field(3)))); c != nil {
+		o.Code = *c
+	}
+
+	s.observationValue(o, sg)
+
+	if v := sg.Value(7); v != "" {
+		o.ReferenceRange = append(o.ReferenceRange, referenceRange(v))
+	}
+
+	for _, fi := range sg.Field(8) {
+		if v := hl7.DecodeCWE(fi).Identifier; v != "" {
+			o.Interpretation = append(o.Interpretation, CodeableConcept{
+				Coding: []Coding{{System: "http://terminology.hl7.org/CodeSystem/v2-0078", Code: v}},
+			})
+		}
+	}
+
+	if s.report != nil {
+		s.report.Result = append(s.report.Result, Reference{Reference: "Observation/" + o.ID})
+	}
+
+	s.obs = o
+
+	return o
+}
+
+func (s *mapState) observationValue(o *Observation, sg hl7.Segment) {
+	units := hl7.DecodeCWE(first(sg.Field(6)))
+
+	values, err := hl7.ObservationValue(sg)
+	if err != nil {
+		// If the value doesn't match its declared type, keep the text of it
+		// rather than losing it completely.
+		o.ValueString = sg.Value(5)
+		return
+	}
+
+	var texts []string
+
+	// FHIR only has room for one value, so all but the first repetition is
+	// dropped, except for text, which is joined up.
+	for i, v := range values {
+		switch v := v.(type) {
+		case nil:
+			continue
+		case float64:
+			o.ValueQuantity = s.quantity(v, units)
+		case hl7.SN:
+			s.structuredNumeric(o, v, units)
+		case hl7.CQ:
+			o.ValueQuantity = s.quantity(v.Quantity, hl7.DecodeCWE(v.Units.Encode("")))
+		case hl7.CE:
+			o.ValueCodeableConcept = s.codeableConcept(hl7.DecodeCWE(v.Encode("")))
+		case hl7.CWE:
+			o.ValueCodeableConcept = s.codeableConcept(v)
+		case time.Time:
+			o.ValueDateTime = dateTime(text(sg.Field(5)[i]))
+		case string:
+			texts = append(texts, v)
+			continue
+		default:
+			texts = append(texts, text(sg.Field(5)[i]))
+			continue
+		}
+
+		break
+	}
+
+	if len(texts) > 0 {
+		o.ValueString = strings.Join(texts, "\n")
+	}
+}
+
+func (s *mapState) quantity(v float64, units hl7.CWE) *Quantity {
+	q := &Quantity{Value: &v}
+
+	if units.Identifier != "" {
+		q.Code = units.Identifier
+		q.System = s.system(units.CodingSystem)
+		q.Unit = units.Text
+		if q.Unit == "" {
+			q.Unit = units.Identifier
+		}
+	}
+
+	return q
+}
+
+func (s *mapState) structuredNumeric(o *Observation, v hl7.SN, units hl7.CWE) {
+	switch {
+	case v.IsRange():
+		o.ValueRange = &Range{Low: s.quantity(v.Num1, units), High: s.quantity(v.Num2, units)}
+	case v.IsRatio():
+		o.ValueRatio = &Ratio{Numerator: s.quantity(v.Num1, hl7.CWE{}), Denominator: s.quantity(v.Num2, hl7.CWE{})}
+	case v.HasNum1 && v.Separator == "":
+		o.ValueQuantity = s.quantity(v.Num1, units)
+		switch v.Comparator {
+		case "<", "<=", ">", ">=":
+			o.ValueQuantity.Comparator = v.Comparator
+		}
+	default:
+		o.ValueString = v.String()
+	}
+}
+
+func (s *mapState) note(sg hl7.Segment) {
+	if s.obs == nil {
+		return
+	}
+
+	var a []string
+	for _, fi := range sg.Field(3) {
+		a = append(a, text(fi))
+	}
+
+	if t := strings.Join(a, "\n"); t != "" {
+		s.obs.Note = append(s.obs.Note, Annotation{Text: t})
+	}
+}
@@ -0,0 +1,205 @@
+package fhir
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"fknsrs.biz/p/hl7"
+)
+
+const testADT = "MSH|^~\\&|ADT1^1.2.3^ISO|GOOD HEALTH HOSPITAL|GHH LAB|GHH|20240102120000+1000||ADT^A01^ADT_A01|MSG00001|P|2.5\r" +
+	"EVN|A01|20240102120000+1000\r" +
+	"PID|1||PATID1234^^^GHH^MR~123456789^^^USSSA^SS||EVERYMAN^ADAM^A^III^^^L||19610615|M||2106-3|2222 HOME STREET^^GREENSBORO^NC^27401-1020^USA^H||(555)555-2004^PRN^PH|^WPN^Internet^adam@example.com||S||||||||||||\r" +
+	"PV1|1|I|2000^2012^01||||004777^ATTEND^AARON^A^^DR|||SUR||||ADM|A0||||VN5678|||||||||||||||||||||||||20240102110000+1000\r"
+
+const testORU = "MSH|^~\\&|LAB|LABFAC|EMR|EMRFAC|20240103093000+1000||ORU^R01|MSG00002|P|2.5\r" +
+	"PID|1||PATID1234^^^GHH^MR||EVERYMAN^ADAM||19610615|M\r" +
+	"OBR|1|ORD1|FIL1|24331-1^Lipid panel^LN|||20240103080000+1000|||||||||||||||20240103090000+1000|||F\r" +
+	"OBX|1|NM|2093-3^Cholesterol^LN||196|mg/dL^mg/dL^UCUM|<200|N|||F\r" +
+	"NTE|1||Fasting sample\r" +
+	"OBX|2|SN|2571-8^Triglyceride^LN||>^150|mg/dL^mg/dL^UCUM|0-150|H|||F\r" +
+	"OBX|3|CE|883-9^ABO group^LN||A^Group A^L||||||F\r" +
+	"OBX|4|ST|8251-1^Comment^LN||See note||||||F\r" +
+	"OBX|5|ED|PDF^Report||^AP^PDF^Base64^aGVsbG8=||||||F\r"
+
+func TestMapADT(t *testing.T) {
+	a := assert.New(t)
+
+	m, _, err := hl7.ParseMessage([]byte(testADT))
+	a.NoError(err)
+
+	b, err := Map(m)
+	a.NoError(err)
+
+	a.Equal("message", b.Type)
+	a.Equal(&Identifier{Value: "MSG00001"}, b.Identifier)
+	a.Equal("2024-01-02T12:00:00+10:00", b.Timestamp)
+
+	if !a.Len(b.Entry, 3) {
+		return
+	}
+
+	mh := b.Entry[0].Resource.(*MessageHeader)
+	a.Equal("A01", mh.EventCoding.Code)
+	a.Equal(MessageSource{Name: "ADT1", Endpoint: "urn:oid:1.2.3"}, mh.Source)
+	a.Equal("GHH LAB", mh.Destination[0].Name)
+	a.Equal([]Reference{{Reference: "Patient/patient-1"}, {Reference: "Encounter/encounter-1"}}, mh.Focus)
+
+	p := b.Entry[1].Resource.(*Patient)
+	a.Equal("patient-1", p.ID)
+	a.Equal("male", p.Gender)
+	a.Equal("1961-06-15", p.BirthDate)
+	a.Equal([]HumanName{{Use: "official", Family: "EVERYMAN", Given: []string{"ADAM", "A"}, Suffix: []string{"III"}}}, p.Name)
+	if a.Len(p.Identifier, 2) {
+		a.Equal("PATID1234", p.Identifier[0].Value)
+		a.Equal(&Reference{Display: "GHH"}, p.Identifier[0].Assigner)
+		a.Equal("MR", p.Identifier[0].Type.Coding[0].Code)
+	}
+	a.Equal([]Address{{Use: "home", Line: []string{"2222 HOME STREET"}, City: "GREENSBORO", State: "NC", PostalCode: "27401-1020", Country: "USA"}}, p.Address)
+	a.Equal([]ContactPoint{
+		{System: "phone", Value: "(555)555-2004", Use: "home"},
+		{System: "email", Value: "adam@example.com", Use: "work"},
+	}, p.Telecom)
+	a.Equal("S", p.MaritalStatus.Coding[0].Code)
+
+	e := b.Entry[2].Resource.(*Encounter)
+	a.Equal("IMP", e.Class.Code)
+	a.Equal("in-progress", e.Status)
+	a.Equal(&Reference{Reference: "Patient/patient-1"}, e.Subject)
+	a.Equal("VN5678", e.Identifier[0].Value)
+	a.Equal(&Period{Start: "2024-01-02T11:00:00+10:00"}, e.Period)
+	a.Equal("2000, 2012, 01", e.Location[0].Location.Display)
+	if a.Len(e.Participant, 1) {
+		a.Equal("ATND", e.Participant[0].Type[0].Coding[0].Code)
+		a.Equal("DR AARON A ATTEND", e.Participant[0].Individual.Display)
+		a.Equal("004777", e.Participant[0].Individual.Identifier.Value)
+	}
+}
+
+func TestMapORU(t *testing.T) {
+	a := assert.New(t)
+
+	m, _, err := hl7.ParseMessage([]byte(testORU))
+	a.NoError(err)
+
+	b, err := Map(m)
+	a.NoError(err)
+
+	if !a.Len(b.Entry, 7) {
+		return
+	}
+
+	r := b.Entry[2].Resource.(*DiagnosticReport)
+	a.Equal("final", r.Status)
+	a.Equal("http://loinc.org", r.Code.Coding[0].System)
+	a.Equal("2024-01-03T08:00:00+10:00", r.EffectiveDateTime)
+	a.Equal("2024-01-03T09:00:00+10:00", r.Issued)
+	a.Len(r.Identifier, 2)
+	a.Len(r.Result, 4)
+	a.Equal([]Attachment{{ContentType: "application/pdf", Data: "aGVsbG8=", Title: "Report"}}, r.PresentedForm)
+
+	o := b.Entry[3].Resource.(*Observation)
+	a.Equal("final", o.Status)
+	a.Equal(196.0, *o.ValueQuantity.Value)
+	a.Equal("mg/dL", o.ValueQuantity.Code)
+	a.Equal("http://unitsofmeasure.org", o.ValueQuantity.System)
+	a.Equal("2024-01-03T08:00:00+10:00", o.EffectiveDateTime)
+	a.Equal([]ObservationReferenceRange{{Text: "<200"}}, o.ReferenceRange)
+	a.Equal("N", o.Interpretation[0].Coding[0].Code)
+	a.Equal([]Annotation{{Text: "Fasting sample"}}, o.Note)
+
+	o = b.Entry[4].Resource.(*Observation)
+	a.Equal(">", o.ValueQuantity.Comparator)
+	a.Equal(150.0, *o.ValueQuantity.Value)
+	if a.Len(o.ReferenceRange, 1) {
+		a.Equal(0.0, *o.ReferenceRange[0].Low.Value)
+		a.Equal(150.0, *o.ReferenceRange[0].High.Value)
+	}
+
+	o = b.Entry[5].Resource.(*Observation)
+	a.Equal(&CodeableConcept{Coding: []Coding{{Code: "A", Display: "Group A"}}}, o.ValueCodeableConcept)
+
+	o = b.Entry[6].Resource.(*Observation)
+	a.Equal("See note", o.ValueString)
+}
+
+func TestMapperHooks(t *testing.T) {
+	a := assert.New(t)
+
+	m, _, err := hl7.ParseMessage([]byte(testORU))
+	a.NoError(err)
+
+	mp := Mapper{
+		CodeSystem: func(name string) string {
+			if name == "LN" {
+				return "urn:test:loinc"
+			}
+			return DefaultCodeSystem(name)
+		},
+		Identifier: func(cx hl7.CX) *Identifier {
+			return &Identifier{System: "urn:test:" + cx.AssigningAuthority.NamespaceID, Value: cx.ID}
+		},
+		ID: func(resourceType string, n int) string {
+			return strings.ToUpper(resourceType[0:1]) + string(rune('0'+n))
+		},
+	}
+
+	b, err := mp.Map(m)
+	a.NoError(err)
+
+	p := b.Entry[1].Resource.(*Patient)
+	a.Equal("P1", p.ID)
+	a.Equal([]Identifier{{System: "urn:test:GHH", Value: "PATID1234"}}, p.Identifier)
+
+	r := b.Entry[2].Resource.(*DiagnosticReport)
+	a.Equal("urn:test:loinc", r.Code.Coding[0].System)
+	a.Equal(Reference{Reference: "Observation/O1"}, r.Result[0])
+}
+
+func TestMapPDF(t *testing.T) {
+	a := assert.New(t)
+
+	d, err := ioutil.ReadFile("../testdata/pdf_genetics.hl7")
+	a.NoError(err)
+
+	m, _, err := hl7.ParseMessage(d)
+	a.NoError(err)
+
+	b, err := Map(m)
+	a.NoError(err)
+
+	var r *DiagnosticReport
+	for _, e := range b.Entry {
+		if v, ok := e.Resource.(*DiagnosticReport); ok && r == nil {
+			r = v
+		}
+	}
+
+	if a.NotNil(r) && a.Len(r.PresentedForm, 1) {
+		a.Equal("application/pdf", r.PresentedForm[0].ContentType)
+		a.True(strings.HasPrefix(r.PresentedForm[0].Data, "JVBERi0"))
+	}
+
+	buf, err := json.Marshal(b)
+	a.NoError(err)
+	a.Contains(string(buf), `"resourceType":"DiagnosticReport"`)
+}
+
+func TestMapNoHeader(t *testing.T) {
+	a := assert.New(t)
+
+	_, err := Map(hl7.Message{hl7.Segment{hl7.Field{hl7.FieldItem{hl7.Component{"PID"}}}}})
+	a.Error(err)
+}
+
+func TestDefaultCodeSystem(t *testing.T) {
+	a := assert.New(t)
+
+	a.Equal("http://loinc.org", DefaultCodeSystem("LN"))
+	a.Equal("http://terminology.hl7.org/CodeSystem/v2-0078", DefaultCodeSystem("HL70078"))
+	a.Equal("", DefaultCodeSystem("L"))
+}
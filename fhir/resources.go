@@ -0,0 +1,248 @@
+package fhir // import "fknsrs.biz/p/hl7/fhir"
+
+// Resource is implemented by every FHIR resource in this package.
+type Resource interface {
+	FHIRResourceType() string
+}
+
+// Bundle holds the resources made from a single HL7 message. Its type is
+// always "message", with the MessageHeader as the first entry.
+type Bundle struct {
+	ResourceType string        `json:"resourceType"`
+	Identifier   *Identifier   `json:"identifier,omitempty"`
+	Type         string        `json:"type"`
+	Timestamp    string        `json:"timestamp,omitempty"`
+	Entry        []BundleEntry `json:"entry,omitempty"`
+}
+
+// FHIRResourceType implements Resource.
+func (Bundle) FHIRResourceType() string { return "Bundle" }
+
+// BundleEntry is one resource in a Bundle.
+type BundleEntry struct {
+	Resource Resource `json:"resource"`
+}
+
+// Coding is a code from a code system.
+type Coding struct {
+	System  string `json:"system,omitempty"`
+	Code    string `json:"code,omitempty"`
+	Display string `json:"display,omitempty"`
+}
+
+// CodeableConcept is a concept, described by codes and/or text.
+type CodeableConcept struct {
+	Coding []Coding `json:"coding,omitempty"`
+	Text   string   `json:"text,omitempty"`
+}
+
+// Identifier is an identifier for a resource, like a medical record number.
+type Identifier struct {
+	Use      string           `json:"use,omitempty"`
+	Type     *CodeableConcept `json:"type,omitempty"`
+	System   string           `json:"system,omitempty"`
+	Value    string           `json:"value,omitempty"`
+	Period   *Period          `json:"period,omitempty"`
+	Assigner *Reference       `json:"assigner,omitempty"`
+}
+
+// Reference points at another resource, either by id or by identifier and
+// description.
+type Reference struct {
+	Reference  string      `json:"reference,omitempty"`
+	Identifier *Identifier `json:"identifier,omitempty"`
+	Display    string      `json:"display,omitempty"`
+}
+
+// Period is a time range; either end may be left out.
+type Period struct {
+	Start string `json:"start,omitempty"`
+	End   string `json:"end,omitempty"`
+}
+
+// HumanName is a person's name.
+type HumanName struct {
+	Use    string   `json:"use,omitempty"`
+	Family string   `json:"family,omitempty"`
+	Given  []string `json:"given,omitempty"`
+	Prefix []string `json:"prefix,omitempty"`
+	Suffix []string `json:"suffix,omitempty"`
+	Period *Period  `json:"period,omitempty"`
+}
+
+// Address is a postal address.
+type Address struct {
+	Use        string   `json:"use,omitempty"`
+	Type       string   `json:"type,omitempty"`
+	Line       []string `json:"line,omitempty"`
+	City       string   `json:"city,omitempty"`
+	District   string   `json:"district,omitempty"`
+	State      string   `json:"state,omitempty"`
+	PostalCode string   `json:"postalCode,omitempty"`
+	Country    string   `json:"country,omitempty"`
+	Period     *Period  `json:"period,omitempty"`
+}
+
+// ContactPoint is a phone number, email address, or similar.
+type ContactPoint struct {
+	System string `json:"system,omitempty"`
+	Value  string `json:"value,omitempty"`
+	Use    string `json:"use,omitempty"`
+}
+
+// Quantity is a measured amount. Value is a pointer so that zero can be told
+// apart from no value at all.
+type Quantity struct {
+	Value      *float64 `json:"value,omitempty"`
+	Comparator string   `json:"comparator,omitempty"`
+	Unit       string   `json:"unit,omitempty"`
+	System     string   `json:"system,omitempty"`
+	Code       string   `json:"code,omitempty"`
+}
+
+// Range is a set of values bounded by low and high.
+type Range struct {
+	Low  *Quantity `json:"low,omitempty"`
+	High *Quantity `json:"high,omitempty"`
+}
+
+// Ratio is a ratio of two quantities, like a titer.
+type Ratio struct {
+	Numerator   *Quantity `json:"numerator,omitempty"`
+	Denominator *Quantity `json:"denominator,omitempty"`
+}
+
+// Annotation is a text note.
+type Annotation struct {
+	Text string `json:"text"`
+}
+
+// Attachment holds content in some other format, like a PDF report.
+type Attachment struct {
+	ContentType string `json:"contentType,omitempty"`
+	Data        string `json:"data,omitempty"`
+	Title       string `json:"title,omitempty"`
+}
+
+// Patient is made from PID.
+type Patient struct {
+	ResourceType     string           `json:"resourceType"`
+	ID               string           `json:"id,omitempty"`
+	Identifier       []Identifier     `json:"identifier,omitempty"`
+	Name             []HumanName      `json:"name,omitempty"`
+	Telecom          []ContactPoint   `json:"telecom,omitempty"`
+	Gender           string           `json:"gender,omitempty"`
+	BirthDate        string           `json:"birthDate,omitempty"`
+	DeceasedBoolean  *bool            `json:"deceasedBoolean,omitempty"`
+	DeceasedDateTime string           `json:"deceasedDateTime,omitempty"`
+	Address          []Address        `json:"address,omitempty"`
+	MaritalStatus    *CodeableConcept `json:"maritalStatus,omitempty"`
+}
+
+// FHIRResourceType implements Resource.
+func (Patient) FHIRResourceType() string { return "Patient" }
+
+// Encounter is made from PV1.
+type Encounter struct {
+	ResourceType string                 `json:"resourceType"`
+	ID           string                 `json:"id,omitempty"`
+	Identifier   []Identifier           `json:"identifier,omitempty"`
+	Status       string                 `json:"status"`
+	Class        Coding                 `json:"class"`
+	Subject      *Reference             `json:"subject,omitempty"`
+	Participant  []EncounterParticipant `json:"participant,omitempty"`
+	Period       *Period                `json:"period,omitempty"`
+	Location     []EncounterLocation    `json:"location,omitempty"`
+}
+
+// FHIRResourceType implements Resource.
+func (Encounter) FHIRResourceType() string { return "Encounter" }
+
+// EncounterParticipant is someone involved in an encounter, like the
+// attending doctor.
+type EncounterParticipant struct {
+	Type       []CodeableConcept `json:"type,omitempty"`
+	Individual *Reference        `json:"individual,omitempty"`
+}
+
+// EncounterLocation is somewhere the patient was during an encounter.
+type EncounterLocation struct {
+	Location Reference `json:"location"`
+}
+
+// Observation is made from OBX.
+type Observation struct {
+	ResourceType         string                      `json:"resourceType"`
+	ID                   string                      `json:"id,omitempty"`
+	Status               string                      `json:"status"`
+	Code                 CodeableConcept             `json:"code"`
+	Subject              *Reference                  `json:"subject,omitempty"`
+	Encounter            *Reference                  `json:"encounter,omitempty"`
+	EffectiveDateTime    string                      `json:"effectiveDateTime,omitempty"`
+	ValueQuantity        *Quantity                   `json:"valueQuantity,omitempty"`
+	ValueCodeableConcept *CodeableConcept            `json:"valueCodeableConcept,omitempty"`
+	ValueString          string                      `json:"valueString,omitempty"`
+	ValueDateTime        string                      `json:"valueDateTime,omitempty"`
+	ValueRange           *Range                      `json:"valueRange,omitempty"`
+	ValueRatio           *Ratio                      `json:"valueRatio,omitempty"`
+	Interpretation       []CodeableConcept           `json:"interpretation,omitempty"`
+	Note                 []Annotation                `json:"note,omitempty"`
+	ReferenceRange       []ObservationReferenceRange `json:"referenceRange,omitempty"`
+}
+
+// FHIRResourceType implements Resource.
+func (Observation) FHIRResourceType() string { return "Observation" }
+
+// ObservationReferenceRange is the normal range for an observation.
+type ObservationReferenceRange struct {
+	Low  *Quantity `json:"low,omitempty"`
+	High *Quantity `json:"high,omitempty"`
+	Text string    `json:"text,omitempty"`
+}
+
+// DiagnosticReport is made from OBR, and refers to the observations made
+// from the OBX segments that follow it. OBX segments holding ED values (like
+// PDF reports) become presented forms of the report instead of observations.
+type DiagnosticReport struct {
+	ResourceType      string          `json:"resourceType"`
+	ID                string          `json:"id,omitempty"`
+	Identifier        []Identifier    `json:"identifier,omitempty"`
+	Status            string          `json:"status"`
+	Code              CodeableConcept `json:"code"`
+	Subject           *Reference      `json:"subject,omitempty"`
+	Encounter         *Reference      `json:"encounter,omitempty"`
+	EffectiveDateTime string          `json:"effectiveDateTime,omitempty"`
+	Issued            string          `json:"issued,omitempty"`
+	Result            []Reference     `json:"result,omitempty"`
+	PresentedForm     []Attachment    `json:"presentedForm,omitempty"`
+}
+
+// FHIRResourceType implements Resource.
+func (DiagnosticReport) FHIRResourceType() string { return "DiagnosticReport" }
+
+// MessageHeader is made from MSH.
+type MessageHeader struct {
+	ResourceType string               `json:"resourceType"`
+	ID           string               `json:"id,omitempty"`
+	EventCoding  Coding               `json:"eventCoding"`
+	Destination  []MessageDestination `json:"destination,omitempty"`
+	Sender       *Reference           `json:"sender,omitempty"`
+	Source       MessageSource        `json:"source"`
+	Focus        []Reference          `json:"focus,omitempty"`
+}
+
+// FHIRResourceType implements Resource.
+func (MessageHeader) FHIRResourceType() string { return "MessageHeader" }
+
+// MessageDestination is where a message was sent, from MSH-5 and MSH-6.
+type MessageDestination struct {
+	Name     string     `json:"name,omitempty"`
+	Endpoint string     `json:"endpoint"`
+	Receiver *Reference `json:"receiver,omitempty"`
+}
+
+// MessageSource is where a message came from, from MSH-3.
+type MessageSource struct {
+	Name     string `json:"name,omitempty"`
+	Endpoint string `json:"endpoint"`
+}
@@ -0,0 +1,345 @@
+// Package filedrop picks up HL7 files that other systems drop into a
+// directory, passes the messages in them to a handler, and then moves each
+// file out of the way: to a "processed" directory if every message in it was
+// accepted, or to an "error" directory, with a report beside it, if not.
+package filedrop // import "fknsrs.biz/p/hl7/filedrop"
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/facebookgo/stackerr"
+
+	"fknsrs.biz/p/hl7"
+)
+
+// Watcher polls a directory for files. Files can hold any number of
+// messages, and can be batch files (with FHS and BHS segments).
+//
+// A file isn't touched until its size and modification time have stayed the
+// same for Settle, so that files that are still being written aren't picked
+// up half done. Writers that can should still write to a temporary name
+// (one that doesn't match Pattern, or that starts with a dot) and rename the
+// file when it's done.
+type Watcher struct {
+	// Dir is the directory to watch.
+	Dir string
+	// Handler handles each message. A message counts as accepted if the
+	// handler's acknowledgement (see hl7.Respond) is AA or CA.
+	Handler hl7.Handler
+	// Pattern is matched against file names, using filepath.Match. It
+	// defaults to "*.hl7". Names starting with a dot are always ignored.
+	Pattern string
+	// ProcessedDir and ErrorDir are where files go after they've been
+	// handled. They default to "processed" and "error" inside Dir.
+	ProcessedDir string
+	ErrorDir     string
+	// Interval is how often Run polls the directory. It defaults to five
+	// seconds.
+	Interval time.Duration
+	// Settle is how long a file has to stay the same before it's picked
+	// up. If it's zero, files are picked up as soon as they're seen.
+	Settle time.Duration
+	// ErrorLog is used to log problems with files. If it's nil, the log
+	// package's standard logger is used.
+	ErrorLog *log.Logger
+
+	now    func() time.Time
+	rename func(oldpath, newpath string) error
+	files  map[string]fileState
+	stuck  map[string]fileState
+}
+
+type fileState struct {
+	size  int64
+	mod   time.Time
+	since time.Time
+}
+
+// New returns a Watcher for dir, with the defaults described on Watcher,
+// and a Settle time of two seconds.
+func New(dir string, h hl7.Handler) *Watcher {
+	return &Watcher{
+		Dir:          dir,
+		Handler:      h,
+		Pattern:      "*.hl7",
+		ProcessedDir: filepath.Join(dir, "processed"),
+		ErrorDir:     filepath.Join(dir, "error"),
+		Interval:     5 * time.Second,
+		Settle:       2 * time.Second,
+	}
+}
+
+// Run polls the directory until ctx is done. Problems with individual files
+// are logged, and don't stop it; it only returns early if it can't create the
+// processed and error directories.
+func (w *Watcher) Run(ctx context.Context) error {
+	interval := w.Interval
+	if interval <= 0 {
+		interval = 5 * time.Second
+	}
+
+	t := time.NewTicker(interval)
+	defer t.Stop()
+
+	for {
+		if err := w.Poll(ctx); err != nil {
+			if _, ok := err.(ErrDirectory); ok {
+				return err
+			}
+
+			w.logf("filedrop: %s", hl7.ErrorText(err))
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-t.C:
+		}
+	}
+}
+
+// ErrDirectory is returned by Poll when the processed or error directory
+// can't be created.
+type ErrDirectory struct {
+	Dir string
+	Err error
+}
+
+func (e ErrDirectory) Error() string {
+	return fmt.Sprintf("can't create %s: %s", e.Dir, e.Err)
+}
+
+// Unwrap returns the error from creating the directory.
+func (e ErrDirectory) Unwrap() error {
+	return e.Err
+}
+
+// Poll looks through the directory once, handling every file that's ready.
+// It returns the first error it comes across, but carries on with the other
+// files regardless.
+func (w *Watcher) Poll(ctx context.Context) error {
+	processed, failed := w.dirs()
+
+	for _, d := range []string{processed, failed} {
+		if err := os.MkdirAll(d, 0755); err != nil {
+			return ErrDirectory{Dir: d, Err: stackerr.Wrap(err)}
+		}
+	}
+
+	l, err := ioutil.ReadDir(w.Dir)
+	if err != nil {
+		return stackerr.Wrap(err)
+	}
+
+	pattern := w.Pattern
+	if pattern == "" {
+		pattern = "*.hl7"
+	}
+
+	now := time.Now
+	if w.now != nil {
+		now = w.now
+	}
+
+	if w.files == nil {
+		w.files = make(map[string]fileState)
+		w.stuck = make(map[string]fileState)
+	}
+
+	present := make(map[string]bool)
+
+	var first error
+
+	for _, fi := range l {
+		name := fi.Name()
+
+		if !fi.Mode().IsRegular() || strings.HasPrefix(name, ".") {
+			continue
+		}
+		if ok, err := filepath.Match(pattern, name); err != nil {
+			return stackerr.Wrap(err)
+		} else if !ok {
+			continue
+		}
+
+		present[name] = true
+
+		// a file that's been handled but couldn't be moved away is left
+		// alone, so that its messages aren't handled again and again, until
+		// someone deals with it
+		if s, ok := w.stuck[name]; ok && s.size == fi.Size() && s.mod.Equal(fi.ModTime()) {
+			continue
+		}
+		delete(w.stuck, name)
+
+		if w.Settle > 0 {
+			s, ok := w.files[name]
+			if !ok || s.size != fi.Size() || !s.mod.Equal(fi.ModTime()) {
+				w.files[name] = fileState{size: fi.Size(), mod: fi.ModTime(), since: now()}
+				continue
+			}
+			if now().Sub(s.since) < w.Settle {
+				continue
+			}
+		}
+
+		delete(w.files, name)
+
+		if err := w.process(ctx, name, processed, failed); err != nil && first == nil {
+			first = err
+		}
+
+		if ctx.Err() != nil {
+			break
+		}
+	}
+
+	for name := range w.files {
+		if !present[name] {
+			delete(w.files, name)
+		}
+	}
+	for name := range w.stuck {
+		if !present[name] {
+			delete(w.stuck, name)
+		}
+	}
+
+	return first
+}
+
+func (w *Watcher) dirs() (string, string) {
+	processed, failed := w.ProcessedDir, w.ErrorDir
+	if processed == "" {
+		processed = filepath.Join(w.Dir, "processed")
+	}
+	if failed == "" {
+		failed = filepath.Join(w.Dir, "error")
+	}
+
+	return processed, failed
+}
+
+// process handles all of the messages in one file, and moves it to where it
+// belongs.
+func (w *Watcher) process(ctx context.Context, name, processed, failed string) error {
+	p := filepath.Join(w.Dir, name)
+
+	b, err := ioutil.ReadFile(p)
+	if err != nil {
+		return stackerr.Wrap(err)
+	}
+
+	var report bytes.Buffer
+
+	a := hl7.SplitMessages(b)
+	if len(a) == 0 {
+		fmt.Fprintf(&report, "no messages found\n")
+	}
+
+	for i, mb := range a {
+		m, d, err := hl7.ParseMessage(mb)
+		if err != nil {
+			fmt.Fprintf(&report, "message %d: %s\n", i+1, hl7.ErrorText(err))
+			continue
+		}
+
+		ack, err := hl7.ReadACK(hl7.Respond(ctx, w.Handler, m, d))
+		if err != nil {
+			fmt.Fprintf(&report, "message %d (%s): %s\n", i+1, m.Segment("MSH", 0).Value(10), hl7.ErrorText(err))
+			continue
+		}
+
+		if !ack.OK() {
+			fmt.Fprintf(&report, "message %d (%s): got %s", i+1, m.Segment("MSH", 0).Value(10), ack.Code)
+			if ack.Text != "" {
+				fmt.Fprintf(&report, ": %s", ack.Text)
+			}
+			fmt.Fprintf(&report, "\n")
+		}
+	}
+
+	if report.Len() == 0 {
+		if _, err := w.move(p, processed); err != nil {
+			w.stick(name)
+			return err
+		}
+		return nil
+	}
+
+	dest, err := w.move(p, failed)
+	if err != nil {
+		w.stick(name)
+		return err
+	}
+
+	if err := ioutil.WriteFile(dest+".err", report.Bytes(), 0644); err != nil {
+		return stackerr.Wrap(err)
+	}
+
+	return stackerr.Newf("%s: %s", name, strings.TrimSpace(strings.SplitN(report.String(), "\n", 2)[0]))
+}
+
+// stick remembers that a file in the directory has been handled but couldn't
+// be moved, so that Poll leaves it alone until it changes.
+func (w *Watcher) stick(name string) {
+	if fi, err := os.Stat(filepath.Join(w.Dir, name)); err == nil {
+		w.stuck[name] = fileState{size: fi.Size(), mod: fi.ModTime()}
+	}
+}
+
+// move moves a file into a directory, adding a timestamp to its name if
+// there's already a file there with the same name. If the directory is on
+// another device, the file is copied and then removed. It returns the file's
+// new path.
+func (w *Watcher) move(p, dir string) (string, error) {
+	dest := filepath.Join(dir, filepath.Base(p))
+
+	if _, err := os.Stat(dest); err == nil {
+		dest = filepath.Join(dir, time.Now().Format("20060102T150405.000000000")+"-"+filepath.Base(p))
+	}
+
+	rename := os.Rename
+	if w.rename != nil {
+		rename = w.rename
+	}
+
+	if err := rename(p, dest); err == nil {
+		return dest, nil
+	} else if le, ok := err.(*os.LinkError); !ok || le.Err != syscall.EXDEV {
+		return "", stackerr.Wrap(err)
+	}
+
+	b, err := ioutil.ReadFile(p)
+	if err != nil {
+		return "", stackerr.Wrap(err)
+	}
+
+	if err := ioutil.WriteFile(dest, b, 0644); err != nil {
+		os.Remove(dest)
+		return "", stackerr.Wrap(err)
+	}
+
+	if err := os.Remove(p); err != nil {
+		return "", stackerr.Wrap(err)
+	}
+
+	return dest, nil
+}
+
+func (w *Watcher) logf(format string, args ...interface{}) {
+	if w.ErrorLog != nil {
+		w.ErrorLog.Printf(format, args...)
+	} else {
+		log.Printf(format, args...)
+	}
+}
@@ -0,0 +1,254 @@
+package filedrop
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"fknsrs.biz/p/hl7"
+)
+
+func testMessage(id, mrn string) string {
+	return "MSH|^~\\&|APP|FAC|RAPP|RFAC|20240102||ADT^A01|" + id + "|P|2.5\rPID|1||" + mrn + "\r"
+}
+
+func testWatcher(t *testing.T) (*Watcher, *[]string, func()) {
+	dir, err := ioutil.TempDir("", "filedrop")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var seen []string
+
+	w := New(dir, hl7.HandlerFunc(func(ctx context.Context, m hl7.Message, d *hl7.Delimiters) (hl7.Message, error) {
+		seen = append(seen, m.Segment("MSH", 0).Value(10))
+
+		if m.Segment("PID", 0).Value(3) == "bad" {
+			return nil, errors.New("unknown patient")
+		}
+
+		return nil, nil
+	}))
+	w.Settle = 0
+
+	return w, &seen, func() { os.RemoveAll(dir) }
+}
+
+func writeFile(t *testing.T, p, s string) {
+	if err := ioutil.WriteFile(p, []byte(s), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestPoll(t *testing.T) {
+	a := assert.New(t)
+
+	w, seen, done := testWatcher(t)
+	defer done()
+
+	writeFile(t, filepath.Join(w.Dir, "one.hl7"), testMessage("1", "123"))
+	writeFile(t, filepath.Join(w.Dir, "many.hl7"), testMessage("2", "123")+"\n"+testMessage("3", "456"))
+	writeFile(t, filepath.Join(w.Dir, "batch.hl7"), strings.Join([]string{
+		"FHS|^~\\&|APP|FAC",
+		"BHS|^~\\&|APP|FAC",
+		strings.TrimSuffix(testMessage("4", "123"), "\r"),
+		strings.TrimSuffix(testMessage("5", "123"), "\r"),
+		"BTS|2",
+		"FTS|1",
+	}, "\r"))
+	writeFile(t, filepath.Join(w.Dir, "other.txt"), testMessage("6", "123"))
+	writeFile(t, filepath.Join(w.Dir, ".partial.hl7"), testMessage("7", "123"))
+
+	a.NoError(w.Poll(context.Background()))
+	a.ElementsMatch([]string{"1", "2", "3", "4", "5"}, *seen)
+
+	for _, name := range []string{"one.hl7", "many.hl7", "batch.hl7"} {
+		_, err := os.Stat(filepath.Join(w.Dir, "processed", name))
+		a.NoError(err, name)
+		_, err = os.Stat(filepath.Join(w.Dir, name))
+		a.True(os.IsNotExist(err), name)
+	}
+
+	for _, name := range []string{"other.txt", ".partial.hl7"} {
+		_, err := os.Stat(filepath.Join(w.Dir, name))
+		a.NoError(err, name)
+	}
+}
+
+func TestPollErrors(t *testing.T) {
+	a := assert.New(t)
+
+	w, seen, done := testWatcher(t)
+	defer done()
+
+	writeFile(t, filepath.Join(w.Dir, "mixed.hl7"), testMessage("1", "123")+testMessage("2", "bad")+testMessage("3", "123"))
+
+	err := w.Poll(context.Background())
+	if a.Error(err) {
+		a.Equal("mixed.hl7: message 2 (2): got AE: unknown patient", hl7.ErrorText(err))
+	}
+	a.Equal([]string{"1", "2", "3"}, *seen)
+
+	b, err := ioutil.ReadFile(filepath.Join(w.Dir, "error", "mixed.hl7.err"))
+	a.NoError(err)
+	a.Equal("message 2 (2): got AE: unknown patient\n", string(b))
+
+	writeFile(t, filepath.Join(w.Dir, "empty.hl7"), "")
+	writeFile(t, filepath.Join(w.Dir, "mixed.hl7"), testMessage("4", "bad"))
+
+	a.Error(w.Poll(context.Background()))
+
+	b, err = ioutil.ReadFile(filepath.Join(w.Dir, "error", "empty.hl7.err"))
+	a.NoError(err)
+	a.Equal("no messages found\n", string(b))
+
+	l, err := filepath.Glob(filepath.Join(w.Dir, "error", "*mixed.hl7"))
+	a.NoError(err)
+	a.Len(l, 2)
+}
+
+func TestPollSettle(t *testing.T) {
+	a := assert.New(t)
+
+	w, seen, done := testWatcher(t)
+	defer done()
+
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	w.now = func() time.Time { return now }
+	w.Settle = time.Second
+
+	p := filepath.Join(w.Dir, "slow.hl7")
+
+	writeFile(t, p, "MSH|^~\\&|APP|FAC")
+	a.NoError(w.Poll(context.Background()))
+	a.Empty(*seen)
+
+	now = now.Add(500 * time.Millisecond)
+	writeFile(t, p, testMessage("1", "123"))
+	a.NoError(os.Chtimes(p, now, now))
+	a.NoError(w.Poll(context.Background()))
+	a.Empty(*seen)
+
+	now = now.Add(500 * time.Millisecond)
+	a.NoError(w.Poll(context.Background()))
+	a.Empty(*seen)
+
+	now = now.Add(500 * time.Millisecond)
+	a.NoError(w.Poll(context.Background()))
+	a.Equal([]string{"1"}, *seen)
+	a.Empty(w.files)
+}
+
+// dropFile writes a file the way a well-behaved writer would, so that Run
+// can't see it half written.
+func dropFile(t *testing.T, dir, name, s string) {
+	writeFile(t, filepath.Join(dir, "."+name), s)
+
+	if err := os.Rename(filepath.Join(dir, "."+name), filepath.Join(dir, name)); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func waitFile(t *testing.T, p string) {
+	for i := 0; i < 500; i++ {
+		if _, err := os.Stat(p); err == nil {
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	t.Fatalf("%s never showed up", p)
+}
+
+func TestRun(t *testing.T) {
+	a := assert.New(t)
+
+	w, _, done := testWatcher(t)
+	defer done()
+
+	w.Interval = 10 * time.Millisecond
+	w.ErrorLog = log.New(ioutil.Discard, "", 0)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	errs := make(chan error, 1)
+	go func() { errs <- w.Run(ctx) }()
+
+	dropFile(t, w.Dir, "bad.hl7", testMessage("1", "bad"))
+	waitFile(t, filepath.Join(w.Dir, "error", "bad.hl7"))
+
+	dropFile(t, w.Dir, "good.hl7", testMessage("2", "123"))
+	waitFile(t, filepath.Join(w.Dir, "processed", "good.hl7"))
+
+	cancel()
+	a.NoError(<-errs)
+}
+
+func TestRunDirectory(t *testing.T) {
+	a := assert.New(t)
+
+	w, _, done := testWatcher(t)
+	defer done()
+
+	writeFile(t, filepath.Join(w.Dir, "processed"), "not a directory")
+
+	err := w.Run(context.Background())
+	if a.Error(err) {
+		a.IsType(ErrDirectory{}, err)
+		a.Equal(filepath.Join(w.Dir, "processed"), err.(ErrDirectory).Dir)
+		a.Equal(err.(ErrDirectory).Err, errors.Unwrap(err))
+	}
+}
+
+func TestPollMoveFailed(t *testing.T) {
+	a := assert.New(t)
+
+	w, seen, done := testWatcher(t)
+	defer done()
+
+	// another device, which is fine, since the file can be copied instead
+	w.rename = func(oldpath, newpath string) error {
+		return &os.LinkError{Op: "rename", Old: oldpath, New: newpath, Err: syscall.EXDEV}
+	}
+
+	writeFile(t, filepath.Join(w.Dir, "one.hl7"), testMessage("1", "123"))
+
+	a.NoError(w.Poll(context.Background()))
+	a.Equal([]string{"1"}, *seen)
+
+	b, err := ioutil.ReadFile(filepath.Join(w.Dir, "processed", "one.hl7"))
+	a.NoError(err)
+	a.Equal(testMessage("1", "123"), string(b))
+	_, err = os.Stat(filepath.Join(w.Dir, "one.hl7"))
+	a.True(os.IsNotExist(err))
+
+	// a file that can't be moved at all is only handled once
+	w.rename = func(oldpath, newpath string) error {
+		return &os.LinkError{Op: "rename", Old: oldpath, New: newpath, Err: syscall.EPERM}
+	}
+
+	p := filepath.Join(w.Dir, "two.hl7")
+	writeFile(t, p, testMessage("2", "123"))
+
+	a.Error(w.Poll(context.Background()))
+	a.NoError(w.Poll(context.Background()))
+	a.Equal([]string{"1", "2"}, *seen)
+
+	// until it changes
+	writeFile(t, p, testMessage("3", "123"))
+	later := time.Now().Add(time.Minute)
+	a.NoError(os.Chtimes(p, later, later))
+
+	a.Error(w.Poll(context.Background()))
+	a.Equal([]string{"1", "2", "3"}, *seen)
+}
@@ -0,0 +1,45 @@
+package hl7 // import "fknsrs.biz/p/hl7"
+
+import (
+	"context"
+	"strings"
+)
+
+// Handler processes messages for a receiver, like an MLLP server. It returns
+// the acknowledgement to send back to the sender. If it returns an error, the
+// sender gets an AE acknowledgement with the error's text instead; if it
+// returns neither, the sender gets a plain AA.
+type Handler interface {
+	ServeHL7(ctx context.Context, m Message, d *Delimiters) (Message, error)
+}
+
+// HandlerFunc lets an ordinary function be used as a Handler.
+type HandlerFunc func(ctx context.Context, m Message, d *Delimiters) (Message, error)
+
+// ServeHL7 calls f(ctx, m, d).
+func (f HandlerFunc) ServeHL7(ctx context.Context, m Message, d *Delimiters) (Message, error) {
+	return f(ctx, m, d)
+}
+
+// Respond passes a message to a handler and returns the acknowledgement to
+// send back, following the rules described for Handler. Receivers use this so
+// that they all treat handlers the same way.
+func Respond(ctx context.Context, h Handler, m Message, d *Delimiters) Message {
+	ack, err := h.ServeHL7(ctx, m, d)
+	if err != nil {
+		return NewACK(m, d, AckError, ErrorText(err))
+	}
+
+	if ack == nil {
+		return NewACK(m, d, AckAccept, "")
+	}
+
+	return ack
+}
+
+// ErrorText returns the first line of an error's text. Errors from this
+// package carry a stack trace after their message, which doesn't belong in
+// an acknowledgement.
+func ErrorText(err error) string {
+	return strings.SplitN(err.Error(), "\n", 2)[0]
+}
@@ -0,0 +1,33 @@
+package hl7
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRespond(t *testing.T) {
+	a := assert.New(t)
+
+	m, d, err := ParseMessage([]byte("MSH|^~\\&|APP|FAC|RAPP|RFAC|20240102||ADT^A01|MSG1|P|2.5\r"))
+	a.NoError(err)
+
+	ack := Respond(context.Background(), HandlerFunc(func(ctx context.Context, m Message, d *Delimiters) (Message, error) {
+		return nil, nil
+	}), m, d)
+	a.Equal("AA", ack.Segment("MSA", 0).Value(1))
+
+	ack = Respond(context.Background(), HandlerFunc(func(ctx context.Context, m Message, d *Delimiters) (Message, error) {
+		return nil, errors.New("no good\nstack trace goes here")
+	}), m, d)
+	a.Equal("AE", ack.Segment("MSA", 0).Value(1))
+	a.Equal("no good", ack.Segment("MSA", 0).Value(3))
+
+	custom := NewACK(m, d, AckReject, "go away")
+	ack = Respond(context.Background(), HandlerFunc(func(ctx context.Context, m Message, d *Delimiters) (Message, error) {
+		return custom, nil
+	}), m, d)
+	a.Equal(custom, ack)
+}
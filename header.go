@@ -0,0 +1,182 @@
+package hl7 // import "fknsrs.biz/p/hl7"
+
+import (
+	"strings"
+	"time"
+
+	"github.com/facebookgo/stackerr"
+)
+
+// ErrNoHeader is returned when a message doesn't have an MSH segment.
+type ErrNoHeader error
+
+// ErrHeaderField is returned by Header, along with the rest of the header,
+// when one of the fields in the MSH segment can't be decoded.
+type ErrHeaderField struct {
+	Field string // like "MSH-7"
+	Err   error
+}
+
+func (e ErrHeaderField) Error() string {
+	return e.Field + ": " + e.Err.Error()
+}
+
+// Unwrap returns the error from decoding the field.
+func (e ErrHeaderField) Unwrap() error {
+	return e.Err
+}
+
+// Header is a typed view of the interesting parts of an MSH segment.
+type Header struct {
+	SendingApplication   HD        // MSH-3
+	SendingFacility      HD        // MSH-4
+	ReceivingApplication HD        // MSH-5
+	ReceivingFacility    HD        // MSH-6
+	Timestamp            time.Time // MSH-7
+	MessageCode          string    // MSH-9-1
+	TriggerEvent         string    // MSH-9-2
+	MessageStructure     string    // MSH-9-3
+	ControlID            string    // MSH-10
+	ProcessingID         string    // MSH-11-1
+	Version              string    // MSH-12-1
+	AcceptAckType        string    // MSH-15
+	ApplicationAckType   string    // MSH-16
+	CharacterSet         string    // MSH-18, first repetition
+}
+
+// Header extracts the contents of the MSH segment. It returns an error if
+// there's no MSH segment. If the timestamp in MSH-7 is invalid, it returns
+// the header with a zero Timestamp, along with an ErrHeaderField.
+func (m Message) Header() (*Header, error) {
+	s := m.Segment("MSH", 0)
+	if s == nil {
+		return nil, ErrNoHeader(stackerr.Newf("message has no MSH segment"))
+	}
+
+	var herr error
+
+	t, err := ParseTime(s.Value(7))
+	if err != nil {
+		herr = ErrHeaderField{Field: "MSH-7", Err: err}
+	}
+
+	msh9 := s.Field(9).item(0)
+
+	return &Header{
+		SendingApplication:   DecodeHD(s.Field(3).item(0)),
+		SendingFacility:      DecodeHD(s.Field(4).item(0)),
+		ReceivingApplication: DecodeHD(s.Field(5).item(0)),
+		ReceivingFacility:    DecodeHD(s.Field(6).item(0)),
+		Timestamp:            t,
+		MessageCode:          msh9.get(1),
+		TriggerEvent:         msh9.get(2),
+		MessageStructure:     msh9.get(3),
+		ControlID:            s.Value(10),
+		ProcessingID:         s.Value(11),
+		Version:              s.Value(12),
+		AcceptAckType:        s.Value(15),
+		ApplicationAckType:   s.Value(16),
+		CharacterSet:         s.Value(18),
+	}, herr
+}
+
+// Version returns the version of the standard the message claims to follow,
+// from MSH-12. This is what the data type encoders expect.
+func (m Message) Version() string {
+	return m.Segment("MSH", 0).Value(12)
+}
+
+// Type returns the message code and trigger event from MSH-9, like
+// "ADT^A01", or just the message code if there's no trigger event.
+func (m Message) Type() string {
+	msh9 := m.Segment("MSH", 0).Field(9).item(0)
+	return strings.TrimSuffix(msh9.get(1)+"^"+msh9.get(2), "^")
+}
+
+// SetHeader writes the contents of h into the message's MSH segment. Fields
+// that aren't represented in Header (like MSH-8 or MSH-13) are left alone, as
+// are the extra components of MSH-11 and MSH-12, and any repetitions of MSH-18
+// after the first. MSH-7 is only rewritten if Timestamp is a different time
+// from what's there, so that the sender's precision and time zone (or lack of
+// one) survive a round trip. It returns an error if there's no MSH segment.
+func (m Message) SetHeader(h *Header) error {
+	for i, s := range m {
+		if s.Name() != "MSH" {
+			continue
+		}
+
+		m[i] = h.apply(s)
+
+		return nil
+	}
+
+	return ErrNoHeader(stackerr.Newf("message has no MSH segment"))
+}
+
+// Segment builds a new MSH segment from the header, using the given
+// delimiters for MSH-1 and MSH-2.
+func (h *Header) Segment(d *Delimiters) Segment {
+	s := Segment{
+		Field{FieldItem{Component{"MSH"}}},
+		Field{FieldItem{Component{Subcomponent(d.Field)}}},
+		Field{FieldItem{Component{Subcomponent([]byte{d.Component, d.Repeat, d.Escape, d.Subcomponent})}}},
+	}
+
+	return h.apply(s)
+}
+
+func (h *Header) apply(s Segment) Segment {
+	s = s.SetField(3, makeField(h.SendingApplication.Encode(h.Version)))
+	s = s.SetField(4, makeField(h.SendingFacility.Encode(h.Version)))
+	s = s.SetField(5, makeField(h.ReceivingApplication.Encode(h.Version)))
+	s = s.SetField(6, makeField(h.ReceivingFacility.Encode(h.Version)))
+	// a timestamp that couldn't be parsed comes back from Header as a zero
+	// time, so that doesn't count as a change either
+	if t, err := ParseTime(s.Value(7)); (err == nil && !t.Equal(h.Timestamp)) || (err != nil && !h.Timestamp.IsZero()) {
+		s = s.SetField(7, makeField(makeFieldItem(FormatTime(h.Timestamp))))
+	}
+	s = s.SetField(9, makeField(makeFieldItem(h.MessageCode, h.TriggerEvent, h.MessageStructure)))
+	s = s.SetField(10, makeField(makeFieldItem(h.ControlID)))
+	s = s.SetField(11, setFirstComponent(s.Field(11), h.ProcessingID))
+	s = s.SetField(12, setFirstComponent(s.Field(12), h.Version))
+	s = s.SetField(15, makeField(makeFieldItem(h.AcceptAckType)))
+	s = s.SetField(16, makeField(makeFieldItem(h.ApplicationAckType)))
+	s = s.SetField(18, setFirstComponent(s.Field(18), h.CharacterSet))
+
+	return trimSegment(s)
+}
+
+// setFirstComponent returns a copy of f with the first component of the first
+// repetition replaced by v, keeping everything else intact.
+func setFirstComponent(f Field, v string) Field {
+	fi := append(FieldItem(nil), f.item(0)...)
+	if len(fi) == 0 {
+		fi = FieldItem{nil}
+	}
+
+	fi[0] = nil
+	if v != "" {
+		fi[0] = Component{Subcomponent(v)}
+	}
+
+	r := append(Field(nil), f...)
+	if len(r) == 0 {
+		r = Field{nil}
+	}
+
+	r[0] = trimFieldItem(fi)
+
+	if len(r) == 1 && r[0] == nil {
+		return nil
+	}
+
+	return r
+}
+
+func trimSegment(s Segment) Segment {
+	for len(s) > 1 && len(s[len(s)-1]) == 0 {
+		s = s[:len(s)-1]
+	}
+
+	return s
+}
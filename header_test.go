@@ -0,0 +1,204 @@
+package hl7
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHeader(t *testing.T) {
+	a := assert.New(t)
+
+	m, _, err := ParseMessage([]byte(`MSH|^~\&|IPM|1919^1.2.3^ISO|SUPERHOSPITAL|1919|20160101000000+1000||ADT^A08^ADT_A01|555544444|D^T|2.4|||AL|NE||UNICODE UTF-8`))
+	a.NoError(err)
+
+	h, err := m.Header()
+	a.NoError(err)
+	a.Equal(&Header{
+		SendingApplication:   HD{NamespaceID: "IPM"},
+		SendingFacility:      HD{NamespaceID: "1919", UniversalID: "1.2.3", UniversalIDType: "ISO"},
+		ReceivingApplication: HD{NamespaceID: "SUPERHOSPITAL"},
+		ReceivingFacility:    HD{NamespaceID: "1919"},
+		Timestamp:            time.Date(2016, 1, 1, 0, 0, 0, 0, time.FixedZone("", 36000)),
+		MessageCode:          "ADT",
+		TriggerEvent:         "A08",
+		MessageStructure:     "ADT_A01",
+		ControlID:            "555544444",
+		ProcessingID:         "D",
+		Version:              "2.4",
+		AcceptAckType:        "AL",
+		ApplicationAckType:   "NE",
+		CharacterSet:         "UNICODE UTF-8",
+	}, h)
+}
+
+func TestHeaderNoMSH(t *testing.T) {
+	a := assert.New(t)
+
+	_, err := Message{}.Header()
+	a.Error(err)
+}
+
+func TestHeaderInvalidTimestamp(t *testing.T) {
+	a := assert.New(t)
+
+	m, _, err := ParseMessage([]byte(longTestMessageContent))
+	a.NoError(err)
+
+	h, err := m.Header()
+	if a.Error(err) {
+		a.IsType(ErrHeaderField{}, err)
+		a.Equal("MSH-7", err.(ErrHeaderField).Field)
+		a.Equal(err.(ErrHeaderField).Err, errors.Unwrap(err))
+		a.Equal(`MSH-7: invalid timestamp "20010331605"; length must be 4, 6, 8, 10, 12, or 14`, ErrorText(err))
+	}
+
+	// the rest of the header is still there
+	if a.NotNil(h) {
+		a.True(h.Timestamp.IsZero())
+		a.Equal("ORU", h.MessageCode)
+		a.Equal("20010422GA03", h.ControlID)
+	}
+}
+
+func TestMessageType(t *testing.T) {
+	a := assert.New(t)
+
+	for s, typ := range map[string]string{
+		"ADT^A01^ADT_A01": "ADT^A01",
+		"ACK":             "ACK",
+		"":                "",
+	} {
+		m, _, err := ParseMessage([]byte(`MSH|^~\&|||||||` + s))
+		a.NoError(err)
+		a.Equal(typ, m.Type(), s)
+	}
+
+	a.Equal("", Message{}.Type())
+}
+
+func TestSetHeader(t *testing.T) {
+	a := assert.New(t)
+
+	m, _, err := ParseMessage([]byte(`MSH|^~\&|IPM|1919|SUPERHOSPITAL|1919|20160101000000||ADT^A08|555544444|D^T|2.4|||AL|NE`))
+	a.NoError(err)
+
+	h, err := m.Header()
+	a.NoError(err)
+
+	h.SendingApplication = HD{NamespaceID: "APP", UniversalID: "1.2.3", UniversalIDType: "ISO"}
+	h.Timestamp = time.Date(2017, 2, 3, 4, 5, 6, 0, time.UTC)
+	h.ControlID = "X1"
+	h.ProcessingID = "P"
+	h.ApplicationAckType = ""
+
+	a.NoError(m.SetHeader(h))
+
+	a.Equal(Segment{
+		Field{FieldItem{Component{"MSH"}}},
+		Field{FieldItem{Component{"|"}}},
+		Field{FieldItem{Component{"^~\\&"}}},
+		Field{FieldItem{Component{"APP"}, Component{"1.2.3"}, Component{"ISO"}}},
+		Field{FieldItem{Component{"1919"}}},
+		Field{FieldItem{Component{"SUPERHOSPITAL"}}},
+		Field{FieldItem{Component{"1919"}}},
+		Field{FieldItem{Component{"20170203040506+0000"}}},
+		nil,
+		Field{FieldItem{Component{"ADT"}, Component{"A08"}}},
+		Field{FieldItem{Component{"X1"}}},
+		Field{FieldItem{Component{"P"}, Component{"T"}}},
+		Field{FieldItem{Component{"2.4"}}},
+		nil,
+		nil,
+		Field{FieldItem{Component{"AL"}}},
+	}, m[0])
+
+	h2, err := m.Header()
+	a.NoError(err)
+	a.Equal(h.ControlID, h2.ControlID)
+	a.True(h.Timestamp.Equal(h2.Timestamp))
+}
+
+func TestHeaderSegment(t *testing.T) {
+	a := assert.New(t)
+
+	h := Header{
+		SendingApplication: HD{NamespaceID: "APP"},
+		MessageCode:        "ACK",
+		ControlID:          "1",
+		ProcessingID:       "P",
+		Version:            "2.5",
+	}
+
+	a.Equal(Segment{
+		Field{FieldItem{Component{"MSH"}}},
+		Field{FieldItem{Component{"|"}}},
+		Field{FieldItem{Component{"^~\\&"}}},
+		Field{FieldItem{Component{"APP"}}},
+		nil,
+		nil,
+		nil,
+		nil,
+		nil,
+		Field{FieldItem{Component{"ACK"}}},
+		Field{FieldItem{Component{"1"}}},
+		Field{FieldItem{Component{"P"}}},
+		Field{FieldItem{Component{"2.5"}}},
+	}, h.Segment(&Delimiters{'|', '^', '~', '\\', '&'}))
+}
+
+func TestParseTime(t *testing.T) {
+	a := assert.New(t)
+
+	for _, c := range []struct {
+		s string
+		t time.Time
+	}{
+		{"2016", time.Date(2016, 1, 1, 0, 0, 0, 0, time.Local)},
+		{"201602", time.Date(2016, 2, 1, 0, 0, 0, 0, time.Local)},
+		{"20160203", time.Date(2016, 2, 3, 0, 0, 0, 0, time.Local)},
+		{"2016020304", time.Date(2016, 2, 3, 4, 0, 0, 0, time.Local)},
+		{"201602030405", time.Date(2016, 2, 3, 4, 5, 0, 0, time.Local)},
+		{"20160203040506", time.Date(2016, 2, 3, 4, 5, 6, 0, time.Local)},
+		{"20160203040506.12", time.Date(2016, 2, 3, 4, 5, 6, 120000000, time.Local)},
+		{"20160203040506-0530", time.Date(2016, 2, 3, 4, 5, 6, 0, time.FixedZone("", -19800))},
+		{"201602030405+1000", time.Date(2016, 2, 3, 4, 5, 0, 0, time.FixedZone("", 36000))},
+	} {
+		v, err := ParseTime(c.s)
+		if a.NoError(err, c.s) {
+			a.True(c.t.Equal(v), "%s: expected %s but got %s", c.s, c.t, v)
+		}
+	}
+
+	for _, s := range []string{"20010331605", "2016a", "20161301", "20160203040506.", "20160203+10"} {
+		_, err := ParseTime(s)
+		a.Error(err, s)
+	}
+}
+
+func TestFormatTime(t *testing.T) {
+	a := assert.New(t)
+
+	a.Equal("", FormatTime(time.Time{}))
+	a.Equal("20160203040506+1000", FormatTime(time.Date(2016, 2, 3, 4, 5, 6, 0, time.FixedZone("", 36000))))
+	a.Equal("20160203040506.1200-0530", FormatTime(time.Date(2016, 2, 3, 4, 5, 6, 120000000, time.FixedZone("", -19800))))
+}
+
+func TestSetHeaderRoundTrip(t *testing.T) {
+	a := assert.New(t)
+
+	for _, ts := range []string{"200104220000", "2001", "20010422000000.12+1000", "2001042", ""} {
+		m, _, err := ParseMessage([]byte(`MSH|^~\&|APP|FAC|||` + ts + `||ADT^A01|1|P|2.5`))
+		a.NoError(err)
+
+		h, _ := m.Header()
+		if !a.NotNil(h, ts) {
+			continue
+		}
+
+		a.NoError(m.SetHeader(h), ts)
+		a.Equal(ts, m.Segment("MSH", 0).Value(7), ts)
+	}
+}
@@ -0,0 +1,86 @@
+package hl7http
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"net/http"
+
+	"github.com/facebookgo/stackerr"
+
+	"fknsrs.biz/p/hl7"
+)
+
+// Client posts messages to a URL, like one served by Handler.
+type Client struct {
+	// URL is where messages are posted.
+	URL string
+	// XML sends messages as v2.xml, rather than ER7.
+	XML bool
+	// Header holds extra headers to send with each request, like
+	// Authorization.
+	Header http.Header
+	// HTTPClient is used to make requests. If it's nil,
+	// http.DefaultClient is used.
+	HTTPClient *http.Client
+}
+
+// NewClient returns a Client that posts messages to url.
+func NewClient(url string) *Client {
+	return &Client{URL: url}
+}
+
+// Send posts a message and returns the acknowledgement that comes back. Like
+// mllp.Client's SendMessage, it doesn't look at what the acknowledgement
+// says; use hl7.ReadACK for that. It returns an error if the response
+// doesn't hold a message, which includes most responses with an error
+// status.
+func (c *Client) Send(ctx context.Context, m hl7.Message, d *hl7.Delimiters) (hl7.Message, error) {
+	b, contentType, err := encode(m, d, c.XML)
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequest(http.MethodPost, c.URL, bytes.NewReader(b))
+	if err != nil {
+		return nil, stackerr.Wrap(err)
+	}
+	req = req.WithContext(ctx)
+
+	for k, v := range c.Header {
+		req.Header[k] = v
+	}
+	req.Header.Set("Content-Type", contentType)
+
+	hc := c.HTTPClient
+	if hc == nil {
+		hc = http.DefaultClient
+	}
+
+	res, err := hc.Do(req)
+	if err != nil {
+		return nil, stackerr.Wrap(err)
+	}
+	defer res.Body.Close()
+
+	body, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		return nil, stackerr.Wrap(err)
+	}
+
+	xml, ok := isXML(res.Header.Get("Content-Type"))
+	if !ok {
+		return nil, stackerr.Newf("hl7http: got %s with content type %q", res.Status, res.Header.Get("Content-Type"))
+	}
+
+	ack, _, err := parse(body, xml)
+	if err != nil {
+		if res.StatusCode != http.StatusOK {
+			return nil, stackerr.Newf("hl7http: got %s", res.Status)
+		}
+
+		return nil, stackerr.Wrap(err)
+	}
+
+	return ack, nil
+}
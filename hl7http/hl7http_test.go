@@ -0,0 +1,126 @@
+package hl7http
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"fknsrs.biz/p/hl7"
+)
+
+const testMessage = "MSH|^~\\&|APP|FAC|RAPP|RFAC|20240102||ADT^A01|MSG1|P|2.5\rPID|1||123\r"
+
+func startServer(t *testing.T) *httptest.Server {
+	h := NewHandler(hl7.HandlerFunc(func(ctx context.Context, m hl7.Message, d *hl7.Delimiters) (hl7.Message, error) {
+		if Request(ctx).Header.Get("Authorization") != "Bearer secret" {
+			return hl7.NewACK(m, d, hl7.AckReject, "not authorised"), nil
+		}
+
+		if m.Segment("PID", 0).Value(3) != "123" {
+			return nil, errors.New("unknown patient")
+		}
+
+		return nil, nil
+	}))
+	h.ErrorLog = log.New(ioutil.Discard, "", 0)
+
+	return httptest.NewServer(h)
+}
+
+func TestClientServer(t *testing.T) {
+	a := assert.New(t)
+
+	s := startServer(t)
+	defer s.Close()
+
+	m, d, err := hl7.ParseMessage([]byte(testMessage))
+	a.NoError(err)
+
+	for _, xml := range []bool{false, true} {
+		c := NewClient(s.URL)
+		c.XML = xml
+		c.Header = http.Header{"Authorization": {"Bearer secret"}}
+
+		ack, err := c.Send(context.Background(), m, d)
+		if a.NoError(err) {
+			r, err := hl7.ReadACK(ack)
+			a.NoError(err)
+			a.Equal(&hl7.ACK{Code: hl7.AckAccept, ControlID: "MSG1"}, r)
+		}
+
+		m2, d2, err := hl7.ParseMessage([]byte(strings.Replace(testMessage, "||123", "||456", 1)))
+		a.NoError(err)
+
+		ack, err = c.Send(context.Background(), m2, d2)
+		if a.NoError(err) {
+			r, err := hl7.ReadACK(ack)
+			a.NoError(err)
+			a.Equal(hl7.AckError, r.Code)
+			a.Equal("unknown patient", r.Text)
+		}
+
+		c.Header = nil
+
+		ack, err = c.Send(context.Background(), m, d)
+		if a.NoError(err) {
+			a.Equal(hl7.AckReject, ack.Segment("MSA", 0).Value(1))
+		}
+	}
+}
+
+func TestHandlerErrors(t *testing.T) {
+	a := assert.New(t)
+
+	s := startServer(t)
+	defer s.Close()
+
+	res, err := http.Get(s.URL)
+	if a.NoError(err) {
+		res.Body.Close()
+		a.Equal(http.StatusMethodNotAllowed, res.StatusCode)
+	}
+
+	res, err = http.Post(s.URL, "image/png", strings.NewReader(testMessage))
+	if a.NoError(err) {
+		res.Body.Close()
+		a.Equal(http.StatusUnsupportedMediaType, res.StatusCode)
+	}
+
+	res, err = http.Post(s.URL, ContentTypeER7, strings.NewReader("this isn't HL7"))
+	if a.NoError(err) {
+		b, _ := ioutil.ReadAll(res.Body)
+		res.Body.Close()
+		a.Equal(http.StatusBadRequest, res.StatusCode)
+		a.Equal(ContentTypeER7, res.Header.Get("Content-Type"))
+		a.Contains(string(b), "MSA|AR|")
+	}
+
+	res, err = http.Post(s.URL, "text/xml; charset=utf-8", strings.NewReader("<ADT_A01><MSH>"))
+	if a.NoError(err) {
+		b, _ := ioutil.ReadAll(res.Body)
+		res.Body.Close()
+		a.Equal(http.StatusBadRequest, res.StatusCode)
+		a.Contains(string(b), "<MSA.1>AR</MSA.1>")
+	}
+
+	m, d, err := hl7.ParseMessage([]byte(testMessage))
+	a.NoError(err)
+
+	_, err = NewClient("http://127.0.0.1:1/").Send(context.Background(), m, d)
+	a.Error(err)
+
+	nf := httptest.NewServer(http.NotFoundHandler())
+	defer nf.Close()
+
+	_, err = NewClient(nf.URL).Send(context.Background(), m, d)
+	if a.Error(err) {
+		a.Equal("hl7http: got 404 Not Found", hl7.ErrorText(err))
+	}
+}
@@ -0,0 +1,175 @@
+// Package hl7http carries HL7 messages over HTTP, for systems that post
+// them to a URL instead of using MLLP. Each request holds one message, in
+// either the usual pipe-delimited encoding (ER7) or v2.xml, and each
+// response holds its acknowledgement, in the same encoding.
+package hl7http // import "fknsrs.biz/p/hl7/hl7http"
+
+import (
+	"context"
+	"io/ioutil"
+	"log"
+	"mime"
+	"net/http"
+	"strconv"
+
+	"github.com/facebookgo/stackerr"
+
+	"fknsrs.biz/p/hl7"
+)
+
+// Content types for the two encodings.
+const (
+	ContentTypeER7 = "application/hl7-v2"
+	ContentTypeXML = "application/hl7-v2+xml"
+)
+
+// xmlOptions are used to encode acknowledgements for v2.xml requests.
+var xmlOptions = hl7.XMLOptions{Dictionary: hl7.DefaultDictionary, Structures: hl7.DefaultStructures}
+
+// Handler is an http.Handler that passes the message in each POST request to
+// an hl7.Handler, and sends back the acknowledgement. Requests with a
+// content type of application/hl7-v2+xml, application/xml, or text/xml are
+// parsed as v2.xml; anything else that looks like text (or has no content
+// type at all) is parsed as ER7.
+//
+// The acknowledgement is sent with a 200 status, even if it's AE or AR, since
+// the HTTP request itself succeeded. Bodies that can't be parsed get an AR
+// acknowledgement with a 400 status.
+type Handler struct {
+	// Handler handles each message.
+	Handler hl7.Handler
+	// MaxSize limits the size of request bodies. If it's zero, the limit is
+	// 16MB.
+	MaxSize int64
+	// ErrorLog is used to log errors writing responses. If it's nil, the
+	// log package's standard logger is used.
+	ErrorLog *log.Logger
+}
+
+// NewHandler returns a Handler that passes messages on to h.
+func NewHandler(h hl7.Handler) *Handler {
+	return &Handler{Handler: h}
+}
+
+type contextKey int
+
+const requestKey contextKey = iota
+
+// Request returns the HTTP request that the message being handled came in
+// on, or nil if it didn't come from a Handler. It's there so that handlers
+// can look at things like headers or the client's TLS certificate.
+func Request(ctx context.Context) *http.Request {
+	r, _ := ctx.Value(requestKey).(*http.Request)
+	return r
+}
+
+// ServeHTTP implements http.Handler.
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		http.Error(w, "only POST is allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	xml, ok := isXML(r.Header.Get("Content-Type"))
+	if !ok {
+		http.Error(w, "unsupported content type", http.StatusUnsupportedMediaType)
+		return
+	}
+
+	max := h.MaxSize
+	if max <= 0 {
+		max = 16 << 20
+	}
+
+	b, err := ioutil.ReadAll(http.MaxBytesReader(w, r.Body, max))
+	if err != nil {
+		http.Error(w, "couldn't read request body", http.StatusRequestEntityTooLarge)
+		return
+	}
+
+	m, d, err := parse(b, xml)
+	if err != nil {
+		h.respond(w, hl7.NewACK(nil, nil, hl7.AckReject, hl7.ErrorText(err)), nil, xml, http.StatusBadRequest)
+		return
+	}
+
+	ctx := context.WithValue(r.Context(), requestKey, r)
+
+	h.respond(w, hl7.Respond(ctx, h.Handler, m, d), d, xml, http.StatusOK)
+}
+
+func (h *Handler) respond(w http.ResponseWriter, ack hl7.Message, d *hl7.Delimiters, xml bool, status int) {
+	b, contentType, err := encode(ack, d, xml)
+	if err != nil {
+		h.logf("hl7http: error encoding acknowledgement: %s", hl7.ErrorText(err))
+		http.Error(w, "couldn't encode acknowledgement", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Content-Length", strconv.Itoa(len(b)))
+	w.WriteHeader(status)
+
+	if _, err := w.Write(b); err != nil {
+		h.logf("hl7http: error writing response: %v", err)
+	}
+}
+
+func (h *Handler) logf(format string, args ...interface{}) {
+	if h.ErrorLog != nil {
+		h.ErrorLog.Printf(format, args...)
+	} else {
+		log.Printf(format, args...)
+	}
+}
+
+// isXML works out from a content type whether a body is v2.xml or ER7. The
+// second result is false if it's neither.
+func isXML(contentType string) (bool, bool) {
+	if contentType == "" {
+		return false, true
+	}
+
+	t, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return false, false
+	}
+
+	switch t {
+	case ContentTypeXML, "application/xml", "text/xml":
+		return true, true
+	case ContentTypeER7, "application/edi-hl7", "x-application/hl7-v2+er7", "text/plain", "application/octet-stream":
+		return false, true
+	default:
+		return false, false
+	}
+}
+
+// parse reads the single message in a request or response body.
+func parse(b []byte, xml bool) (hl7.Message, *hl7.Delimiters, error) {
+	if xml {
+		return hl7.ParseXML(b)
+	}
+
+	a := hl7.SplitMessages(b)
+	if len(a) != 1 {
+		return nil, nil, stackerr.Newf("expected one message; instead found %d", len(a))
+	}
+
+	return hl7.ParseMessage(a[0])
+}
+
+// encode turns a message into a body, returning its content type too.
+func encode(m hl7.Message, d *hl7.Delimiters, xml bool) ([]byte, string, error) {
+	if xml {
+		b, err := hl7.EncodeXML(m, xmlOptions)
+		if err != nil {
+			return nil, "", stackerr.Wrap(err)
+		}
+
+		return b, ContentTypeXML + "; charset=utf-8", nil
+	}
+
+	return hl7.EncodeMessage(m, d), ContentTypeER7, nil
+}
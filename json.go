@@ -0,0 +1,348 @@
+package hl7 // import "fknsrs.biz/p/hl7"
+
+import (
+	"bytes"
+	"encoding/json"
+	"sort"
+	"strconv"
+
+	"github.com/facebookgo/stackerr"
+)
+
+// ErrInvalidJSON is returned when DecodeJSON is given something that doesn't
+// look like the output of EncodeJSON.
+type ErrInvalidJSON error
+
+// JSONOptions controls how messages are turned into JSON.
+type JSONOptions struct {
+	// Named switches from the positional form, where every level of the
+	// message is an array, to a form where each segment is an object keyed by
+	// its name, and fields, components, and subcomponents are objects keyed by
+	// their position (numbered from one, like in a query). Empty positions are
+	// left out of the named form, except for empty repetitions, which are
+	// null. This means that a message decoded from the named form won't have
+	// any empty fields at the end of its segments, which makes no difference
+	// once it's turned back into HL7.
+	//
+	//   positional: [[["PID"]],null,null,null,null,[[["Smith"],["John"]]]]
+	//   named:      {"PID":{"5":[{"1":"Smith","2":"John"}]}}
+	Named bool
+	// Dictionary, if set along with Named, is used to key fields by their
+	// name instead of their position (e.g. "Patient Name" instead of "5").
+	// Fields that aren't in the dictionary still use their position.
+	Dictionary *Dictionary
+}
+
+// EncodeJSON turns a message into JSON. The message is always an array of
+// segments, so that segment order and repeated segments are preserved.
+func EncodeJSON(m Message, o JSONOptions) ([]byte, error) {
+	var v interface{}
+	if o.Named {
+		a := make([]interface{}, len(m))
+		for i, s := range m {
+			a[i] = namedSegment(s, o.Dictionary)
+		}
+		v = a
+	} else {
+		v = m
+	}
+
+	var buf bytes.Buffer
+	if err := writeJSON(&buf, v); err != nil {
+		return nil, stackerr.Wrap(err)
+	}
+
+	return buf.Bytes(), nil
+}
+
+// DecodeJSON reconstructs a message from the output of EncodeJSON, in either
+// form (the two forms can even be mixed, segment by segment). The dictionary
+// is used to look up fields that are keyed by name; it can be nil if there
+// aren't any.
+func DecodeJSON(b []byte, d *Dictionary) (Message, error) {
+	var raw []json.RawMessage
+	if err := json.Unmarshal(b, &raw); err != nil {
+		return nil, ErrInvalidJSON(stackerr.Wrap(err))
+	}
+
+	var m Message
+	for i, r := range raw {
+		r = bytes.TrimSpace(r)
+
+		if len(r) > 0 && r[0] == '[' {
+			var s Segment
+			if err := json.Unmarshal(r, &s); err != nil {
+				return nil, ErrInvalidJSON(stackerr.Newf("segment %d: %s", i+1, err.Error()))
+			}
+
+			m = append(m, s)
+
+			continue
+		}
+
+		s, err := decodeNamedSegment(r, d)
+		if err != nil {
+			return nil, ErrInvalidJSON(stackerr.Newf("segment %d: %s", i+1, err.Error()))
+		}
+
+		m = append(m, s)
+	}
+
+	return m, nil
+}
+
+type jsonMember struct {
+	Key   string
+	Value interface{}
+}
+
+// jsonObject is an object whose keys are written out in order, so that
+// field 10 comes after field 9 instead of field 1.
+type jsonObject []jsonMember
+
+func namedSegment(s Segment, d *Dictionary) jsonObject {
+	var fields jsonObject
+
+	for n := 1; n < len(s); n++ {
+		if len(s[n]) == 0 {
+			continue
+		}
+
+		k := strconv.Itoa(n)
+		if f, ok := d.Field(s.Name(), n); ok {
+			k = f.Name
+		}
+
+		a := make([]interface{}, len(s[n]))
+		for i, fi := range s[n] {
+			if len(fi) != 0 {
+				a[i] = namedFieldItem(fi)
+			}
+		}
+
+		fields = append(fields, jsonMember{k, a})
+	}
+
+	return jsonObject{{s.Name(), fields}}
+}
+
+func namedFieldItem(fi FieldItem) jsonObject {
+	o := jsonObject{}
+
+	for i, c := range fi {
+		switch {
+		case c.empty():
+			continue
+		case len(c) == 1:
+			o = append(o, jsonMember{strconv.Itoa(i + 1), string(c[0])})
+		default:
+			var sc jsonObject
+			for j, s := range c {
+				if s != "" {
+					sc = append(sc, jsonMember{strconv.Itoa(j + 1), string(s)})
+				}
+			}
+			o = append(o, jsonMember{strconv.Itoa(i + 1), sc})
+		}
+	}
+
+	return o
+}
+
+func decodeNamedSegment(b []byte, d *Dictionary) (Segment, error) {
+	var o map[string]map[string][]map[string]json.RawMessage
+	if err := json.Unmarshal(b, &o); err != nil {
+		return nil, stackerr.Wrap(err)
+	}
+
+	if len(o) != 1 {
+		return nil, stackerr.Newf("expected exactly one segment name; instead found %d", len(o))
+	}
+
+	var name string
+	var fields map[string][]map[string]json.RawMessage
+	for k, v := range o {
+		name, fields = k, v
+	}
+
+	s := Segment{Field{FieldItem{Component{Subcomponent(name)}}}}
+
+	for _, k := range sortedKeys(fields) {
+		n, err := strconv.Atoi(k)
+		if err != nil {
+			if n = d.FieldByName(name, k); n == 0 {
+				return nil, stackerr.Newf("unknown field %q in %s", k, name)
+			}
+		}
+		if n < 1 {
+			return nil, stackerr.Newf("invalid field number %d in %s", n, name)
+		}
+
+		var f Field
+		for _, r := range fields[k] {
+			fi, err := decodeNamedFieldItem(r)
+			if err != nil {
+				return nil, stackerr.Newf("%s-%s: %s", name, k, err.Error())
+			}
+
+			f = append(f, fi)
+		}
+
+		s = s.SetField(n, f)
+	}
+
+	return s, nil
+}
+
+func decodeNamedFieldItem(o map[string]json.RawMessage) (FieldItem, error) {
+	var fi FieldItem
+
+	for _, k := range sortedKeys(o) {
+		n, err := strconv.Atoi(k)
+		if err != nil || n < 1 {
+			return nil, stackerr.Newf("invalid component number %q", k)
+		}
+
+		for len(fi) < n {
+			fi = append(fi, nil)
+		}
+
+		var s string
+		if err := json.Unmarshal(o[k], &s); err == nil {
+			fi[n-1] = Component{Subcomponent(s)}
+			continue
+		}
+
+		var sc map[string]string
+		if err := json.Unmarshal(o[k], &sc); err != nil {
+			return nil, stackerr.Newf("component %d must be a string or an object of strings", n)
+		}
+
+		var c Component
+		for _, k := range sortedKeys(sc) {
+			m, err := strconv.Atoi(k)
+			if err != nil || m < 1 {
+				return nil, stackerr.Newf("invalid subcomponent number %q", k)
+			}
+
+			for len(c) < m {
+				c = append(c, "")
+			}
+
+			c[m-1] = Subcomponent(sc[k])
+		}
+
+		fi[n-1] = c
+	}
+
+	return fi, nil
+}
+
+// sortedKeys returns the keys of a map, with numeric keys in numeric order
+// before any others.
+func sortedKeys(m interface{}) []string {
+	var a []string
+
+	switch m := m.(type) {
+	case map[string][]map[string]json.RawMessage:
+		for k := range m {
+			a = append(a, k)
+		}
+	case map[string]json.RawMessage:
+		for k := range m {
+			a = append(a, k)
+		}
+	case map[string]string:
+		for k := range m {
+			a = append(a, k)
+		}
+	}
+
+	sort.Slice(a, func(i, j int) bool {
+		x, errX := strconv.Atoi(a[i])
+		y, errY := strconv.Atoi(a[j])
+
+		switch {
+		case errX == nil && errY == nil:
+			return x < y
+		case errX == nil:
+			return true
+		case errY == nil:
+			return false
+		}
+
+		return a[i] < a[j]
+	})
+
+	return a
+}
+
+// writeJSON writes out the handful of types that make up a message, without
+// the HTML escaping that encoding/json does by default - otherwise MSH-2
+// would come out as "^~\\&".
+func writeJSON(buf *bytes.Buffer, v interface{}) error {
+	switch v := v.(type) {
+	case nil:
+		buf.WriteString("null")
+	case string:
+		e := json.NewEncoder(buf)
+		e.SetEscapeHTML(false)
+		if err := e.Encode(v); err != nil {
+			return stackerr.Wrap(err)
+		}
+		buf.Truncate(buf.Len() - 1)
+	case Subcomponent:
+		return writeJSON(buf, string(v))
+	case jsonObject:
+		buf.WriteByte('{')
+		for i, m := range v {
+			if i > 0 {
+				buf.WriteByte(',')
+			}
+			if err := writeJSON(buf, m.Key); err != nil {
+				return err
+			}
+			buf.WriteByte(':')
+			if err := writeJSON(buf, m.Value); err != nil {
+				return err
+			}
+		}
+		buf.WriteByte('}')
+	case []interface{}:
+		return writeJSONArray(buf, len(v), v == nil, func(i int) interface{} { return v[i] })
+	case Message:
+		return writeJSONArray(buf, len(v), v == nil, func(i int) interface{} { return v[i] })
+	case Segment:
+		return writeJSONArray(buf, len(v), v == nil, func(i int) interface{} { return v[i] })
+	case Field:
+		return writeJSONArray(buf, len(v), v == nil, func(i int) interface{} { return v[i] })
+	case FieldItem:
+		return writeJSONArray(buf, len(v), v == nil, func(i int) interface{} { return v[i] })
+	case Component:
+		return writeJSONArray(buf, len(v), v == nil, func(i int) interface{} { return v[i] })
+	default:
+		return stackerr.Newf("can't write %T as JSON", v)
+	}
+
+	return nil
+}
+
+func writeJSONArray(buf *bytes.Buffer, n int, null bool, get func(i int) interface{}) error {
+	if null {
+		buf.WriteString("null")
+		return nil
+	}
+
+	buf.WriteByte('[')
+	for i := 0; i < n; i++ {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		if err := writeJSON(buf, get(i)); err != nil {
+			return err
+		}
+	}
+	buf.WriteByte(']')
+
+	return nil
+}
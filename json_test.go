@@ -0,0 +1,93 @@
+package hl7
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEncodeJSONPositional(t *testing.T) {
+	a := assert.New(t)
+
+	m, _, err := ParseMessage([]byte("MSH|^~\\&|A&1~|B\rPID|||||Smith^John&J"))
+	a.NoError(err)
+
+	b, err := EncodeJSON(m, JSONOptions{})
+	a.NoError(err)
+	a.Equal(`[[[[["MSH"]]],[[["|"]]],[[["^~\\&"]]],[[["A","1"]]],[[["B"]]]],[[[["PID"]]],null,null,null,null,[[["Smith"],["John","J"]]]]]`, string(b))
+
+	n, err := DecodeJSON(b, nil)
+	a.NoError(err)
+	a.Equal(m, n)
+}
+
+func TestEncodeJSONNamed(t *testing.T) {
+	a := assert.New(t)
+
+	m, _, err := ParseMessage([]byte("MSH|^~\\&|APP|FAC|||||ADT^A01|1|P|2.5\rPID|||123^^^HOSP&1.2.3&ISO~~456||Smith^John"))
+	a.NoError(err)
+
+	b, err := EncodeJSON(m, JSONOptions{Named: true})
+	a.NoError(err)
+	a.Equal(`[{"MSH":{"1":[{"1":"|"}],"2":[{"1":"^~\\&"}],"3":[{"1":"APP"}],"4":[{"1":"FAC"}],"9":[{"1":"ADT","2":"A01"}],"10":[{"1":"1"}],"11":[{"1":"P"}],"12":[{"1":"2.5"}]}},{"PID":{"3":[{"1":"123","4":{"1":"HOSP","2":"1.2.3","3":"ISO"}},null,{"1":"456"}],"5":[{"1":"Smith","2":"John"}]}}]`, string(b))
+
+	n, err := DecodeJSON(b, nil)
+	a.NoError(err)
+	a.Equal(m, n)
+}
+
+func TestEncodeJSONNamedDictionary(t *testing.T) {
+	a := assert.New(t)
+
+	m, _, err := ParseMessage([]byte("MSH|^~\\&|APP\rPID|||123||Smith^John\rZZZ|1"))
+	a.NoError(err)
+
+	b, err := EncodeJSON(m, JSONOptions{Named: true, Dictionary: DefaultDictionary})
+	a.NoError(err)
+	a.Equal(`[{"MSH":{"Field Separator":[{"1":"|"}],"Encoding Characters":[{"1":"^~\\&"}],"Sending Application":[{"1":"APP"}]}},{"PID":{"Patient Identifier List":[{"1":"123"}],"Patient Name":[{"1":"Smith","2":"John"}]}},{"ZZZ":{"1":[{"1":"1"}]}}]`, string(b))
+
+	n, err := DecodeJSON(b, DefaultDictionary)
+	a.NoError(err)
+	a.Equal(m, n)
+
+	_, err = DecodeJSON(b, nil)
+	a.Error(err)
+}
+
+func TestJSONRoundTripLong(t *testing.T) {
+	a := assert.New(t)
+
+	m, _, err := ParseMessage([]byte(longTestMessageContent))
+	a.NoError(err)
+
+	b, err := EncodeJSON(m, JSONOptions{})
+	a.NoError(err)
+	n, err := DecodeJSON(b, nil)
+	a.NoError(err)
+	a.Equal(m, n)
+
+	b1, err := EncodeJSON(m, JSONOptions{Named: true, Dictionary: DefaultDictionary})
+	a.NoError(err)
+	n, err = DecodeJSON(b1, DefaultDictionary)
+	a.NoError(err)
+	b2, err := EncodeJSON(n, JSONOptions{Named: true, Dictionary: DefaultDictionary})
+	a.NoError(err)
+	a.Equal(string(b1), string(b2))
+	a.Equal(len(m), len(n))
+}
+
+func TestDecodeJSONInvalid(t *testing.T) {
+	a := assert.New(t)
+
+	for _, s := range []string{
+		`{}`,
+		`[{"PID":{"x":[{"1":"a"}]}}]`,
+		`[{"PID":{"5":[{"a":"b"}]}}]`,
+		`[{"PID":{"5":[{"1":1}]}}]`,
+		`[{"PID":{},"PV1":{}}]`,
+		`[[1]]`,
+	} {
+		_, err := DecodeJSON([]byte(s), DefaultDictionary)
+		a.Error(err, s)
+	}
+}
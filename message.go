@@ -50,3 +50,117 @@ func (m Message) Query(s string) (res string, ok bool, err error) {
 
 	return res, ok, nil
 }
+
+// Name returns the segment name (e.g. "MSH" or "PID"), or an empty string if
+// the segment is empty.
+func (s Segment) Name() string {
+	if len(s) == 0 || len(s[0]) == 0 || len(s[0][0]) == 0 || len(s[0][0][0]) == 0 {
+		return ""
+	}
+
+	return string(s[0][0][0][0])
+}
+
+// Field returns field n of the segment, numbered the same way as the HL7
+// specification (so MSH-9 is `Field(9)`). It returns nil if the segment
+// doesn't have that many fields.
+func (s Segment) Field(n int) Field {
+	if n < 0 || n >= len(s) {
+		return nil
+	}
+
+	return s[n]
+}
+
+// Value returns the first subcomponent of the first component of the first
+// repetition of field n. This is the usual way to read a simple field like
+// an ST or an ID.
+func (s Segment) Value(n int) string {
+	return s.Field(n).item(0).get(1)
+}
+
+// SetField sets field n of the segment to f, padding the segment with empty
+// fields if it's not long enough. Like `append`, it returns the updated
+// segment, which may or may not share storage with the original.
+func (s Segment) SetField(n int, f Field) Segment {
+	for len(s) <= n {
+		s = append(s, nil)
+	}
+
+	s[n] = f
+
+	return s
+}
+
+func (f Field) item(n int) FieldItem {
+	if n < 0 || n >= len(f) {
+		return nil
+	}
+
+	return f[n]
+}
+
+// get returns the first subcomponent of component n (numbered from one).
+func (fi FieldItem) get(n int) string {
+	return fi.component(n).get(1)
+}
+
+func (fi FieldItem) component(n int) Component {
+	if n < 1 || n > len(fi) {
+		return nil
+	}
+
+	return fi[n-1]
+}
+
+// get returns subcomponent n (numbered from one).
+func (c Component) get(n int) string {
+	if n < 1 || n > len(c) {
+		return ""
+	}
+
+	return string(c[n-1])
+}
+
+// makeFieldItem builds a field item with one subcomponent per component,
+// leaving out empty trailing components.
+func makeFieldItem(a ...string) FieldItem {
+	fi := make(FieldItem, len(a))
+	for i, s := range a {
+		fi[i] = simple(s)
+	}
+
+	return trimFieldItem(fi)
+}
+
+func trimFieldItem(fi FieldItem) FieldItem {
+	for len(fi) > 0 && fi[len(fi)-1].empty() {
+		fi = fi[:len(fi)-1]
+	}
+
+	if len(fi) == 0 {
+		return nil
+	}
+
+	return fi
+}
+
+// makeField wraps a single field item up as a field, returning nil if the
+// item is empty.
+func makeField(fi FieldItem) Field {
+	if len(fi) == 0 {
+		return nil
+	}
+
+	return Field{fi}
+}
+
+func (c Component) empty() bool {
+	for _, s := range c {
+		if s != "" {
+			return false
+		}
+	}
+
+	return true
+}
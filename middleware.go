@@ -0,0 +1,150 @@
+package hl7 // import "fknsrs.biz/p/hl7"
+
+import (
+	"context"
+	"log"
+	"runtime/debug"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Middleware wraps a Handler to add some behaviour to it, like logging or
+// validation, that doesn't depend on what the handler does.
+type Middleware func(h Handler) Handler
+
+// Chain wraps a handler in a list of middleware. The first one in the list is
+// the outermost, so it sees each message first and each acknowledgement last.
+func Chain(h Handler, middleware ...Middleware) Handler {
+	for i := len(middleware) - 1; i >= 0; i-- {
+		h = middleware[i](h)
+	}
+
+	return h
+}
+
+// Recoverer recovers from panics in the handler, logging the panic and a
+// stack trace to l and sending back an AE acknowledgement. If l is nil, the
+// log package's standard logger is used.
+func Recoverer(l *log.Logger) Middleware {
+	return func(h Handler) Handler {
+		return HandlerFunc(func(ctx context.Context, m Message, d *Delimiters) (ack Message, err error) {
+			defer func() {
+				if r := recover(); r != nil {
+					logf(l, "hl7: panic handling message %s: %v\n%s", m.Segment("MSH", 0).Value(10), r, debug.Stack())
+					ack, err = NewACK(m, d, AckError, "internal error"), nil
+				}
+			}()
+
+			return h.ServeHL7(ctx, m, d)
+		})
+	}
+}
+
+// Validator checks messages before they reach the handler, sending back an
+// AE acknowledgement for any that have an invalid header, or that don't fit
+// their structure (as found by LookupStructure) in structures. Messages that
+// don't have a structure in structures are let through. If structures is nil,
+// DefaultStructures is used.
+func Validator(structures map[string]*Structure) Middleware {
+	if structures == nil {
+		structures = DefaultStructures
+	}
+
+	return func(h Handler) Handler {
+		return HandlerFunc(func(ctx context.Context, m Message, d *Delimiters) (Message, error) {
+			hd, err := m.Header()
+			if err != nil {
+				return NewACK(m, d, AckError, ErrorText(err)), nil
+			}
+			if hd.MessageCode == "" || hd.ControlID == "" {
+				return NewACK(m, d, AckError, "MSH-9 and MSH-10 are required"), nil
+			}
+
+			if s := LookupStructure(m, structures); s != nil {
+				if err := s.Validate(m); err != nil {
+					return NewACK(m, d, AckError, ErrorText(err)), nil
+				}
+			}
+
+			return h.ServeHL7(ctx, m, d)
+		})
+	}
+}
+
+// Logger logs a line to l for each message, after it's been handled, with
+// its type (MSH-9), control ID (MSH-10), sender (MSH-3 and MSH-4), the
+// acknowledgement code that will be sent back, how long the handler took,
+// and the error, if there was one. The line is made of key=value pairs, like
+// this:
+//
+//	hl7: type=ADT^A01 control_id=123 sender=APP^FAC ack=AA duration=1.2ms
+//
+// If l is nil, the log package's standard logger is used.
+func Logger(l *log.Logger) Middleware {
+	return Timer(func(ctx context.Context, m Message, ack Message, err error, d time.Duration) {
+		msh := m.Segment("MSH", 0)
+
+		a := []string{
+			"type=" + logValue(m.Type()),
+			"control_id=" + logValue(msh.Value(10)),
+			"sender=" + logValue(strings.TrimSuffix(msh.Value(3)+"^"+msh.Value(4), "^")),
+			"ack=" + ackCode(ack, err),
+			"duration=" + d.String(),
+		}
+
+		if err != nil {
+			a = append(a, "error="+strconv.Quote(ErrorText(err)))
+		}
+
+		logf(l, "hl7: %s", strings.Join(a, " "))
+	})
+}
+
+// Timer calls fn after each message has been handled, with the message, what
+// the handler returned, and how long it took. It's meant for collecting
+// metrics.
+func Timer(fn func(ctx context.Context, m Message, ack Message, err error, d time.Duration)) Middleware {
+	return func(h Handler) Handler {
+		return HandlerFunc(func(ctx context.Context, m Message, d *Delimiters) (Message, error) {
+			t := time.Now()
+
+			ack, err := h.ServeHL7(ctx, m, d)
+
+			fn(ctx, m, ack, err, time.Since(t))
+
+			return ack, err
+		})
+	}
+}
+
+// ackCode works out which acknowledgement code will be sent back for what a
+// handler returned, following the same rules as Respond.
+func ackCode(ack Message, err error) string {
+	switch {
+	case err != nil:
+		return AckError
+	case ack == nil:
+		return AckAccept
+	default:
+		return ack.Segment("MSA", 0).Value(1)
+	}
+}
+
+// logValue quotes a value for a log line if it's empty or has spaces,
+// quotes, or control characters in it.
+func logValue(s string) string {
+	if s == "" || strings.ContainsAny(s, " \"=") || strconv.Quote(s) != `"`+s+`"` {
+		return strconv.Quote(s)
+	}
+
+	return s
+}
+
+func logf(l *log.Logger, format string, args ...interface{}) {
+	if l != nil {
+		l.Printf(format, args...)
+	} else {
+		log.Printf(format, args...)
+	}
+}
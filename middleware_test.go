@@ -0,0 +1,146 @@
+package hl7
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"log"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func middlewareTestMessage(a *assert.Assertions, s string) (Message, *Delimiters) {
+	m, d, err := ParseMessage([]byte(s))
+	a.NoError(err)
+	return m, d
+}
+
+func TestChain(t *testing.T) {
+	a := assert.New(t)
+
+	var calls []string
+
+	mw := func(name string) Middleware {
+		return func(h Handler) Handler {
+			return HandlerFunc(func(ctx context.Context, m Message, d *Delimiters) (Message, error) {
+				calls = append(calls, name+" before")
+				ack, err := h.ServeHL7(ctx, m, d)
+				calls = append(calls, name+" after")
+				return ack, err
+			})
+		}
+	}
+
+	h := Chain(HandlerFunc(func(ctx context.Context, m Message, d *Delimiters) (Message, error) {
+		calls = append(calls, "handler")
+		return nil, nil
+	}), mw("a"), mw("b"))
+
+	m, d := middlewareTestMessage(a, "MSH|^~\\&|APP|FAC|||20240102||ADT^A01|1|P|2.5\r")
+	_, err := h.ServeHL7(context.Background(), m, d)
+	a.NoError(err)
+	a.Equal([]string{"a before", "b before", "handler", "b after", "a after"}, calls)
+}
+
+func TestRecoverer(t *testing.T) {
+	a := assert.New(t)
+
+	var buf bytes.Buffer
+
+	h := Chain(HandlerFunc(func(ctx context.Context, m Message, d *Delimiters) (Message, error) {
+		panic("oh no")
+	}), Recoverer(log.New(&buf, "", 0)))
+
+	m, d := middlewareTestMessage(a, "MSH|^~\\&|APP|FAC|||20240102||ADT^A01|MSG1|P|2.5\r")
+	ack, err := h.ServeHL7(context.Background(), m, d)
+	a.NoError(err)
+	a.Equal("AE", ack.Segment("MSA", 0).Value(1))
+	a.Equal("MSG1", ack.Segment("MSA", 0).Value(2))
+	a.Equal("internal error", ack.Segment("MSA", 0).Value(3))
+	a.True(strings.HasPrefix(buf.String(), "hl7: panic handling message MSG1: oh no\n"))
+}
+
+func TestValidator(t *testing.T) {
+	a := assert.New(t)
+
+	called := 0
+	h := Chain(HandlerFunc(func(ctx context.Context, m Message, d *Delimiters) (Message, error) {
+		called++
+		return nil, nil
+	}), Validator(nil))
+
+	for _, c := range []struct{ message, text string }{
+		{"MSH|^~\\&|APP|FAC|||20240102||ADT^A01|1|P|2.5\rEVN|A01\rPID|1\rPV1|1\r", ""},
+		{"MSH|^~\\&|APP|FAC|||20240102||ZZZ^Z01|1|P|2.5\rZZZ|1\r", ""},
+		{"MSH|^~\\&|APP|FAC|||20240102||ADT^A01|1|P|2.5\rEVN|A01\rPID|1\r", "ADT_A01: required segment PV1 is missing"},
+		{"MSH|^~\\&|APP|FAC|||2024010||ADT^A01|1|P|2.5\rEVN|A01\rPID|1\rPV1|1\r", `MSH-7: invalid timestamp "2024010"; length must be 4, 6, 8, 10, 12, or 14`},
+		{"MSH|^~\\&|APP|FAC|||20240102||ADT^A01||P|2.5\rEVN|A01\rPID|1\rPV1|1\r", "MSH-9 and MSH-10 are required"},
+	} {
+		m, d := middlewareTestMessage(a, c.message)
+
+		before := called
+
+		ack, err := h.ServeHL7(context.Background(), m, d)
+		a.NoError(err)
+
+		if c.text == "" {
+			a.Nil(ack)
+			a.Equal(before+1, called)
+		} else {
+			a.Equal("AE", ack.Segment("MSA", 0).Value(1))
+			a.Equal(c.text, ack.Segment("MSA", 0).Value(3))
+			a.Equal(before, called)
+		}
+	}
+}
+
+func TestLogger(t *testing.T) {
+	a := assert.New(t)
+
+	var buf bytes.Buffer
+
+	h := Chain(HandlerFunc(func(ctx context.Context, m Message, d *Delimiters) (Message, error) {
+		if m.Segment("MSH", 0).Value(10) == "2" {
+			return nil, errors.New("bad \"thing\"")
+		}
+		return nil, nil
+	}), Logger(log.New(&buf, "", 0)))
+
+	m, d := middlewareTestMessage(a, "MSH|^~\\&|APP|FAC|||20240102||ADT^A01|1|P|2.5\r")
+	_, err := h.ServeHL7(context.Background(), m, d)
+	a.NoError(err)
+
+	m, d = middlewareTestMessage(a, "MSH|^~\\&|APP||||20240102||ORU^R01|2|P|2.5\r")
+	_, err = h.ServeHL7(context.Background(), m, d)
+	a.Error(err)
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if a.Len(lines, 2) {
+		a.Regexp(`^hl7: type=ADT\^A01 control_id=1 sender=APP\^FAC ack=AA duration=\S+$`, lines[0])
+		a.Regexp(`^hl7: type=ORU\^R01 control_id=2 sender=APP ack=AE duration=\S+ error="bad \\"thing\\""$`, lines[1])
+	}
+}
+
+func TestTimer(t *testing.T) {
+	a := assert.New(t)
+
+	var got time.Duration
+	var code string
+
+	h := Chain(HandlerFunc(func(ctx context.Context, m Message, d *Delimiters) (Message, error) {
+		time.Sleep(10 * time.Millisecond)
+		return NewACK(m, d, AckReject, "no"), nil
+	}), Timer(func(ctx context.Context, m Message, ack Message, err error, d time.Duration) {
+		got = d
+		code = ackCode(ack, err)
+	}))
+
+	m, d := middlewareTestMessage(a, "MSH|^~\\&|APP|FAC|||20240102||ADT^A01|1|P|2.5\r")
+	_, err := h.ServeHL7(context.Background(), m, d)
+	a.NoError(err)
+	a.True(got >= 10*time.Millisecond)
+	a.Equal("AR", code)
+}
@@ -0,0 +1,214 @@
+package mllp // import "fknsrs.biz/p/hl7/mllp"
+
+import (
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/facebookgo/stackerr"
+
+	"fknsrs.biz/p/hl7"
+)
+
+// Client sends messages over a single connection, waiting for the
+// acknowledgement of each before sending the next. It's safe to use from
+// more than one goroutine.
+type Client struct {
+	// Timeout, if more than zero, limits how long each exchange (sending a
+	// message and reading its acknowledgement) can take.
+	Timeout time.Duration
+	// ApplicationACKs says that the server sends application
+	// acknowledgements in enhanced mode back on the same connection, after
+	// the commit acknowledgement, so SendMessage should wait for them.
+	ApplicationACKs bool
+	// Metrics, if it's set, collects statistics about the connection and
+	// the messages sent over it (see PrometheusMetrics). The connection is
+	// counted as open from when it's first used until Close is called.
+	Metrics Metrics
+
+	mu       sync.Mutex
+	conn     net.Conn
+	r        *Reader
+	w        *Writer
+	enhanced bool
+	state    int32
+}
+
+// Dial connects to an MLLP server at addr (host:port) over TCP.
+func Dial(addr string) (*Client, error) {
+	conn, err := net.Dial("tcp", addr)
+	if err != nil {
+		return nil, stackerr.Wrap(err)
+	}
+
+	return NewClient(conn), nil
+}
+
+// NewClient returns a client that uses an existing connection.
+func NewClient(conn net.Conn) *Client {
+	return &Client{conn: conn, r: NewReader(conn), w: NewWriter(conn)}
+}
+
+// Send sends an already-encoded message and returns the reply, without
+// looking at either of them. Since it doesn't parse them, it reports them to
+// Metrics without a type.
+func (c *Client) Send(b []byte) ([]byte, error) {
+	mt := c.metrics()
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.Timeout > 0 {
+		if err := c.conn.SetDeadline(time.Now().Add(c.Timeout)); err != nil {
+			return nil, stackerr.Wrap(err)
+		}
+		defer c.conn.SetDeadline(time.Time{})
+	}
+
+	start := time.Now()
+
+	if err := c.w.WriteMessage(b); err != nil {
+		return nil, stackerr.Wrap(err)
+	}
+
+	mt.MessageSent("", len(b))
+
+	r, err := c.r.ReadMessage()
+	if err != nil {
+		return nil, stackerr.Wrap(err)
+	}
+
+	mt.MessageReceived("", len(r))
+	mt.Latency("", time.Since(start))
+
+	return r, nil
+}
+
+// SendMessage encodes and sends a message, and parses the acknowledgement
+// that comes back. It doesn't look at what the acknowledgement says; use
+// hl7.ReadACK for that.
+//
+// If the message asks for enhanced mode acknowledgements (with MSH-15 or
+// MSH-16), SendMessage only waits for the ones that are always sent (AL): the
+// commit acknowledgement, and then, if ApplicationACKs is set, the
+// application acknowledgement. It returns the last one it got, which is nil
+// if it didn't wait for any. Acknowledgements that are only sent sometimes
+// (ER or SU) can't be waited for, since the point is that they might not
+// come; if they turn up later, they're skipped over by the next call. An
+// acknowledgement with an empty MSA-2 (which is what a server sends when it
+// can't read a message at all) is taken to be for the message just sent. A CE
+// or CR commit acknowledgement is returned straight away, since there won't
+// be an application acknowledgement after it.
+func (c *Client) SendMessage(m hl7.Message, d *hl7.Delimiters) (hl7.Message, error) {
+	n := 1
+
+	accept, application := hl7.AckConditions(m)
+	if accept != "" {
+		n = 0
+		if accept == hl7.AckAlways {
+			n++
+		}
+		if application == hl7.AckAlways && c.ApplicationACKs {
+			n++
+		}
+	}
+
+	mt := c.metrics()
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if accept != "" {
+		c.enhanced = true
+	}
+
+	if c.Timeout > 0 {
+		if err := c.conn.SetDeadline(time.Now().Add(c.Timeout)); err != nil {
+			return nil, stackerr.Wrap(err)
+		}
+		defer c.conn.SetDeadline(time.Time{})
+	}
+
+	start := time.Now()
+
+	eb := hl7.EncodeMessage(m, d)
+	if err := c.w.WriteMessage(eb); err != nil {
+		return nil, stackerr.Wrap(err)
+	}
+
+	mt.MessageSent(m.Type(), len(eb))
+
+	id := m.Segment("MSH", 0).Value(10)
+
+	var ack hl7.Message
+	for n > 0 {
+		b, err := c.r.ReadMessage()
+		if err != nil {
+			return nil, stackerr.Wrap(err)
+		}
+
+		a, _, err := parseFrame(b)
+		if err != nil {
+			mt.MessageReceived("", len(b))
+			mt.ParseError()
+
+			return nil, stackerr.Wrap(err)
+		}
+
+		mt.MessageReceived(a.Type(), len(b))
+		mt.ACK(a.Segment("MSA", 0).Value(1))
+
+		// once enhanced mode has been used, there might be conditional
+		// acknowledgements for earlier messages still to come
+		aid := a.Segment("MSA", 0).Value(2)
+		if c.enhanced && aid != "" && aid != id {
+			continue
+		}
+
+		ack = a
+
+		// an acknowledgement that doesn't say which message it's for is
+		// a server rejecting something it couldn't read, and it has to be
+		// this message; nothing else is coming. Nor is anything coming
+		// after a commit acknowledgement that isn't a CA, since the
+		// message never got to the application.
+		if code := a.Segment("MSA", 0).Value(1); aid == "" || code == hl7.AckCommitError || code == hl7.AckCommitReject {
+			break
+		}
+
+		n--
+	}
+
+	mt.Latency(m.Type(), time.Since(start))
+
+	return ack, nil
+}
+
+// Close closes the connection.
+func (c *Client) Close() error {
+	if atomic.SwapInt32(&c.state, clientClosed) == clientOpen {
+		c.Metrics.ConnClosed()
+	}
+
+	return c.conn.Close()
+}
+
+const (
+	clientOpen int32 = iota + 1
+	clientClosed
+)
+
+// metrics returns c.Metrics, or a Metrics that does nothing if it's not set,
+// counting the connection as open the first time it's called.
+func (c *Client) metrics() Metrics {
+	if c.Metrics == nil {
+		return nopMetrics{}
+	}
+
+	if atomic.CompareAndSwapInt32(&c.state, 0, clientOpen) {
+		c.Metrics.ConnOpened()
+	}
+
+	return c.Metrics
+}
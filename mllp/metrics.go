@@ -0,0 +1,340 @@
+package mllp // import "fknsrs.biz/p/hl7/mllp"
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"fknsrs.biz/p/hl7"
+)
+
+// Metrics collects statistics from a Server or a Client. Its methods are
+// called from many goroutines at once, and shouldn't block.
+//
+// Message types are what hl7.Message.Type returns, like "ADT^A01", and codes
+// are from MSA-1. Both come from the other end of the connection, so there's
+// no limit on how many different ones there might be; implementations that
+// keep a count for each have to guard against that.
+type Metrics interface {
+	// ConnOpened and ConnClosed are called when a connection starts and
+	// ends.
+	ConnOpened()
+	ConnClosed()
+	// MessageReceived and MessageSent are called for each message that's
+	// read from or written to a connection, with its type and its size in
+	// bytes (not counting the MLLP framing). The type is empty if the
+	// message couldn't be parsed.
+	MessageReceived(typ string, size int)
+	MessageSent(typ string, size int)
+	// ACK is called with the code (MSA-1) of each acknowledgement that a
+	// Server makes, whether or not the sender asked for it, and of each one
+	// that a Client receives.
+	ACK(code string)
+	// ParseError is called when a message that a Server receives, or an
+	// acknowledgement that a Client receives, can't be parsed.
+	ParseError()
+	// Latency is called with how long each message took: for a Server, how
+	// long the handler took, and for a Client, the time from sending the
+	// message to getting its acknowledgement.
+	Latency(typ string, d time.Duration)
+}
+
+type nopMetrics struct{}
+
+func (nopMetrics) ConnOpened()                          {}
+func (nopMetrics) ConnClosed()                          {}
+func (nopMetrics) MessageReceived(typ string, size int) {}
+func (nopMetrics) MessageSent(typ string, size int)     {}
+func (nopMetrics) ACK(code string)                      {}
+func (nopMetrics) ParseError()                          {}
+func (nopMetrics) Latency(typ string, d time.Duration)  {}
+
+// DefaultBuckets are the latency histogram buckets, in seconds, used by
+// NewPrometheusMetrics.
+var DefaultBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+
+// PrometheusMetrics is a Metrics that keeps counts in memory, and writes them
+// out in the Prometheus text exposition format. It's an http.Handler, so it
+// can be served directly as a metrics endpoint.
+//
+// The metrics it writes are, with the prefix in front of each:
+//
+//	_connections_open                  gauge
+//	_connections_total                 counter
+//	_messages_received_total{type}     counter
+//	_messages_sent_total{type}         counter
+//	_received_bytes_total              counter
+//	_sent_bytes_total                  counter
+//	_acks_total{code}                  counter
+//	_parse_errors_total                counter
+//	_latency_seconds{type}             histogram
+//
+// Types that don't look like a message code and trigger event (three letters
+// or digits each, like "ADT^A01" or "ACK"), and any new ones after MaxTypes
+// have been seen, are counted as "other". So are acknowledgement codes that
+// aren't one of the six in the standard.
+type PrometheusMetrics struct {
+	// Prefix goes at the start of each metric name, like "mllp_server".
+	// Use different prefixes for a Server and a Client, so that their
+	// metrics can be told apart.
+	Prefix string
+	// Buckets are the upper bounds of the latency histogram buckets, in
+	// seconds, in increasing order.
+	Buckets []float64
+	// MaxTypes is the most message types that get their own counts. If it's
+	// zero or less, 100 is used.
+	MaxTypes int
+
+	mu            sync.Mutex
+	open          int64
+	conns         int64
+	received      map[string]int64
+	sent          map[string]int64
+	receivedBytes int64
+	sentBytes     int64
+	acks          map[string]int64
+	parseErrors   int64
+	latency       map[string]*histogram
+	types         map[string]bool
+}
+
+type histogram struct {
+	buckets []float64
+	counts  []int64
+	count   int64
+	sum     float64
+}
+
+// NewPrometheusMetrics returns a PrometheusMetrics with the given prefix and
+// the default buckets.
+func NewPrometheusMetrics(prefix string) *PrometheusMetrics {
+	return &PrometheusMetrics{Prefix: prefix, Buckets: DefaultBuckets}
+}
+
+func (p *PrometheusMetrics) ConnOpened() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.open++
+	p.conns++
+}
+
+func (p *PrometheusMetrics) ConnClosed() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.open--
+}
+
+func (p *PrometheusMetrics) MessageReceived(typ string, size int) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.received == nil {
+		p.received = make(map[string]int64)
+	}
+
+	p.received[p.typeLabel(typ)]++
+	p.receivedBytes += int64(size)
+}
+
+func (p *PrometheusMetrics) MessageSent(typ string, size int) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.sent == nil {
+		p.sent = make(map[string]int64)
+	}
+
+	p.sent[p.typeLabel(typ)]++
+	p.sentBytes += int64(size)
+}
+
+func (p *PrometheusMetrics) ACK(code string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.acks == nil {
+		p.acks = make(map[string]int64)
+	}
+
+	p.acks[codeLabel(code)]++
+}
+
+func (p *PrometheusMetrics) ParseError() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.parseErrors++
+}
+
+func (p *PrometheusMetrics) Latency(typ string, d time.Duration) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.latency == nil {
+		p.latency = make(map[string]*histogram)
+	}
+
+	typ = p.typeLabel(typ)
+
+	h := p.latency[typ]
+	if h == nil {
+		h = &histogram{buckets: p.Buckets, counts: make([]int64, len(p.Buckets))}
+		p.latency[typ] = h
+	}
+
+	v := d.Seconds()
+
+	for i, b := range h.buckets {
+		if v <= b {
+			h.counts[i]++
+		}
+	}
+
+	h.count++
+	h.sum += v
+}
+
+var typePattern = regexp.MustCompile(`^[A-Z0-9]{3}(\^[A-Z0-9]{3})?$`)
+
+// typeLabel returns the label to count a message type under: the type
+// itself, if it looks like one and there's room for it, and "other" if not.
+// The empty type, for messages that couldn't be parsed, is always kept. It
+// has to be called with p.mu held.
+func (p *PrometheusMetrics) typeLabel(typ string) string {
+	if typ == "" || p.types[typ] {
+		return typ
+	}
+
+	max := p.MaxTypes
+	if max <= 0 {
+		max = 100
+	}
+
+	if !typePattern.MatchString(typ) || len(p.types) >= max {
+		return "other"
+	}
+
+	if p.types == nil {
+		p.types = make(map[string]bool)
+	}
+
+	p.types[typ] = true
+
+	return typ
+}
+
+// codeLabel returns the label to count an acknowledgement code under.
+func codeLabel(code string) string {
+	switch code {
+	case hl7.AckAccept, hl7.AckError, hl7.AckReject, hl7.AckCommitAccept, hl7.AckCommitError, hl7.AckCommitReject:
+		return code
+	default:
+		return "other"
+	}
+}
+
+// WriteTo writes the metrics to w in the Prometheus text format.
+func (p *PrometheusMetrics) WriteTo(w io.Writer) (int64, error) {
+	var b bytes.Buffer
+
+	p.mu.Lock()
+
+	p.write(&b, "connections_open", "gauge", "Number of connections currently open.", nil, "", p.open)
+	p.write(&b, "connections_total", "counter", "Number of connections opened.", nil, "", p.conns)
+	p.write(&b, "messages_received_total", "counter", "Number of messages received, by type.", p.received, "type", 0)
+	p.write(&b, "messages_sent_total", "counter", "Number of messages sent, by type.", p.sent, "type", 0)
+	p.write(&b, "received_bytes_total", "counter", "Number of bytes of messages received.", nil, "", p.receivedBytes)
+	p.write(&b, "sent_bytes_total", "counter", "Number of bytes of messages sent.", nil, "", p.sentBytes)
+	p.write(&b, "acks_total", "counter", "Number of acknowledgements, by code.", p.acks, "code", 0)
+	p.write(&b, "parse_errors_total", "counter", "Number of messages that couldn't be parsed.", nil, "", p.parseErrors)
+
+	name := p.name("latency_seconds")
+	fmt.Fprintf(&b, "# HELP %s Time taken to handle or send messages, by type.\n# TYPE %s histogram\n", name, name)
+	for _, typ := range sortedKeys(p.latency) {
+		h := p.latency[typ]
+		for i, le := range h.buckets {
+			fmt.Fprintf(&b, "%s_bucket{type=%s,le=\"%s\"} %d\n", name, quoteLabel(typ), formatFloat(le), h.counts[i])
+		}
+		fmt.Fprintf(&b, "%s_bucket{type=%s,le=\"+Inf\"} %d\n", name, quoteLabel(typ), h.count)
+		fmt.Fprintf(&b, "%s_sum{type=%s} %s\n", name, quoteLabel(typ), formatFloat(h.sum))
+		fmt.Fprintf(&b, "%s_count{type=%s} %d\n", name, quoteLabel(typ), h.count)
+	}
+
+	p.mu.Unlock()
+
+	return b.WriteTo(w)
+}
+
+// ServeHTTP writes the metrics in response to any request.
+func (p *PrometheusMetrics) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	p.WriteTo(w)
+}
+
+// write writes a single metric, or, if values isn't nil, one for each of its
+// label values.
+func (p *PrometheusMetrics) write(w io.Writer, name, kind, help string, values map[string]int64, label string, v int64) {
+	name = p.name(name)
+
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, kind)
+
+	if label == "" {
+		fmt.Fprintf(w, "%s %d\n", name, v)
+		return
+	}
+
+	for _, k := range sortedKeys(values) {
+		fmt.Fprintf(w, "%s{%s=%s} %d\n", name, label, quoteLabel(k), values[k])
+	}
+}
+
+func (p *PrometheusMetrics) name(s string) string {
+	if p.Prefix == "" {
+		return s
+	}
+
+	return p.Prefix + "_" + s
+}
+
+func sortedKeys(m interface{}) []string {
+	var a []string
+
+	switch m := m.(type) {
+	case map[string]int64:
+		for k := range m {
+			a = append(a, k)
+		}
+	case map[string]*histogram:
+		for k := range m {
+			a = append(a, k)
+		}
+	}
+
+	sort.Strings(a)
+
+	return a
+}
+
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func quoteLabel(s string) string {
+	return `"` + labelEscaper.Replace(s) + `"`
+}
+
+func formatFloat(f float64) string {
+	if math.IsInf(f, 1) {
+		return "+Inf"
+	}
+
+	return strconv.FormatFloat(f, 'g', -1, 64)
+}
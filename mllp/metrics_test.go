@@ -0,0 +1,182 @@
+package mllp
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"log"
+	"net"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"fknsrs.biz/p/hl7"
+)
+
+func TestPrometheusMetrics(t *testing.T) {
+	a := assert.New(t)
+
+	p := NewPrometheusMetrics("mllp_server")
+	p.Buckets = []float64{0.1, 1}
+
+	p.ConnOpened()
+	p.ConnOpened()
+	p.ConnClosed()
+	p.MessageReceived("ADT^A01", 100)
+	p.MessageReceived("ADT^A01", 50)
+	p.MessageReceived("", 10)
+	p.MessageSent("ACK^A01", 40)
+	p.ACK(hl7.AckAccept)
+	p.ACK(hl7.AckReject)
+	p.ParseError()
+	p.Latency("ADT^A01", 50*time.Millisecond)
+	p.Latency("ADT^A01", 500*time.Millisecond)
+	p.Latency(`Z"Z\Z`, 2*time.Second)
+
+	var b bytes.Buffer
+	_, err := p.WriteTo(&b)
+	a.NoError(err)
+
+	a.Equal(strings.Join([]string{
+		`# HELP mllp_server_connections_open Number of connections currently open.`,
+		`# TYPE mllp_server_connections_open gauge`,
+		`mllp_server_connections_open 1`,
+		`# HELP mllp_server_connections_total Number of connections opened.`,
+		`# TYPE mllp_server_connections_total counter`,
+		`mllp_server_connections_total 2`,
+		`# HELP mllp_server_messages_received_total Number of messages received, by type.`,
+		`# TYPE mllp_server_messages_received_total counter`,
+		`mllp_server_messages_received_total{type=""} 1`,
+		`mllp_server_messages_received_total{type="ADT^A01"} 2`,
+		`# HELP mllp_server_messages_sent_total Number of messages sent, by type.`,
+		`# TYPE mllp_server_messages_sent_total counter`,
+		`mllp_server_messages_sent_total{type="ACK^A01"} 1`,
+		`# HELP mllp_server_received_bytes_total Number of bytes of messages received.`,
+		`# TYPE mllp_server_received_bytes_total counter`,
+		`mllp_server_received_bytes_total 160`,
+		`# HELP mllp_server_sent_bytes_total Number of bytes of messages sent.`,
+		`# TYPE mllp_server_sent_bytes_total counter`,
+		`mllp_server_sent_bytes_total 40`,
+		`# HELP mllp_server_acks_total Number of acknowledgements, by code.`,
+		`# TYPE mllp_server_acks_total counter`,
+		`mllp_server_acks_total{code="AA"} 1`,
+		`mllp_server_acks_total{code="AR"} 1`,
+		`# HELP mllp_server_parse_errors_total Number of messages that couldn't be parsed.`,
+		`# TYPE mllp_server_parse_errors_total counter`,
+		`mllp_server_parse_errors_total 1`,
+		`# HELP mllp_server_latency_seconds Time taken to handle or send messages, by type.`,
+		`# TYPE mllp_server_latency_seconds histogram`,
+		`mllp_server_latency_seconds_bucket{type="ADT^A01",le="0.1"} 1`,
+		`mllp_server_latency_seconds_bucket{type="ADT^A01",le="1"} 2`,
+		`mllp_server_latency_seconds_bucket{type="ADT^A01",le="+Inf"} 2`,
+		`mllp_server_latency_seconds_sum{type="ADT^A01"} 0.55`,
+		`mllp_server_latency_seconds_count{type="ADT^A01"} 2`,
+		`mllp_server_latency_seconds_bucket{type="other",le="0.1"} 0`,
+		`mllp_server_latency_seconds_bucket{type="other",le="1"} 0`,
+		`mllp_server_latency_seconds_bucket{type="other",le="+Inf"} 1`,
+		`mllp_server_latency_seconds_sum{type="other"} 2`,
+		`mllp_server_latency_seconds_count{type="other"} 1`,
+		``,
+	}, "\n"), b.String())
+
+	rec := httptest.NewRecorder()
+	p.ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+	a.Equal(b.String(), rec.Body.String())
+	a.Contains(rec.Header().Get("Content-Type"), "text/plain")
+}
+
+func TestPrometheusMetricsLimits(t *testing.T) {
+	a := assert.New(t)
+
+	// types and codes from the other end can't make the metrics grow
+	// forever
+	p := NewPrometheusMetrics("")
+	p.MaxTypes = 2
+
+	for _, typ := range []string{"ADT^A01", "ORU^R01", "ORM^O01", "ADT^A01", "adt^a01", "ADT^A01^ADT_A01", "", "ACK"} {
+		p.MessageReceived(typ, 1)
+		p.Latency(typ, time.Millisecond)
+	}
+	p.ACK("XX")
+
+	a.Equal(map[string]int64{"": 1, "ADT^A01": 2, "ORU^R01": 1, "other": 4}, p.received)
+	a.Len(p.latency, 4)
+	a.Equal(map[string]int64{"other": 1}, p.acks)
+}
+
+func TestServerClientMetrics(t *testing.T) {
+	a := assert.New(t)
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sm := NewPrometheusMetrics("mllp_server")
+
+	s := &Server{
+		Handler: hl7.HandlerFunc(func(ctx context.Context, m hl7.Message, d *hl7.Delimiters) (hl7.Message, error) {
+			return nil, nil
+		}),
+		Metrics:  sm,
+		ErrorLog: log.New(ioutil.Discard, "", 0),
+	}
+	go s.Serve(l)
+	defer s.Close()
+
+	c, err := Dial(l.Addr().String())
+	a.NoError(err)
+
+	cm := NewPrometheusMetrics("mllp_client")
+	c.Metrics = cm
+
+	m, d, err := hl7.ParseMessage([]byte(testMessage))
+	a.NoError(err)
+
+	_, err = c.SendMessage(m, d)
+	a.NoError(err)
+
+	_, err = c.Send([]byte("this isn't HL7"))
+	a.NoError(err)
+
+	a.NoError(c.Close())
+
+	var b bytes.Buffer
+	_, err = cm.WriteTo(&b)
+	a.NoError(err)
+
+	a.Contains(b.String(), "mllp_client_connections_open 0\n")
+	a.Contains(b.String(), "mllp_client_connections_total 1\n")
+	a.Contains(b.String(), "mllp_client_messages_sent_total{type=\"\"} 1\n")
+	a.Contains(b.String(), "mllp_client_messages_sent_total{type=\"ADT^A01\"} 1\n")
+	a.Contains(b.String(), "mllp_client_messages_received_total{type=\"ACK^A01\"} 1\n")
+	a.Contains(b.String(), "mllp_client_acks_total{code=\"AA\"} 1\n")
+	a.Contains(b.String(), "mllp_client_latency_seconds_count{type=\"ADT^A01\"} 1\n")
+
+	// the server finishes with the connection in its own time
+	for i := 0; i < 100; i++ {
+		b.Reset()
+		_, err = sm.WriteTo(&b)
+		a.NoError(err)
+
+		if strings.Contains(b.String(), "mllp_server_connections_open 0\n") {
+			break
+		}
+
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	a.Contains(b.String(), "mllp_server_connections_open 0\n")
+	a.Contains(b.String(), "mllp_server_connections_total 1\n")
+	a.Contains(b.String(), "mllp_server_messages_received_total{type=\"\"} 1\n")
+	a.Contains(b.String(), "mllp_server_messages_received_total{type=\"ADT^A01\"} 1\n")
+	a.Contains(b.String(), "mllp_server_messages_sent_total{type=\"ACK^A01\"} 1\n")
+	a.Contains(b.String(), "mllp_server_messages_sent_total{type=\"ACK\"} 1\n")
+	a.Contains(b.String(), "mllp_server_acks_total{code=\"AA\"} 1\n")
+	a.Contains(b.String(), "mllp_server_acks_total{code=\"AR\"} 1\n")
+	a.Contains(b.String(), "mllp_server_parse_errors_total 1\n")
+	a.Contains(b.String(), "mllp_server_latency_seconds_count{type=\"ADT^A01\"} 1\n")
+}
@@ -0,0 +1,137 @@
+// Package mllp implements the Minimal Lower Layer Protocol, the usual way of
+// sending HL7 messages over TCP. Each message is wrapped in a frame that
+// starts with a vertical tab (0x0b) and ends with a file separator and a
+// carriage return (0x1c 0x0d), and each message sent gets an acknowledgement
+// message back on the same connection.
+package mllp // import "fknsrs.biz/p/hl7/mllp"
+
+import (
+	"bufio"
+	"io"
+
+	"github.com/facebookgo/stackerr"
+
+	"fknsrs.biz/p/hl7"
+)
+
+const (
+	startBlock = 0x0b
+	endBlock   = 0x1c
+	endData    = 0x0d
+)
+
+type (
+	// ErrInvalidFrame is returned when a frame isn't properly terminated.
+	ErrInvalidFrame error
+	// ErrFrameTooLarge is returned when a frame is bigger than a Reader's
+	// MaxSize.
+	ErrFrameTooLarge error
+)
+
+// Reader reads framed messages from a stream.
+type Reader struct {
+	// MaxSize, if more than zero, limits the size of each message.
+	MaxSize int
+
+	r *bufio.Reader
+}
+
+// NewReader returns a Reader that reads from r.
+func NewReader(r io.Reader) *Reader {
+	return &Reader{r: bufio.NewReader(r)}
+}
+
+// ReadMessage reads the next message, without its framing. Anything between
+// frames (like stray newlines) is skipped. It returns io.EOF if the stream
+// ends between frames, and io.ErrUnexpectedEOF if it ends in the middle of
+// one.
+func (r *Reader) ReadMessage() ([]byte, error) {
+	for {
+		c, err := r.r.ReadByte()
+		if err != nil {
+			return nil, err
+		}
+
+		if c == startBlock {
+			break
+		}
+	}
+
+	var buf []byte
+
+	for {
+		c, err := r.r.ReadByte()
+		if err == io.EOF {
+			return nil, io.ErrUnexpectedEOF
+		} else if err != nil {
+			return nil, err
+		}
+
+		if c == endBlock {
+			break
+		}
+
+		if c == startBlock {
+			return nil, ErrInvalidFrame(stackerr.Newf("start of frame found inside frame"))
+		}
+
+		if r.MaxSize > 0 && len(buf) >= r.MaxSize {
+			return nil, ErrFrameTooLarge(stackerr.Newf("message is larger than %d bytes", r.MaxSize))
+		}
+
+		buf = append(buf, c)
+	}
+
+	c, err := r.r.ReadByte()
+	if err == io.EOF {
+		return nil, io.ErrUnexpectedEOF
+	} else if err != nil {
+		return nil, err
+	}
+
+	if c != endData {
+		return nil, ErrInvalidFrame(stackerr.Newf("expected \\x%02x after end of frame; instead found \\x%02x", endData, c))
+	}
+
+	return buf, nil
+}
+
+// Writer writes framed messages to a stream.
+type Writer struct {
+	w io.Writer
+}
+
+// NewWriter returns a Writer that writes to w.
+func NewWriter(w io.Writer) *Writer {
+	return &Writer{w: w}
+}
+
+// WriteMessage writes a message wrapped in a frame, in a single write.
+func (w *Writer) WriteMessage(b []byte) error {
+	buf := make([]byte, 0, len(b)+3)
+	buf = append(buf, startBlock)
+	buf = append(buf, b...)
+	buf = append(buf, endBlock, endData)
+
+	if _, err := w.w.Write(buf); err != nil {
+		return stackerr.Wrap(err)
+	}
+
+	return nil
+}
+
+// parseFrame parses the contents of a frame, which should hold exactly one
+// message. Segments can be separated by "\n" or "\r\n" as well as "\r".
+func parseFrame(b []byte) (hl7.Message, *hl7.Delimiters, error) {
+	a := hl7.SplitMessages(b)
+	if len(a) != 1 {
+		return nil, nil, ErrInvalidFrame(stackerr.Newf("expected one message in frame; instead found %d", len(a)))
+	}
+
+	m, d, err := hl7.ParseMessage(a[0])
+	if err != nil {
+		return nil, nil, stackerr.Wrap(err)
+	}
+
+	return m, d, nil
+}
@@ -0,0 +1,60 @@
+package mllp
+
+import (
+	"bytes"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReader(t *testing.T) {
+	a := assert.New(t)
+
+	r := NewReader(strings.NewReader("\x0bMSH|one\r\x1c\r\r\n\x0bMSH|two\r\x1c\r"))
+
+	b, err := r.ReadMessage()
+	a.NoError(err)
+	a.Equal("MSH|one\r", string(b))
+
+	b, err = r.ReadMessage()
+	a.NoError(err)
+	a.Equal("MSH|two\r", string(b))
+
+	_, err = r.ReadMessage()
+	a.Equal(io.EOF, err)
+}
+
+func TestReaderErrors(t *testing.T) {
+	a := assert.New(t)
+
+	_, err := NewReader(strings.NewReader("\x0bMSH|one\r")).ReadMessage()
+	a.Equal(io.ErrUnexpectedEOF, err)
+
+	_, err = NewReader(strings.NewReader("\x0bMSH|one\r\x1c")).ReadMessage()
+	a.Equal(io.ErrUnexpectedEOF, err)
+
+	_, err = NewReader(strings.NewReader("\x0bMSH|one\r\x1cX")).ReadMessage()
+	a.Error(err)
+
+	_, err = NewReader(strings.NewReader("\x0bMSH|one\r\x0bMSH|two\r\x1c\r")).ReadMessage()
+	a.Error(err)
+
+	r := NewReader(strings.NewReader("\x0bMSH|one\r\x1c\r"))
+	r.MaxSize = 4
+	_, err = r.ReadMessage()
+	a.Error(err)
+}
+
+func TestWriter(t *testing.T) {
+	a := assert.New(t)
+
+	var buf bytes.Buffer
+
+	w := NewWriter(&buf)
+	a.NoError(w.WriteMessage([]byte("MSH|one\r")))
+	a.NoError(w.WriteMessage([]byte("MSH|two\r")))
+
+	a.Equal("\x0bMSH|one\r\x1c\r\x0bMSH|two\r\x1c\r", buf.String())
+}
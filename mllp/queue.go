@@ -0,0 +1,344 @@
+package mllp
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/facebookgo/stackerr"
+
+	"fknsrs.biz/p/hl7"
+)
+
+// Queue is a store-and-forward queue for sending messages to an MLLP server
+// that might not always be there. Messages are written to files in a
+// directory as they're added, and sent one at a time, in the order they were
+// added, by Run. Because the queue lives on disk, anything that hasn't been
+// sent when the process stops is sent once it's started again.
+//
+// What happens to a message depends on its acknowledgement:
+//
+//   - AA or CA: it's removed from the queue.
+//   - AR or CR: it's moved to the dead letter directory, "dead" inside the
+//     queue's directory, along with the acknowledgement, and the next message
+//     is sent.
+//   - AE or CE, or anything that goes wrong with the connection: it's sent
+//     again after a delay, which doubles after each failure in a row.
+//
+// Messages are only removed once they've been acknowledged, so if the
+// process stops between the two, they're sent again. Receivers can use the
+// dedup package to cope with this.
+type Queue struct {
+	// Dial connects to the server. The default connects to Addr.
+	Dial func() (*Client, error)
+	// Timeout is passed on to each Client; the default is 30 seconds.
+	Timeout time.Duration
+	// MinDelay and MaxDelay set the range of delays before sending a
+	// message again. They default to one second and five minutes.
+	MinDelay time.Duration
+	MaxDelay time.Duration
+	// ErrorLog is used to log failed attempts at delivery. If it's nil, the
+	// log package's standard logger is used.
+	ErrorLog *log.Logger
+
+	dir    string
+	mu     sync.Mutex
+	seq    uint64
+	notify chan struct{}
+}
+
+const queueSuffix = ".hl7"
+
+// NewQueue opens (or creates) a queue in dir, for sending messages to addr.
+func NewQueue(dir, addr string) (*Queue, error) {
+	if err := os.MkdirAll(filepath.Join(dir, "dead"), 0755); err != nil {
+		return nil, stackerr.Wrap(err)
+	}
+
+	q := &Queue{
+		Dial:     func() (*Client, error) { return Dial(addr) },
+		Timeout:  30 * time.Second,
+		MinDelay: time.Second,
+		MaxDelay: 5 * time.Minute,
+		dir:      dir,
+		notify:   make(chan struct{}, 1),
+	}
+
+	// dead letters keep their names, so they count too; otherwise a
+	// message could end up with the same name as one that's already been
+	// buried
+	for _, d := range []string{dir, filepath.Join(dir, "dead")} {
+		names, err := listQueue(d)
+		if err != nil {
+			return nil, err
+		}
+
+		if len(names) > 0 {
+			if n, _ := strconv.ParseUint(strings.TrimSuffix(names[len(names)-1], queueSuffix), 10, 64); n > q.seq {
+				q.seq = n
+			}
+		}
+	}
+
+	// clean up after any writes that were interrupted
+	tmp, _ := filepath.Glob(filepath.Join(dir, ".tmp-*"))
+	for _, p := range tmp {
+		os.Remove(p)
+	}
+
+	return q, nil
+}
+
+// Enqueue adds an encoded message to the end of the queue. The message is
+// parsed first, so that one that could never be sent isn't accepted. Once
+// Enqueue returns, the message is safely on disk.
+func (q *Queue) Enqueue(b []byte) error {
+	if _, _, err := parseFrame(b); err != nil {
+		return stackerr.Wrap(err)
+	}
+
+	f, err := ioutil.TempFile(q.dir, ".tmp-")
+	if err != nil {
+		return stackerr.Wrap(err)
+	}
+
+	_, err = f.Write(b)
+	if err == nil {
+		err = f.Sync()
+	}
+	if e := f.Close(); err == nil {
+		err = e
+	}
+	if err != nil {
+		os.Remove(f.Name())
+		return stackerr.Wrap(err)
+	}
+
+	q.mu.Lock()
+	q.seq++
+	name := fmt.Sprintf("%020d%s", q.seq, queueSuffix)
+	err = os.Rename(f.Name(), filepath.Join(q.dir, name))
+	q.mu.Unlock()
+
+	if err != nil {
+		os.Remove(f.Name())
+		return stackerr.Wrap(err)
+	}
+
+	select {
+	case q.notify <- struct{}{}:
+	default:
+	}
+
+	return nil
+}
+
+// EnqueueMessage encodes a message and adds it to the end of the queue.
+func (q *Queue) EnqueueMessage(m hl7.Message, d *hl7.Delimiters) error {
+	return q.Enqueue(hl7.EncodeMessage(m, d))
+}
+
+// Len returns the number of messages waiting to be sent.
+func (q *Queue) Len() (int, error) {
+	names, err := q.list()
+	return len(names), err
+}
+
+// list returns the names of the files in the queue, in order.
+func (q *Queue) list() ([]string, error) {
+	return listQueue(q.dir)
+}
+
+// listQueue returns the names of the message files in dir, in order.
+func listQueue(dir string) ([]string, error) {
+	l, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, stackerr.Wrap(err)
+	}
+
+	var names []string
+	for _, fi := range l {
+		if fi.Mode().IsRegular() && strings.HasSuffix(fi.Name(), queueSuffix) {
+			names = append(names, fi.Name())
+		}
+	}
+
+	sort.Strings(names)
+
+	return names, nil
+}
+
+// Run sends messages until ctx is done, waiting for more when the queue is
+// empty. It only returns early if it can't read the queue's directory.
+func (q *Queue) Run(ctx context.Context) error {
+	var c *Client
+	defer func() {
+		if c != nil {
+			c.Close()
+		}
+	}()
+
+	var delay time.Duration
+
+	for {
+		names, err := q.list()
+		if err != nil {
+			return err
+		}
+
+		var wait <-chan time.Time
+
+		if len(names) == 0 {
+			delay = 0
+		} else {
+			ok, err := q.deliver(&c, names[0])
+			if err != nil {
+				q.logf("mllp: queue: delivering %s: %s", names[0], hl7.ErrorText(err))
+			}
+
+			if ok {
+				delay = 0
+				continue
+			}
+
+			if delay == 0 {
+				delay = q.MinDelay
+			} else if delay *= 2; delay > q.MaxDelay {
+				delay = q.MaxDelay
+			}
+
+			wait = time.After(delay)
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-wait:
+		case <-q.notify:
+			if wait != nil {
+				// a new message doesn't make the one at the front any
+				// more likely to get through, so keep waiting
+				select {
+				case <-ctx.Done():
+					return nil
+				case <-wait:
+				}
+			}
+		}
+	}
+}
+
+// deliver sends the message in one file, and deals with the response. It
+// reports whether the queue can move on to the next message.
+func (q *Queue) deliver(c **Client, name string) (bool, error) {
+	p := filepath.Join(q.dir, name)
+
+	b, err := ioutil.ReadFile(p)
+	if err != nil {
+		return false, stackerr.Wrap(err)
+	}
+
+	m, d, err := parseFrame(b)
+	if err != nil {
+		if err := q.bury(name, []byte("unreadable message: "+hl7.ErrorText(err)+"\n")); err != nil {
+			return false, err
+		}
+		return true, nil
+	}
+
+	if *c == nil {
+		cl, err := q.Dial()
+		if err != nil {
+			return false, stackerr.Wrap(err)
+		}
+
+		cl.Timeout = q.Timeout
+		*c = cl
+	}
+
+	am, err := (*c).SendMessage(m, d)
+	if err != nil {
+		(*c).Close()
+		*c = nil
+		return false, stackerr.Wrap(err)
+	}
+
+	if am == nil {
+		// in enhanced mode, the message might not ask for an
+		// acknowledgement we can wait for; all we can do is assume it
+		// got there
+		if err := os.Remove(p); err != nil {
+			return false, stackerr.Wrap(err)
+		}
+		return true, nil
+	}
+
+	ack, err := hl7.ReadACK(am)
+	if err != nil {
+		(*c).Close()
+		*c = nil
+		return false, stackerr.Wrap(err)
+	}
+
+	// a reject without a control ID is from a server that couldn't read
+	// the message well enough to find it, and it's still for this message
+	unaddressed := ack.ControlID == "" && (ack.Code == hl7.AckReject || ack.Code == hl7.AckCommitReject)
+
+	if id := m.Segment("MSH", 0).Value(10); ack.ControlID != id && !unaddressed {
+		(*c).Close()
+		*c = nil
+		return false, stackerr.Newf("acknowledgement is for %q, not %q", ack.ControlID, id)
+	}
+
+	switch ack.Code {
+	case hl7.AckAccept, hl7.AckCommitAccept:
+		if err := os.Remove(p); err != nil {
+			return false, stackerr.Wrap(err)
+		}
+		return true, nil
+	case hl7.AckReject, hl7.AckCommitReject:
+		if err := q.bury(name, hl7.EncodeMessage(am, nil)); err != nil {
+			return false, err
+		}
+		return true, nil
+	default:
+		return false, stackerr.Newf("got %s: %s", ack.Code, ack.Text)
+	}
+}
+
+// bury moves a message to the dead letter directory, with a note (usually
+// the acknowledgement) beside it. It won't replace a dead letter that's
+// already there.
+func (q *Queue) bury(name string, note []byte) error {
+	dead := filepath.Join(q.dir, "dead")
+
+	if _, err := os.Stat(filepath.Join(dead, name)); err == nil {
+		return stackerr.Newf("dead letter %s already exists", name)
+	}
+
+	if err := ioutil.WriteFile(filepath.Join(dead, strings.TrimSuffix(name, queueSuffix)+".ack"), note, 0644); err != nil {
+		return stackerr.Wrap(err)
+	}
+
+	if err := os.Rename(filepath.Join(q.dir, name), filepath.Join(dead, name)); err != nil {
+		return stackerr.Wrap(err)
+	}
+
+	return nil
+}
+
+func (q *Queue) logf(format string, args ...interface{}) {
+	if q.ErrorLog != nil {
+		q.ErrorLog.Printf(format, args...)
+	} else {
+		log.Printf(format, args...)
+	}
+}
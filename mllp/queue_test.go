@@ -0,0 +1,275 @@
+package mllp
+
+import (
+	"context"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"fknsrs.biz/p/hl7"
+)
+
+func queueTestMessage(id, pid string) []byte {
+	return []byte("MSH|^~\\&|APP|FAC|RAPP|RFAC|20240102||ADT^A01|" + id + "|P|2.5\rPID|1||" + pid + "\r")
+}
+
+func TestQueue(t *testing.T) {
+	a := assert.New(t)
+
+	dir, err := ioutil.TempDir("", "mllp-queue")
+	if !a.NoError(err) {
+		return
+	}
+	defer os.RemoveAll(dir)
+
+	q, err := NewQueue(dir, "127.0.0.1:1")
+	if !a.NoError(err) {
+		return
+	}
+
+	a.Error(q.Enqueue([]byte("not a message")))
+
+	a.NoError(q.Enqueue(queueTestMessage("1", "ok")))
+	a.NoError(q.Enqueue(queueTestMessage("2", "error-once")))
+	a.NoError(q.Enqueue(queueTestMessage("3", "reject")))
+
+	// a fresh queue on the same directory picks up where the last one left
+	// off, which is what happens after a restart
+	q, err = NewQueue(dir, "127.0.0.1:1")
+	if !a.NoError(err) {
+		return
+	}
+
+	a.NoError(q.Enqueue(queueTestMessage("4", "ok")))
+
+	n, err := q.Len()
+	a.NoError(err)
+	a.Equal(4, n)
+
+	var mu sync.Mutex
+	var received []string
+	failed := false
+
+	s, addr := startServer(t, hl7.HandlerFunc(func(ctx context.Context, m hl7.Message, d *hl7.Delimiters) (hl7.Message, error) {
+		mu.Lock()
+		defer mu.Unlock()
+
+		received = append(received, m.Segment("MSH", 0).Value(10))
+
+		switch m.Segment("PID", 0).Value(3) {
+		case "error-once":
+			if !failed {
+				failed = true
+				return hl7.NewACK(m, d, hl7.AckError, "try again"), nil
+			}
+		case "reject":
+			return hl7.NewACK(m, d, hl7.AckReject, "go away"), nil
+		}
+
+		return nil, nil
+	}))
+	defer s.Close()
+
+	q.Dial = func() (*Client, error) { return Dial(addr) }
+	q.MinDelay = 10 * time.Millisecond
+	q.ErrorLog = log.New(ioutil.Discard, "", 0)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() { done <- q.Run(ctx) }()
+
+	for i := 0; i < 100; i++ {
+		if n, _ := q.Len(); n == 0 {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	a.NoError(q.Enqueue(queueTestMessage("5", "ok")))
+
+	for i := 0; i < 100; i++ {
+		if n, _ := q.Len(); n == 0 {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	cancel()
+	a.NoError(<-done)
+
+	mu.Lock()
+	a.Equal([]string{"1", "2", "2", "3", "4", "5"}, received)
+	mu.Unlock()
+
+	dead, err := filepath.Glob(filepath.Join(dir, "dead", "*"))
+	a.NoError(err)
+	if a.Len(dead, 2) {
+		a.True(strings.HasSuffix(dead[0], "03.ack"))
+		a.True(strings.HasSuffix(dead[1], "03.hl7"))
+
+		b, err := ioutil.ReadFile(dead[0])
+		a.NoError(err)
+		a.Contains(string(b), "MSA|AR|3|go away")
+	}
+}
+
+func TestQueueRetryConnection(t *testing.T) {
+	a := assert.New(t)
+
+	dir, err := ioutil.TempDir("", "mllp-queue")
+	if !a.NoError(err) {
+		return
+	}
+	defer os.RemoveAll(dir)
+
+	q, err := NewQueue(dir, "")
+	if !a.NoError(err) {
+		return
+	}
+
+	a.NoError(q.Enqueue(queueTestMessage("1", "ok")))
+
+	var s *Server
+	var addr string
+	attempts := 0
+
+	q.Dial = func() (*Client, error) {
+		attempts++
+		if attempts < 3 {
+			return nil, os.ErrNotExist
+		}
+		return Dial(addr)
+	}
+	q.MinDelay = time.Millisecond
+	q.ErrorLog = log.New(ioutil.Discard, "", 0)
+
+	s, addr = startServer(t, hl7.HandlerFunc(func(ctx context.Context, m hl7.Message, d *hl7.Delimiters) (hl7.Message, error) {
+		return nil, nil
+	}))
+	defer s.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() { done <- q.Run(ctx) }()
+
+	for i := 0; i < 100; i++ {
+		if n, _ := q.Len(); n == 0 {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	cancel()
+	a.NoError(<-done)
+
+	n, err := q.Len()
+	a.NoError(err)
+	a.Equal(0, n)
+	a.Equal(3, attempts)
+}
+
+func TestQueueDeadLetters(t *testing.T) {
+	a := assert.New(t)
+
+	dir, err := ioutil.TempDir("", "mllp-queue")
+	if !a.NoError(err) {
+		return
+	}
+	defer os.RemoveAll(dir)
+
+	q, err := NewQueue(dir, "")
+	if !a.NoError(err) {
+		return
+	}
+
+	// the only sign of earlier messages is a dead letter
+	a.NoError(ioutil.WriteFile(filepath.Join(dir, "dead", "00000000000000000007.hl7"), queueTestMessage("7", "reject"), 0644))
+
+	q, err = NewQueue(dir, "")
+	if !a.NoError(err) {
+		return
+	}
+
+	a.NoError(q.Enqueue(queueTestMessage("8", "ok")))
+
+	names, err := q.list()
+	a.NoError(err)
+	a.Equal([]string{"00000000000000000008.hl7"}, names)
+
+	// an unreadable message would be buried, but there's already a dead
+	// letter with its name, so it has to stay put and be tried again later
+	a.NoError(ioutil.WriteFile(filepath.Join(dir, "00000000000000000007.hl7"), []byte("not a message"), 0644))
+
+	var c *Client
+	ok, err := q.deliver(&c, "00000000000000000007.hl7")
+	a.False(ok)
+	a.Error(err)
+
+	b, err := ioutil.ReadFile(filepath.Join(dir, "dead", "00000000000000000007.hl7"))
+	a.NoError(err)
+	a.Equal(queueTestMessage("7", "reject"), b)
+
+	_, err = os.Stat(filepath.Join(dir, "dead", "00000000000000000007.ack"))
+	a.True(os.IsNotExist(err))
+}
+
+func TestQueueUnaddressedReject(t *testing.T) {
+	a := assert.New(t)
+
+	dir, err := ioutil.TempDir("", "mllp-queue")
+	if !a.NoError(err) {
+		return
+	}
+	defer os.RemoveAll(dir)
+
+	// the server can't read the first message, so its reject has a blank
+	// MSA-2, but it's happy with the second
+	addr, stop := startACKServer(t, func(m hl7.Message, d *hl7.Delimiters) hl7.Message {
+		if m.Segment("PID", 0).Value(3) == "unreadable" {
+			return hl7.NewACK(nil, nil, hl7.AckReject, "can't read that")
+		}
+		return hl7.NewACK(m, d, hl7.AckAccept, "")
+	})
+	defer stop()
+
+	q, err := NewQueue(dir, addr)
+	if !a.NoError(err) {
+		return
+	}
+
+	q.MinDelay = 10 * time.Millisecond
+	q.ErrorLog = log.New(ioutil.Discard, "", 0)
+
+	a.NoError(q.Enqueue(queueTestMessage("1", "unreadable")))
+	a.NoError(q.Enqueue(queueTestMessage("2", "ok")))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() { done <- q.Run(ctx) }()
+
+	for i := 0; i < 100; i++ {
+		if n, _ := q.Len(); n == 0 {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	cancel()
+	a.NoError(<-done)
+
+	n, err := q.Len()
+	a.NoError(err)
+	a.Equal(0, n)
+
+	b, err := ioutil.ReadFile(filepath.Join(dir, "dead", "00000000000000000001.ack"))
+	if a.NoError(err) {
+		a.Contains(string(b), "MSA|AR||can't read that")
+	}
+}
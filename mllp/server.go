@@ -0,0 +1,725 @@
+package mllp // import "fknsrs.biz/p/hl7/mllp"
+
+import (
+	"context"
+	"crypto/tls"
+	"io"
+	"log"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/facebookgo/stackerr"
+
+	"fknsrs.biz/p/hl7"
+)
+
+// ErrServerClosed is returned by Serve and ListenAndServe after Close or
+// Shutdown is called.
+var ErrServerClosed = stackerr.New("mllp: server closed")
+
+// Server accepts MLLP connections and passes each message it receives to a
+// handler, sending back whatever acknowledgement the handler gives (see
+// hl7.Handler). Messages on one connection are handled one at a time, in the
+// order they arrive.
+//
+// Messages that ask for enhanced mode acknowledgements (with MSH-15 or
+// MSH-16) get a CA commit acknowledgement as soon as they're received (and
+// stored, if Store is set), before the handler is called, and then the
+// handler's application acknowledgement. Each is only sent if the message
+// asks for it (see hl7.AckWanted).
+//
+// Messages that can't be parsed don't reach the handler. They're rejected
+// with a CR commit acknowledgement if their MSH segment shows they're in
+// enhanced mode, or with an AR acknowledgement otherwise, including when the
+// MSH segment can't be read either.
+type Server struct {
+	// Addr is the address to listen on for ListenAndServe, like ":2575".
+	Addr string
+	// Handler handles each message.
+	Handler hl7.Handler
+	// SendApplicationACK, if it's set, is used to deliver application
+	// acknowledgements in enhanced mode, instead of sending them back on the
+	// same connection as the message came in on. Enhanced mode senders
+	// usually expect them as separate messages, sent to their own receiver,
+	// so this would typically add them to a Queue.
+	SendApplicationACK func(ctx context.Context, ack hl7.Message, d *hl7.Delimiters) error
+	// Store, if it's set, is called with each enhanced mode message before
+	// its commit acknowledgement is sent, to put it somewhere safe. If it
+	// fails, the message gets a CE commit acknowledgement and isn't passed
+	// to the handler.
+	Store func(ctx context.Context, m hl7.Message, d *hl7.Delimiters) error
+	// TLSConfig is used by ServeTLS and ListenAndServeTLS. To require
+	// client certificates, set ClientAuth to tls.RequireAndVerifyClientCert
+	// and ClientCAs to the CAs they have to be signed by (see
+	// LoadCertPool). Handlers can find the client's certificate with
+	// PeerCertificate.
+	TLSConfig *tls.Config
+	// Metrics, if it's set, collects statistics about connections and
+	// messages (see PrometheusMetrics).
+	Metrics Metrics
+	// MaxConns, if more than zero, limits how many connections can be open
+	// at once. Once there are that many, no more are accepted until one of
+	// them closes.
+	MaxConns int
+	// IdleTimeout, if more than zero, is how long a connection can go
+	// without sending a whole message before it's closed.
+	IdleTimeout time.Duration
+	// AllowList, if it's not empty, is a list of IP addresses (like
+	// "10.1.2.3") and networks (like "10.0.0.0/8") that are allowed to
+	// connect. Connections from anywhere else are closed as soon as
+	// they're accepted.
+	AllowList []string
+	// ErrorLog is used to log connection errors. If it's nil, the log
+	// package's standard logger is used.
+	ErrorLog *log.Logger
+
+	mu        sync.Mutex
+	listeners map[net.Listener]bool
+	conns     map[net.Conn]bool // true while a message is being handled
+	closed    bool
+	done      chan struct{}
+	sem       chan struct{}
+}
+
+// ListenAndServe listens on addr and serves connections with h.
+func ListenAndServe(addr string, h hl7.Handler) error {
+	s := &Server{Addr: addr, Handler: h}
+	return s.ListenAndServe()
+}
+
+// ListenAndServe listens on s.Addr (or ":2575" if it's empty) and serves
+// connections.
+func (s *Server) ListenAndServe() error {
+	addr := s.Addr
+	if addr == "" {
+		addr = ":2575"
+	}
+
+	l, err := net.Listen("tcp", addr)
+	if err != nil {
+		return stackerr.Wrap(err)
+	}
+
+	return s.Serve(l)
+}
+
+// ListenAndServeTLS is like ListenAndServe, but for connections over TLS. See
+// ServeTLS.
+func (s *Server) ListenAndServeTLS(certFile, keyFile string) error {
+	addr := s.Addr
+	if addr == "" {
+		addr = ":2575"
+	}
+
+	l, err := net.Listen("tcp", addr)
+	if err != nil {
+		return stackerr.Wrap(err)
+	}
+
+	return s.ServeTLS(l, certFile, keyFile)
+}
+
+// ServeTLS is like Serve, but for connections over TLS, configured by
+// s.TLSConfig. If certFile and keyFile are given, the server's certificate
+// and key are loaded from them; otherwise they have to be in s.TLSConfig
+// already.
+func (s *Server) ServeTLS(l net.Listener, certFile, keyFile string) error {
+	config := &tls.Config{}
+	if s.TLSConfig != nil {
+		config = s.TLSConfig.Clone()
+	}
+
+	if certFile != "" || keyFile != "" {
+		cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+		if err != nil {
+			l.Close()
+			return stackerr.Wrap(err)
+		}
+
+		config.Certificates = append(config.Certificates, cert)
+	}
+
+	if len(config.Certificates) == 0 && config.GetCertificate == nil {
+		l.Close()
+		return stackerr.Newf("mllp: no certificate for TLS")
+	}
+
+	return s.Serve(tls.NewListener(l, config))
+}
+
+// Serve accepts connections from l until it fails or the server is closed,
+// handling each connection in its own goroutine. It closes l before it
+// returns.
+func (s *Server) Serve(l net.Listener) error {
+	defer l.Close()
+
+	allowed, err := parseAllowList(s.AllowList)
+	if err != nil {
+		return err
+	}
+
+	if !s.track(l, nil, true) {
+		return ErrServerClosed
+	}
+	defer s.track(l, nil, false)
+
+	var delay time.Duration
+
+	for {
+		if !s.acquire() {
+			return ErrServerClosed
+		}
+
+		conn, err := l.Accept()
+		if err != nil {
+			s.release()
+
+			if s.isClosed() {
+				return ErrServerClosed
+			}
+
+			if ne, ok := err.(net.Error); ok && ne.Temporary() {
+				if delay == 0 {
+					delay = 5 * time.Millisecond
+				} else if delay *= 2; delay > time.Second {
+					delay = time.Second
+				}
+
+				s.logf("mllp: accept error: %v; retrying in %v", err, delay)
+				time.Sleep(delay)
+
+				continue
+			}
+
+			return stackerr.Wrap(err)
+		}
+
+		delay = 0
+
+		if allowed != nil && !allowed(conn.RemoteAddr()) {
+			s.logf("mllp: connection from %s not allowed", conn.RemoteAddr())
+			conn.Close()
+			s.release()
+
+			continue
+		}
+
+		go s.serveConn(conn)
+	}
+}
+
+// Close stops the server, closing all of its listeners and connections. To
+// let messages that are being handled finish first, use Shutdown.
+func (s *Server) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	err := s.closeListeners()
+
+	for c := range s.conns {
+		c.Close()
+	}
+
+	return err
+}
+
+// Shutdown stops the server without interrupting any messages that are being
+// handled. It closes all of the server's listeners, and then connections as
+// they become idle (that is, once the acknowledgements for the messages they
+// were handling have been sent), and returns when they're all closed. If ctx
+// is done first, it returns ctx's error, and the remaining connections are
+// left open; call Close to close them too.
+func (s *Server) Shutdown(ctx context.Context) error {
+	s.mu.Lock()
+	err := s.closeListeners()
+	s.mu.Unlock()
+
+	delay := time.Millisecond
+
+	for {
+		if s.closeIdle() {
+			return err
+		}
+
+		t := time.NewTimer(delay)
+
+		select {
+		case <-ctx.Done():
+			t.Stop()
+			return ctx.Err()
+		case <-t.C:
+		}
+
+		if delay *= 2; delay > 500*time.Millisecond {
+			delay = 500 * time.Millisecond
+		}
+	}
+}
+
+// closeListeners marks the server as closed, and closes its listeners. It
+// has to be called with s.mu held.
+func (s *Server) closeListeners() error {
+	if !s.closed {
+		s.closed = true
+
+		if s.done != nil {
+			close(s.done)
+		}
+	}
+
+	var err error
+	for l := range s.listeners {
+		if e := l.Close(); e != nil && err == nil {
+			err = e
+		}
+	}
+
+	return err
+}
+
+// closeIdle interrupts the read on every connection that isn't handling a
+// message, so that it closes, and reports whether there are none left. It
+// doesn't close them itself, since one of them might have just started
+// receiving a message; see receiving.
+func (s *Server) closeIdle() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for c, active := range s.conns {
+		if !active {
+			c.SetReadDeadline(aLongTimeAgo)
+		}
+	}
+
+	return len(s.conns) == 0
+}
+
+// aLongTimeAgo is a read deadline that's already passed.
+var aLongTimeAgo = time.Unix(1, 0)
+
+func (s *Server) serveConn(conn net.Conn) {
+	defer s.release()
+	defer conn.Close()
+
+	if !s.track(nil, conn, true) {
+		return
+	}
+	defer s.track(nil, conn, false)
+
+	mt := s.metrics()
+	mt.ConnOpened()
+	defer mt.ConnClosed()
+
+	ctx := context.WithValue(context.Background(), remoteAddrKey, conn.RemoteAddr())
+
+	if tc, ok := conn.(*tls.Conn); ok {
+		tc.SetDeadline(time.Now().Add(handshakeTimeout))
+
+		if err := tc.Handshake(); err != nil {
+			if !s.isClosed() {
+				s.logf("mllp: TLS handshake error from %s: %v", conn.RemoteAddr(), err)
+			}
+
+			return
+		}
+
+		tc.SetDeadline(time.Time{})
+
+		state := tc.ConnectionState()
+		ctx = context.WithValue(ctx, tlsStateKey, &state)
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	cr := &connReader{s: s, conn: conn}
+	r := NewReader(cr)
+	w := NewWriter(conn)
+
+	for {
+		cr.deadline = time.Time{}
+		if s.IdleTimeout > 0 {
+			cr.deadline = time.Now().Add(s.IdleTimeout)
+		}
+
+		if !s.waiting(conn, cr.deadline) {
+			return
+		}
+
+		b, err := r.ReadMessage()
+		if err != nil {
+			// an idle connection timing out isn't worth logging
+			if ne, ok := err.(net.Error); ok && ne.Timeout() {
+				return
+			}
+
+			if err != io.EOF && !s.isClosed() {
+				s.logf("mllp: error reading from %s: %v", conn.RemoteAddr(), hl7.ErrorText(err))
+			}
+
+			return
+		}
+
+		if !s.setActive(conn, true) {
+			return
+		}
+
+		err = s.handle(ctx, b, func(ack hl7.Message, d *hl7.Delimiters) error {
+			eb := hl7.EncodeMessage(ack, d)
+			if err := w.WriteMessage(eb); err != nil {
+				return err
+			}
+
+			mt.MessageSent(ack.Type(), len(eb))
+
+			return nil
+		})
+		if err != nil {
+			if !s.isClosed() {
+				s.logf("mllp: error writing to %s: %v", conn.RemoteAddr(), hl7.ErrorText(err))
+			}
+
+			return
+		}
+
+		if !s.setActive(conn, false) {
+			return
+		}
+	}
+}
+
+// handle deals with one message, using send to write acknowledgements back
+// to the connection it came from.
+func (s *Server) handle(ctx context.Context, b []byte, send func(ack hl7.Message, d *hl7.Delimiters) error) error {
+	mt := s.metrics()
+
+	m, d, err := parseFrame(b)
+	if err != nil {
+		mt.MessageReceived("", len(b))
+		mt.ParseError()
+
+		return s.reject(b, err, send)
+	}
+
+	mt.MessageReceived(m.Type(), len(b))
+
+	accept, application := hl7.AckConditions(m)
+	if accept == "" {
+		return send(s.respond(ctx, m, d), d)
+	}
+
+	if s.Store != nil {
+		if err := s.Store(ctx, m, d); err != nil {
+			s.logf("mllp: error storing %s: %v", m.Segment("MSH", 0).Value(10), hl7.ErrorText(err))
+
+			if !hl7.AckWanted(accept, hl7.AckCommitError) {
+				return nil
+			}
+
+			mt.ACK(hl7.AckCommitError)
+
+			return send(hl7.NewACK(m, d, hl7.AckCommitError, hl7.ErrorText(err)), d)
+		}
+	}
+
+	if hl7.AckWanted(accept, hl7.AckCommitAccept) {
+		mt.ACK(hl7.AckCommitAccept)
+
+		if err := send(hl7.NewACK(m, d, hl7.AckCommitAccept, ""), d); err != nil {
+			return err
+		}
+	}
+
+	ack := s.respond(ctx, m, d)
+
+	if !hl7.AckWanted(application, ack.Segment("MSA", 0).Value(1)) {
+		return nil
+	}
+
+	if s.SendApplicationACK != nil {
+		if err := s.SendApplicationACK(ctx, ack, d); err != nil {
+			s.logf("mllp: error sending application acknowledgement for %s: %v", m.Segment("MSH", 0).Value(10), hl7.ErrorText(err))
+		}
+
+		return nil
+	}
+
+	return send(ack, d)
+}
+
+// reject answers a frame that couldn't be parsed. If the MSH segment of the
+// first message in it can be parsed, the acknowledgement is addressed to that
+// message, in the mode it asked for. If not, it gets an AR, since original
+// mode is the default.
+func (s *Server) reject(b []byte, err error, send func(ack hl7.Message, d *hl7.Delimiters) error) error {
+	var h hl7.Message
+	var d *hl7.Delimiters
+
+	code := hl7.AckReject
+
+	if a := hl7.SplitMessages(b); len(a) > 0 {
+		if m, md, err := hl7.ParseMessage(a[0]); err == nil {
+			h, d = m, md
+
+			if accept, _ := hl7.AckConditions(h); accept != "" {
+				code = hl7.AckCommitReject
+				if !hl7.AckWanted(accept, code) {
+					return nil
+				}
+			}
+		}
+	}
+
+	s.metrics().ACK(code)
+
+	return send(hl7.NewACK(h, d, code, hl7.ErrorText(err)), d)
+}
+
+// respond calls the handler, recording how long it took and the code of the
+// acknowledgement it gave.
+func (s *Server) respond(ctx context.Context, m hl7.Message, d *hl7.Delimiters) hl7.Message {
+	mt := s.metrics()
+
+	start := time.Now()
+	ack := hl7.Respond(ctx, s.Handler, m, d)
+	mt.Latency(m.Type(), time.Since(start))
+	mt.ACK(ack.Segment("MSA", 0).Value(1))
+
+	return ack
+}
+
+func (s *Server) track(l net.Listener, c net.Conn, add bool) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if add && s.closed {
+		return false
+	}
+
+	if s.listeners == nil {
+		s.listeners = make(map[net.Listener]bool)
+		s.conns = make(map[net.Conn]bool)
+	}
+
+	switch {
+	case l != nil && add:
+		s.listeners[l] = true
+	case l != nil:
+		delete(s.listeners, l)
+	case add:
+		s.conns[c] = false
+	default:
+		delete(s.conns, c)
+	}
+
+	return true
+}
+
+// waiting sets the read deadline for a connection that's about to wait for
+// a message. It returns false if the server is shutting down, in which case
+// there's no point waiting.
+func (s *Server) waiting(c net.Conn, deadline time.Time) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.closed {
+		return false
+	}
+
+	c.SetReadDeadline(deadline)
+
+	return true
+}
+
+// receiving marks a connection as handling a message as soon as any of the
+// message arrives. If closeIdle got to it in between the data arriving and
+// this being called, it undoes closeIdle's deadline, so that the message can
+// be finished and acknowledged.
+func (s *Server) receiving(c net.Conn, deadline time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if active, ok := s.conns[c]; ok && !active {
+		s.conns[c] = true
+		c.SetReadDeadline(deadline)
+	}
+}
+
+// connReader tells the server when data arrives on a connection; see
+// receiving.
+type connReader struct {
+	s        *Server
+	conn     net.Conn
+	deadline time.Time
+}
+
+func (r *connReader) Read(p []byte) (int, error) {
+	n, err := r.conn.Read(p)
+	if n > 0 {
+		r.s.receiving(r.conn, r.deadline)
+	}
+
+	return n, err
+}
+
+// setActive records whether a connection is handling a message. It returns
+// false if the server is shutting down and the connection has become idle.
+func (s *Server) setActive(c net.Conn, active bool) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.conns[c]; !ok || (s.closed && !active) {
+		return false
+	}
+
+	s.conns[c] = active
+
+	return true
+}
+
+// acquire waits until there's room for another connection, according to
+// MaxConns. It returns false if the server is closed while it's waiting.
+func (s *Server) acquire() bool {
+	s.mu.Lock()
+
+	if s.closed {
+		s.mu.Unlock()
+		return false
+	}
+
+	if s.MaxConns <= 0 {
+		s.mu.Unlock()
+		return true
+	}
+
+	if s.sem == nil {
+		s.sem = make(chan struct{}, s.MaxConns)
+	}
+	if s.done == nil {
+		s.done = make(chan struct{})
+	}
+
+	sem, done := s.sem, s.done
+
+	s.mu.Unlock()
+
+	select {
+	case sem <- struct{}{}:
+		return true
+	case <-done:
+		return false
+	}
+}
+
+// release makes room for another connection, after acquire.
+func (s *Server) release() {
+	s.mu.Lock()
+	sem := s.sem
+	s.mu.Unlock()
+
+	if sem != nil {
+		<-sem
+	}
+}
+
+func (s *Server) metrics() Metrics {
+	if s.Metrics != nil {
+		return s.Metrics
+	}
+
+	return nopMetrics{}
+}
+
+func (s *Server) isClosed() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.closed
+}
+
+func (s *Server) logf(format string, args ...interface{}) {
+	if s.ErrorLog != nil {
+		s.ErrorLog.Printf(format, args...)
+	} else {
+		log.Printf(format, args...)
+	}
+}
+
+// parseAllowList turns a list of IP addresses and networks into a function
+// that checks whether an address is in one of them. It returns nil if the
+// list is empty.
+func parseAllowList(list []string) (func(addr net.Addr) bool, error) {
+	if len(list) == 0 {
+		return nil, nil
+	}
+
+	var nets []*net.IPNet
+
+	for _, e := range list {
+		if strings.Contains(e, "/") {
+			_, n, err := net.ParseCIDR(e)
+			if err != nil {
+				return nil, stackerr.Wrap(err)
+			}
+
+			nets = append(nets, n)
+
+			continue
+		}
+
+		ip := net.ParseIP(e)
+		if ip == nil {
+			return nil, stackerr.Newf("mllp: invalid IP address %q in allow list", e)
+		}
+
+		bits := 8 * net.IPv6len
+		if ip4 := ip.To4(); ip4 != nil {
+			ip, bits = ip4, 8*net.IPv4len
+		}
+
+		nets = append(nets, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+	}
+
+	return func(addr net.Addr) bool {
+		var ip net.IP
+
+		switch a := addr.(type) {
+		case *net.TCPAddr:
+			ip = a.IP
+		default:
+			host, _, err := net.SplitHostPort(addr.String())
+			if err != nil {
+				return false
+			}
+
+			ip = net.ParseIP(host)
+		}
+
+		for _, n := range nets {
+			if n.Contains(ip) {
+				return true
+			}
+		}
+
+		return false
+	}, nil
+}
+
+type contextKey int
+
+const (
+	remoteAddrKey contextKey = iota
+	tlsStateKey
+)
+
+// handshakeTimeout limits how long a client has to finish the TLS handshake.
+const handshakeTimeout = 30 * time.Second
+
+// RemoteAddr returns the address of the client that sent the message being
+// handled, or nil if the context didn't come from a Server.
+func RemoteAddr(ctx context.Context) net.Addr {
+	a, _ := ctx.Value(remoteAddrKey).(net.Addr)
+	return a
+}
@@ -0,0 +1,679 @@
+package mllp
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"io/ioutil"
+	"log"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"fknsrs.biz/p/hl7"
+)
+
+const testMessage = "MSH|^~\\&|APP|FAC|RAPP|RFAC|20240102||ADT^A01|MSG1|P|2.5\rPID|1||123\r"
+
+func startServer(t *testing.T, h hl7.Handler) (*Server, string) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s := &Server{Handler: h, ErrorLog: log.New(ioutil.Discard, "", 0)}
+	go s.Serve(l)
+
+	return s, l.Addr().String()
+}
+
+func TestServer(t *testing.T) {
+	a := assert.New(t)
+
+	var remote net.Addr
+
+	s, addr := startServer(t, hl7.HandlerFunc(func(ctx context.Context, m hl7.Message, d *hl7.Delimiters) (hl7.Message, error) {
+		remote = RemoteAddr(ctx)
+
+		if m.Segment("PID", 0).Value(3) != "123" {
+			return nil, errors.New("unknown patient")
+		}
+
+		return nil, nil
+	}))
+	defer s.Close()
+
+	c, err := Dial(addr)
+	a.NoError(err)
+	defer c.Close()
+
+	m, d, err := hl7.ParseMessage([]byte(testMessage))
+	a.NoError(err)
+
+	ack, err := c.SendMessage(m, d)
+	a.NoError(err)
+
+	r, err := hl7.ReadACK(ack)
+	a.NoError(err)
+	a.Equal(&hl7.ACK{Code: hl7.AckAccept, ControlID: "MSG1"}, r)
+	a.Equal(c.conn.LocalAddr().String(), remote.String())
+
+	m[1][3] = hl7.Field{hl7.FieldItem{hl7.Component{"456"}}}
+
+	ack, err = c.SendMessage(m, d)
+	a.NoError(err)
+
+	r, err = hl7.ReadACK(ack)
+	a.NoError(err)
+	a.Equal(&hl7.ACK{Code: hl7.AckError, ControlID: "MSG1", Text: "unknown patient"}, r)
+
+	b, err := c.Send([]byte("this isn't HL7"))
+	a.NoError(err)
+
+	ack, _, err = hl7.ParseMessage(b)
+	a.NoError(err)
+	a.Equal(hl7.AckReject, ack.Segment("MSA", 0).Value(1))
+}
+
+func enhancedTestMessage(a *assert.Assertions, id, pid, msh15, msh16 string) (hl7.Message, *hl7.Delimiters) {
+	m, d, err := hl7.ParseMessage([]byte("MSH|^~\\&|APP|FAC|RAPP|RFAC|20240102||ADT^A01|" + id + "|P|2.5|||" + msh15 + "|" + msh16 + "\rPID|1||" + pid + "\r"))
+	a.NoError(err)
+	return m, d
+}
+
+func TestServerEnhanced(t *testing.T) {
+	a := assert.New(t)
+
+	s, addr := startServer(t, hl7.HandlerFunc(func(ctx context.Context, m hl7.Message, d *hl7.Delimiters) (hl7.Message, error) {
+		if m.Segment("PID", 0).Value(3) != "123" {
+			return nil, errors.New("unknown patient")
+		}
+
+		return nil, nil
+	}))
+	defer s.Close()
+
+	c, err := Dial(addr)
+	a.NoError(err)
+	defer c.Close()
+
+	code := func(ack hl7.Message) string {
+		if ack == nil {
+			return ""
+		}
+		return ack.Segment("MSA", 0).Value(1) + " " + ack.Segment("MSA", 0).Value(2)
+	}
+
+	// commit acknowledgement only; the application acknowledgement that
+	// follows is left for the next call to skip
+	ack, err := c.SendMessage(enhancedTestMessage(a, "1", "123", "AL", "AL"))
+	a.NoError(err)
+	a.Equal("CA 1", code(ack))
+
+	c.ApplicationACKs = true
+
+	ack, err = c.SendMessage(enhancedTestMessage(a, "2", "123", "AL", "AL"))
+	a.NoError(err)
+	a.Equal("AA 2", code(ack))
+
+	ack, err = c.SendMessage(enhancedTestMessage(a, "3", "456", "", "AL"))
+	a.NoError(err)
+	a.Equal("AE 3", code(ack))
+
+	// nothing to wait for, but the AE comes later anyway
+	ack, err = c.SendMessage(enhancedTestMessage(a, "4", "456", "NE", "ER"))
+	a.NoError(err)
+	a.Nil(ack)
+
+	ack, err = c.SendMessage(enhancedTestMessage(a, "5", "123", "NE", "AL"))
+	a.NoError(err)
+	a.Equal("AA 5", code(ack))
+
+	// and back to original mode
+	m, d, err := hl7.ParseMessage([]byte(testMessage))
+	a.NoError(err)
+
+	ack, err = c.SendMessage(m, d)
+	a.NoError(err)
+	a.Equal("AA MSG1", code(ack))
+}
+
+func TestServerCommitACKs(t *testing.T) {
+	a := assert.New(t)
+
+	handled := make(chan string, 10)
+
+	s, addr := startServer(t, hl7.HandlerFunc(func(ctx context.Context, m hl7.Message, d *hl7.Delimiters) (hl7.Message, error) {
+		handled <- m.Segment("PID", 0).Value(3)
+		return nil, nil
+	}))
+	defer s.Close()
+
+	s.Store = func(ctx context.Context, m hl7.Message, d *hl7.Delimiters) error {
+		if m.Segment("PID", 0).Value(3) == "full" {
+			return errors.New("disk full")
+		}
+		return nil
+	}
+
+	c, err := Dial(addr)
+	a.NoError(err)
+	defer c.Close()
+
+	c.Timeout = time.Second
+
+	original := "MSH|^~\\&|APP|FAC|RAPP|RFAC|20240102||ADT^A01|1|P|2.5\rPID|1||123\r"
+	enhanced := "MSH|^~\\&|APP|FAC|RAPP|RFAC|20240102||ADT^A01|2|P|2.5|||AL|NE\rPID|1||123\r"
+
+	for _, e := range []struct {
+		name, frame, code, id string
+	}{
+		{"garbage", "this isn't HL7", hl7.AckReject, ""},
+		{"original", original + original, hl7.AckReject, "1"},
+		{"enhanced", enhanced + enhanced, hl7.AckCommitReject, "2"},
+		{"store failed", strings.Replace(enhanced, "123", "full", 1), hl7.AckCommitError, "2"},
+		{"stored", enhanced, hl7.AckCommitAccept, "2"},
+	} {
+		b, err := c.Send([]byte(e.frame))
+		if !a.NoError(err, e.name) {
+			continue
+		}
+
+		ack, _, err := hl7.ParseMessage(b)
+		if a.NoError(err, e.name) {
+			a.Equal(e.code, ack.Segment("MSA", 0).Value(1), e.name)
+			a.Equal(e.id, ack.Segment("MSA", 0).Value(2), e.name)
+		}
+	}
+
+	// only the message that was stored gets to the handler, and it's the
+	// last one, so anything else would have turned up first
+	select {
+	case pid := <-handled:
+		a.Equal("123", pid)
+	case <-time.After(time.Second):
+		a.Fail("message wasn't handled")
+	}
+}
+
+// startACKServer starts a bare MLLP server that answers each message with
+// whatever respond returns, without any of Server's logic. It returns the
+// address to connect to, and a function to stop it.
+func startACKServer(t *testing.T, respond func(m hl7.Message, d *hl7.Delimiters) hl7.Message) (string, func()) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+
+			go func() {
+				defer conn.Close()
+
+				r, w := NewReader(conn), NewWriter(conn)
+				for {
+					b, err := r.ReadMessage()
+					if err != nil {
+						return
+					}
+
+					m, d, _ := parseFrame(b)
+					if err := w.WriteMessage(hl7.EncodeMessage(respond(m, d), d)); err != nil {
+						return
+					}
+				}
+			}()
+		}
+	}()
+
+	return l.Addr().String(), func() { l.Close() }
+}
+
+func TestClientUnaddressedACK(t *testing.T) {
+	a := assert.New(t)
+
+	addr, stop := startACKServer(t, func(m hl7.Message, d *hl7.Delimiters) hl7.Message {
+		return hl7.NewACK(nil, nil, hl7.AckCommitReject, "can't read that")
+	})
+	defer stop()
+
+	c, err := Dial(addr)
+	if !a.NoError(err) {
+		return
+	}
+	defer c.Close()
+
+	c.ApplicationACKs = true
+	c.Timeout = time.Second
+
+	// the first message turns on enhanced mode, and the second is one where
+	// the client is already in it
+	for _, id := range []string{"1", "2"} {
+		ack, err := c.SendMessage(enhancedTestMessage(a, id, "123", "AL", "AL"))
+		if a.NoError(err, id) {
+			a.Equal(hl7.AckCommitReject, ack.Segment("MSA", 0).Value(1), id)
+		}
+	}
+}
+
+func TestClientCommitErrors(t *testing.T) {
+	a := assert.New(t)
+
+	// a CE from a real server, when it can't store the message
+	s, addr := startServer(t, hl7.HandlerFunc(func(ctx context.Context, m hl7.Message, d *hl7.Delimiters) (hl7.Message, error) {
+		return nil, nil
+	}))
+	defer s.Close()
+
+	s.Store = func(ctx context.Context, m hl7.Message, d *hl7.Delimiters) error {
+		return errors.New("disk full")
+	}
+
+	// and a CR from a server that doesn't like the message
+	rejectAddr, stop := startACKServer(t, func(m hl7.Message, d *hl7.Delimiters) hl7.Message {
+		return hl7.NewACK(m, d, hl7.AckCommitReject, "go away")
+	})
+	defer stop()
+
+	for _, e := range []struct{ addr, code string }{
+		{addr, hl7.AckCommitError},
+		{rejectAddr, hl7.AckCommitReject},
+	} {
+		c, err := Dial(e.addr)
+		if !a.NoError(err, e.code) {
+			continue
+		}
+
+		// there's no application acknowledgement coming after either of
+		// these, so the client mustn't wait for one
+		c.ApplicationACKs = true
+		c.Timeout = time.Second
+
+		ack, err := c.SendMessage(enhancedTestMessage(a, "1", "123", "AL", "AL"))
+		if a.NoError(err, e.code) {
+			a.Equal(e.code, ack.Segment("MSA", 0).Value(1), e.code)
+			a.Equal("1", ack.Segment("MSA", 0).Value(2), e.code)
+		}
+
+		c.Close()
+	}
+}
+
+func TestServerSendApplicationACK(t *testing.T) {
+	a := assert.New(t)
+
+	acks := make(chan hl7.Message, 1)
+
+	s, addr := startServer(t, hl7.HandlerFunc(func(ctx context.Context, m hl7.Message, d *hl7.Delimiters) (hl7.Message, error) {
+		return nil, nil
+	}))
+	defer s.Close()
+
+	s.SendApplicationACK = func(ctx context.Context, ack hl7.Message, d *hl7.Delimiters) error {
+		acks <- ack
+		return nil
+	}
+
+	c, err := Dial(addr)
+	a.NoError(err)
+	defer c.Close()
+
+	c.ApplicationACKs = true
+	c.Timeout = time.Second
+
+	ack, err := c.SendMessage(enhancedTestMessage(a, "1", "123", "AL", "SU"))
+	a.NoError(err)
+	a.Equal(hl7.AckCommitAccept, ack.Segment("MSA", 0).Value(1))
+
+	ack = <-acks
+	a.Equal(hl7.AckAccept, ack.Segment("MSA", 0).Value(1))
+	a.Equal("1", ack.Segment("MSA", 0).Value(2))
+}
+
+func TestServerClose(t *testing.T) {
+	a := assert.New(t)
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	a.NoError(err)
+
+	s := &Server{Handler: hl7.HandlerFunc(func(ctx context.Context, m hl7.Message, d *hl7.Delimiters) (hl7.Message, error) {
+		return nil, nil
+	})}
+
+	done := make(chan error)
+	go func() { done <- s.Serve(l) }()
+
+	c, err := Dial(l.Addr().String())
+	a.NoError(err)
+	defer c.Close()
+
+	_, err = c.Send([]byte(testMessage))
+	a.NoError(err)
+
+	a.NoError(s.Close())
+	a.Equal(ErrServerClosed, <-done)
+
+	_, err = c.Send([]byte(testMessage))
+	a.Error(err)
+
+	a.Equal(ErrServerClosed, s.Serve(l))
+}
+
+func TestServerShutdown(t *testing.T) {
+	a := assert.New(t)
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	a.NoError(err)
+
+	started := make(chan struct{})
+	release := make(chan struct{})
+
+	s := &Server{Handler: hl7.HandlerFunc(func(ctx context.Context, m hl7.Message, d *hl7.Delimiters) (hl7.Message, error) {
+		if m.Segment("PID", 0).Value(3) == "slow" {
+			close(started)
+			<-release
+		}
+
+		return nil, nil
+	})}
+
+	done := make(chan error)
+	go func() { done <- s.Serve(l) }()
+
+	busy, err := Dial(l.Addr().String())
+	a.NoError(err)
+	defer busy.Close()
+
+	idle, err := Dial(l.Addr().String())
+	a.NoError(err)
+	defer idle.Close()
+
+	// make sure the idle connection has been accepted
+	_, err = idle.Send([]byte(testMessage))
+	a.NoError(err)
+
+	m, d, err := hl7.ParseMessage([]byte(testMessage))
+	a.NoError(err)
+	m[1][3] = hl7.Field{hl7.FieldItem{hl7.Component{"slow"}}}
+
+	acked := make(chan error)
+	go func() {
+		_, err := busy.SendMessage(m, d)
+		acked <- err
+	}()
+
+	<-started
+
+	shutdown := make(chan error)
+	go func() { shutdown <- s.Shutdown(context.Background()) }()
+
+	a.Equal(ErrServerClosed, <-done)
+
+	// the idle connection gets closed straight away
+	idle.conn.SetReadDeadline(time.Now().Add(time.Second))
+	_, err = idle.conn.Read(make([]byte, 1))
+	a.Equal(io.EOF, err)
+
+	select {
+	case err := <-shutdown:
+		t.Fatalf("shutdown finished early: %v", err)
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	close(release)
+
+	a.NoError(<-acked)
+	a.NoError(<-shutdown)
+
+	_, err = busy.Send([]byte(testMessage))
+	a.Error(err)
+}
+
+func TestServerShutdownPartialMessage(t *testing.T) {
+	a := assert.New(t)
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	a.NoError(err)
+
+	s := &Server{Handler: hl7.HandlerFunc(func(ctx context.Context, m hl7.Message, d *hl7.Delimiters) (hl7.Message, error) {
+		return nil, nil
+	}), ErrorLog: log.New(ioutil.Discard, "", 0)}
+
+	go s.Serve(l)
+
+	c, err := Dial(l.Addr().String())
+	a.NoError(err)
+	defer c.Close()
+
+	// make sure the connection has been accepted
+	_, err = c.Send([]byte(testMessage))
+	a.NoError(err)
+
+	var buf bytes.Buffer
+	a.NoError(NewWriter(&buf).WriteMessage([]byte(testMessage)))
+	frame := buf.Bytes()
+
+	// once part of a message has arrived, the connection isn't idle any
+	// more, and it gets to finish the message
+	_, err = c.conn.Write(frame[:10])
+	a.NoError(err)
+
+	for i := 0; i < 100; i++ {
+		s.mu.Lock()
+		active := anyActive(s.conns)
+		s.mu.Unlock()
+
+		if active {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	shutdown := make(chan error)
+	go func() { shutdown <- s.Shutdown(context.Background()) }()
+
+	time.Sleep(20 * time.Millisecond)
+
+	_, err = c.conn.Write(frame[10:])
+	a.NoError(err)
+
+	c.conn.SetReadDeadline(time.Now().Add(time.Second))
+	b, err := NewReader(c.conn).ReadMessage()
+	if a.NoError(err) {
+		ack, _, err := hl7.ParseMessage(b)
+		a.NoError(err)
+		a.Equal(hl7.AckAccept, ack.Segment("MSA", 0).Value(1))
+	}
+
+	a.NoError(<-shutdown)
+}
+
+func anyActive(conns map[net.Conn]bool) bool {
+	for _, active := range conns {
+		if active {
+			return true
+		}
+	}
+	return false
+}
+
+func TestServerShutdownTimeout(t *testing.T) {
+	a := assert.New(t)
+
+	started := make(chan struct{})
+	release := make(chan struct{})
+	defer close(release)
+
+	s, addr := startServer(t, hl7.HandlerFunc(func(ctx context.Context, m hl7.Message, d *hl7.Delimiters) (hl7.Message, error) {
+		close(started)
+		<-release
+		return nil, nil
+	}))
+	defer s.Close()
+
+	c, err := Dial(addr)
+	a.NoError(err)
+	defer c.Close()
+
+	go c.Send([]byte(testMessage))
+
+	<-started
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+
+	a.Equal(context.DeadlineExceeded, s.Shutdown(ctx))
+}
+
+func TestServerMaxConns(t *testing.T) {
+	a := assert.New(t)
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	a.NoError(err)
+
+	s := &Server{
+		Handler: hl7.HandlerFunc(func(ctx context.Context, m hl7.Message, d *hl7.Delimiters) (hl7.Message, error) {
+			return nil, nil
+		}),
+		MaxConns: 1,
+	}
+	go s.Serve(l)
+	defer s.Close()
+
+	c1, err := Dial(l.Addr().String())
+	a.NoError(err)
+
+	_, err = c1.Send([]byte(testMessage))
+	a.NoError(err)
+
+	c2, err := Dial(l.Addr().String())
+	a.NoError(err)
+	defer c2.Close()
+
+	acked := make(chan error)
+	go func() {
+		_, err := c2.Send([]byte(testMessage))
+		acked <- err
+	}()
+
+	select {
+	case err := <-acked:
+		t.Fatalf("second connection was served: %v", err)
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	c1.Close()
+
+	a.NoError(<-acked)
+}
+
+func TestServerIdleTimeout(t *testing.T) {
+	a := assert.New(t)
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	a.NoError(err)
+
+	s := &Server{
+		Handler: hl7.HandlerFunc(func(ctx context.Context, m hl7.Message, d *hl7.Delimiters) (hl7.Message, error) {
+			return nil, nil
+		}),
+		IdleTimeout: 50 * time.Millisecond,
+	}
+	go s.Serve(l)
+	defer s.Close()
+
+	c, err := Dial(l.Addr().String())
+	a.NoError(err)
+	defer c.Close()
+
+	_, err = c.Send([]byte(testMessage))
+	a.NoError(err)
+
+	time.Sleep(150 * time.Millisecond)
+
+	_, err = c.Send([]byte(testMessage))
+	a.Error(err)
+}
+
+func TestServerAllowList(t *testing.T) {
+	a := assert.New(t)
+
+	for _, c := range []struct {
+		list []string
+		ok   bool
+	}{
+		{[]string{"127.0.0.1"}, true},
+		{[]string{"10.0.0.0/8", "127.0.0.0/8"}, true},
+		{[]string{"10.0.0.0/8", "::1"}, false},
+	} {
+		l, err := net.Listen("tcp", "127.0.0.1:0")
+		a.NoError(err)
+
+		s := &Server{
+			Handler: hl7.HandlerFunc(func(ctx context.Context, m hl7.Message, d *hl7.Delimiters) (hl7.Message, error) {
+				return nil, nil
+			}),
+			AllowList: c.list,
+			ErrorLog:  log.New(ioutil.Discard, "", 0),
+		}
+		go s.Serve(l)
+
+		cl, err := Dial(l.Addr().String())
+		a.NoError(err)
+
+		_, err = cl.Send([]byte(testMessage))
+		if c.ok {
+			a.NoError(err, c.list)
+		} else {
+			a.Error(err, c.list)
+		}
+
+		cl.Close()
+		s.Close()
+	}
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	a.NoError(err)
+
+	s := &Server{AllowList: []string{"not an address"}}
+	if err := s.Serve(l); a.Error(err) {
+		a.Equal(`mllp: invalid IP address "not an address" in allow list`, hl7.ErrorText(err))
+	}
+}
+
+func TestParseAllowList(t *testing.T) {
+	a := assert.New(t)
+
+	allowed, err := parseAllowList([]string{"192.168.1.5", "10.0.0.0/8", "fd00::/8", "::1"})
+	a.NoError(err)
+
+	for addr, ok := range map[string]bool{
+		"192.168.1.5:1000": true,
+		"192.168.1.6:1000": false,
+		"10.20.30.40:1000": true,
+		"11.0.0.1:1000":    false,
+		"[fd12::1]:1000":   true,
+		"[::1]:1000":       true,
+		"[::2]:1000":       false,
+	} {
+		tcp, err := net.ResolveTCPAddr("tcp", addr)
+		a.NoError(err)
+		a.Equal(ok, allowed(tcp), addr)
+	}
+
+	allowed, err = parseAllowList(nil)
+	a.NoError(err)
+	a.Nil(allowed)
+
+	_, err = parseAllowList([]string{"10.0.0.0/33"})
+	a.Error(err)
+}
@@ -0,0 +1,112 @@
+package mllp
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"io/ioutil"
+	"strings"
+
+	"github.com/facebookgo/stackerr"
+
+	"fknsrs.biz/p/hl7"
+)
+
+// DialTLS connects to an MLLP server at addr (host:port) over TLS. To use a
+// client certificate, put it in config.Certificates; to trust a private CA,
+// put it in config.RootCAs (see LoadCertPool).
+func DialTLS(addr string, config *tls.Config) (*Client, error) {
+	conn, err := tls.Dial("tcp", addr, config)
+	if err != nil {
+		return nil, stackerr.Wrap(err)
+	}
+
+	return NewClient(conn), nil
+}
+
+// LoadCertPool reads PEM encoded certificates from files into a pool, for
+// use as tls.Config's RootCAs or ClientCAs.
+func LoadCertPool(files ...string) (*x509.CertPool, error) {
+	p := x509.NewCertPool()
+
+	for _, f := range files {
+		b, err := ioutil.ReadFile(f)
+		if err != nil {
+			return nil, stackerr.Wrap(err)
+		}
+
+		if !p.AppendCertsFromPEM(b) {
+			return nil, stackerr.Newf("mllp: no certificates found in %s", f)
+		}
+	}
+
+	return p, nil
+}
+
+// TLSState returns the state of the TLS connection that the message being
+// handled came in on, or nil if it didn't come in over TLS.
+func TLSState(ctx context.Context) *tls.ConnectionState {
+	s, _ := ctx.Value(tlsStateKey).(*tls.ConnectionState)
+	return s
+}
+
+// PeerCertificate returns the certificate the client presented on the TLS
+// connection that the message being handled came in on, or nil if there
+// wasn't one.
+func PeerCertificate(ctx context.Context) *x509.Certificate {
+	if s := TLSState(ctx); s != nil && len(s.PeerCertificates) > 0 {
+		return s.PeerCertificates[0]
+	}
+
+	return nil
+}
+
+// AuthorizeFacility returns middleware that checks the sending facility
+// (MSH-4) of each message against the client's certificate, using allowed,
+// and rejects the message with an AR acknowledgement if it doesn't pass, or
+// if there's no certificate. If allowed is nil, CertificateMatchesFacility is
+// used.
+func AuthorizeFacility(allowed func(cert *x509.Certificate, facility hl7.HD) bool) hl7.Middleware {
+	if allowed == nil {
+		allowed = CertificateMatchesFacility
+	}
+
+	return func(h hl7.Handler) hl7.Handler {
+		return hl7.HandlerFunc(func(ctx context.Context, m hl7.Message, d *hl7.Delimiters) (hl7.Message, error) {
+			cert := PeerCertificate(ctx)
+			if cert == nil {
+				return hl7.NewACK(m, d, hl7.AckReject, "no client certificate"), nil
+			}
+
+			var facility hl7.HD
+			if a := hl7.DecodeHDs(m.Segment("MSH", 0).Field(4)); len(a) > 0 {
+				facility = a[0]
+			}
+
+			if !allowed(cert, facility) {
+				return hl7.NewACK(m, d, hl7.AckReject, "sending facility \""+facility.NamespaceID+"\" doesn't match certificate \""+cert.Subject.CommonName+"\""), nil
+			}
+
+			return h.ServeHL7(ctx, m, d)
+		})
+	}
+}
+
+// CertificateMatchesFacility reports whether the namespace ID or universal ID
+// of a facility matches the common name, or one of the DNS names, of a
+// certificate, ignoring case.
+func CertificateMatchesFacility(cert *x509.Certificate, facility hl7.HD) bool {
+	names := append([]string{cert.Subject.CommonName}, cert.DNSNames...)
+
+	for _, n := range names {
+		if n == "" {
+			continue
+		}
+
+		if strings.EqualFold(n, facility.NamespaceID) || strings.EqualFold(n, facility.UniversalID) {
+			return true
+		}
+	}
+
+	return false
+}
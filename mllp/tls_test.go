@@ -0,0 +1,177 @@
+package mllp
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io/ioutil"
+	"log"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"fknsrs.biz/p/hl7"
+)
+
+type testCert struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+	der  []byte
+}
+
+func makeTestCert(t *testing.T, name string, parent *testCert, ca bool) *testCert {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(time.Now().UnixNano()),
+		Subject:               pkix.Name{CommonName: name},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+		BasicConstraintsValid: true,
+		IsCA:                  ca,
+		IPAddresses:           []net.IP{net.ParseIP("127.0.0.1")},
+	}
+
+	signer, signerKey := tmpl, key
+	if parent != nil {
+		signer, signerKey = parent.cert, parent.key
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, signer, &key.PublicKey, signerKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return &testCert{cert: cert, key: key, der: der}
+}
+
+func (c *testCert) write(t *testing.T, dir, name string) (string, string) {
+	k, err := x509.MarshalECPrivateKey(c.key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	certFile, keyFile := filepath.Join(dir, name+".crt"), filepath.Join(dir, name+".key")
+
+	if err := ioutil.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: c.der}), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: k}), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	return certFile, keyFile
+}
+
+func (c *testCert) tls() tls.Certificate {
+	return tls.Certificate{Certificate: [][]byte{c.der}, PrivateKey: c.key, Leaf: c.cert}
+}
+
+func TestTLS(t *testing.T) {
+	a := assert.New(t)
+
+	dir, err := ioutil.TempDir("", "mllp-tls")
+	if !a.NoError(err) {
+		return
+	}
+	defer os.RemoveAll(dir)
+
+	ca := makeTestCert(t, "Test CA", nil, true)
+	server := makeTestCert(t, "localhost", ca, false)
+	client := makeTestCert(t, "FAC", ca, false)
+
+	caFile, _ := ca.write(t, dir, "ca")
+	certFile, keyFile := server.write(t, dir, "server")
+
+	pool, err := LoadCertPool(caFile)
+	if !a.NoError(err) {
+		return
+	}
+
+	_, err = LoadCertPool(keyFile)
+	a.Error(err)
+
+	var subject string
+
+	s := &Server{
+		Handler: hl7.Chain(hl7.HandlerFunc(func(ctx context.Context, m hl7.Message, d *hl7.Delimiters) (hl7.Message, error) {
+			subject = PeerCertificate(ctx).Subject.CommonName
+			return nil, nil
+		}), AuthorizeFacility(nil)),
+		TLSConfig: &tls.Config{ClientAuth: tls.RequireAndVerifyClientCert, ClientCAs: pool},
+		ErrorLog:  log.New(ioutil.Discard, "", 0),
+	}
+	defer s.Close()
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if !a.NoError(err) {
+		return
+	}
+	go s.ServeTLS(l, certFile, keyFile)
+
+	c, err := DialTLS(l.Addr().String(), &tls.Config{RootCAs: pool, Certificates: []tls.Certificate{client.tls()}})
+	if !a.NoError(err) {
+		return
+	}
+	defer c.Close()
+
+	m, d, err := hl7.ParseMessage([]byte(testMessage))
+	a.NoError(err)
+
+	ack, err := c.SendMessage(m, d)
+	a.NoError(err)
+	a.Equal(hl7.AckAccept, ack.Segment("MSA", 0).Value(1))
+	a.Equal("FAC", subject)
+
+	// the certificate is for FAC, not OTHER
+	m[0][4] = hl7.Field{hl7.FieldItem{hl7.Component{"OTHER"}}}
+
+	ack, err = c.SendMessage(m, d)
+	a.NoError(err)
+	a.Equal(hl7.AckReject, ack.Segment("MSA", 0).Value(1))
+	a.Equal(`sending facility "OTHER" doesn't match certificate "FAC"`, ack.Segment("MSA", 0).Value(3))
+
+	// no client certificate means no connection
+	c2, err := DialTLS(l.Addr().String(), &tls.Config{RootCAs: pool})
+	if err == nil {
+		_, err = c2.SendMessage(m, d)
+		c2.Close()
+	}
+	a.Error(err)
+}
+
+func TestAuthorizeFacilityWithoutTLS(t *testing.T) {
+	a := assert.New(t)
+
+	h := hl7.Chain(hl7.HandlerFunc(func(ctx context.Context, m hl7.Message, d *hl7.Delimiters) (hl7.Message, error) {
+		return nil, nil
+	}), AuthorizeFacility(nil))
+
+	m, d, err := hl7.ParseMessage([]byte(testMessage))
+	a.NoError(err)
+
+	ack, err := h.ServeHL7(context.Background(), m, d)
+	a.NoError(err)
+	a.Equal(hl7.AckReject, ack.Segment("MSA", 0).Value(1))
+	a.Equal("no client certificate", ack.Segment("MSA", 0).Value(3))
+}
@@ -0,0 +1,194 @@
+package hl7 // import "fknsrs.biz/p/hl7"
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/facebookgo/stackerr"
+)
+
+type (
+	// ErrInvalidNumber is returned when an NM value isn't a valid number.
+	ErrInvalidNumber error
+	// ErrInvalidSN is returned when an SN value has an unknown comparator or
+	// separator, or doesn't have the numbers its separator calls for.
+	ErrInvalidSN error
+)
+
+// ParseNM parses an NM value - an optional leading sign, some digits, and an
+// optional decimal point. Leading and trailing spaces are ignored. Unlike
+// strconv.ParseFloat, exponents, hexadecimal, and things like "Inf" are
+// rejected, as HL7 doesn't allow them.
+func ParseNM(s string) (float64, error) {
+	s = strings.TrimSpace(s)
+
+	b := s
+	if len(b) > 0 && (b[0] == '+' || b[0] == '-') {
+		b = b[1:]
+	}
+
+	digits, dots := 0, 0
+	for i := 0; i < len(b); i++ {
+		switch {
+		case b[i] >= '0' && b[i] <= '9':
+			digits++
+		case b[i] == '.':
+			dots++
+		default:
+			return 0, ErrInvalidNumber(stackerr.Newf("invalid character %q in number %q", b[i], s))
+		}
+	}
+
+	if digits == 0 || dots > 1 {
+		return 0, ErrInvalidNumber(stackerr.Newf("invalid number %q", s))
+	}
+
+	f, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		return 0, ErrInvalidNumber(stackerr.Wrap(err))
+	}
+
+	return f, nil
+}
+
+// FormatNM formats a number as an NM value, using as few digits as possible.
+func FormatNM(f float64) string {
+	return strconv.FormatFloat(f, 'f', -1, 64)
+}
+
+// SN is a structured numeric value, used for results like ">100", "1:128",
+// or "10-20" that aren't a plain number.
+type SN struct {
+	Comparator string // one of >, <, >=, <=, =, <>, or empty
+	HasNum1    bool
+	Num1       float64
+	Separator  string // one of -, +, /, ., :, or empty
+	HasNum2    bool
+	Num2       float64
+}
+
+// ParseSN parses an SN value from a field item.
+func ParseSN(fi FieldItem) (SN, error) {
+	var v SN
+
+	v.Comparator = fi.get(1)
+	switch v.Comparator {
+	case "", ">", "<", ">=", "<=", "=", "<>":
+	default:
+		return SN{}, ErrInvalidSN(stackerr.Newf("invalid comparator %q", v.Comparator))
+	}
+
+	if s := fi.get(2); s != "" {
+		n, err := ParseNM(s)
+		if err != nil {
+			return SN{}, stackerr.Wrap(err)
+		}
+
+		v.HasNum1, v.Num1 = true, n
+	}
+
+	v.Separator = fi.get(3)
+	switch v.Separator {
+	case "", "-", "+", "/", ".", ":":
+	default:
+		return SN{}, ErrInvalidSN(stackerr.Newf("invalid separator %q", v.Separator))
+	}
+
+	if s := fi.get(4); s != "" {
+		n, err := ParseNM(s)
+		if err != nil {
+			return SN{}, stackerr.Wrap(err)
+		}
+
+		v.HasNum2, v.Num2 = true, n
+	}
+
+	switch {
+	case !v.HasNum1 && !v.HasNum2:
+		return SN{}, ErrInvalidSN(stackerr.Newf("structured numeric value has no numbers"))
+	case v.HasNum2 && v.Separator == "":
+		return SN{}, ErrInvalidSN(stackerr.Newf("second number %s has no separator", FormatNM(v.Num2)))
+	case v.Separator == "+" && v.HasNum2:
+		return SN{}, ErrInvalidSN(stackerr.Newf("separator \"+\" can't be followed by a number"))
+	case v.Separator != "" && v.Separator != "+" && (!v.HasNum1 || !v.HasNum2):
+		return SN{}, ErrInvalidSN(stackerr.Newf("separator %q needs a number on each side", v.Separator))
+	}
+
+	return v, nil
+}
+
+// Encode turns an SN value into a field item.
+func (v SN) Encode(version string) FieldItem {
+	var n1, n2 string
+	if v.HasNum1 {
+		n1 = FormatNM(v.Num1)
+	}
+	if v.HasNum2 {
+		n2 = FormatNM(v.Num2)
+	}
+
+	return makeFieldItem(v.Comparator, n1, v.Separator, n2)
+}
+
+// String returns the value the way a person would write it, e.g. ">100",
+// "1:128", or "2+".
+func (v SN) String() string {
+	s := v.Comparator
+	if v.HasNum1 {
+		s += FormatNM(v.Num1)
+	}
+	s += v.Separator
+	if v.HasNum2 {
+		s += FormatNM(v.Num2)
+	}
+
+	return s
+}
+
+// IsRange reports whether the value describes a range, like "10-20".
+func (v SN) IsRange() bool {
+	return v.Separator == "-" && v.HasNum1 && v.HasNum2
+}
+
+// IsRatio reports whether the value describes a ratio, like "1:128" or
+// "1/2".
+func (v SN) IsRatio() bool {
+	return (v.Separator == ":" || v.Separator == "/") && v.HasNum1 && v.HasNum2
+}
+
+// CQ is a composite quantity with units, like "5^mg".
+type CQ struct {
+	Quantity float64
+	Units    CE
+}
+
+// ParseCQ parses a CQ value from a field item. The units are embedded as
+// subcomponents of the second component.
+func ParseCQ(fi FieldItem) (CQ, error) {
+	n, err := ParseNM(fi.get(1))
+	if err != nil {
+		return CQ{}, stackerr.Wrap(err)
+	}
+
+	u := fi.component(2)
+
+	return CQ{
+		Quantity: n,
+		Units: CE{
+			Identifier:            u.get(1),
+			Text:                  u.get(2),
+			CodingSystem:          u.get(3),
+			AlternateIdentifier:   u.get(4),
+			AlternateText:         u.get(5),
+			AlternateCodingSystem: u.get(6),
+		},
+	}, nil
+}
+
+// Encode turns a CQ value into a field item.
+func (c CQ) Encode(version string) FieldItem {
+	return trimFieldItem(FieldItem{
+		simple(FormatNM(c.Quantity)),
+		subcomponents(c.Units.Encode(version)),
+	})
+}
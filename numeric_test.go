@@ -0,0 +1,97 @@
+package hl7
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseNM(t *testing.T) {
+	a := assert.New(t)
+
+	for s, f := range map[string]float64{
+		"05":     5,
+		"-1.5":   -1.5,
+		"+.5":    0.5,
+		"100.":   100,
+		" 12 ":   12,
+		"0.0010": 0.001,
+	} {
+		v, err := ParseNM(s)
+		a.NoError(err, s)
+		a.Equal(f, v, s)
+	}
+
+	for _, s := range []string{"", "-", ".", "1e5", "Inf", "NaN", "0x10", "1.2.3", "01I", "1,000"} {
+		_, err := ParseNM(s)
+		a.Error(err, s)
+	}
+}
+
+func TestFormatNM(t *testing.T) {
+	a := assert.New(t)
+
+	a.Equal("5", FormatNM(5))
+	a.Equal("-1.25", FormatNM(-1.25))
+	a.Equal("0.001", FormatNM(0.001))
+}
+
+func TestParseSN(t *testing.T) {
+	a := assert.New(t)
+
+	for _, c := range []struct {
+		fi FieldItem
+		v  SN
+		s  string
+	}{
+		{makeFieldItem(">", "100"), SN{Comparator: ">", HasNum1: true, Num1: 100}, ">100"},
+		{makeFieldItem("<=", "0.5"), SN{Comparator: "<=", HasNum1: true, Num1: 0.5}, "<=0.5"},
+		{makeFieldItem("", "1", ":", "128"), SN{HasNum1: true, Num1: 1, Separator: ":", HasNum2: true, Num2: 128}, "1:128"},
+		{makeFieldItem("", "10", "-", "20"), SN{HasNum1: true, Num1: 10, Separator: "-", HasNum2: true, Num2: 20}, "10-20"},
+		{makeFieldItem("", "2", "+"), SN{HasNum1: true, Num1: 2, Separator: "+"}, "2+"},
+		{makeFieldItem("", "1", "/", "2"), SN{HasNum1: true, Num1: 1, Separator: "/", HasNum2: true, Num2: 2}, "1/2"},
+	} {
+		v, err := ParseSN(c.fi)
+		if a.NoError(err, c.s) {
+			a.Equal(c.v, v, c.s)
+			a.Equal(c.s, v.String())
+			a.Equal(c.fi, v.Encode("2.5"))
+		}
+	}
+
+	for _, fi := range []FieldItem{
+		makeFieldItem("!", "100"),
+		makeFieldItem(">"),
+		makeFieldItem("", "1", "*", "2"),
+		makeFieldItem("", "1", ":"),
+		makeFieldItem("", "1", "", "2"),
+		makeFieldItem("", "2", "+", "3"),
+		makeFieldItem("", "x"),
+	} {
+		_, err := ParseSN(fi)
+		a.Error(err)
+	}
+}
+
+func TestSNKinds(t *testing.T) {
+	a := assert.New(t)
+
+	a.True(SN{HasNum1: true, Num1: 10, Separator: "-", HasNum2: true, Num2: 20}.IsRange())
+	a.False(SN{HasNum1: true, Num1: 10, Separator: "-", HasNum2: true, Num2: 20}.IsRatio())
+	a.True(SN{HasNum1: true, Num1: 1, Separator: ":", HasNum2: true, Num2: 128}.IsRatio())
+	a.False(SN{Comparator: ">", HasNum1: true, Num1: 100}.IsRange())
+}
+
+func TestParseCQ(t *testing.T) {
+	a := assert.New(t)
+
+	fi := FieldItem{Component{"5"}, Component{"mg", "milligram", "ISO+"}}
+
+	c, err := ParseCQ(fi)
+	a.NoError(err)
+	a.Equal(CQ{Quantity: 5, Units: CE{Identifier: "mg", Text: "milligram", CodingSystem: "ISO+"}}, c)
+	a.Equal(fi, c.Encode("2.5"))
+
+	_, err = ParseCQ(makeFieldItem("five", "mg"))
+	a.Error(err)
+}
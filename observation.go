@@ -0,0 +1,110 @@
+package hl7 // import "fknsrs.biz/p/hl7"
+
+import (
+	"fmt"
+
+	"github.com/facebookgo/stackerr"
+)
+
+// ErrNotOBX is returned when ObservationValue is given a segment other than
+// an OBX.
+type ErrNotOBX error
+
+// ErrObservationValue is returned by ObservationValue when a repetition of
+// OBX-5 can't be decoded as the type in OBX-2. Err is the error from the
+// decoder, like an ErrInvalidTime.
+type ErrObservationValue struct {
+	Repetition int // counting from 1
+	Type       string
+	Err        error
+}
+
+func (e ErrObservationValue) Error() string {
+	return fmt.Sprintf("OBX-5(%d) of type %s: %s", e.Repetition, e.Type, e.Err.Error())
+}
+
+// Unwrap returns the error from the decoder.
+func (e ErrObservationValue) Unwrap() error {
+	return e.Err
+}
+
+// ObservationValue interprets each repetition of OBX-5 according to the
+// value type declared in OBX-2 of the same segment. The values it returns
+// depend on the value type:
+//
+//	NM               float64
+//	SN               SN
+//	CQ               CQ
+//	CE               CE
+//	CWE, CNE         CWE
+//	ED               ED
+//	RP               RP
+//	TS, DT, DTM      time.Time
+//	CX               CX
+//	HD               HD
+//	XAD, AD          XAD
+//	XCN, CN          XCN
+//	XPN, PN          XPN
+//	XTN, TN          XTN
+//
+// Anything else (ST, TX, FT, ID, IS, TM, and so on) comes back as a string
+// holding the first component. Empty repetitions come back as nil.
+func ObservationValue(obx Segment) ([]interface{}, error) {
+	if obx.Name() != "OBX" {
+		return nil, ErrNotOBX(stackerr.Newf("expected an OBX segment; instead got %q", obx.Name()))
+	}
+
+	typ := obx.Value(2)
+
+	var a []interface{}
+	for i, fi := range obx.Field(5) {
+		if len(trimFieldItem(fi)) == 0 {
+			a = append(a, nil)
+			continue
+		}
+
+		v, err := decodeValue(typ, fi)
+		if err != nil {
+			return nil, ErrObservationValue{Repetition: i + 1, Type: typ, Err: err}
+		}
+
+		a = append(a, v)
+	}
+
+	return a, nil
+}
+
+func decodeValue(typ string, fi FieldItem) (interface{}, error) {
+	switch typ {
+	case "NM":
+		return ParseNM(fi.get(1))
+	case "SN":
+		return ParseSN(fi)
+	case "CQ":
+		return ParseCQ(fi)
+	case "CE":
+		return DecodeCE(fi), nil
+	case "CWE", "CNE":
+		return DecodeCWE(fi), nil
+	case "ED":
+		return DecodeED(fi), nil
+	case "RP":
+		return DecodeRP(fi), nil
+	case "TS", "DT", "DTM":
+		return ParseTime(fi.get(1))
+	case "CX":
+		return DecodeCX(fi), nil
+	case "HD":
+		return DecodeHD(fi), nil
+	case "XAD", "AD":
+		return DecodeXAD(fi), nil
+	case "XCN", "CN":
+		return DecodeXCN(fi), nil
+	case "XPN", "PN":
+		return DecodeXPN(fi), nil
+	case "XTN", "TN":
+		return DecodeXTN(fi), nil
+	}
+
+	return fi.get(1), nil
+}
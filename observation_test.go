@@ -0,0 +1,65 @@
+package hl7
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestObservationValue(t *testing.T) {
+	a := assert.New(t)
+
+	m, _, err := ParseMessage([]byte(longTestMessageContent))
+	a.NoError(err)
+
+	obx := m.Segments("OBX")
+
+	v, err := ObservationValue(obx[0])
+	a.NoError(err)
+	a.Equal([]interface{}{float64(5)}, v)
+
+	v, err = ObservationValue(obx[2])
+	a.NoError(err)
+	a.Equal([]interface{}{"fever of 106F, with vomiting, seizures, persistent crying lasting over 3 hours, loss of appetite"}, v)
+
+	v, err = ObservationValue(obx[3])
+	a.NoError(err)
+	a.Equal([]interface{}{CE{Identifier: "E", Text: "required emergency room/doctor visit", CodingSystem: "NIP005"}}, v)
+
+	v, err = ObservationValue(obx[1])
+	a.NoError(err)
+	if a.Len(v, 1) {
+		a.True(time.Date(2001, 3, 16, 0, 0, 0, 0, time.Local).Equal(v[0].(time.Time)))
+	}
+
+	_, err = ObservationValue(m.Segment("PID", 0))
+	a.Error(err)
+}
+
+func TestObservationValueSN(t *testing.T) {
+	a := assert.New(t)
+
+	m, _, err := ParseMessage([]byte("MSH|^~\\&|||||||ORU^R01|1|P|2.5\rOBX|1|SN|5778-6^Color^LN||>^100~^1^:^128||\rOBX|2|NM|5778-6^Color^LN||abc"))
+	a.NoError(err)
+
+	v, err := ObservationValue(m.Segment("OBX", 0))
+	a.NoError(err)
+	a.Equal([]interface{}{
+		SN{Comparator: ">", HasNum1: true, Num1: 100},
+		SN{HasNum1: true, Num1: 1, Separator: ":", HasNum2: true, Num2: 128},
+	}, v)
+
+	_, err = ObservationValue(m.Segment("OBX", 1))
+	if a.Error(err) {
+		var verr ErrObservationValue
+		if a.True(errors.As(err, &verr)) {
+			a.Equal(1, verr.Repetition)
+			a.Equal("NM", verr.Type)
+			a.True(errors.Is(err, verr.Err))
+			a.Equal(verr.Err, errors.Unwrap(err))
+		}
+		a.Equal(`OBX-5(1) of type NM: invalid character 'a' in number "abc"`, ErrorText(err))
+	}
+}
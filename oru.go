@@ -0,0 +1,298 @@
+package hl7 // import "fknsrs.biz/p/hl7"
+
+import (
+	"strings"
+	"time"
+
+	"github.com/facebookgo/stackerr"
+)
+
+// ErrNotORU is returned by ParseORU when it's given a message that isn't an
+// ORU^R01.
+type ErrNotORU error
+
+// ORU is an ORU^R01 (unsolicited observation result) message, arranged into
+// its groups: patients, the orders for each patient, and the observations
+// and specimens for each order. The segments are the ones in the message,
+// not copies.
+type ORU struct {
+	Results []ORUResult
+}
+
+// ORUResult is one PATIENT_RESULT group.
+type ORUResult struct {
+	Patient *ORUPatient // nil if there's no PID
+	Orders  []ORUOrder
+}
+
+// ORUPatient is the PATIENT group of a result, including the VISIT group.
+// Segments that aren't there are nil.
+type ORUPatient struct {
+	PID Segment
+	PD1 Segment
+	NTE []Segment
+	NK1 []Segment
+	PV1 Segment
+	PV2 Segment
+}
+
+// ORUOrder is an ORDER_OBSERVATION group: an OBR, its notes, and its
+// observations and specimens.
+type ORUOrder struct {
+	ORC          Segment
+	OBR          Segment
+	NTE          []Segment
+	Observations []ORUObservation
+	Specimens    []ORUSpecimen // since 2.5
+}
+
+// ORUObservation is an OBX and its notes.
+type ORUObservation struct {
+	OBX Segment
+	NTE []Segment
+}
+
+// ORUSpecimen is a SPECIMEN group: an SPM and the observations about the
+// specimen itself. Those observations don't have notes.
+type ORUSpecimen struct {
+	SPM          Segment
+	Observations []ORUObservation
+}
+
+// ParseORU arranges an ORU^R01 message into an ORU, using the ORU_R01
+// structure in DefaultStructures. Segments that the structure doesn't place
+// in a group (Z segments, or segments that are out of order) are left out;
+// use Structure.Validate to check for those.
+func ParseORU(m Message) (*ORU, error) {
+	s := LookupStructure(m, DefaultStructures)
+	if s == nil || s.Name != "ORU_R01" {
+		return nil, ErrNotORU(stackerr.Newf("expected an ORU^R01 message; instead got %q", m.Type()))
+	}
+
+	nodes, _ := s.Match(m)
+
+	var r ORU
+	for _, n := range nodes {
+		if n.Group == "PATIENT_RESULT" {
+			r.Results = append(r.Results, oruResult(n.Children))
+		}
+	}
+
+	return &r, nil
+}
+
+func oruResult(nodes []StructureNode) ORUResult {
+	var r ORUResult
+
+	for _, n := range nodes {
+		switch n.Group {
+		case "PATIENT":
+			r.Patient = oruPatient(n.Children)
+		case "ORDER_OBSERVATION":
+			r.Orders = append(r.Orders, oruOrder(n.Children))
+		}
+	}
+
+	return r
+}
+
+func oruPatient(nodes []StructureNode) *ORUPatient {
+	var p ORUPatient
+
+	for _, n := range nodes {
+		if n.Group == "VISIT" {
+			for _, c := range n.Children {
+				switch c.Segment.Name() {
+				case "PV1":
+					p.PV1 = c.Segment
+				case "PV2":
+					p.PV2 = c.Segment
+				}
+			}
+
+			continue
+		}
+
+		switch n.Segment.Name() {
+		case "PID":
+			p.PID = n.Segment
+		case "PD1":
+			p.PD1 = n.Segment
+		case "NTE":
+			p.NTE = append(p.NTE, n.Segment)
+		case "NK1":
+			p.NK1 = append(p.NK1, n.Segment)
+		}
+	}
+
+	if p.PID == nil {
+		return nil
+	}
+
+	return &p
+}
+
+func oruOrder(nodes []StructureNode) ORUOrder {
+	var o ORUOrder
+
+	for _, n := range nodes {
+		switch n.Group {
+		case "OBSERVATION":
+			o.Observations = append(o.Observations, oruObservation(n.Children))
+		case "SPECIMEN":
+			o.Specimens = append(o.Specimens, oruSpecimen(n.Children))
+		case "":
+			switch n.Segment.Name() {
+			case "ORC":
+				o.ORC = n.Segment
+			case "OBR":
+				o.OBR = n.Segment
+			case "NTE":
+				o.NTE = append(o.NTE, n.Segment)
+			}
+		}
+	}
+
+	return o
+}
+
+func oruSpecimen(nodes []StructureNode) ORUSpecimen {
+	var s ORUSpecimen
+
+	for _, n := range nodes {
+		switch n.Segment.Name() {
+		case "SPM":
+			s.SPM = n.Segment
+		case "OBX":
+			s.Observations = append(s.Observations, ORUObservation{OBX: n.Segment})
+		}
+	}
+
+	return s
+}
+
+func oruObservation(nodes []StructureNode) ORUObservation {
+	var o ORUObservation
+
+	for _, n := range nodes {
+		switch n.Segment.Name() {
+		case "OBX":
+			o.OBX = n.Segment
+		case "NTE":
+			o.NTE = append(o.NTE, n.Segment)
+		}
+	}
+
+	return o
+}
+
+// Identifiers returns the patient's identifiers, from PID-3.
+func (p *ORUPatient) Identifiers() []CX {
+	return DecodeCXs(p.PID.Field(3))
+}
+
+// Names returns the patient's names, from PID-5.
+func (p *ORUPatient) Names() []XPN {
+	return DecodeXPNs(p.PID.Field(5))
+}
+
+// Notes returns the text of the patient's NTE segments.
+func (p *ORUPatient) Notes() []string {
+	return noteText(p.NTE)
+}
+
+// ServiceID returns what was ordered, from OBR-4.
+func (o *ORUOrder) ServiceID() CWE {
+	return DecodeCWE(o.OBR.Field(4).item(0))
+}
+
+// ObservationTime returns when the specimen was collected or the
+// observations were made, from OBR-7. It's the zero time if OBR-7 is empty.
+func (o *ORUOrder) ObservationTime() (time.Time, error) {
+	return ParseTime(o.OBR.Value(7))
+}
+
+// ResultStatus returns the status of the results, from OBR-25, like "F" for
+// final or "P" for preliminary.
+func (o *ORUOrder) ResultStatus() string {
+	return o.OBR.Value(25)
+}
+
+// Notes returns the text of the order's NTE segments. It doesn't include the
+// notes on each observation.
+func (o *ORUOrder) Notes() []string {
+	return noteText(o.NTE)
+}
+
+// ID returns what was observed, from OBX-3.
+func (o *ORUObservation) ID() CWE {
+	return DecodeCWE(o.OBX.Field(3).item(0))
+}
+
+// SubID returns the observation sub-ID, from OBX-4, which groups related
+// observations within an order.
+func (o *ORUObservation) SubID() string {
+	return o.OBX.Value(4)
+}
+
+// Value returns the observation's values, interpreted according to OBX-2.
+// See ObservationValue.
+func (o *ORUObservation) Value() ([]interface{}, error) {
+	return ObservationValue(o.OBX)
+}
+
+// Units returns the units of the observation's values, from OBX-6.
+func (o *ORUObservation) Units() CWE {
+	return DecodeCWE(o.OBX.Field(6).item(0))
+}
+
+// ReferenceRange returns the observation's reference range, from OBX-7,
+// like "3.5-5.0".
+func (o *ORUObservation) ReferenceRange() string {
+	return o.OBX.Value(7)
+}
+
+// AbnormalFlags returns the observation's abnormal flags, from the
+// repetitions of OBX-8, like "H" for high or "LL" for critically low.
+func (o *ORUObservation) AbnormalFlags() []string {
+	var a []string
+	for _, fi := range o.OBX.Field(8) {
+		if v := fi.get(1); v != "" {
+			a = append(a, v)
+		}
+	}
+	return a
+}
+
+// Status returns the observation's result status, from OBX-11, like "F" for
+// final or "C" for a correction.
+func (o *ORUObservation) Status() string {
+	return o.OBX.Value(11)
+}
+
+// Notes returns the text of the observation's NTE segments.
+func (o *ORUObservation) Notes() []string {
+	return noteText(o.NTE)
+}
+
+// Type returns the type of specimen, from SPM-4.
+func (s *ORUSpecimen) Type() CWE {
+	return DecodeCWE(s.SPM.Field(4).item(0))
+}
+
+// noteText returns the comment (NTE-3) of each NTE segment, with the
+// repetitions of the comment joined by newlines.
+func noteText(a []Segment) []string {
+	var r []string
+
+	for _, s := range a {
+		var lines []string
+		for _, fi := range s.Field(3) {
+			lines = append(lines, fi.get(1))
+		}
+
+		r = append(r, strings.Join(lines, "\n"))
+	}
+
+	return r
+}
@@ -0,0 +1,153 @@
+package hl7
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const testORU = "MSH|^~\\&|LAB|HOSP|EMR|HOSP|20240102103000||ORU^R01^ORU_R01|1|P|2.5\r" +
+	"PID|1||123^^^HOSP^MR~456^^^STATE^SS||Smith^Jane||19800101|F\r" +
+	"NTE|1||patient note\r" +
+	"PV1|1|O\r" +
+	"ORC|RE|ORD1\r" +
+	"OBR|1|ORD1||24323-8^Comprehensive metabolic panel^LN|||20240102080000||||||||||||||||||F\r" +
+	"NTE|1||fasting~second line\r" +
+	"OBX|1|NM|2345-7^Glucose^LN||182|mg/dL^mg/dL^UCUM|70-99|H~A|||F\r" +
+	"NTE|1||repeat advised\r" +
+	"NTE|2||called to ward\r" +
+	"OBX|2|NM|2951-2^Sodium^LN||140|mmol/L|135-145||||F\r" +
+	"SPM|1|||BLD^Whole blood^HL70487\r" +
+	"OBX|1|ST|SPECQ^Specimen quality^L||haemolysed||||||F\r" +
+	"OBR|2|ORD2||58410-2^CBC panel^LN|||20240102080000||||||||||||||||||P\r" +
+	"ZZZ|1\r" +
+	"PID|2||789^^^HOSP^MR||Brown^Bob\r" +
+	"OBR|1|ORD3||1234-5^Other^LN\r"
+
+func TestParseORU(t *testing.T) {
+	a := assert.New(t)
+
+	m, _, err := ParseMessage([]byte(testORU))
+	a.NoError(err)
+
+	r, err := ParseORU(m)
+	if !a.NoError(err) || !a.Len(r.Results, 2) {
+		return
+	}
+
+	p := r.Results[0].Patient
+	if a.NotNil(p) {
+		a.Equal("123", p.Identifiers()[0].ID)
+		a.Equal("SS", p.Identifiers()[1].IdentifierTypeCode)
+		a.Equal("Smith", p.Names()[0].Family)
+		a.Equal([]string{"patient note"}, p.Notes())
+		a.Equal("O", p.PV1.Value(2))
+		a.Nil(p.PV2)
+		a.Nil(p.PD1)
+	}
+
+	orders := r.Results[0].Orders
+	if !a.Len(orders, 2) {
+		return
+	}
+
+	o := orders[0]
+	a.Equal("ORD1", o.ORC.Value(2))
+	a.Equal("24323-8", o.ServiceID().Identifier)
+	a.Equal("F", o.ResultStatus())
+	a.Equal([]string{"fasting\nsecond line"}, o.Notes())
+
+	tm, err := o.ObservationTime()
+	a.NoError(err)
+	a.Equal(time.Date(2024, 1, 2, 8, 0, 0, 0, time.Local), tm)
+
+	if a.Len(o.Observations, 2) {
+		obs := o.Observations[0]
+		a.Equal("Glucose", obs.ID().Text)
+		a.Equal("mg/dL", obs.Units().Identifier)
+		a.Equal("70-99", obs.ReferenceRange())
+		a.Equal([]string{"H", "A"}, obs.AbnormalFlags())
+		a.Equal("F", obs.Status())
+		a.Equal([]string{"repeat advised", "called to ward"}, obs.Notes())
+
+		v, err := obs.Value()
+		a.NoError(err)
+		a.Equal([]interface{}{float64(182)}, v)
+
+		a.Equal("Sodium", o.Observations[1].ID().Text)
+		a.Nil(o.Observations[1].AbnormalFlags())
+		a.Nil(o.Observations[1].Notes())
+	}
+
+	if a.Len(o.Specimens, 1) {
+		sp := o.Specimens[0]
+		a.Equal("BLD", sp.Type().Identifier)
+		if a.Len(sp.Observations, 1) {
+			a.Equal("SPECQ", sp.Observations[0].ID().Identifier)
+		}
+	}
+
+	a.Nil(orders[1].ORC)
+	a.Equal("P", orders[1].ResultStatus())
+	a.Empty(orders[1].Observations)
+
+	if a.NotNil(r.Results[1].Patient) {
+		a.Equal("789", r.Results[1].Patient.Identifiers()[0].ID)
+	}
+	a.Len(r.Results[1].Orders, 1)
+}
+
+func TestParseORUOlderVersion(t *testing.T) {
+	a := assert.New(t)
+
+	m, _, err := ParseMessage([]byte(longTestMessageContent))
+	a.NoError(err)
+
+	r, err := ParseORU(m)
+	if a.NoError(err) && a.Len(r.Results, 1) {
+		res := r.Results[0]
+		if a.NotNil(res.Patient) {
+			a.Len(res.Patient.NK1, 2)
+		}
+
+		if a.Len(res.Orders, 8) {
+			a.NotNil(res.Orders[0].ORC)
+			a.Nil(res.Orders[1].ORC)
+			a.Len(res.Orders[0].Observations, 10)
+			a.Len(res.Orders[1].Observations, 12)
+			a.Equal("30955-9", res.Orders[1].ServiceID().Identifier)
+			a.Empty(res.Orders[0].Specimens)
+		}
+	}
+}
+
+func TestParseORUNoPatient(t *testing.T) {
+	a := assert.New(t)
+
+	m, _, err := ParseMessage([]byte(strings.Join([]string{
+		`MSH|^~\&|||||||ORU^R01|1|P|2.5`,
+		`OBR|1`,
+		`OBX|1|ST|X||y`,
+	}, "\r")))
+	a.NoError(err)
+
+	r, err := ParseORU(m)
+	if a.NoError(err) && a.Len(r.Results, 1) {
+		a.Nil(r.Results[0].Patient)
+		a.Len(r.Results[0].Orders, 1)
+	}
+}
+
+func TestParseORUWrongType(t *testing.T) {
+	a := assert.New(t)
+
+	m, _, err := ParseMessage([]byte(`MSH|^~\&|||||||ADT^A01|1|P|2.5`))
+	a.NoError(err)
+
+	_, err = ParseORU(m)
+	if a.Error(err) {
+		a.Equal(`expected an ORU^R01 message; instead got "ADT^A01"`, ErrorText(err))
+	}
+}
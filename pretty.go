@@ -0,0 +1,189 @@
+package hl7 // import "fknsrs.biz/p/hl7"
+
+import (
+	"bytes"
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// PrettyOptions controls how Pretty lays out a message.
+type PrettyOptions struct {
+	// Dictionary, if set, is used to name fields and components (e.g.
+	// "PID-5-1 Patient Name.Family Name").
+	Dictionary *Dictionary
+	// HideEmpty leaves out fields, components, and subcomponents that have no
+	// value.
+	HideEmpty bool
+	// MaxValueLength, if more than zero, cuts values that are longer than
+	// this down to size, noting how long they were. This is useful for things
+	// like base64-encoded reports in OBX-5.
+	MaxValueLength int
+}
+
+// Pretty formats a message as an indented tree, one value per line, with
+// the query path of each value (e.g. "PID-5-1 = Smith"). Repeated segments
+// and field repetitions after the first are numbered (e.g. "OBX(2)-5" or
+// "PID-3(2)-1"). Fields and components made up of more than one value get a
+// line of their own, with their parts indented underneath.
+func Pretty(m Message, o PrettyOptions) string {
+	p := prettyPrinter{o: o}
+
+	counts := make(map[string]int)
+
+	for _, s := range m {
+		name := s.Name()
+
+		path := name
+		if n := counts[name]; n > 0 {
+			path += "(" + strconv.Itoa(n+1) + ")"
+		}
+		counts[name]++
+
+		p.line(0, path, "", nil)
+
+		for n := 1; n < len(s); n++ {
+			p.field(s, n, path+"-"+strconv.Itoa(n))
+		}
+	}
+
+	return p.buf.String()
+}
+
+type prettyPrinter struct {
+	o   PrettyOptions
+	buf bytes.Buffer
+}
+
+func (p *prettyPrinter) field(s Segment, n int, path string) {
+	var name, typ string
+	if d, ok := p.o.Dictionary.Field(s.Name(), n); ok {
+		name, typ = d.Name, d.Type
+	}
+	if s.Name() == "OBX" && n == 5 {
+		typ = s.Value(2)
+	}
+
+	f := s[n]
+
+	if len(f) == 0 {
+		if !p.o.HideEmpty {
+			v := ""
+			p.line(1, path, name, &v)
+		}
+		return
+	}
+
+	for i, fi := range f {
+		fpath := path
+		if i > 0 {
+			fpath += "(" + strconv.Itoa(i+1) + ")"
+		}
+
+		p.fieldItem(fi, fpath, name, typ)
+	}
+}
+
+func (p *prettyPrinter) fieldItem(fi FieldItem, path, name, typ string) {
+	if p.o.HideEmpty {
+		fi = trimFieldItem(fi)
+	}
+
+	switch {
+	case len(fi) == 0:
+		if !p.o.HideEmpty {
+			v := ""
+			p.line(1, path, name, &v)
+		}
+		return
+	case len(fi) == 1 && len(fi[0]) <= 1:
+		v := fi[0].get(1)
+		p.line(1, path, name, &v)
+		return
+	}
+
+	p.line(1, path, name, nil)
+
+	for i, c := range fi {
+		if p.o.HideEmpty && c.empty() {
+			continue
+		}
+
+		var cname, ctyp string
+		if d, ok := p.o.Dictionary.Component(typ, i+1); ok {
+			cname, ctyp = d.Name, d.Type
+		}
+
+		p.component(c, path+"-"+strconv.Itoa(i+1), joinNames(name, cname), ctyp)
+	}
+}
+
+func (p *prettyPrinter) component(c Component, path, name, typ string) {
+	if len(c) <= 1 {
+		v := c.get(1)
+		p.line(2, path, name, &v)
+		return
+	}
+
+	p.line(2, path, name, nil)
+
+	for i, sc := range c {
+		if p.o.HideEmpty && sc == "" {
+			continue
+		}
+
+		var sname string
+		if d, ok := p.o.Dictionary.Component(typ, i+1); ok {
+			sname = d.Name
+		}
+
+		v := string(sc)
+		p.line(3, path+"-"+strconv.Itoa(i+1), joinNames(name, sname), &v)
+	}
+}
+
+func (p *prettyPrinter) line(depth int, path, name string, value *string) {
+	p.buf.WriteString(strings.Repeat("  ", depth))
+	p.buf.WriteString(path)
+
+	if name != "" {
+		p.buf.WriteString(" ")
+		p.buf.WriteString(name)
+	}
+
+	if value != nil {
+		p.buf.WriteString(" = ")
+		p.buf.WriteString(p.value(*value))
+	}
+
+	p.buf.WriteString("\n")
+}
+
+func (p *prettyPrinter) value(s string) string {
+	if n := p.o.MaxValueLength; n > 0 && len(s) > n {
+		for n > 0 && !utf8.RuneStart(s[n]) {
+			n--
+		}
+
+		s = fmt.Sprintf("%s... (%d bytes)", s[:n], len(s))
+	}
+
+	// Keep each value on its own line, so the tree stays readable.
+	if strings.ContainsAny(s, "\r\n") {
+		s = strings.NewReplacer("\r", `\r`, "\n", `\n`).Replace(s)
+	}
+
+	return s
+}
+
+func joinNames(a, b string) string {
+	switch {
+	case a == "":
+		return b
+	case b == "":
+		return a
+	default:
+		return a + "." + b
+	}
+}
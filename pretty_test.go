@@ -0,0 +1,122 @@
+package hl7
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const prettyTestMessage = "MSH|^~\\&|APP|FAC|||20240102||ADT^A01|1|P|2.5\r" +
+	"PID|||123^^^GHH&1.2.3&ISO~456||Smith^John||19800101\r" +
+	"OBX|1|ED|PDF||^AP^PDF^Base64^JVBERi0xLjQKJeTjz9IK\r" +
+	"OBX|2|ST|X||a\r"
+
+func TestPretty(t *testing.T) {
+	a := assert.New(t)
+
+	m, _, err := ParseMessage([]byte(prettyTestMessage))
+	a.NoError(err)
+
+	m[3][5] = Field{FieldItem{Component{"a\nb"}}}
+
+	a.Equal(`MSH
+  MSH-1 = |
+  MSH-2 = ^~\&
+  MSH-3 = APP
+  MSH-4 = FAC
+  MSH-5 = 
+  MSH-6 = 
+  MSH-7 = 20240102
+  MSH-8 = 
+  MSH-9
+    MSH-9-1 = ADT
+    MSH-9-2 = A01
+  MSH-10 = 1
+  MSH-11 = P
+  MSH-12 = 2.5
+PID
+  PID-1 = 
+  PID-2 = 
+  PID-3
+    PID-3-1 = 123
+    PID-3-2 = 
+    PID-3-3 = 
+    PID-3-4
+      PID-3-4-1 = GHH
+      PID-3-4-2 = 1.2.3
+      PID-3-4-3 = ISO
+  PID-3(2) = 456
+  PID-4 = 
+  PID-5
+    PID-5-1 = Smith
+    PID-5-2 = John
+  PID-6 = 
+  PID-7 = 19800101
+OBX
+  OBX-1 = 1
+  OBX-2 = ED
+  OBX-3 = PDF
+  OBX-4 = 
+  OBX-5
+    OBX-5-1 = 
+    OBX-5-2 = AP
+    OBX-5-3 = PDF
+    OBX-5-4 = Base64
+    OBX-5-5 = JVBERi0xLjQKJeTjz9IK
+OBX(2)
+  OBX(2)-1 = 2
+  OBX(2)-2 = ST
+  OBX(2)-3 = X
+  OBX(2)-4 = 
+  OBX(2)-5 = a\nb
+`, Pretty(m, PrettyOptions{}))
+}
+
+func TestPrettyOptions(t *testing.T) {
+	a := assert.New(t)
+
+	m, _, err := ParseMessage([]byte(prettyTestMessage))
+	a.NoError(err)
+
+	m[3][5] = Field{FieldItem{Component{"a\nb"}}}
+
+	a.Equal(`MSH
+  MSH-1 Field Separator = |
+  MSH-2 Encoding Characters = ^~\&
+  MSH-3 Sending Application = APP
+  MSH-4 Sending Facility = FAC
+  MSH-7 Date/Time Of Message = 20240102
+  MSH-9 Message Type
+    MSH-9-1 Message Type.Message Code = ADT
+    MSH-9-2 Message Type.Trigger Event = A01
+  MSH-10 Message Control ID = 1
+  MSH-11 Processing ID = P
+  MSH-12 Version ID = 2.5
+PID
+  PID-3 Patient Identifier List
+    PID-3-1 Patient Identifier List.ID Number = 123
+    PID-3-4 Patient Identifier List.Assigning Authority
+      PID-3-4-1 Patient Identifier List.Assigning Authority.Namespace ID = GHH
+      PID-3-4-2 Patient Identifier List.Assigning Authority.Universal ID = 1.2.3
+      PID-3-4-3 Patient Identifier List.Assigning Authority.Universal ID Type = ISO
+  PID-3(2) Patient Identifier List = 456
+  PID-5 Patient Name
+    PID-5-1 Patient Name.Family Name = Smith
+    PID-5-2 Patient Name.Given Name = John
+  PID-7 Date/Time of Birth = 19800101
+OBX
+  OBX-1 Set ID - OBX = 1
+  OBX-2 Value Type = ED
+  OBX-3 Observation Identifier = PDF
+  OBX-5 Observation Value
+    OBX-5-2 Observation Value.Type of Data = AP
+    OBX-5-3 Observation Value.Data Subtype = PDF
+    OBX-5-4 Observation Value.Encoding = Base64
+    OBX-5-5 Observation Value.Data = JVBERi0xLj... (20 bytes)
+OBX(2)
+  OBX(2)-1 Set ID - OBX = 2
+  OBX(2)-2 Value Type = ST
+  OBX(2)-3 Observation Identifier = X
+  OBX(2)-5 Observation Value = a\nb
+`, Pretty(m, PrettyOptions{Dictionary: DefaultDictionary, HideEmpty: true, MaxValueLength: 10}))
+}
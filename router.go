@@ -0,0 +1,165 @@
+package hl7 // import "fknsrs.biz/p/hl7"
+
+import (
+	"context"
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/facebookgo/stackerr"
+)
+
+// ServeMux is a Handler that passes each message on to one of a number of
+// other handlers, depending on its type (MSH-9) and, optionally, who sent it
+// (MSH-3 and MSH-4).
+//
+// Patterns look like "CODE^TRIGGER", optionally followed by a space and
+// "APPLICATION^FACILITY", for example "ADT^A01", "ORU^R01 LAB^GENERAL", or
+// "ADT^A01 *^NORTH". Each part can use the wildcards understood by
+// path.Match, so "ADT^A0*" matches ADT^A01 through ADT^A09. Parts that are
+// left out (like the trigger in "ADT") match anything.
+//
+// If more than one pattern matches a message, the one with the most
+// characters that aren't wildcards wins, so "ADT^A01" beats "ADT^A0*", which
+// beats "ADT". Ties go to whichever was registered first.
+type ServeMux struct {
+	// NotFound handles messages that don't match any pattern. If it's nil,
+	// they're rejected with an AR acknowledgement.
+	NotFound Handler
+
+	mu     sync.RWMutex
+	routes []route
+}
+
+type route struct {
+	pattern  string
+	parts    [4]string
+	literals int
+	handler  Handler
+}
+
+// NewServeMux returns an empty ServeMux.
+func NewServeMux() *ServeMux {
+	return &ServeMux{}
+}
+
+// Handle registers a handler for a pattern. It panics if the pattern is
+// invalid, or if there's already a handler for it.
+func (mux *ServeMux) Handle(pattern string, h Handler) {
+	if h == nil {
+		panic("hl7: nil handler for " + pattern)
+	}
+
+	r, err := parseRoute(pattern)
+	if err != nil {
+		panic(ErrorText(err))
+	}
+	r.handler = h
+
+	mux.mu.Lock()
+	defer mux.mu.Unlock()
+
+	for _, e := range mux.routes {
+		if e.parts == r.parts {
+			panic("hl7: multiple registrations for " + pattern)
+		}
+	}
+
+	mux.routes = append(mux.routes, r)
+
+	sort.SliceStable(mux.routes, func(i, j int) bool {
+		return mux.routes[i].literals > mux.routes[j].literals
+	})
+}
+
+// HandleFunc registers a handler function for a pattern.
+func (mux *ServeMux) HandleFunc(pattern string, f func(ctx context.Context, m Message, d *Delimiters) (Message, error)) {
+	mux.Handle(pattern, HandlerFunc(f))
+}
+
+// Handler returns the handler that a message would be passed to, and the
+// pattern it was registered with. If nothing matches, it returns nil and an
+// empty pattern.
+func (mux *ServeMux) Handler(m Message) (Handler, string) {
+	msh := m.Segment("MSH", 0)
+	msh9 := msh.Field(9).item(0)
+
+	values := [4]string{
+		msh9.get(1),
+		msh9.get(2),
+		msh.Field(3).item(0).get(1),
+		msh.Field(4).item(0).get(1),
+	}
+
+	mux.mu.RLock()
+	defer mux.mu.RUnlock()
+
+	for _, r := range mux.routes {
+		if r.match(values) {
+			return r.handler, r.pattern
+		}
+	}
+
+	return nil, ""
+}
+
+// ServeHL7 passes the message on to the handler for its pattern, or to
+// NotFound if there isn't one.
+func (mux *ServeMux) ServeHL7(ctx context.Context, m Message, d *Delimiters) (Message, error) {
+	h, _ := mux.Handler(m)
+	if h == nil {
+		h = mux.NotFound
+	}
+
+	if h == nil {
+		msh9 := m.Segment("MSH", 0).Field(9).item(0)
+		return NewACK(m, d, AckReject, fmt.Sprintf("no handler for message type %s^%s", msh9.get(1), msh9.get(2))), nil
+	}
+
+	return h.ServeHL7(ctx, m, d)
+}
+
+// parseRoute splits a pattern into its message code, trigger event, sending
+// application, and sending facility, filling in "*" for anything that's left
+// out.
+func parseRoute(pattern string) (route, error) {
+	r := route{pattern: pattern, parts: [4]string{"*", "*", "*", "*"}}
+
+	a := strings.Split(pattern, " ")
+	if len(a) > 2 || a[0] == "" {
+		return r, stackerr.Newf("hl7: invalid pattern %q", pattern)
+	}
+
+	for i, s := range a {
+		b := strings.Split(s, "^")
+		if len(b) > 2 {
+			return r, stackerr.Newf("hl7: invalid pattern %q", pattern)
+		}
+
+		for j, p := range b {
+			if p == "" {
+				return r, stackerr.Newf("hl7: invalid pattern %q", pattern)
+			}
+			if _, err := path.Match(p, ""); err != nil {
+				return r, stackerr.Newf("hl7: invalid pattern %q: %s", pattern, err)
+			}
+
+			r.parts[i*2+j] = p
+			r.literals += len(p) - strings.Count(p, "*") - strings.Count(p, "?")
+		}
+	}
+
+	return r, nil
+}
+
+func (r route) match(values [4]string) bool {
+	for i, p := range r.parts {
+		if ok, _ := path.Match(p, values[i]); !ok {
+			return false
+		}
+	}
+
+	return true
+}
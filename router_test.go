@@ -0,0 +1,76 @@
+package hl7
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func routerTestHandler(name string) Handler {
+	return HandlerFunc(func(ctx context.Context, m Message, d *Delimiters) (Message, error) {
+		return NewACK(m, d, AckAccept, name), nil
+	})
+}
+
+func routerTestMessage(a *assert.Assertions, app, facility, msh9 string) Message {
+	m, _, err := ParseMessage([]byte("MSH|^~\\&|" + app + "|" + facility + "|||20240102||" + msh9 + "|1|P|2.5\r"))
+	a.NoError(err)
+	return m
+}
+
+func TestServeMux(t *testing.T) {
+	a := assert.New(t)
+
+	mux := NewServeMux()
+	mux.Handle("ADT", routerTestHandler("adt"))
+	mux.Handle("ADT^A0*", routerTestHandler("adt-a0x"))
+	mux.Handle("ADT^A01", routerTestHandler("adt-a01"))
+	mux.Handle("ADT^A01 *^NORTH", routerTestHandler("adt-a01-north"))
+	mux.Handle("ORU^R01 LAB", routerTestHandler("oru-lab"))
+
+	for _, c := range []struct{ app, facility, msh9, pattern string }{
+		{"APP", "FAC", "ADT^A01", "ADT^A01"},
+		{"APP", "NORTH", "ADT^A01", "ADT^A01 *^NORTH"},
+		{"APP", "FAC", "ADT^A08^ADT_A01", "ADT^A0*"},
+		{"APP", "FAC", "ADT^A40", "ADT"},
+		{"LAB", "FAC", "ORU^R01", "ORU^R01 LAB"},
+		{"RAD", "FAC", "ORU^R01", ""},
+		{"APP", "FAC", "SIU^S12", ""},
+	} {
+		_, pattern := mux.Handler(routerTestMessage(a, c.app, c.facility, c.msh9))
+		a.Equal(c.pattern, pattern, c.msh9+" from "+c.app+"^"+c.facility)
+	}
+
+	m := routerTestMessage(a, "APP", "FAC", "ADT^A04")
+	ack, err := mux.ServeHL7(context.Background(), m, nil)
+	a.NoError(err)
+	a.Equal("AA", ack.Segment("MSA", 0).Value(1))
+	a.Equal("adt-a0x", ack.Segment("MSA", 0).Value(3))
+
+	m = routerTestMessage(a, "APP", "FAC", "SIU^S12")
+	ack, err = mux.ServeHL7(context.Background(), m, nil)
+	a.NoError(err)
+	a.Equal("AR", ack.Segment("MSA", 0).Value(1))
+	a.Equal("no handler for message type SIU^S12", ack.Segment("MSA", 0).Value(3))
+
+	mux.NotFound = routerTestHandler("fallback")
+	ack, err = mux.ServeHL7(context.Background(), m, nil)
+	a.NoError(err)
+	a.Equal("fallback", ack.Segment("MSA", 0).Value(3))
+}
+
+func TestServeMuxInvalid(t *testing.T) {
+	a := assert.New(t)
+
+	mux := NewServeMux()
+	mux.Handle("ADT^A01", routerTestHandler("a"))
+
+	for _, p := range []string{"", "ADT^", "ADT^A01^ADT_A01", "ADT A B", "ADT^[", "^A01"} {
+		a.Panics(func() { mux.Handle(p, routerTestHandler("b")) }, p)
+	}
+
+	a.Panics(func() { mux.Handle("ADT^A01", routerTestHandler("b")) })
+	a.Panics(func() { mux.Handle("ADT^A01 *^*", routerTestHandler("b")) })
+	a.Panics(func() { mux.Handle("ADT", nil) })
+}
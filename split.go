@@ -0,0 +1,50 @@
+package hl7 // import "fknsrs.biz/p/hl7"
+
+import (
+	"bytes"
+)
+
+// SplitMessages breaks up a buffer holding any number of messages, like a
+// file full of them or an HL7 batch file, into one buffer per message, ready
+// for ParseMessage. Segments can be separated by "\r", "\n", or "\r\n"; in
+// the output they're always separated by "\r". MLLP framing characters,
+// blank lines, and batch header and trailer segments (FHS, BHS, BTS, FTS) are
+// thrown away. A new message starts at each MSH segment.
+func SplitMessages(buf []byte) [][]byte {
+	var (
+		messages [][]byte
+		current  []byte
+	)
+
+	for _, line := range bytes.FieldsFunc(buf, isSegmentBreak) {
+		line = bytes.Trim(line, "\x0b\x1c")
+		if len(line) == 0 {
+			continue
+		}
+
+		if len(line) >= 3 {
+			switch string(line[0:3]) {
+			case "FHS", "BHS", "BTS", "FTS":
+				continue
+			case "MSH":
+				if current != nil {
+					messages = append(messages, current)
+				}
+				current = nil
+			}
+		}
+
+		current = append(current, line...)
+		current = append(current, '\r')
+	}
+
+	if current != nil {
+		messages = append(messages, current)
+	}
+
+	return messages
+}
+
+func isSegmentBreak(r rune) bool {
+	return r == '\r' || r == '\n'
+}
@@ -0,0 +1,35 @@
+package hl7
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSplitMessages(t *testing.T) {
+	a := assert.New(t)
+
+	a.Equal([][]byte{
+		[]byte("MSH|^~\\&|A\rPID|1\r"),
+		[]byte("MSH|^~\\&|B\rPID|2\rOBX|1\r"),
+	}, SplitMessages([]byte("FHS|^~\\&\r\nBHS|^~\\&\r\nMSH|^~\\&|A\r\nPID|1\r\n\r\nMSH|^~\\&|B\nPID|2\nOBX|1\nBTS|2\r\nFTS|1\r\n")))
+
+	a.Equal([][]byte{[]byte("MSH|^~\\&|A\r")}, SplitMessages([]byte("\x0bMSH|^~\\&|A\r\x1c\r")))
+
+	a.Nil(SplitMessages([]byte("\r\n\r\n")))
+}
+
+func TestSplitMessagesParse(t *testing.T) {
+	a := assert.New(t)
+
+	a.Len(SplitMessages([]byte(longTestMessageContent)), 1)
+
+	expected, _, err := ParseMessage([]byte(longTestMessageContent))
+	a.NoError(err)
+
+	for _, b := range SplitMessages([]byte(longTestMessageContent + longTestMessageContent)) {
+		m, _, err := ParseMessage(b)
+		a.NoError(err)
+		a.Equal(expected, m)
+	}
+}
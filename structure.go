@@ -0,0 +1,442 @@
+package hl7 // import "fknsrs.biz/p/hl7"
+
+import (
+	"github.com/facebookgo/stackerr"
+)
+
+// ErrInvalidStructure is returned by Structure.Validate when a message doesn't
+// fit its structure.
+type ErrInvalidStructure error
+
+// StructureElement is either a segment or a group of other elements within a
+// message structure.
+type StructureElement struct {
+	Segment   string // set for segments, e.g. "OBX"
+	Group     string // set for groups, e.g. "PATIENT_RESULT"
+	Required  bool
+	Repeating bool
+	Children  []StructureElement // only for groups
+}
+
+// Structure describes the abstract message syntax of a message structure,
+// like ORU_R01 or ADT_A01.
+type Structure struct {
+	Name     string
+	Elements []StructureElement
+}
+
+// StructureNode is one element of a message that's been arranged according
+// to a Structure. Exactly one of Segment and Group is set.
+type StructureNode struct {
+	Segment  Segment
+	Group    string
+	Children []StructureNode
+}
+
+// Match arranges the segments of a message into the groups of the structure.
+// Segments are matched greedily, in order. Segments that don't appear
+// anywhere in the structure (like Z segments) are left where they are, in
+// whichever group they turn up in. Segments that do appear in the structure
+// but can't be placed (because they're out of order) are put at the top
+// level. The second return value is the number of segments that had to be
+// put at the top level like this.
+func (s *Structure) Match(m Message) ([]StructureNode, int) {
+	known := make(map[string]bool)
+	collectSegments(s.Elements, known)
+
+	var nodes []StructureNode
+	var misplaced int
+
+	for i := 0; i < len(m); {
+		a, j := matchElements(s.Elements, m, i, known)
+		nodes = append(nodes, a...)
+
+		if j < len(m) {
+			nodes = append(nodes, StructureNode{Segment: m[j]})
+			misplaced++
+			j++
+		}
+
+		i = j
+	}
+
+	return nodes, misplaced
+}
+
+// Validate checks that a message fits the structure: that every segment the
+// structure knows about is in a place it's allowed to be, and that every
+// required segment and group is there. Segments the structure doesn't know
+// about (like Z segments) are ignored.
+func (s *Structure) Validate(m Message) error {
+	known := make(map[string]bool)
+	collectSegments(s.Elements, known)
+
+	nodes, i := matchElements(s.Elements, m, 0, known)
+	if i < len(m) {
+		return ErrInvalidStructure(stackerr.Newf("%s: segment %d (%s) is out of place", s.Name, i+1, m[i].Name()))
+	}
+
+	return checkRequired(s.Name, s.Elements, nodes)
+}
+
+// checkRequired makes sure that each required element is present in a list
+// of nodes, and does the same for the children of each group.
+func checkRequired(path string, els []StructureElement, nodes []StructureNode) error {
+	for _, e := range els {
+		found := false
+
+		for _, n := range nodes {
+			if (e.Segment != "" && n.Group == "" && n.Segment.Name() == e.Segment) || (e.Group != "" && n.Group == e.Group) {
+				found = true
+				break
+			}
+		}
+
+		if found || !e.Required {
+			continue
+		}
+
+		if e.Segment != "" {
+			return ErrInvalidStructure(stackerr.Newf("%s: required segment %s is missing", path, e.Segment))
+		}
+
+		return ErrInvalidStructure(stackerr.Newf("%s: required group %s is missing", path, e.Group))
+	}
+
+	for _, n := range nodes {
+		if n.Group == "" {
+			continue
+		}
+
+		for _, e := range els {
+			if e.Group == n.Group {
+				if err := checkRequired(path+"."+n.Group, e.Children, n.Children); err != nil {
+					return err
+				}
+				break
+			}
+		}
+	}
+
+	return nil
+}
+
+func collectSegments(els []StructureElement, m map[string]bool) {
+	for _, e := range els {
+		if e.Segment != "" {
+			m[e.Segment] = true
+		}
+
+		collectSegments(e.Children, m)
+	}
+}
+
+// matchElements places as many segments as it can, starting at m[i], into
+// the elements given. It returns the nodes it made, and the index of the
+// first segment it couldn't place.
+func matchElements(els []StructureElement, m Message, i int, known map[string]bool) ([]StructureNode, int) {
+	var nodes []StructureNode
+
+	pos, used := 0, false
+
+	for i < len(m) {
+		name := m[i].Name()
+
+		if !known[name] {
+			nodes = append(nodes, StructureNode{Segment: m[i]})
+			i++
+			continue
+		}
+
+		found := false
+		for j := pos; j < len(els) && !found; j++ {
+			e := els[j]
+
+			if j == pos && used && !e.Repeating {
+				continue
+			}
+
+			switch {
+			case e.Segment != "" && e.Segment == name:
+				nodes = append(nodes, StructureNode{Segment: m[i]})
+				i++
+				found = true
+			case e.Group != "" && startsGroup(e.Children, name):
+				a, k := matchElements(e.Children, m, i, known)
+				if k > i {
+					nodes = append(nodes, StructureNode{Group: e.Group, Children: a})
+					i = k
+					found = true
+				}
+			}
+
+			if found {
+				pos, used = j, true
+			}
+		}
+
+		if !found {
+			break
+		}
+	}
+
+	return nodes, i
+}
+
+// startsGroup reports whether a segment with the given name can be the first
+// segment in a group - that is, whether it's the first required element of
+// the group, or one of the optional elements before it.
+func startsGroup(els []StructureElement, name string) bool {
+	for _, e := range els {
+		if e.Segment == name {
+			return true
+		}
+		if e.Group != "" && startsGroup(e.Children, name) {
+			return true
+		}
+		if e.Required {
+			return false
+		}
+	}
+
+	return false
+}
+
+// LookupStructure finds the structure for a message in a map like
+// DefaultStructures, first by MSH-9-3, then by MSH-9-1 and MSH-9-2 (e.g.
+// "ADT_A08"), then by MSH-9-1 alone. It returns nil if there's no match.
+func LookupStructure(m Message, structures map[string]*Structure) *Structure {
+	msh := m.Segment("MSH", 0)
+	msh9 := msh.Field(9).item(0)
+
+	if s, ok := structures[msh9.get(3)]; ok {
+		return s
+	}
+	if s, ok := structures[msh9.get(1)+"_"+msh9.get(2)]; ok {
+		return s
+	}
+	if s, ok := structures[msh9.get(1)]; ok {
+		return s
+	}
+
+	return nil
+}
+
+func seg(name string, required, repeating bool) StructureElement {
+	return StructureElement{Segment: name, Required: required, Repeating: repeating}
+}
+
+func group(name string, required, repeating bool, children ...StructureElement) StructureElement {
+	return StructureElement{Group: name, Required: required, Repeating: repeating, Children: children}
+}
+
+var (
+	structureACK = &Structure{
+		Name: "ACK",
+		Elements: []StructureElement{
+			seg("MSH", true, false),
+			seg("SFT", false, true),
+			seg("MSA", true, false),
+			seg("ERR", false, true),
+		},
+	}
+
+	structureADTA01 = &Structure{
+		Name: "ADT_A01",
+		Elements: []StructureElement{
+			seg("MSH", true, false),
+			seg("SFT", false, true),
+			seg("EVN", true, false),
+			seg("PID", true, false),
+			seg("PD1", false, false),
+			seg("ROL", false, true),
+			seg("NK1", false, true),
+			seg("PV1", true, false),
+			seg("PV2", false, false),
+			seg("ROL", false, true),
+			seg("DB1", false, true),
+			seg("OBX", false, true),
+			seg("AL1", false, true),
+			seg("DG1", false, true),
+			seg("DRG", false, false),
+			group("PROCEDURE", false, true,
+				seg("PR1", true, false),
+				seg("ROL", false, true),
+			),
+			seg("GT1", false, true),
+			group("INSURANCE", false, true,
+				seg("IN1", true, false),
+				seg("IN2", false, false),
+				seg("IN3", false, true),
+				seg("ROL", false, true),
+			),
+			seg("ACC", false, false),
+			seg("UB1", false, false),
+			seg("UB2", false, false),
+			seg("PDA", false, false),
+		},
+	}
+
+	structureADTA30 = &Structure{
+		Name: "ADT_A30",
+		Elements: []StructureElement{
+			seg("MSH", true, false),
+			seg("SFT", false, true),
+			seg("EVN", true, false),
+			seg("PID", true, false),
+			seg("PD1", false, false),
+			seg("MRG", true, false),
+		},
+	}
+
+	structureADTA39 = &Structure{
+		Name: "ADT_A39",
+		Elements: []StructureElement{
+			seg("MSH", true, false),
+			seg("SFT", false, true),
+			seg("EVN", true, false),
+			group("PATIENT", true, true,
+				seg("PID", true, false),
+				seg("PD1", false, false),
+				seg("MRG", true, false),
+				seg("PV1", false, false),
+			),
+		},
+	}
+
+	structureORMO01 = &Structure{
+		Name: "ORM_O01",
+		Elements: []StructureElement{
+			seg("MSH", true, false),
+			seg("NTE", false, true),
+			group("PATIENT", false, false,
+				seg("PID", true, false),
+				seg("PD1", false, false),
+				seg("NTE", false, true),
+				group("PATIENT_VISIT", false, false,
+					seg("PV1", true, false),
+					seg("PV2", false, false),
+				),
+				group("INSURANCE", false, true,
+					seg("IN1", true, false),
+					seg("IN2", false, false),
+					seg("IN3", false, false),
+				),
+				seg("GT1", false, false),
+				seg("AL1", false, true),
+			),
+			group("ORDER", true, true,
+				seg("ORC", true, false),
+				group("ORDER_DETAIL", false, false,
+					seg("OBR", true, false),
+					seg("NTE", false, true),
+					seg("CTD", false, false),
+					seg("DG1", false, true),
+					group("OBSERVATION", false, true,
+						seg("OBX", true, false),
+						seg("NTE", false, true),
+					),
+				),
+				seg("FT1", false, true),
+				seg("CTI", false, true),
+				seg("BLG", false, false),
+			),
+		},
+	}
+
+	structureORUR01 = &Structure{
+		Name: "ORU_R01",
+		Elements: []StructureElement{
+			seg("MSH", true, false),
+			seg("SFT", false, true),
+			group("PATIENT_RESULT", true, true,
+				group("PATIENT", false, false,
+					seg("PID", true, false),
+					seg("PD1", false, false),
+					seg("NTE", false, true),
+					seg("NK1", false, true),
+					group("VISIT", false, false,
+						seg("PV1", true, false),
+						seg("PV2", false, false),
+					),
+				),
+				group("ORDER_OBSERVATION", true, true,
+					seg("ORC", false, false),
+					seg("OBR", true, false),
+					seg("NTE", false, true),
+					group("TIMING_QTY", false, true,
+						seg("TQ1", true, false),
+						seg("TQ2", false, true),
+					),
+					seg("CTD", false, false),
+					group("OBSERVATION", false, true,
+						seg("OBX", true, false),
+						seg("NTE", false, true),
+					),
+					seg("FT1", false, true),
+					seg("CTI", false, true),
+					group("SPECIMEN", false, true,
+						seg("SPM", true, false),
+						seg("OBX", false, true),
+					),
+				),
+			),
+			seg("DSC", false, false),
+		},
+	}
+
+	structureSIUS12 = &Structure{
+		Name: "SIU_S12",
+		Elements: []StructureElement{
+			seg("MSH", true, false),
+			seg("SCH", true, false),
+			seg("TQ1", false, true),
+			seg("NTE", false, true),
+			group("PATIENT", false, true,
+				seg("PID", true, false),
+				seg("PD1", false, false),
+				seg("PV1", false, false),
+				seg("PV2", false, false),
+				seg("OBX", false, true),
+				seg("DG1", false, true),
+			),
+			group("RESOURCES", true, true,
+				seg("RGS", true, false),
+				group("SERVICE", false, true,
+					seg("AIS", true, false),
+					seg("NTE", false, true),
+				),
+				group("GENERAL_RESOURCE", false, true,
+					seg("AIG", true, false),
+					seg("NTE", false, true),
+				),
+				group("LOCATION_RESOURCE", false, true,
+					seg("AIL", true, false),
+					seg("NTE", false, true),
+				),
+				group("PERSONNEL_RESOURCE", false, true,
+					seg("AIP", true, false),
+					seg("NTE", false, true),
+				),
+			),
+		},
+	}
+)
+
+// DefaultStructures holds version 2.5 definitions of some common message
+// structures, keyed both by structure name and by the message type and
+// trigger events that use them.
+var DefaultStructures = map[string]*Structure{
+	"ACK":     structureACK,
+	"ADT_A01": structureADTA01,
+	"ADT_A04": structureADTA01,
+	"ADT_A08": structureADTA01,
+	"ADT_A13": structureADTA01,
+	"ADT_A30": structureADTA30,
+	"ADT_A34": structureADTA30,
+	"ADT_A39": structureADTA39,
+	"ADT_A40": structureADTA39,
+	"ORM_O01": structureORMO01,
+	"ORU_R01": structureORUR01,
+	"SIU_S12": structureSIUS12,
+}
@@ -0,0 +1,133 @@
+package hl7
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func structureNames(nodes []StructureNode) []string {
+	var a []string
+	for _, n := range nodes {
+		if n.Group != "" {
+			a = append(a, n.Group+"("+strings.Join(structureNames(n.Children), " ")+")")
+		} else {
+			a = append(a, n.Segment.Name())
+		}
+	}
+	return a
+}
+
+func TestStructureMatchORU(t *testing.T) {
+	a := assert.New(t)
+
+	m, _, err := ParseMessage([]byte(strings.Join([]string{
+		`MSH|^~\&|||||||ORU^R01|1|P|2.5`,
+		`PID|1`,
+		`PV1|1`,
+		`OBR|1`,
+		`NTE|1`,
+		`OBX|1`,
+		`NTE|1`,
+		`OBX|2`,
+		`SPM|1`,
+		`OBX|3`,
+		`OBR|2`,
+		`OBX|1`,
+		`PID|2`,
+		`OBR|1`,
+	}, "\r")))
+	a.NoError(err)
+
+	s := LookupStructure(m, DefaultStructures)
+	if a.NotNil(s) {
+		nodes, misplaced := s.Match(m)
+		a.Equal(0, misplaced)
+		a.Equal([]string{
+			"MSH",
+			"PATIENT_RESULT(PATIENT(PID VISIT(PV1)) ORDER_OBSERVATION(OBR NTE OBSERVATION(OBX NTE) OBSERVATION(OBX) SPECIMEN(SPM OBX)) ORDER_OBSERVATION(OBR OBSERVATION(OBX)))",
+			"PATIENT_RESULT(PATIENT(PID) ORDER_OBSERVATION(OBR))",
+		}, structureNames(nodes))
+	}
+}
+
+func TestStructureMatchADT(t *testing.T) {
+	a := assert.New(t)
+
+	m, _, err := ParseMessage([]byte(strings.Join([]string{
+		`MSH|^~\&|||||||ADT^A08|1|P|2.5`,
+		`EVN|A08`,
+		`PID|1`,
+		`NK1|1`,
+		`NK1|2`,
+		`PV1|1`,
+		`ZPV|1`,
+		`AL1|1`,
+		`IN1|1`,
+		`IN2|1`,
+		`IN1|2`,
+		`EVN|A08`,
+	}, "\r")))
+	a.NoError(err)
+
+	s := LookupStructure(m, DefaultStructures)
+	if a.NotNil(s) {
+		a.Equal("ADT_A01", s.Name)
+
+		nodes, misplaced := s.Match(m)
+		a.Equal(1, misplaced)
+		a.Equal([]string{"MSH", "EVN", "PID", "NK1", "NK1", "PV1", "ZPV", "AL1", "INSURANCE(IN1 IN2)", "INSURANCE(IN1)", "EVN"}, structureNames(nodes))
+	}
+}
+
+func TestStructureValidate(t *testing.T) {
+	a := assert.New(t)
+
+	for _, c := range []struct {
+		segments []string
+		err      string
+	}{
+		{[]string{"ORU^R01", "PID|1", "OBR|1", "OBX|1", "ZZZ|1"}, ""},
+		{[]string{"ORU^R01", "OBR|1", "SPM|1", "OBX|1"}, ""},
+		{[]string{"ORU^R01", "PID|1"}, "ORU_R01.PATIENT_RESULT: required group ORDER_OBSERVATION is missing"},
+		{[]string{"ORU^R01"}, "ORU_R01: required group PATIENT_RESULT is missing"},
+		{[]string{"ORU^R01", "PID|1", "OBR|1", "DSC|1", "OBX|1"}, "ORU_R01: segment 5 (OBX) is out of place"},
+		{[]string{"ADT^A01", "EVN|A01", "PID|1", "PV1|1"}, ""},
+		{[]string{"ADT^A01", "EVN|A01", "PID|1"}, "ADT_A01: required segment PV1 is missing"},
+		{[]string{"ADT^A01", "EVN|A01", "PID|1", "PV1|1", "EVN|A01"}, "ADT_A01: segment 5 (EVN) is out of place"},
+	} {
+		m, _, err := ParseMessage([]byte(`MSH|^~\&|||||||` + strings.Join(c.segments, "\r")))
+		a.NoError(err)
+
+		err = LookupStructure(m, DefaultStructures).Validate(m)
+		if c.err == "" {
+			a.NoError(err, c.segments)
+		} else if a.Error(err, c.segments) {
+			a.Equal(c.err, ErrorText(err))
+		}
+	}
+}
+
+func TestLookupStructure(t *testing.T) {
+	a := assert.New(t)
+
+	for s, n := range map[string]string{
+		"ADT^A01^ADT_A01": "ADT_A01",
+		"ADT^A04":         "ADT_A01",
+		"ADT^A40":         "ADT_A39",
+		"ACK^A01":         "ACK",
+		"ORU^R01":         "ORU_R01",
+		"ZZZ^Z01":         "",
+	} {
+		m, _, err := ParseMessage([]byte(`MSH|^~\&|||||||` + s))
+		a.NoError(err)
+
+		st := LookupStructure(m, DefaultStructures)
+		if n == "" {
+			a.Nil(st, s)
+		} else if a.NotNil(st, s) {
+			a.Equal(n, st.Name, s)
+		}
+	}
+}
@@ -0,0 +1,103 @@
+package synth
+
+var (
+	familyNames = []string{
+		"Smith", "Johnson", "Williams", "Brown", "Jones", "Garcia", "Miller",
+		"Davis", "Rodriguez", "Martinez", "Hernandez", "Lopez", "Wilson",
+		"Anderson", "Thomas", "Taylor", "Moore", "Jackson", "Martin", "Lee",
+		"Thompson", "White", "Harris", "Clark", "Lewis", "Robinson", "Walker",
+		"Young", "Allen", "King", "Wright", "Scott", "Nguyen", "Hill",
+		"Green", "Adams", "Nelson", "Baker", "Hall", "Campbell",
+	}
+	givenNamesFemale = []string{
+		"Mary", "Patricia", "Jennifer", "Linda", "Elizabeth", "Barbara",
+		"Susan", "Jessica", "Sarah", "Karen", "Emma", "Olivia", "Ava",
+		"Sophia", "Mia", "Grace", "Chloe", "Zoe", "Hannah", "Amelia",
+	}
+	givenNamesMale = []string{
+		"James", "Robert", "John", "Michael", "David", "William", "Richard",
+		"Joseph", "Thomas", "Charles", "Daniel", "Matthew", "Anthony", "Mark",
+		"Liam", "Noah", "Oliver", "Elijah", "Lucas", "Henry",
+	}
+	streets = []string{
+		"Main St", "Oak St", "Pine St", "Maple Ave", "Cedar Ln", "Elm St",
+		"Washington Ave", "Lake Dr", "Hill Rd", "Park Ave", "Church St",
+		"Sunset Blvd", "River Rd", "Mill Rd", "Forest Dr",
+	}
+	// cities are a city, a state, and the first three digits of a zip code.
+	cities = [][3]string{
+		{"Springfield", "IL", "627"},
+		{"Madison", "WI", "537"},
+		{"Columbus", "OH", "432"},
+		{"Salem", "OR", "973"},
+		{"Austin", "TX", "787"},
+		{"Albany", "NY", "122"},
+		{"Denver", "CO", "802"},
+		{"Raleigh", "NC", "276"},
+		{"Boise", "ID", "837"},
+		{"Richmond", "VA", "232"},
+	}
+	wards = []string{"4W", "5E", "ICU", "CCU", "MED1", "SURG2", "ONC"}
+	// relationships are codes and descriptions from table 0063.
+	relationships = [][2]string{
+		{"SPO", "Spouse"},
+		{"CHD", "Child"},
+		{"PAR", "Parent"},
+		{"SIB", "Sibling"},
+		{"FND", "Friend"},
+	}
+	// allergies are an allergen type from table 0127 and an allergen.
+	allergies = [][2]string{
+		{"DA", "Penicillin"},
+		{"DA", "Sulfa drugs"},
+		{"DA", "Codeine"},
+		{"FA", "Peanuts"},
+		{"FA", "Shellfish"},
+		{"EA", "Latex"},
+		{"EA", "Bee stings"},
+	}
+	// diagnoses are ICD-10 codes and descriptions.
+	diagnoses = [][2]string{
+		{"I10", "Essential (primary) hypertension"},
+		{"E11.9", "Type 2 diabetes mellitus without complications"},
+		{"J18.9", "Pneumonia, unspecified organism"},
+		{"N39.0", "Urinary tract infection, site not specified"},
+		{"I48.91", "Unspecified atrial fibrillation"},
+		{"J44.1", "Chronic obstructive pulmonary disease with (acute) exacerbation"},
+		{"K35.80", "Unspecified acute appendicitis"},
+		{"S72.001A", "Fracture of unspecified part of neck of right femur, initial encounter"},
+	}
+	// services are codes and descriptions of things appointments are for.
+	services = [][2]string{
+		{"FU", "Follow up"},
+		{"NP", "New patient consultation"},
+		{"XR", "X-ray"},
+		{"US", "Ultrasound"},
+		{"PT", "Physiotherapy"},
+	}
+	panels = []panel{
+		{"58410-2", "CBC panel - Blood by Automated count", []result{
+			{"6690-2", "Leukocytes [#/volume] in Blood by Automated count", "10*9/L", 4, 11, 1},
+			{"718-7", "Hemoglobin [Mass/volume] in Blood", "g/dL", 12, 17.5, 1},
+			{"4544-3", "Hematocrit [Volume Fraction] of Blood by Automated count", "%", 36, 50, 1},
+			{"777-3", "Platelets [#/volume] in Blood by Automated count", "10*9/L", 150, 400, 0},
+		}},
+		{"51990-0", "Basic metabolic panel - Blood", []result{
+			{"2345-7", "Glucose [Mass/volume] in Serum or Plasma", "mg/dL", 70, 99, 0},
+			{"2951-2", "Sodium [Moles/volume] in Serum or Plasma", "mmol/L", 135, 145, 0},
+			{"2823-3", "Potassium [Moles/volume] in Serum or Plasma", "mmol/L", 3.5, 5.1, 1},
+			{"2075-0", "Chloride [Moles/volume] in Serum or Plasma", "mmol/L", 98, 107, 0},
+			{"2160-0", "Creatinine [Mass/volume] in Serum or Plasma", "mg/dL", 0.6, 1.3, 2},
+		}},
+		{"57698-3", "Lipid panel with direct LDL - Serum or Plasma", []result{
+			{"2093-3", "Cholesterol [Mass/volume] in Serum or Plasma", "mg/dL", 125, 200, 0},
+			{"2085-9", "Cholesterol in HDL [Mass/volume] in Serum or Plasma", "mg/dL", 40, 80, 0},
+			{"2571-8", "Triglyceride [Mass/volume] in Serum or Plasma", "mg/dL", 50, 150, 0},
+		}},
+		{"24362-6", "Renal function panel - Serum or Plasma", []result{
+			{"3094-0", "Urea nitrogen [Mass/volume] in Serum or Plasma", "mg/dL", 7, 20, 0},
+			{"2160-0", "Creatinine [Mass/volume] in Serum or Plasma", "mg/dL", 0.6, 1.3, 2},
+			{"17861-6", "Calcium [Mass/volume] in Serum or Plasma", "mg/dL", 8.5, 10.2, 1},
+		}},
+	}
+)
@@ -0,0 +1,296 @@
+package synth
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"time"
+
+	"fknsrs.biz/p/hl7"
+)
+
+// segment builds a segment from a name and a list of field items, which go
+// in SEG-1, SEG-2, and so on. Empty items leave their fields empty.
+func segment(name string, fields ...hl7.FieldItem) hl7.Segment {
+	s := hl7.Segment{hl7.Field{hl7.FieldItem{hl7.Component{hl7.Subcomponent(name)}}}}
+
+	for i, fi := range fields {
+		if len(fi) > 0 {
+			s = s.SetField(i+1, hl7.Field{fi})
+		}
+	}
+
+	return s
+}
+
+// values builds a field item with one component per value, leaving out
+// empty trailing components.
+func values(a ...string) hl7.FieldItem {
+	for len(a) > 0 && a[len(a)-1] == "" {
+		a = a[:len(a)-1]
+	}
+
+	fi := make(hl7.FieldItem, len(a))
+	for i, s := range a {
+		if s != "" {
+			fi[i] = hl7.Component{hl7.Subcomponent(s)}
+		}
+	}
+
+	return fi
+}
+
+func ts(t time.Time) hl7.FieldItem {
+	return values(hl7.FormatTime(t))
+}
+
+func setID(n int) hl7.FieldItem {
+	return values(strconv.Itoa(n))
+}
+
+func (g *Generator) ce(code, text, system string) hl7.FieldItem {
+	return hl7.CE{Identifier: code, Text: text, CodingSystem: system}.Encode(g.Version)
+}
+
+func (g *Generator) pid(p *Patient) hl7.Segment {
+	return segment("PID",
+		setID(1),
+		nil,
+		p.ID.Encode(g.Version),
+		nil,
+		p.Name.Encode(g.Version),
+		nil,
+		values(p.BirthDate.Format("20060102")),
+		values(p.Sex),
+		nil,
+		nil,
+		p.Address.Encode(g.Version),
+		nil,
+		p.Phone.Encode(g.Version),
+	)
+}
+
+func (g *Generator) pv1(p *Patient) hl7.Segment {
+	fields := make([]hl7.FieldItem, 44)
+	fields[0] = setID(1)
+	fields[1] = values(p.Class)
+	fields[2] = values(p.Location[0], p.Location[1], p.Location[2], g.SendingFacility.NamespaceID)
+	fields[6] = p.Attending.Encode(g.Version)
+	fields[9] = values(pick(g, []string{"MED", "SUR", "CAR", "PUL"}))
+	fields[18] = p.VisitNumber.Encode(g.Version)
+	fields[43] = ts(p.Admitted)
+
+	return segment("PV1", fields...)
+}
+
+func (g *Generator) adt(trigger string, p *Patient) hl7.Message {
+	m := hl7.Message{
+		g.header("ADT", trigger, "ADT_A01"),
+		segment("EVN", values(trigger), ts(g.Now)),
+		g.pid(p),
+	}
+
+	for i := 0; i < g.rand.Intn(3); i++ {
+		r := relationships[g.rand.Intn(len(relationships))]
+		m = append(m, segment("NK1",
+			setID(i+1),
+			hl7.XPN{Family: p.Name.Family, Given: pick(g, append(givenNamesFemale, givenNamesMale...)), NameTypeCode: "L"}.Encode(g.Version),
+			g.ce(r[0], r[1], "HL70063"),
+			nil,
+			hl7.XTN{TelephoneNumber: "(555)555-" + g.digits(4), TelecomUseCode: "PRN", TelecomEquipmentType: "PH"}.Encode(g.Version),
+		))
+	}
+
+	m = append(m, g.pv1(p))
+
+	for i := 0; i < g.rand.Intn(3); i++ {
+		a := allergies[g.rand.Intn(len(allergies))]
+		m = append(m, segment("AL1",
+			setID(i+1),
+			values(a[0]),
+			g.ce("", a[1], ""),
+			values(pick(g, []string{"MI", "MO", "SV"})),
+		))
+	}
+
+	for i := 0; i < g.rand.Intn(3); i++ {
+		d := diagnoses[g.rand.Intn(len(diagnoses))]
+		m = append(m, segment("DG1",
+			setID(i+1),
+			nil,
+			g.ce(d[0], d[1], "I10"),
+			nil,
+			ts(p.Admitted),
+			values(pick(g, []string{"A", "W"})),
+		))
+	}
+
+	return m
+}
+
+func (g *Generator) orc(control string, placer string, p *Patient, t time.Time) hl7.Segment {
+	fields := make([]hl7.FieldItem, 12)
+	fields[0] = values(control)
+	fields[1] = values(placer, g.SendingApplication.NamespaceID)
+	fields[8] = ts(t)
+	fields[11] = p.Attending.Encode(g.Version)
+
+	return segment("ORC", fields...)
+}
+
+func (g *Generator) obr(n int, placer, filler string, pn panel, p *Patient, t time.Time, status string) hl7.Segment {
+	fields := make([]hl7.FieldItem, 25)
+	fields[0] = setID(n)
+	fields[1] = values(placer, g.SendingApplication.NamespaceID)
+	if filler != "" {
+		fields[2] = values(filler, "LAB")
+	}
+	fields[3] = g.ce(pn.code, pn.name, "LN")
+	fields[6] = ts(t)
+	fields[15] = p.Attending.Encode(g.Version)
+	if status != "" {
+		fields[21] = ts(g.between(t, g.Now))
+		fields[24] = values(status)
+	}
+
+	return segment("OBR", fields...)
+}
+
+func (g *Generator) orm(p *Patient) hl7.Message {
+	t := g.between(p.Admitted, g.Now)
+	placer := g.digits(8)
+	pn := panels[g.rand.Intn(len(panels))]
+
+	return hl7.Message{
+		g.header("ORM", "O01", "ORM_O01"),
+		g.pid(p),
+		g.pv1(p),
+		g.orc("NW", placer, p, t),
+		g.obr(1, placer, "", pn, p, t, ""),
+	}
+}
+
+func (g *Generator) oru(p *Patient) hl7.Message {
+	m := hl7.Message{
+		g.header("ORU", "R01", "ORU_R01"),
+		g.pid(p),
+		g.pv1(p),
+	}
+
+	for i, n := 0, 1+g.rand.Intn(2); i < n; i++ {
+		t := g.between(p.Admitted, g.Now)
+		placer := g.digits(8)
+		pn := panels[g.rand.Intn(len(panels))]
+
+		m = append(m,
+			g.orc("RE", placer, p, t),
+			g.obr(i+1, placer, g.digits(8), pn, p, t, "F"),
+		)
+
+		for j, r := range pn.results {
+			v := r.value(g)
+
+			flag := "N"
+			switch {
+			case v < r.low:
+				flag = "L"
+			case v > r.high:
+				flag = "H"
+			}
+
+			m = append(m, segment("OBX",
+				setID(j+1),
+				values("NM"),
+				g.ce(r.code, r.name, "LN"),
+				nil,
+				values(strconv.FormatFloat(v, 'f', r.decimals, 64)),
+				g.ce(r.units, r.units, "UCUM"),
+				values(fmt.Sprintf("%s-%s", strconv.FormatFloat(r.low, 'f', r.decimals, 64), strconv.FormatFloat(r.high, 'f', r.decimals, 64))),
+				values(flag),
+				nil,
+				nil,
+				values("F"),
+				nil,
+				nil,
+				ts(t),
+			))
+
+			if flag != "N" && g.rand.Intn(3) == 0 {
+				m = append(m, segment("NTE", setID(1), values("L"), values("Result checked and confirmed.")))
+			}
+		}
+	}
+
+	return m
+}
+
+func (g *Generator) siu(p *Patient) hl7.Message {
+	start := g.Now.Add(time.Duration(1+g.rand.Intn(14*24)) * time.Hour).Truncate(15 * time.Minute)
+	minutes := 15 * (1 + g.rand.Intn(4))
+	end := start.Add(time.Duration(minutes) * time.Minute)
+	s := services[g.rand.Intn(len(services))]
+	id := g.digits(8)
+	doctor := g.doctor()
+	duration := strconv.Itoa(minutes)
+
+	return hl7.Message{
+		g.header("SIU", "S12", "SIU_S12"),
+		segment("SCH",
+			values(id, g.SendingApplication.NamespaceID),
+			values(id, "SCHED"),
+			nil,
+			nil,
+			nil,
+			g.ce("NEW", "New appointment", "HL70276"),
+			g.ce("ROUTINE", "Routine appointment", "HL70276"),
+			g.ce("NORMAL", "Routine schedule request", "HL70277"),
+			values(duration),
+			g.ce("min", "minutes", "ANS+"),
+			values("", "", duration+"M", hl7.FormatTime(start), hl7.FormatTime(end)),
+			nil,
+			nil,
+			nil,
+			nil,
+			doctor.Encode(g.Version),
+			nil,
+			nil,
+			nil,
+			nil,
+			nil,
+			nil,
+			nil,
+			nil,
+			g.ce("Booked", "Booked", "HL70278"),
+		),
+		g.pid(p),
+		g.pv1(p),
+		segment("RGS", setID(1), values("A")),
+		segment("AIS", setID(1), values("A"), g.ce(s[0], s[1], "L"), ts(start), nil, nil, values(duration), values("min")),
+		segment("AIL", setID(1), values("A"), values(p.Location[0], "", "", g.SendingFacility.NamespaceID), nil, nil, ts(start), nil, nil, values(duration), values("min")),
+		segment("AIP", setID(1), values("A"), doctor.Encode(g.Version), g.ce("D", "Doctor", "HL70182"), nil, ts(start), nil, nil, values(duration), values("min")),
+	}
+}
+
+// result describes a lab test with a numeric result and a reference range.
+type result struct {
+	code, name, units string
+	low, high         float64
+	decimals          int
+}
+
+// value makes up a result, usually (but not always) in the reference range.
+func (r result) value(g *Generator) float64 {
+	v := (r.low+r.high)/2 + g.rand.NormFloat64()*(r.high-r.low)/3
+	if v < 0 {
+		v = 0
+	}
+
+	p := math.Pow(10, float64(r.decimals))
+
+	return math.Round(v*p) / p
+}
+
+type panel struct {
+	code, name string
+	results    []result
+}
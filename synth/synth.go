@@ -0,0 +1,237 @@
+// Package synth generates synthetic HL7 messages for load and integration
+// testing. The patients, visits, orders, and results in them are made up,
+// but plausible, and the same seed always gives the same messages.
+package synth // import "fknsrs.biz/p/hl7/synth"
+
+import (
+	"fmt"
+	"math/rand"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/facebookgo/stackerr"
+
+	"fknsrs.biz/p/hl7"
+)
+
+// ErrUnknownType is returned when asked for a message type that the generator
+// doesn't know how to make.
+type ErrUnknownType error
+
+// Generator makes synthetic messages. Create one with New; the exported
+// fields can be changed before generating anything.
+type Generator struct {
+	// Version goes in MSH-12, and decides how data types are encoded. It
+	// defaults to "2.5".
+	Version string
+	// Now is the time the messages are sent at; everything else in them
+	// happens a little before. It defaults to midday on the first of
+	// January 2024, so that the output depends only on the seed.
+	Now time.Time
+	// These go in MSH-3 to MSH-6.
+	SendingApplication   hl7.HD
+	SendingFacility      hl7.HD
+	ReceivingApplication hl7.HD
+	ReceivingFacility    hl7.HD
+	// Structures are what generated messages are checked against. It
+	// defaults to hl7.DefaultStructures.
+	Structures map[string]*hl7.Structure
+
+	rand  *rand.Rand
+	count int
+}
+
+// Patient is a made up patient, along with their current visit. Pass the
+// same Patient to more than one call to Message to make a series of
+// messages about one person.
+type Patient struct {
+	ID          hl7.CX
+	Name        hl7.XPN
+	BirthDate   time.Time
+	Sex         string
+	Address     hl7.XAD
+	Phone       hl7.XTN
+	VisitNumber hl7.CX
+	Class       string
+	// Location is the point of care, room, and bed.
+	Location  [3]string
+	Attending hl7.XCN
+	Admitted  time.Time
+}
+
+// New returns a Generator seeded with seed.
+func New(seed int64) *Generator {
+	return &Generator{
+		Version:              "2.5",
+		Now:                  time.Date(2024, time.January, 1, 12, 0, 0, 0, time.UTC),
+		SendingApplication:   hl7.HD{NamespaceID: "SYNTH"},
+		SendingFacility:      hl7.HD{NamespaceID: "GENERAL"},
+		ReceivingApplication: hl7.HD{NamespaceID: "RECEIVER"},
+		ReceivingFacility:    hl7.HD{NamespaceID: "GENERAL"},
+		Structures:           hl7.DefaultStructures,
+		rand:                 rand.New(rand.NewSource(seed)),
+	}
+}
+
+var generators = map[string]func(g *Generator, p *Patient) hl7.Message{
+	"ADT^A01": func(g *Generator, p *Patient) hl7.Message { return g.adt("A01", p) },
+	"ADT^A08": func(g *Generator, p *Patient) hl7.Message { return g.adt("A08", p) },
+	"ORU^R01": (*Generator).oru,
+	"ORM^O01": (*Generator).orm,
+	"SIU^S12": (*Generator).siu,
+}
+
+// Types returns the message types that Message can make, like "ADT^A01",
+// sorted.
+func Types() []string {
+	var a []string
+	for k := range generators {
+		a = append(a, k)
+	}
+	sort.Strings(a)
+	return a
+}
+
+// Message makes a message of the given type (one of those returned by
+// Types) about p. If p is nil, a new patient is made up. The message is
+// checked against the structure definitions before it's returned.
+func (g *Generator) Message(messageType string, p *Patient) (hl7.Message, error) {
+	fn, ok := generators[messageType]
+	if !ok {
+		return nil, ErrUnknownType(stackerr.Newf("unknown message type %q", messageType))
+	}
+
+	if p == nil {
+		p = g.Patient()
+	}
+
+	m := fn(g, p)
+
+	if s := hl7.LookupStructure(m, g.Structures); s != nil {
+		if err := s.Validate(m); err != nil {
+			return nil, stackerr.Wrap(err)
+		}
+	}
+
+	return m, nil
+}
+
+// Encode is a shortcut for Message followed by hl7.EncodeMessage with the
+// default delimiters.
+func (g *Generator) Encode(messageType string, p *Patient) ([]byte, error) {
+	m, err := g.Message(messageType, p)
+	if err != nil {
+		return nil, err
+	}
+
+	return hl7.EncodeMessage(m, nil), nil
+}
+
+// Patient makes up a new patient, admitted some time in the last few days.
+func (g *Generator) Patient() *Patient {
+	sex := pick(g, []string{"F", "M"})
+
+	given := pick(g, givenNamesFemale)
+	if sex == "M" {
+		given = pick(g, givenNamesMale)
+	}
+
+	city := cities[g.rand.Intn(len(cities))]
+	phone := g.digits(4)
+
+	return &Patient{
+		ID: hl7.CX{
+			ID:                 g.digits(8),
+			AssigningAuthority: g.SendingFacility,
+			IdentifierTypeCode: "MR",
+		},
+		Name: hl7.XPN{
+			Family:       pick(g, familyNames),
+			Given:        given,
+			Middle:       string('A' + rune(g.rand.Intn(26))),
+			NameTypeCode: "L",
+		},
+		BirthDate: g.Now.AddDate(-1-g.rand.Intn(90), 0, -g.rand.Intn(365)),
+		Sex:       sex,
+		Address: hl7.XAD{
+			Street:      fmt.Sprintf("%d %s", 1+g.rand.Intn(2000), pick(g, streets)),
+			City:        city[0],
+			State:       city[1],
+			Zip:         city[2] + g.digits(2),
+			Country:     "USA",
+			AddressType: "H",
+		},
+		Phone: hl7.XTN{
+			TelephoneNumber:      "(555)555-" + phone,
+			TelecomUseCode:       "PRN",
+			TelecomEquipmentType: "PH",
+			AreaCode:             "555",
+			LocalNumber:          "555" + phone,
+		},
+		VisitNumber: hl7.CX{
+			ID:                 g.digits(10),
+			AssigningAuthority: g.SendingFacility,
+			IdentifierTypeCode: "VN",
+		},
+		Class:     "I",
+		Location:  [3]string{pick(g, wards), strconv.Itoa(100 + g.rand.Intn(30)), pick(g, []string{"A", "B"})},
+		Attending: g.doctor(),
+		Admitted:  g.Now.Add(-time.Duration(1+g.rand.Intn(72*60)) * time.Minute),
+	}
+}
+
+func (g *Generator) doctor() hl7.XCN {
+	return hl7.XCN{
+		ID:                 g.digits(6),
+		Family:             pick(g, familyNames),
+		Given:              pick(g, append(givenNamesFemale, givenNamesMale...)),
+		Prefix:             "Dr",
+		AssigningAuthority: g.SendingFacility,
+	}
+}
+
+func (g *Generator) digits(n int) string {
+	b := make([]byte, n)
+	for i := range b {
+		b[i] = byte('0' + g.rand.Intn(10))
+	}
+	return string(b)
+}
+
+func pick(g *Generator, a []string) string {
+	return a[g.rand.Intn(len(a))]
+}
+
+// between returns a random time between a and b.
+func (g *Generator) between(a, b time.Time) time.Time {
+	d := b.Sub(a)
+	if d <= 0 {
+		return a
+	}
+
+	return a.Add(time.Duration(g.rand.Int63n(int64(d))) / time.Second * time.Second)
+}
+
+func (g *Generator) header(code, trigger, structure string) hl7.Segment {
+	g.count++
+
+	h := hl7.Header{
+		SendingApplication:   g.SendingApplication,
+		SendingFacility:      g.SendingFacility,
+		ReceivingApplication: g.ReceivingApplication,
+		ReceivingFacility:    g.ReceivingFacility,
+		Timestamp:            g.Now,
+		MessageCode:          code,
+		TriggerEvent:         trigger,
+		ControlID:            fmt.Sprintf("%s%06d", g.Now.Format("20060102150405"), g.count),
+		ProcessingID:         "T",
+		Version:              g.Version,
+	}
+
+	if hl7.CompareVersion(g.Version, "2.3.1") >= 0 {
+		h.MessageStructure = structure
+	}
+
+	return h.Segment(&hl7.DefaultDelimiters)
+}
@@ -0,0 +1,83 @@
+package synth
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"fknsrs.biz/p/hl7"
+)
+
+func TestGenerator(t *testing.T) {
+	a := assert.New(t)
+
+	for _, version := range []string{"2.3", "2.5"} {
+		g := New(1)
+		g.Version = version
+
+		for _, typ := range Types() {
+			b, err := g.Encode(typ, nil)
+			if !a.NoError(err, typ) {
+				continue
+			}
+
+			m, _, err := hl7.ParseMessage(b)
+			if !a.NoError(err, typ) {
+				continue
+			}
+
+			a.Equal(b, hl7.EncodeMessage(m, nil), typ)
+
+			h, err := m.Header()
+			if a.NoError(err, typ) {
+				a.Equal(typ, h.MessageCode+"^"+h.TriggerEvent)
+				a.Equal(version, h.Version)
+			}
+
+			s := hl7.LookupStructure(m, hl7.DefaultStructures)
+			if a.NotNil(s, typ) {
+				a.NoError(s.Validate(m), typ)
+			}
+
+			a.NotEmpty(m.Segment("PID", 0).Value(3), typ)
+		}
+	}
+}
+
+func TestGeneratorSeed(t *testing.T) {
+	a := assert.New(t)
+
+	g1, g2, g3 := New(42), New(42), New(43)
+
+	for _, typ := range Types() {
+		b1, err := g1.Encode(typ, nil)
+		a.NoError(err)
+		b2, err := g2.Encode(typ, nil)
+		a.NoError(err)
+		b3, err := g3.Encode(typ, nil)
+		a.NoError(err)
+
+		a.Equal(string(b1), string(b2), typ)
+		a.NotEqual(string(b1), string(b3), typ)
+	}
+}
+
+func TestGeneratorPatient(t *testing.T) {
+	a := assert.New(t)
+
+	g := New(1)
+	p := g.Patient()
+
+	m1, err := g.Message("ADT^A01", p)
+	a.NoError(err)
+	m2, err := g.Message("ORU^R01", p)
+	a.NoError(err)
+
+	a.Equal(m1.Segment("PID", 0).Value(3), p.ID.ID)
+	a.Equal(m1.Segment("PID", 0), m2.Segment("PID", 0))
+	a.Equal(m1.Segment("PV1", 0).Value(19), m2.Segment("PV1", 0).Value(19))
+	a.NotEqual(m1.Segment("MSH", 0).Value(10), m2.Segment("MSH", 0).Value(10))
+
+	_, err = g.Message("ZZZ^Z01", nil)
+	a.Error(err)
+}
@@ -0,0 +1,426 @@
+package hl7 // import "fknsrs.biz/p/hl7"
+
+import (
+	"bytes"
+	"encoding/xml"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/facebookgo/stackerr"
+)
+
+// ErrInvalidXML is returned when ParseXML is given something that isn't
+// well-formed HL7 v2.xml, or EncodeXML is given a message without a type.
+type ErrInvalidXML error
+
+// XMLOptions controls how messages are turned into HL7 v2.xml.
+type XMLOptions struct {
+	// Dictionary is used to find the data type of each field, which v2.xml
+	// uses to name component elements (e.g. <PID.5><XPN.1>). If a field isn't
+	// in the dictionary, its components are named after the field instead
+	// (e.g. <ZZZ.1><ZZZ.1.1>). The data type of OBX-5 is taken from OBX-2.
+	Dictionary *Dictionary
+	// Structures, if set, is used to find the structure of the message, so
+	// that segments can be wrapped up in group elements (e.g.
+	// <ORU_R01.PATIENT_RESULT>). Without it, every segment is a direct child
+	// of the root element.
+	Structures map[string]*Structure
+	// Indent makes the output a bit more readable.
+	Indent bool
+}
+
+// primitiveTypes are the data types that are written as text directly
+// inside their element, rather than being broken up into components.
+var primitiveTypes = map[string]bool{
+	"DT": true, "DTM": true, "FT": true, "GTS": true, "ID": true, "IS": true,
+	"NM": true, "SI": true, "ST": true, "TM": true, "TN": true, "TX": true,
+}
+
+// EncodeXML turns a message into HL7 v2.xml. The root element is named after
+// the message structure, taken from the structure definition if there is
+// one, otherwise from MSH-9.
+func EncodeXML(m Message, o XMLOptions) ([]byte, error) {
+	msh9 := m.Segment("MSH", 0).Field(9).item(0)
+
+	var s *Structure
+	if o.Structures != nil {
+		s = LookupStructure(m, o.Structures)
+	}
+
+	var root string
+	switch {
+	case s != nil:
+		root = s.Name
+	case msh9.get(3) != "":
+		root = msh9.get(3)
+	case msh9.get(1) != "" && msh9.get(2) != "":
+		root = msh9.get(1) + "_" + msh9.get(2)
+	case msh9.get(1) != "":
+		root = msh9.get(1)
+	default:
+		return nil, ErrInvalidXML(stackerr.Newf("message has no type in MSH-9"))
+	}
+
+	var nodes []StructureNode
+	if s != nil {
+		nodes, _ = s.Match(m)
+	} else {
+		for _, sg := range m {
+			nodes = append(nodes, StructureNode{Segment: sg})
+		}
+	}
+
+	var buf bytes.Buffer
+	buf.WriteString(xml.Header)
+
+	x := xmlEncoder{e: xml.NewEncoder(&buf), d: o.Dictionary, root: root}
+	if o.Indent {
+		x.e.Indent("", "  ")
+	}
+
+	x.start(root, xml.Attr{Name: xml.Name{Local: "xmlns"}, Value: "urn:hl7-org:v2xml"})
+	x.nodes(nodes)
+	x.end(root)
+
+	if x.err == nil {
+		x.err = x.e.Flush()
+	}
+	if x.err != nil {
+		return nil, stackerr.Wrap(x.err)
+	}
+
+	return buf.Bytes(), nil
+}
+
+type xmlEncoder struct {
+	e    *xml.Encoder
+	d    *Dictionary
+	root string
+	err  error
+}
+
+func (x *xmlEncoder) start(name string, attrs ...xml.Attr) {
+	if x.err == nil {
+		x.err = x.e.EncodeToken(xml.StartElement{Name: xml.Name{Local: name}, Attr: attrs})
+	}
+}
+
+func (x *xmlEncoder) end(name string) {
+	if x.err == nil {
+		x.err = x.e.EncodeToken(xml.EndElement{Name: xml.Name{Local: name}})
+	}
+}
+
+func (x *xmlEncoder) text(name, s string) {
+	x.start(name)
+	if x.err == nil && s != "" {
+		x.err = x.e.EncodeToken(xml.CharData(s))
+	}
+	x.end(name)
+}
+
+func (x *xmlEncoder) nodes(nodes []StructureNode) {
+	for _, n := range nodes {
+		if n.Group != "" {
+			name := x.root + "." + n.Group
+			x.start(name)
+			x.nodes(n.Children)
+			x.end(name)
+		} else {
+			x.segment(n.Segment)
+		}
+	}
+}
+
+func (x *xmlEncoder) segment(s Segment) {
+	name := s.Name()
+
+	x.start(name)
+
+	for n := 1; n < len(s); n++ {
+		fname := name + "." + strconv.Itoa(n)
+
+		if name == "MSH" && (n == 1 || n == 2) {
+			x.text(fname, s.Value(n))
+			continue
+		}
+
+		typ := ""
+		if f, ok := x.d.Field(name, n); ok {
+			typ = f.Type
+		}
+		if name == "OBX" && n == 5 {
+			typ = s.Value(2)
+		}
+
+		for _, fi := range s[n] {
+			x.fieldItem(fname, typ, fi)
+		}
+	}
+
+	x.end(name)
+}
+
+func (x *xmlEncoder) fieldItem(name, typ string, fi FieldItem) {
+	fi = trimFieldItem(fi)
+
+	if len(fi) == 0 {
+		x.text(name, "")
+		return
+	}
+
+	if (typ == "" || primitiveTypes[typ]) && len(fi) == 1 && len(fi[0]) == 1 {
+		x.text(name, string(fi[0][0]))
+		return
+	}
+
+	prefix := name
+	if typ != "" && !primitiveTypes[typ] {
+		prefix = typ
+	}
+
+	x.start(name)
+
+	for i, c := range fi {
+		if c.empty() {
+			continue
+		}
+
+		ctyp := ""
+		if typ != "" {
+			if d, ok := x.d.Component(typ, i+1); ok {
+				ctyp = d.Type
+			}
+		}
+
+		x.component(prefix+"."+strconv.Itoa(i+1), ctyp, c)
+	}
+
+	x.end(name)
+}
+
+func (x *xmlEncoder) component(name, typ string, c Component) {
+	if (typ == "" || primitiveTypes[typ]) && len(c) == 1 {
+		x.text(name, string(c[0]))
+		return
+	}
+
+	prefix := name
+	if typ != "" && !primitiveTypes[typ] {
+		prefix = typ
+	}
+
+	x.start(name)
+
+	for i, s := range c {
+		if s != "" {
+			x.text(prefix+"."+strconv.Itoa(i+1), string(s))
+		}
+	}
+
+	x.end(name)
+}
+
+type xmlElement struct {
+	name     string
+	text     string
+	children []*xmlElement
+}
+
+// ParseXML turns an HL7 v2.xml document into the same kind of message that
+// ParseMessage returns. Group elements are flattened out, so that the
+// segments appear in document order. The element names of fields,
+// components, and subcomponents are only used for their position (the
+// number after the last "."), so it doesn't matter whether they're named
+// after data types or not.
+func ParseXML(buf []byte) (Message, *Delimiters, error) {
+	root, err := parseXMLTree(buf)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var m Message
+	if err := collectXMLSegments(root, &m); err != nil {
+		return nil, nil, err
+	}
+
+	msh := m.Segment("MSH", 0)
+	if msh == nil {
+		return nil, nil, ErrInvalidHeader(stackerr.Newf("expected document to contain an MSH segment"))
+	}
+
+	d := Delimiters{'|', '^', '~', '\\', '&'}
+	if s := msh.Value(1); len(s) == 1 {
+		d.Field = s[0]
+	}
+	if s := msh.Value(2); len(s) == 4 {
+		d.Component, d.Repeat, d.Escape, d.Subcomponent = s[0], s[1], s[2], s[3]
+	}
+
+	return m, &d, nil
+}
+
+func parseXMLTree(buf []byte) (*xmlElement, error) {
+	dec := xml.NewDecoder(bytes.NewReader(buf))
+
+	var root *xmlElement
+	var stack []*xmlElement
+
+	for {
+		t, err := dec.Token()
+		if err != nil {
+			if err == io.EOF {
+				break
+			}
+
+			return nil, ErrInvalidXML(stackerr.Wrap(err))
+		}
+
+		switch t := t.(type) {
+		case xml.StartElement:
+			e := &xmlElement{name: t.Name.Local}
+			if len(stack) > 0 {
+				p := stack[len(stack)-1]
+				p.children = append(p.children, e)
+			} else if root == nil {
+				root = e
+			}
+			stack = append(stack, e)
+		case xml.EndElement:
+			stack = stack[:len(stack)-1]
+		case xml.CharData:
+			if len(stack) > 0 {
+				stack[len(stack)-1].text += string(t)
+			}
+		}
+	}
+
+	if root == nil {
+		return nil, ErrInvalidXML(stackerr.Newf("document has no root element"))
+	}
+
+	return root, nil
+}
+
+// isSegmentName reports whether an element name looks like a segment: three
+// characters, all upper case letters or digits.
+func isSegmentName(s string) bool {
+	if len(s) != 3 {
+		return false
+	}
+
+	for i := 0; i < len(s); i++ {
+		if !(s[i] >= 'A' && s[i] <= 'Z') && !(s[i] >= '0' && s[i] <= '9') {
+			return false
+		}
+	}
+
+	return true
+}
+
+func collectXMLSegments(e *xmlElement, m *Message) error {
+	for _, c := range e.children {
+		if isSegmentName(c.name) {
+			s, err := parseXMLSegment(c)
+			if err != nil {
+				return err
+			}
+
+			*m = append(*m, s)
+
+			continue
+		}
+
+		if _, ok := xmlPosition(c.name); ok {
+			return ErrInvalidXML(stackerr.Newf("unexpected element <%s> inside <%s>", c.name, e.name))
+		}
+
+		if err := collectXMLSegments(c, m); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// xmlPosition returns the number after the last "." in an element name.
+func xmlPosition(name string) (int, bool) {
+	i := strings.LastIndexByte(name, '.')
+	if i == -1 {
+		return 0, false
+	}
+
+	n, err := strconv.Atoi(name[i+1:])
+	if err != nil || n < 1 {
+		return 0, false
+	}
+
+	return n, true
+}
+
+func parseXMLSegment(e *xmlElement) (Segment, error) {
+	s := Segment{Field{FieldItem{Component{Subcomponent(e.name)}}}}
+
+	for _, c := range e.children {
+		n, ok := xmlPosition(c.name)
+		if !ok {
+			return nil, ErrInvalidXML(stackerr.Newf("unexpected element <%s> inside <%s>", c.name, e.name))
+		}
+
+		fi, err := parseXMLFieldItem(c)
+		if err != nil {
+			return nil, err
+		}
+
+		f := append(s.Field(n), fi)
+		s = s.SetField(n, f)
+	}
+
+	return s, nil
+}
+
+func parseXMLFieldItem(e *xmlElement) (FieldItem, error) {
+	if len(e.children) == 0 {
+		if e.text == "" {
+			return nil, nil
+		}
+
+		return FieldItem{Component{Subcomponent(e.text)}}, nil
+	}
+
+	var fi FieldItem
+	for _, c := range e.children {
+		n, ok := xmlPosition(c.name)
+		if !ok {
+			return nil, ErrInvalidXML(stackerr.Newf("unexpected element <%s> inside <%s>", c.name, e.name))
+		}
+
+		for len(fi) < n {
+			fi = append(fi, nil)
+		}
+
+		if len(c.children) == 0 {
+			fi[n-1] = Component{Subcomponent(c.text)}
+			continue
+		}
+
+		var comp Component
+		for _, sc := range c.children {
+			m, ok := xmlPosition(sc.name)
+			if !ok {
+				return nil, ErrInvalidXML(stackerr.Newf("unexpected element <%s> inside <%s>", sc.name, c.name))
+			}
+
+			for len(comp) < m {
+				comp = append(comp, "")
+			}
+
+			comp[m-1] = Subcomponent(sc.text)
+		}
+
+		fi[n-1] = comp
+	}
+
+	return fi, nil
+}
@@ -0,0 +1,172 @@
+package hl7
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEncodeXML(t *testing.T) {
+	a := assert.New(t)
+
+	m, _, err := ParseMessage([]byte(strings.Join([]string{
+		`MSH|^~\&|LAB|HOSP|||20160101000000||ORU^R01|1|P|2.5`,
+		`PID|||123^^^HOSP&1.2.3&ISO~456||Smith^John`,
+		`OBR|1|||GLU^Glucose`,
+		`OBX|1|NM|GLU^Glucose||5.5|mmol/L`,
+		`NTE|1||Fasting`,
+		`ZZZ|custom^value`,
+	}, "\r")))
+	a.NoError(err)
+
+	b, err := EncodeXML(m, XMLOptions{Dictionary: DefaultDictionary, Structures: DefaultStructures, Indent: true})
+	a.NoError(err)
+	a.Equal(`<?xml version="1.0" encoding="UTF-8"?>
+<ORU_R01 xmlns="urn:hl7-org:v2xml">
+  <MSH>
+    <MSH.1>|</MSH.1>
+    <MSH.2>^~\&amp;</MSH.2>
+    <MSH.3>
+      <HD.1>LAB</HD.1>
+    </MSH.3>
+    <MSH.4>
+      <HD.1>HOSP</HD.1>
+    </MSH.4>
+    <MSH.7>
+      <TS.1>20160101000000</TS.1>
+    </MSH.7>
+    <MSH.9>
+      <MSG.1>ORU</MSG.1>
+      <MSG.2>R01</MSG.2>
+    </MSH.9>
+    <MSH.10>1</MSH.10>
+    <MSH.11>
+      <PT.1>P</PT.1>
+    </MSH.11>
+    <MSH.12>
+      <VID.1>2.5</VID.1>
+    </MSH.12>
+  </MSH>
+  <ORU_R01.PATIENT_RESULT>
+    <ORU_R01.PATIENT>
+      <PID>
+        <PID.3>
+          <CX.1>123</CX.1>
+          <CX.4>
+            <HD.1>HOSP</HD.1>
+            <HD.2>1.2.3</HD.2>
+            <HD.3>ISO</HD.3>
+          </CX.4>
+        </PID.3>
+        <PID.3>
+          <CX.1>456</CX.1>
+        </PID.3>
+        <PID.5>
+          <XPN.1>
+            <FN.1>Smith</FN.1>
+          </XPN.1>
+          <XPN.2>John</XPN.2>
+        </PID.5>
+      </PID>
+    </ORU_R01.PATIENT>
+    <ORU_R01.ORDER_OBSERVATION>
+      <OBR>
+        <OBR.1>1</OBR.1>
+        <OBR.4>
+          <CE.1>GLU</CE.1>
+          <CE.2>Glucose</CE.2>
+        </OBR.4>
+      </OBR>
+      <ORU_R01.OBSERVATION>
+        <OBX>
+          <OBX.1>1</OBX.1>
+          <OBX.2>NM</OBX.2>
+          <OBX.3>
+            <CE.1>GLU</CE.1>
+            <CE.2>Glucose</CE.2>
+          </OBX.3>
+          <OBX.5>5.5</OBX.5>
+          <OBX.6>
+            <CE.1>mmol/L</CE.1>
+          </OBX.6>
+        </OBX>
+        <NTE>
+          <NTE.1>1</NTE.1>
+          <NTE.3>Fasting</NTE.3>
+        </NTE>
+        <ZZZ>
+          <ZZZ.1>
+            <ZZZ.1.1>custom</ZZZ.1.1>
+            <ZZZ.1.2>value</ZZZ.1.2>
+          </ZZZ.1>
+        </ZZZ>
+      </ORU_R01.OBSERVATION>
+    </ORU_R01.ORDER_OBSERVATION>
+  </ORU_R01.PATIENT_RESULT>
+</ORU_R01>`, string(b))
+
+	n, d, err := ParseXML(b)
+	a.NoError(err)
+	a.Equal(&Delimiters{'|', '^', '~', '\\', '&'}, d)
+	a.Equal(m, n)
+}
+
+func TestEncodeXMLNoDictionary(t *testing.T) {
+	a := assert.New(t)
+
+	m, _, err := ParseMessage([]byte("MSH|^~\\&|LAB||||||ACK\rMSA|AA|1"))
+	a.NoError(err)
+
+	b, err := EncodeXML(m, XMLOptions{})
+	a.NoError(err)
+	a.Equal(`<?xml version="1.0" encoding="UTF-8"?>`+"\n"+`<ACK xmlns="urn:hl7-org:v2xml"><MSH><MSH.1>|</MSH.1><MSH.2>^~\&amp;</MSH.2><MSH.3>LAB</MSH.3><MSH.9>ACK</MSH.9></MSH><MSA><MSA.1>AA</MSA.1><MSA.2>1</MSA.2></MSA></ACK>`, string(b))
+
+	n, _, err := ParseXML(b)
+	a.NoError(err)
+	a.Equal(m, n)
+}
+
+func TestXMLRoundTripLong(t *testing.T) {
+	a := assert.New(t)
+
+	for _, c := range [][]byte{[]byte(longTestMessageContent), sampleContent, allElementsContent} {
+		m, _, err := ParseMessage(c)
+		a.NoError(err)
+
+		b1, err := EncodeXML(m, XMLOptions{Dictionary: DefaultDictionary, Structures: DefaultStructures})
+		a.NoError(err)
+
+		n, _, err := ParseXML(b1)
+		a.NoError(err)
+		a.Equal(len(m), len(n))
+
+		b2, err := EncodeXML(n, XMLOptions{Dictionary: DefaultDictionary, Structures: DefaultStructures})
+		a.NoError(err)
+		a.Equal(string(b1), string(b2))
+	}
+}
+
+func TestParseXMLDelimiters(t *testing.T) {
+	a := assert.New(t)
+
+	m, d, err := ParseXML([]byte(`<ADT_A01><MSH><MSH.1>#</MSH.1><MSH.2>$%*@</MSH.2></MSH><PID><PID.3/><PID.3><CX.1>1</CX.1></PID.3></PID></ADT_A01>`))
+	a.NoError(err)
+	a.Equal(&Delimiters{'#', '$', '%', '*', '@'}, d)
+	a.Equal(Field{nil, FieldItem{Component{"1"}}}, m.Segment("PID", 0).Field(3))
+}
+
+func TestParseXMLInvalid(t *testing.T) {
+	a := assert.New(t)
+
+	for _, s := range []string{
+		``,
+		`<ADT_A01><MSH>`,
+		`<ADT_A01><PID><PID.1>1</PID.1></PID></ADT_A01>`,
+		`<ADT_A01><MSH><foo/></MSH></ADT_A01>`,
+		`<ADT_A01><MSH.1>|</MSH.1></ADT_A01>`,
+	} {
+		_, _, err := ParseXML([]byte(s))
+		a.Error(err, s)
+	}
+}